@@ -0,0 +1,383 @@
+// Package alert delivers notifications about key pool events to webhooks and chat tools.
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"gpt-load/internal/config"
+	"gpt-load/internal/models"
+	"gpt-load/internal/store"
+	"gpt-load/internal/utils"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// Event types
+const (
+	EventKeyBlacklisted = "key_blacklisted"
+	EventLowActiveKeys  = "low_active_keys"
+	EventNoActiveKeys   = "no_active_keys"
+	EventHighErrorRate  = "high_error_rate"
+	EventKeysRestored   = "keys_restored"
+	EventTest           = "test"
+)
+
+// EventTypes lists the event types that channels and silences can filter on.
+var EventTypes = []string{
+	EventKeyBlacklisted,
+	EventLowActiveKeys,
+	EventNoActiveKeys,
+	EventHighErrorRate,
+	EventKeysRestored,
+}
+
+// Severities
+const (
+	SeverityCritical = "critical"
+	SeverityWarning  = "warning"
+	SeverityInfo     = "info"
+)
+
+const (
+	queueSize      = 256
+	dedupKeyPrefix = "alert:dedup:"
+	// notifyThrottle limits how often the same alert is queued on this node, so a flood of
+	// failing requests does not fill the queue before the shared dedup window applies.
+	notifyThrottle = time.Minute
+)
+
+// Event is an alert about a group or its keys.
+type Event struct {
+	Type      string         `json:"type"`
+	Severity  string         `json:"severity"`
+	GroupID   uint           `json:"group_id,omitempty"`
+	GroupName string         `json:"group_name,omitempty"`
+	Title     string         `json:"title"`
+	Message   string         `json:"message"`
+	Details   map[string]any `json:"details,omitempty"`
+	Timestamp time.Time      `json:"timestamp"`
+}
+
+// dedupKey identifies alerts that are sent only once per dedup window.
+// Blacklist alerts are per key, so one blacklisted key does not hide the others of the group.
+func (e Event) dedupKey() string {
+	if e.Type == EventKeyBlacklisted {
+		return fmt.Sprintf("%s:%d:%v", e.Type, e.GroupID, e.Details["key_id"])
+	}
+	return fmt.Sprintf("%s:%d", e.Type, e.GroupID)
+}
+
+// Service evaluates alert conditions and delivers alerts asynchronously.
+type Service struct {
+	db              *gorm.DB
+	store           store.Store
+	settingsManager *config.SystemSettingsManager
+	client          *http.Client
+	events          chan Event
+	errorRates      *errorRateTracker
+	lastQueued      sync.Map // dedup key -> time.Time
+	stopChan        chan struct{}
+	wg              sync.WaitGroup
+}
+
+// NewService creates a new alert Service.
+func NewService(db *gorm.DB, store store.Store, settingsManager *config.SystemSettingsManager) *Service {
+	return &Service{
+		db:              db,
+		store:           store,
+		settingsManager: settingsManager,
+		client:          &http.Client{Timeout: 10 * time.Second},
+		events:          make(chan Event, queueSize),
+		errorRates:      newErrorRateTracker(),
+		stopChan:        make(chan struct{}),
+	}
+}
+
+// Start starts delivering queued alerts.
+func (s *Service) Start() {
+	s.wg.Add(1)
+	go s.run()
+}
+
+// Stop stops the delivery, respecting the context for shutdown timeout.
+func (s *Service) Stop(ctx context.Context) {
+	close(s.stopChan)
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		logrus.Info("Alert service stopped gracefully.")
+	case <-ctx.Done():
+		logrus.Warn("Alert service stop timed out.")
+	}
+}
+
+func (s *Service) run() {
+	defer s.wg.Done()
+	for {
+		select {
+		case event := <-s.events:
+			s.dispatch(event)
+		case <-s.stopChan:
+			return
+		}
+	}
+}
+
+// Notify queues an alert without blocking the caller.
+func (s *Service) Notify(event Event) {
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+
+	key := event.dedupKey()
+	if last, ok := s.lastQueued.Load(key); ok && event.Timestamp.Sub(last.(time.Time)) < notifyThrottle {
+		return
+	}
+	s.lastQueued.Store(key, event.Timestamp)
+
+	select {
+	case s.events <- event:
+	default:
+		logrus.Warnf("Alert queue is full, dropping %s alert for group %s", event.Type, event.GroupName)
+	}
+}
+
+// KeyBlacklisted alerts that a key was blacklisted.
+func (s *Service) KeyBlacklisted(group *models.Group, key *models.APIKey, source string, statusCode int, errorMessage string) {
+	s.Notify(Event{
+		Type:      EventKeyBlacklisted,
+		Severity:  SeverityWarning,
+		GroupID:   group.ID,
+		GroupName: group.Name,
+		Title:     "Key blacklisted",
+		Message:   fmt.Sprintf("Key %s in group %s was blacklisted: %s", utils.MaskAPIKey(key.KeyValue), group.Name, errorMessage),
+		Details: map[string]any{
+			"key_id":      key.ID,
+			"source":      source,
+			"status_code": statusCode,
+		},
+	})
+}
+
+// CheckActiveKeys alerts when a group has no active keys left, or fewer than its threshold.
+func (s *Service) CheckActiveKeys(group *models.Group, activeKeys int64) {
+	threshold := group.EffectiveConfig.AlertMinActiveKeys
+	switch {
+	case activeKeys == 0:
+		s.Notify(Event{
+			Type:      EventNoActiveKeys,
+			Severity:  SeverityCritical,
+			GroupID:   group.ID,
+			GroupName: group.Name,
+			Title:     "No active keys",
+			Message:   fmt.Sprintf("Group %s has no active keys left, requests to it are failing.", group.Name),
+		})
+	case activeKeys < int64(threshold):
+		s.Notify(Event{
+			Type:      EventLowActiveKeys,
+			Severity:  SeverityWarning,
+			GroupID:   group.ID,
+			GroupName: group.Name,
+			Title:     "Low active keys",
+			Message:   fmt.Sprintf("Group %s has %d active keys, below the threshold of %d.", group.Name, activeKeys, threshold),
+			Details:   map[string]any{"active_keys": activeKeys, "threshold": threshold},
+		})
+	}
+}
+
+// KeysRestored reports keys that background validation restored to the active pool.
+func (s *Service) KeysRestored(group *models.Group, restored, checked int) {
+	s.Notify(Event{
+		Type:      EventKeysRestored,
+		Severity:  SeverityInfo,
+		GroupID:   group.ID,
+		GroupName: group.Name,
+		Title:     "Keys restored",
+		Message:   fmt.Sprintf("Background validation restored %d of %d invalid keys in group %s.", restored, checked, group.Name),
+		Details:   map[string]any{"restored": restored, "checked": checked},
+	})
+}
+
+// ObserveRequest records the outcome of a proxied request and alerts when the error rate of
+// the group within the window reaches its threshold. Rates are tracked per node.
+func (s *Service) ObserveRequest(group *models.Group, failed bool) {
+	cfg := group.EffectiveConfig
+	if cfg.AlertErrorRateThreshold <= 0 {
+		return
+	}
+
+	window := time.Duration(cfg.AlertErrorRateWindowMinutes) * time.Minute
+	total, failures := s.errorRates.observe(group.ID, failed, window, time.Now())
+	if total < cfg.AlertErrorRateMinRequests {
+		return
+	}
+
+	rate := float64(failures) * 100 / float64(total)
+	if rate < float64(cfg.AlertErrorRateThreshold) {
+		return
+	}
+
+	s.Notify(Event{
+		Type:      EventHighErrorRate,
+		Severity:  SeverityWarning,
+		GroupID:   group.ID,
+		GroupName: group.Name,
+		Title:     "High error rate",
+		Message: fmt.Sprintf("%.1f%% of %d requests to group %s failed in the last %d minutes, threshold is %d%%.",
+			rate, total, group.Name, cfg.AlertErrorRateWindowMinutes, cfg.AlertErrorRateThreshold),
+		Details: map[string]any{
+			"error_rate":     rate,
+			"requests":       total,
+			"failures":       failures,
+			"window_minutes": cfg.AlertErrorRateWindowMinutes,
+			"threshold":      cfg.AlertErrorRateThreshold,
+		},
+	})
+}
+
+// SendTest sends a test alert to a channel, bypassing silences and dedup.
+func (s *Service) SendTest(channel *models.AlertChannel) error {
+	return s.deliver(channel, Event{
+		Type:      EventTest,
+		Severity:  SeverityInfo,
+		Title:     "Test alert",
+		Message:   fmt.Sprintf("This is a test alert for channel %s.", channel.Name),
+		Timestamp: time.Now(),
+	})
+}
+
+func (s *Service) dispatch(event Event) {
+	silenced, err := s.isSilenced(event)
+	if err != nil {
+		logrus.WithError(err).Warn("Failed to check alert silences")
+	}
+	if silenced {
+		logrus.Debugf("Alert %s for group %s is silenced", event.Type, event.GroupName)
+		return
+	}
+
+	// 集群内共享去重窗口
+	dedupWindow := time.Duration(s.settingsManager.GetSettings().AlertDedupMinutes) * time.Minute
+	dedupKey := dedupKeyPrefix + event.dedupKey()
+	claimed, err := s.store.SetNX(dedupKey, []byte("1"), dedupWindow)
+	if err != nil {
+		logrus.WithError(err).Warn("Failed to check alert dedup window")
+	} else if !claimed {
+		logrus.Debugf("Alert %s for group %s was already sent within the dedup window", event.Type, event.GroupName)
+		return
+	}
+
+	var channels []models.AlertChannel
+	if err := s.db.Where("enabled = ?", true).Find(&channels).Error; err != nil {
+		logrus.WithError(err).Error("Failed to load alert channels")
+		s.releaseDedup(dedupKey, claimed)
+		return
+	}
+
+	matched, delivered := 0, 0
+	for i := range channels {
+		channel := &channels[i]
+		if !channelMatches(channel, event) {
+			continue
+		}
+		matched++
+		if err := s.deliver(channel, event); err != nil {
+			logrus.WithError(err).Errorf("Failed to deliver %s alert to channel %s", event.Type, channel.Name)
+			continue
+		}
+		delivered++
+	}
+
+	// 所有渠道都发送失败时释放去重窗口，下次触发时可以重新发送
+	if matched > 0 && delivered == 0 {
+		s.releaseDedup(dedupKey, claimed)
+	}
+}
+
+// releaseDedup deletes the dedup claim of an alert that was not delivered, so the next occurrence is sent.
+func (s *Service) releaseDedup(dedupKey string, claimed bool) {
+	if !claimed {
+		return
+	}
+	if err := s.store.Delete(dedupKey); err != nil {
+		logrus.WithError(err).Warn("Failed to release the alert dedup window")
+	}
+}
+
+func (s *Service) isSilenced(event Event) (bool, error) {
+	now := time.Now()
+	var count int64
+	err := s.db.Model(&models.AlertSilence{}).
+		Where("starts_at <= ? AND ends_at > ?", now, now).
+		Where("group_id = 0 OR group_id = ?", event.GroupID).
+		Where("event_type = '' OR event_type IS NULL OR event_type = ?", event.Type).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// channelMatches reports whether the channel subscribes to the event type and group.
+func channelMatches(channel *models.AlertChannel, event Event) bool {
+	var eventTypes []string
+	if len(channel.EventTypes) > 0 {
+		if err := json.Unmarshal(channel.EventTypes, &eventTypes); err != nil {
+			logrus.WithError(err).Warnf("Invalid event types on alert channel %s", channel.Name)
+		}
+	}
+	if len(eventTypes) > 0 && !slices.Contains(eventTypes, event.Type) {
+		return false
+	}
+
+	var groupIDs []uint
+	if len(channel.GroupIDs) > 0 {
+		if err := json.Unmarshal(channel.GroupIDs, &groupIDs); err != nil {
+			logrus.WithError(err).Warnf("Invalid group IDs on alert channel %s", channel.Name)
+		}
+	}
+	return len(groupIDs) == 0 || slices.Contains(groupIDs, event.GroupID)
+}
+
+// deliver sends the event to a channel, retrying transient failures.
+func (s *Service) deliver(channel *models.AlertChannel, event Event) error {
+	const maxAttempts = 3
+
+	var err error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		var retryable bool
+		retryable, err = s.send(channel, event)
+		if err == nil || !retryable {
+			return err
+		}
+		if attempt < maxAttempts {
+			time.Sleep(time.Duration(attempt) * time.Second)
+		}
+	}
+	return err
+}
+
+func (s *Service) send(channel *models.AlertChannel, event Event) (bool, error) {
+	req, err := buildRequest(channel, event)
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+
+	return checkResponse(channel.Type, resp)
+}
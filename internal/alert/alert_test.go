@@ -0,0 +1,39 @@
+package alert
+
+import (
+	"testing"
+	"time"
+
+	"gpt-load/internal/store"
+)
+
+func TestEventDedupKey(t *testing.T) {
+	first := Event{Type: EventKeyBlacklisted, GroupID: 1, Details: map[string]any{"key_id": uint(10)}}
+	second := Event{Type: EventKeyBlacklisted, GroupID: 1, Details: map[string]any{"key_id": uint(11)}}
+	if first.dedupKey() == second.dedupKey() {
+		t.Errorf("blacklist alerts of different keys share the dedup key %q", first.dedupKey())
+	}
+
+	noKeys := Event{Type: EventNoActiveKeys, GroupID: 1}
+	if noKeys.dedupKey() != (Event{Type: EventNoActiveKeys, GroupID: 1, Details: map[string]any{"active_keys": 0}}).dedupKey() {
+		t.Error("group alerts should be deduplicated per group")
+	}
+}
+
+func TestReleaseDedup(t *testing.T) {
+	s := &Service{store: store.NewMemoryStore()}
+	key := dedupKeyPrefix + "test"
+	if _, err := s.store.SetNX(key, []byte("1"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	s.releaseDedup(key, false)
+	if claimed, _ := s.store.SetNX(key, []byte("1"), time.Minute); claimed {
+		t.Fatal("a claim held by another node must not be released")
+	}
+
+	s.releaseDedup(key, true)
+	if claimed, _ := s.store.SetNX(key, []byte("1"), time.Minute); !claimed {
+		t.Error("the claim of an undelivered alert should be released")
+	}
+}
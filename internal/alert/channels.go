@@ -0,0 +1,177 @@
+package alert
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"gpt-load/internal/models"
+)
+
+// Headers of generic webhook deliveries
+const (
+	HeaderEvent     = "X-GPT-Load-Event"
+	HeaderTimestamp = "X-GPT-Load-Timestamp"
+	HeaderSignature = "X-GPT-Load-Signature"
+)
+
+// ChannelTypes lists the supported channel types.
+var ChannelTypes = []string{
+	models.AlertChannelWebhook,
+	models.AlertChannelSlack,
+	models.AlertChannelFeishu,
+	models.AlertChannelDingTalk,
+	models.AlertChannelTelegram,
+}
+
+// buildRequest renders the event in the payload format of the channel type.
+func buildRequest(channel *models.AlertChannel, event Event) (*http.Request, error) {
+	now := time.Now()
+	targetURL := channel.URL
+	var payload any
+
+	switch channel.Type {
+	case models.AlertChannelWebhook:
+		payload = event
+	case models.AlertChannelSlack:
+		payload = map[string]any{"text": formatText(event, "*")}
+	case models.AlertChannelFeishu:
+		body := map[string]any{
+			"msg_type": "text",
+			"content":  map[string]any{"text": formatText(event, "")},
+		}
+		if channel.Secret != "" {
+			timestamp := strconv.FormatInt(now.Unix(), 10)
+			body["timestamp"] = timestamp
+			body["sign"] = feishuSign(channel.Secret, timestamp)
+		}
+		payload = body
+	case models.AlertChannelDingTalk:
+		payload = map[string]any{
+			"msgtype": "text",
+			"text":    map[string]any{"content": formatText(event, "")},
+		}
+		if channel.Secret != "" {
+			signedURL, err := dingTalkSignedURL(channel.URL, channel.Secret, now)
+			if err != nil {
+				return nil, err
+			}
+			targetURL = signedURL
+		}
+	case models.AlertChannelTelegram:
+		payload = map[string]any{
+			"chat_id": channel.ChatID,
+			"text":    formatText(event, ""),
+		}
+	default:
+		return nil, fmt.Errorf("unsupported alert channel type: %s", channel.Type)
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode alert payload: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, targetURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create alert request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "GPT-Load-Alert")
+
+	if channel.Type == models.AlertChannelWebhook {
+		timestamp := strconv.FormatInt(now.Unix(), 10)
+		req.Header.Set(HeaderEvent, event.Type)
+		req.Header.Set(HeaderTimestamp, timestamp)
+		if channel.Secret != "" {
+			req.Header.Set(HeaderSignature, "sha256="+WebhookSignature(channel.Secret, timestamp, body))
+		}
+	}
+
+	return req, nil
+}
+
+// WebhookSignature returns the hex HMAC-SHA256 of "<timestamp>.<body>" keyed with the secret.
+// Receivers should recompute it and reject stale timestamps to prevent replays.
+func WebhookSignature(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// feishuSign signs a Feishu bot message, the key is "<timestamp>\n<secret>" and the message is empty.
+func feishuSign(secret, timestamp string) string {
+	mac := hmac.New(sha256.New, []byte(timestamp+"\n"+secret))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// dingTalkSignedURL appends the timestamp and signature query parameters of a DingTalk robot.
+func dingTalkSignedURL(rawURL, secret string, now time.Time) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid DingTalk URL: %w", err)
+	}
+	timestamp := strconv.FormatInt(now.UnixMilli(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "\n" + secret))
+
+	query := u.Query()
+	query.Set("timestamp", timestamp)
+	query.Set("sign", base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// formatText renders the event as plain text, with the title wrapped in the given emphasis marker.
+func formatText(event Event, emphasis string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s[GPT-Load] %s%s\n", emphasis, event.Title, emphasis)
+	b.WriteString(event.Message)
+	if event.GroupName != "" {
+		fmt.Fprintf(&b, "\nGroup: %s", event.GroupName)
+	}
+	fmt.Fprintf(&b, "\nSeverity: %s", event.Severity)
+	fmt.Fprintf(&b, "\nTime: %s", event.Timestamp.Format(time.RFC3339))
+	return b.String()
+}
+
+// checkResponse reports delivery errors, including those that chat tools return with status 200.
+// The boolean is whether the delivery may succeed when retried.
+func checkResponse(channelType string, resp *http.Response) (bool, error) {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+
+	if resp.StatusCode >= 300 {
+		retryable := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		return retryable, fmt.Errorf("alert endpoint returned %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var result struct {
+		Code    *int   `json:"code"`
+		ErrCode *int   `json:"errcode"`
+		Msg     string `json:"msg"`
+		ErrMsg  string `json:"errmsg"`
+	}
+	switch channelType {
+	case models.AlertChannelFeishu:
+		if json.Unmarshal(body, &result) == nil && result.Code != nil && *result.Code != 0 {
+			return false, fmt.Errorf("feishu returned code %d: %s", *result.Code, result.Msg)
+		}
+	case models.AlertChannelDingTalk:
+		if json.Unmarshal(body, &result) == nil && result.ErrCode != nil && *result.ErrCode != 0 {
+			return false, fmt.Errorf("dingtalk returned errcode %d: %s", *result.ErrCode, result.ErrMsg)
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,57 @@
+package alert
+
+import (
+	"sync"
+	"time"
+)
+
+// rateBucket counts the requests of a group within one minute.
+type rateBucket struct {
+	minute   int64
+	total    int
+	failures int
+}
+
+// errorRateTracker keeps per-minute request counts of each group for a sliding window.
+type errorRateTracker struct {
+	mu      sync.Mutex
+	buckets map[uint][]rateBucket
+}
+
+func newErrorRateTracker() *errorRateTracker {
+	return &errorRateTracker{buckets: make(map[uint][]rateBucket)}
+}
+
+// observe records a request and returns the requests and failures of the group within the window.
+func (t *errorRateTracker) observe(groupID uint, failed bool, window time.Duration, now time.Time) (int, int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	minute := now.Unix() / 60
+	oldest := minute - int64(window/time.Minute) + 1
+
+	buckets := t.buckets[groupID]
+	// 丢弃窗口外的桶
+	start := 0
+	for start < len(buckets) && buckets[start].minute < oldest {
+		start++
+	}
+	buckets = buckets[start:]
+
+	if len(buckets) == 0 || buckets[len(buckets)-1].minute != minute {
+		buckets = append(buckets, rateBucket{minute: minute})
+	}
+	current := &buckets[len(buckets)-1]
+	current.total++
+	if failed {
+		current.failures++
+	}
+	t.buckets[groupID] = buckets
+
+	var total, failures int
+	for _, bucket := range buckets {
+		total += bucket.total
+		failures += bucket.failures
+	}
+	return total, failures
+}
@@ -8,13 +8,16 @@ import (
 	"sync"
 	"time"
 
+	"gpt-load/internal/alert"
 	"gpt-load/internal/config"
 	db "gpt-load/internal/db/migrations"
+	"gpt-load/internal/encryption"
 	"gpt-load/internal/keypool"
 	"gpt-load/internal/models"
 	"gpt-load/internal/proxy"
 	"gpt-load/internal/services"
 	"gpt-load/internal/store"
+	"gpt-load/internal/tracing"
 	"gpt-load/internal/types"
 	"gpt-load/internal/version"
 
@@ -32,11 +35,16 @@ type App struct {
 	groupManager      *services.GroupManager
 	logCleanupService *services.LogCleanupService
 	requestLogService *services.RequestLogService
+	probeService      *services.ProbeService
 	cronChecker       *keypool.CronChecker
 	keyPoolProvider   *keypool.KeyProvider
 	proxyServer       *proxy.ProxyServer
 	storage           store.Store
 	db                *gorm.DB
+	encryptionService *encryption.Service
+	tracingProvider   *tracing.Provider
+	alertService      *alert.Service
+	migrations        *db.Runner
 	httpServer        *http.Server
 }
 
@@ -49,11 +57,15 @@ type AppParams struct {
 	GroupManager      *services.GroupManager
 	LogCleanupService *services.LogCleanupService
 	RequestLogService *services.RequestLogService
+	ProbeService      *services.ProbeService
 	CronChecker       *keypool.CronChecker
 	KeyPoolProvider   *keypool.KeyProvider
 	ProxyServer       *proxy.ProxyServer
 	Storage           store.Store
 	DB                *gorm.DB
+	EncryptionService *encryption.Service
+	TracingProvider   *tracing.Provider
+	AlertService      *alert.Service
 }
 
 // NewApp is the constructor for App, with dependencies injected by dig.
@@ -65,32 +77,33 @@ func NewApp(params AppParams) *App {
 		groupManager:      params.GroupManager,
 		logCleanupService: params.LogCleanupService,
 		requestLogService: params.RequestLogService,
+		probeService:      params.ProbeService,
 		cronChecker:       params.CronChecker,
 		keyPoolProvider:   params.KeyPoolProvider,
 		proxyServer:       params.ProxyServer,
 		storage:           params.Storage,
 		db:                params.DB,
+		encryptionService: params.EncryptionService,
+		tracingProvider:   params.TracingProvider,
+		alertService:      params.AlertService,
+		migrations:        db.NewRunner(params.DB, params.Storage, params.EncryptionService),
 	}
 }
 
 // Start runs the application, it is a non-blocking call.
 func (a *App) Start() error {
+	// 探测请求经由完整的路由和代理流程处理
+	a.probeService.SetHandler(a.engine)
+
 	// Master 节点执行初始化
 	if a.configManager.IsMaster() {
 		logrus.Info("Starting as Master Node.")
 
 		// 数据库迁移
-		if err := a.db.AutoMigrate(
-			&models.SystemSetting{},
-			&models.Group{},
-			&models.APIKey{},
-			&models.RequestLog{},
-			&models.GroupHourlyStat{},
-		); err != nil {
-			return fmt.Errorf("database auto-migration failed: %w", err)
+		encryptedCount, err := a.MigrateDatabase()
+		if err != nil {
+			return err
 		}
-		// 数据修复
-		db.MigrateDatabase(a.db)
 		logrus.Info("Database auto-migration completed.")
 
 		// 初始化系统设置
@@ -101,8 +114,12 @@ func (a *App) Start() error {
 
 		a.settingsManager.Initialize(a.storage, a.groupManager, a.configManager.IsMaster())
 
-		// 从数据库加载密钥到 Redis
-		if err := a.keyPoolProvider.LoadKeysFromDB(); err != nil {
+		// 从数据库加载密钥到 Redis，新加密的密钥需要覆盖 store 中的明文
+		loadKeys := a.keyPoolProvider.LoadKeysFromDB
+		if encryptedCount > 0 {
+			loadKeys = a.keyPoolProvider.ReloadKeysIntoStore
+		}
+		if err := loadKeys(); err != nil {
 			return fmt.Errorf("failed to load keys into key pool: %w", err)
 		}
 		logrus.Debug("API keys loaded into Redis cache by master.")
@@ -111,8 +128,12 @@ func (a *App) Start() error {
 		a.requestLogService.Start()
 		a.logCleanupService.Start()
 		a.cronChecker.Start()
+		a.probeService.Start()
 	} else {
 		logrus.Info("Starting as Slave Node.")
+		if err := a.encryptionService.Initialize(a.db, false); err != nil {
+			return fmt.Errorf("failed to initialize key encryption: %w", err)
+		}
 		a.settingsManager.Initialize(a.storage, a.groupManager, a.configManager.IsMaster())
 	}
 
@@ -120,6 +141,7 @@ func (a *App) Start() error {
 	a.configManager.DisplayServerConfig()
 
 	a.groupManager.Initialize()
+	a.alertService.Start()
 
 	// Create HTTP server
 	serverConfig := a.configManager.GetEffectiveServerConfig()
@@ -145,6 +167,71 @@ func (a *App) Start() error {
 	return nil
 }
 
+// MigrateDatabase applies the pending versioned migrations, synchronizes the schema with the models
+// and encrypts keys stored before encryption was enabled. It returns the number of keys that were encrypted.
+// The whole process holds the migration lock, so only one master migrates at a time.
+func (a *App) MigrateDatabase() (int64, error) {
+	var encryptedCount int64
+	err := a.migrations.WithLock(func(ctx context.Context) error {
+		// 失去迁移锁时取消进行中的查询
+		db := a.db.WithContext(ctx)
+
+		// 加密服务需要先加载数据密钥，用于回填 key_hash
+		if err := db.AutoMigrate(&models.DataKey{}); err != nil {
+			return fmt.Errorf("database auto-migration failed: %w", err)
+		}
+		if err := a.encryptionService.Initialize(db, true); err != nil {
+			return fmt.Errorf("failed to initialize key encryption: %w", err)
+		}
+
+		// 版本化迁移先于 AutoMigrate 执行，以便重命名列和回填数据
+		if _, err := a.migrations.Up(ctx); err != nil {
+			return fmt.Errorf("database migration failed: %w", err)
+		}
+
+		if err := db.AutoMigrate(
+			&models.SystemSetting{},
+			&models.KeyPool{},
+			&models.Group{},
+			&models.GroupVersion{},
+			&models.APIKey{},
+			&models.KeyEvent{},
+			&models.RequestLog{},
+			&models.GroupHourlyStat{},
+			&models.AdminUser{},
+			&models.AdminUserGroup{},
+			&models.AdminToken{},
+			&models.AuditLog{},
+			&models.AlertChannel{},
+			&models.AlertSilence{},
+			&models.ProbeResult{},
+			&models.ProbeIncident{},
+			&models.Task{},
+		); err != nil {
+			return fmt.Errorf("database auto-migration failed: %w", err)
+		}
+
+		count, err := a.encryptionService.EncryptExistingKeys(db)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt existing keys: %w", err)
+		}
+		encryptedCount = count
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if encryptedCount > 0 {
+		logrus.Infof("Encrypted %d existing API keys.", encryptedCount)
+	}
+	return encryptedCount, nil
+}
+
+// Migrations returns the runner of the versioned database migrations.
+func (a *App) Migrations() *db.Runner {
+	return a.migrations
+}
+
 // Stop gracefully shuts down the application.
 func (a *App) Stop(ctx context.Context) {
 	logrus.Info("Shutting down server...")
@@ -170,6 +257,7 @@ func (a *App) Stop(ctx context.Context) {
 	stoppableServices := []func(context.Context){
 		a.groupManager.Stop,
 		a.settingsManager.Stop,
+		a.alertService.Stop,
 	}
 
 	if serverConfig.IsMaster {
@@ -177,6 +265,7 @@ func (a *App) Stop(ctx context.Context) {
 			a.cronChecker.Stop,
 			a.logCleanupService.Stop,
 			a.requestLogService.Stop,
+			a.probeService.Stop,
 		)
 	}
 
@@ -203,6 +292,9 @@ func (a *App) Stop(ctx context.Context) {
 		logrus.Warn("Shutdown timed out, some services may not have stopped gracefully.")
 	}
 
+	// 请求处理完毕后再导出剩余的链路数据
+	a.tracingProvider.Stop(ctx)
+
 	if a.storage != nil {
 		a.storage.Close()
 	}
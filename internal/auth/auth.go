@@ -0,0 +1,117 @@
+// Package auth defines the identities and permissions of the admin API.
+package auth
+
+import (
+	"slices"
+
+	"gpt-load/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Permission is an action on the admin API.
+type Permission string
+
+// Admin API permissions
+const (
+	PermissionRead           Permission = "read"            // View groups, keys (masked), logs and settings
+	PermissionRevealKeys     Permission = "keys:reveal"     // View and export full key values
+	PermissionWriteKeys      Permission = "keys:write"      // Add, delete, restore and validate keys
+	PermissionUpdateGroups   Permission = "groups:update"   // Update existing groups
+	PermissionManageGroups   Permission = "groups:manage"   // Create, copy and delete groups
+	PermissionManageSettings Permission = "settings:manage" // Update system settings
+	PermissionManageUsers    Permission = "users:manage"    // Manage admin users
+	PermissionReadAudit      Permission = "audit:read"      // View the audit log
+)
+
+var rolePermissions = map[string][]Permission{
+	models.RoleAdmin: {
+		PermissionRead, PermissionRevealKeys, PermissionWriteKeys, PermissionUpdateGroups,
+		PermissionManageGroups, PermissionManageSettings, PermissionManageUsers, PermissionReadAudit,
+	},
+	models.RoleOperator: {
+		PermissionRead, PermissionRevealKeys, PermissionWriteKeys, PermissionUpdateGroups, PermissionManageGroups,
+	},
+	models.RoleMaintainer: {
+		PermissionRead, PermissionRevealKeys, PermissionWriteKeys, PermissionUpdateGroups,
+	},
+	models.RoleViewer: {
+		PermissionRead,
+	},
+}
+
+// IsValidRole reports whether the role is a known admin role.
+func IsValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// principalContextKey is the gin context key of the authenticated principal.
+const principalContextKey = "principal"
+
+// Principal is the authenticated caller of the admin API.
+type Principal struct {
+	UserID   uint   `json:"user_id"`
+	Username string `json:"username"`
+	Role     string `json:"role"`
+	GroupIDs []uint `json:"group_ids,omitempty"` // Only set for maintainers
+	IsRoot   bool   `json:"is_root"`             // Authenticated with AUTH_KEY
+	// SessionID is set when the principal authenticated with a session token.
+	SessionID string `json:"-"`
+}
+
+// RootPrincipal returns the principal of a caller using AUTH_KEY.
+func RootPrincipal() *Principal {
+	return &Principal{Username: "root", Role: models.RoleAdmin, IsRoot: true}
+}
+
+// Can reports whether the principal has the permission.
+func (p *Principal) Can(permission Permission) bool {
+	return slices.Contains(rolePermissions[p.Role], permission)
+}
+
+// Permissions returns the permissions granted to the principal.
+func (p *Principal) Permissions() []Permission {
+	permissions := rolePermissions[p.Role]
+	if permissions == nil {
+		return []Permission{}
+	}
+	return permissions
+}
+
+// IsGroupScoped reports whether the principal is restricted to its assigned groups.
+func (p *Principal) IsGroupScoped() bool {
+	return p.Role == models.RoleMaintainer
+}
+
+// CanAccessGroup reports whether the principal may access the group.
+func (p *Principal) CanAccessGroup(groupID uint) bool {
+	return !p.IsGroupScoped() || slices.Contains(p.GroupIDs, groupID)
+}
+
+// SetPrincipal stores the authenticated principal in the request context.
+func SetPrincipal(c *gin.Context, p *Principal) {
+	c.Set(principalContextKey, p)
+}
+
+// GetPrincipal returns the authenticated principal of the request.
+// Requests that passed no authentication get a principal without permissions.
+func GetPrincipal(c *gin.Context) *Principal {
+	if value, exists := c.Get(principalContextKey); exists {
+		if p, ok := value.(*Principal); ok {
+			return p
+		}
+	}
+	return &Principal{}
+}
+
+// MaskKey hides most of a key value for principals that cannot reveal keys.
+func MaskKey(key string) string {
+	if key == "" {
+		return ""
+	}
+	if len(key) <= 8 {
+		return "****"
+	}
+	return key[:4] + "****" + key[len(key)-4:]
+}
@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"slices"
+	"testing"
+
+	"gpt-load/internal/models"
+)
+
+func TestPrincipalCan(t *testing.T) {
+	permissions := []Permission{
+		PermissionRead, PermissionRevealKeys, PermissionWriteKeys, PermissionUpdateGroups,
+		PermissionManageGroups, PermissionManageSettings, PermissionManageUsers, PermissionReadAudit,
+	}
+	// 每个角色拥有的权限，未列出的权限均不拥有
+	granted := map[string][]Permission{
+		models.RoleAdmin:      permissions,
+		models.RoleOperator:   {PermissionRead, PermissionRevealKeys, PermissionWriteKeys, PermissionUpdateGroups, PermissionManageGroups},
+		models.RoleMaintainer: {PermissionRead, PermissionRevealKeys, PermissionWriteKeys, PermissionUpdateGroups},
+		models.RoleViewer:     {PermissionRead},
+		"":                    {},
+		"unknown":             {},
+	}
+
+	for role, want := range granted {
+		p := &Principal{Role: role}
+		for _, permission := range permissions {
+			wantGranted := slices.Contains(want, permission)
+			if got := p.Can(permission); got != wantGranted {
+				t.Errorf("role %q Can(%s) = %v, want %v", role, permission, got, wantGranted)
+			}
+		}
+		if got := len(p.Permissions()); got != len(want) {
+			t.Errorf("role %q has %d permissions, want %d", role, got, len(want))
+		}
+	}
+
+	if !RootPrincipal().Can(PermissionManageUsers) {
+		t.Error("the root principal should have every permission")
+	}
+}
+
+func TestPrincipalCanAccessGroup(t *testing.T) {
+	tests := []struct {
+		principal Principal
+		groupID   uint
+		want      bool
+	}{
+		{Principal{Role: models.RoleAdmin}, 1, true},
+		{Principal{Role: models.RoleOperator}, 1, true},
+		{Principal{Role: models.RoleViewer}, 1, true},
+		{Principal{Role: models.RoleMaintainer, GroupIDs: []uint{1, 2}}, 2, true},
+		{Principal{Role: models.RoleMaintainer, GroupIDs: []uint{1, 2}}, 3, false},
+		{Principal{Role: models.RoleMaintainer}, 1, false},
+	}
+	for _, tt := range tests {
+		if got := tt.principal.CanAccessGroup(tt.groupID); got != tt.want {
+			t.Errorf("%s with groups %v CanAccessGroup(%d) = %v, want %v", tt.principal.Role, tt.principal.GroupIDs, tt.groupID, got, tt.want)
+		}
+	}
+}
+
+func TestMaskKey(t *testing.T) {
+	tests := map[string]string{
+		"":                "",
+		"sk-12345":        "****",
+		"sk-1234567890ab": "sk-1****90ab",
+	}
+	for key, want := range tests {
+		if got := MaskKey(key); got != want {
+			t.Errorf("MaskKey(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
@@ -1,16 +1,11 @@
 package channel
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
-	"fmt"
-	app_errors "gpt-load/internal/errors"
 	"gpt-load/internal/models"
-	"gpt-load/internal/utils"
-	"io"
 	"net/http"
-	"net/url"
+	"regexp"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -18,6 +13,7 @@ import (
 
 func init() {
 	Register("anthropic", newAnthropicChannel)
+	RegisterKeyFormat("anthropic", regexp.MustCompile(`^sk-ant-[A-Za-z0-9_\-]{20,}$`))
 }
 
 type AnthropicChannel struct {
@@ -73,68 +69,43 @@ func (ch *AnthropicChannel) ExtractModel(c *gin.Context, bodyBytes []byte) strin
 	return ""
 }
 
-// ValidateKey checks if the given API key is valid by making a messages request.
+// ValidateKey checks if the given API key is valid using the group's validation method.
 func (ch *AnthropicChannel) ValidateKey(ctx context.Context, apiKey *models.APIKey, group *models.Group) (bool, error) {
-	upstreamURL := ch.getUpstreamURL()
-	if upstreamURL == nil {
-		return false, fmt.Errorf("no upstream URL configured for channel %s", ch.Name)
-	}
-
-	validationEndpoint := ch.ValidationEndpoint
-	if validationEndpoint == "" {
-		validationEndpoint = "/v1/messages"
-	}
-	reqURL, err := url.JoinPath(upstreamURL.String(), validationEndpoint)
-	if err != nil {
-		return false, fmt.Errorf("failed to join upstream URL and validation endpoint: %w", err)
-	}
-
-	// Use a minimal, low-cost payload for validation
-	payload := gin.H{
-		"model":      ch.TestModel,
-		"max_tokens": 100,
-		"messages": []gin.H{
-			{"role": "user", "content": "hi"},
-		},
-	}
-	body, err := json.Marshal(payload)
-	if err != nil {
-		return false, fmt.Errorf("failed to marshal validation payload: %w", err)
-	}
-
-	req, err := http.NewRequestWithContext(ctx, "POST", reqURL, bytes.NewBuffer(body))
+	vr, err := ch.buildValidationRequest()
 	if err != nil {
-		return false, fmt.Errorf("failed to create validation request: %w", err)
-	}
-	req.Header.Set("x-api-key", apiKey.KeyValue)
-	req.Header.Set("anthropic-version", "2023-06-01")
-	req.Header.Set("Content-Type", "application/json")
-
-	// Apply custom header rules if available
-	if len(group.HeaderRuleList) > 0 {
-		headerCtx := utils.NewHeaderVariableContext(group, apiKey)
-		utils.ApplyHeaderRules(req, group.HeaderRuleList, headerCtx)
-	}
-
-	resp, err := ch.HTTPClient.Do(req)
-	if err != nil {
-		return false, fmt.Errorf("failed to send validation request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	// Any 2xx status code indicates the key is valid.
-	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-		return true, nil
+		return false, err
 	}
+	return ch.executeValidation(ctx, vr, apiKey, group, ch.ModifyRequest)
+}
 
-	// For non-200 responses, parse the body to provide a more specific error reason.
-	errorBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return false, fmt.Errorf("key is invalid (status %d), but failed to read error body: %w", resp.StatusCode, err)
+// buildValidationRequest builds the validation request for the configured validation method.
+func (ch *AnthropicChannel) buildValidationRequest() (*validationRequest, error) {
+	messages := []gin.H{
+		{"role": "user", "content": "hi"},
+	}
+
+	switch ch.ValidationConfig.Method {
+	case models.ValidationMethodCompletion:
+		validationEndpoint := ch.ValidationEndpoint
+		if validationEndpoint == "" {
+			validationEndpoint = "/v1/messages"
+		}
+		// Use a minimal, low-cost payload for validation
+		return newJSONValidationRequest(validationEndpoint, gin.H{
+			"model":      ch.TestModel,
+			"max_tokens": 100,
+			"messages":   messages,
+		})
+	case models.ValidationMethodCountTokens:
+		return newJSONValidationRequest("/v1/messages/count_tokens", gin.H{
+			"model":    ch.TestModel,
+			"messages": messages,
+		})
+	case models.ValidationMethodListModels:
+		return &validationRequest{method: http.MethodGet, path: "/v1/models"}, nil
+	case models.ValidationMethodCustom:
+		return ch.customValidationRequest()
+	default:
+		return nil, ch.unsupportedValidationMethod()
 	}
-
-	// Use the new parser to extract a clean error message.
-	parsedError := app_errors.ParseUpstreamError(errorBody)
-
-	return false, fmt.Errorf("[status %d] %s", resp.StatusCode, parsedError)
 }
@@ -3,6 +3,7 @@ package channel
 import (
 	"bytes"
 	"fmt"
+	"gpt-load/internal/httpclient"
 	"gpt-load/internal/models"
 	"gpt-load/internal/types"
 	"net/http"
@@ -29,12 +30,19 @@ type BaseChannel struct {
 	StreamClient       *http.Client
 	TestModel          string
 	ValidationEndpoint string
+	ValidationConfig   models.ValidationConfig
 	upstreamLock       sync.Mutex
 
+	// Used to build clients for keys bound to their own proxy
+	clientManager      *httpclient.HTTPClientManager
+	httpClientConfig   *httpclient.Config
+	streamClientConfig *httpclient.Config
+
 	// Cached fields from the group for stale check
-	channelType     string
-	groupUpstreams  datatypes.JSON
-	effectiveConfig *types.SystemSettings
+	channelType           string
+	groupUpstreams        datatypes.JSON
+	groupValidationConfig datatypes.JSON
+	effectiveConfig       *types.SystemSettings
 }
 
 // getUpstreamURL selects an upstream URL using a smooth weighted round-robin algorithm.
@@ -70,11 +78,28 @@ func (b *BaseChannel) getUpstreamURL() *url.URL {
 	return best.URL
 }
 
-// BuildUpstreamURL constructs the target URL for the upstream service.
-func (b *BaseChannel) BuildUpstreamURL(originalURL *url.URL, group *models.Group) (string, error) {
+// getUpstreamURLForKey returns the key's bound upstream URL, or selects one of the group's upstreams.
+func (b *BaseChannel) getUpstreamURLForKey(apiKey *models.APIKey) (*url.URL, error) {
+	if apiKey != nil && apiKey.UpstreamURL != "" {
+		u, err := url.Parse(apiKey.UpstreamURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse upstream url '%s' of key %d: %w", apiKey.UpstreamURL, apiKey.ID, err)
+		}
+		return u, nil
+	}
+
 	base := b.getUpstreamURL()
 	if base == nil {
-		return "", fmt.Errorf("no upstream URL configured for channel %s", b.Name)
+		return nil, fmt.Errorf("no upstream URL configured for channel %s", b.Name)
+	}
+	return base, nil
+}
+
+// BuildUpstreamURL constructs the target URL for the upstream service.
+func (b *BaseChannel) BuildUpstreamURL(originalURL *url.URL, group *models.Group, apiKey *models.APIKey) (string, error) {
+	base, err := b.getUpstreamURLForKey(apiKey)
+	if err != nil {
+		return "", err
 	}
 
 	finalURL := *base
@@ -103,6 +128,9 @@ func (b *BaseChannel) IsConfigStale(group *models.Group) bool {
 	if !bytes.Equal(b.groupUpstreams, group.Upstreams) {
 		return true
 	}
+	if !bytes.Equal(b.groupValidationConfig, group.ValidationConfig) {
+		return true
+	}
 	if !reflect.DeepEqual(b.effectiveConfig, &group.EffectiveConfig) {
 		return true
 	}
@@ -110,11 +138,22 @@ func (b *BaseChannel) IsConfigStale(group *models.Group) bool {
 }
 
 // GetHTTPClient returns the client for standard requests.
-func (b *BaseChannel) GetHTTPClient() *http.Client {
-	return b.HTTPClient
+func (b *BaseChannel) GetHTTPClient(apiKey *models.APIKey) *http.Client {
+	return b.clientForKey(b.HTTPClient, b.httpClientConfig, apiKey)
 }
 
 // GetStreamClient returns the client for streaming requests.
-func (b *BaseChannel) GetStreamClient() *http.Client {
-	return b.StreamClient
+func (b *BaseChannel) GetStreamClient(apiKey *models.APIKey) *http.Client {
+	return b.clientForKey(b.StreamClient, b.streamClientConfig, apiKey)
+}
+
+// clientForKey returns a client using the key's proxy URL, or the group client if the key has none.
+func (b *BaseChannel) clientForKey(groupClient *http.Client, config *httpclient.Config, apiKey *models.APIKey) *http.Client {
+	if apiKey == nil || apiKey.ProxyURL == "" || b.clientManager == nil || config == nil {
+		return groupClient
+	}
+
+	keyConfig := *config
+	keyConfig.ProxyURL = apiKey.ProxyURL
+	return b.clientManager.GetClient(&keyConfig)
 }
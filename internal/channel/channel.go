@@ -12,16 +12,18 @@ import (
 // ChannelProxy defines the interface for different API channel proxies.
 type ChannelProxy interface {
 	// BuildUpstreamURL constructs the target URL for the upstream service.
-	BuildUpstreamURL(originalURL *url.URL, group *models.Group) (string, error)
+	// A key bound to its own upstream URL overrides the group's upstreams.
+	BuildUpstreamURL(originalURL *url.URL, group *models.Group, apiKey *models.APIKey) (string, error)
 
 	// IsConfigStale checks if the channel's configuration is stale compared to the provided group.
 	IsConfigStale(group *models.Group) bool
 
 	// GetHTTPClient returns the client for standard requests.
-	GetHTTPClient() *http.Client
+	// A key bound to its own proxy URL gets a client using that proxy.
+	GetHTTPClient(apiKey *models.APIKey) *http.Client
 
 	// GetStreamClient returns the client for streaming requests.
-	GetStreamClient() *http.Client
+	GetStreamClient(apiKey *models.APIKey) *http.Client
 
 	// ModifyRequest allows the channel to add specific headers or modify the request
 	ModifyRequest(req *http.Request, apiKey *models.APIKey, group *models.Group)
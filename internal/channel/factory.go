@@ -80,6 +80,13 @@ func (f *Factory) GetChannel(group *models.Group) (ChannelProxy, error) {
 	return channel, nil
 }
 
+// Invalidate drops the cached channel of a group so the next request builds it from the current configuration.
+func (f *Factory) Invalidate(groupID uint) {
+	f.cacheLock.Lock()
+	defer f.cacheLock.Unlock()
+	delete(f.channelCache, groupID)
+}
+
 // newBaseChannel is a helper function to create and configure a BaseChannel.
 func (f *Factory) newBaseChannel(name string, group *models.Group) (*BaseChannel, error) {
 	type upstreamDef struct {
@@ -109,6 +116,11 @@ func (f *Factory) newBaseChannel(name string, group *models.Group) (*BaseChannel
 		upstreamInfos = append(upstreamInfos, UpstreamInfo{URL: u, Weight: weight})
 	}
 
+	validationConfig, err := parseValidationConfig(group.ValidationConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal validation config for %s channel: %w", name, err)
+	}
+
 	// Base configuration for regular requests, derived from the group's effective settings.
 	clientConfig := &httpclient.Config{
 		ConnectTimeout:        time.Duration(group.EffectiveConfig.ConnectTimeout) * time.Second,
@@ -141,14 +153,19 @@ func (f *Factory) newBaseChannel(name string, group *models.Group) (*BaseChannel
 	streamClient := f.clientManager.GetClient(&streamConfig)
 
 	return &BaseChannel{
-		Name:               name,
-		Upstreams:          upstreamInfos,
-		HTTPClient:         httpClient,
-		StreamClient:       streamClient,
-		TestModel:          group.TestModel,
-		ValidationEndpoint: group.ValidationEndpoint,
-		channelType:        group.ChannelType,
-		groupUpstreams:     group.Upstreams,
-		effectiveConfig:    &group.EffectiveConfig,
+		Name:                  name,
+		Upstreams:             upstreamInfos,
+		HTTPClient:            httpClient,
+		StreamClient:          streamClient,
+		TestModel:             group.TestModel,
+		ValidationEndpoint:    group.ValidationEndpoint,
+		ValidationConfig:      validationConfig,
+		channelType:           group.ChannelType,
+		groupUpstreams:        group.Upstreams,
+		groupValidationConfig: group.ValidationConfig,
+		effectiveConfig:       &group.EffectiveConfig,
+		clientManager:         f.clientManager,
+		httpClientConfig:      clientConfig,
+		streamClientConfig:    &streamConfig,
 	}, nil
 }
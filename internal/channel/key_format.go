@@ -0,0 +1,45 @@
+package channel
+
+import (
+	"fmt"
+	"regexp"
+)
+
+var (
+	// keyFormats holds the format of the keys issued by the provider of each channel type.
+	keyFormats = make(map[string]*regexp.Regexp)
+)
+
+// RegisterKeyFormat registers the format of the keys issued by the provider of a channel type.
+func RegisterKeyFormat(channelType string, pattern *regexp.Regexp) {
+	if _, exists := keyFormats[channelType]; exists {
+		panic(fmt.Sprintf("key format of channel type '%s' is already registered", channelType))
+	}
+	keyFormats[channelType] = pattern
+}
+
+// DetectKeyFormat returns the channel type whose key format the key matches, or "" when it matches none.
+// When several formats match, the most specific one wins, the one with the longest literal prefix.
+func DetectKeyFormat(key string) string {
+	detected, detectedPrefix := "", -1
+	for channelType, pattern := range keyFormats {
+		if !pattern.MatchString(key) {
+			continue
+		}
+		prefix, _ := pattern.LiteralPrefix()
+		if len(prefix) > detectedPrefix || (len(prefix) == detectedPrefix && channelType < detected) {
+			detected, detectedPrefix = channelType, len(prefix)
+		}
+	}
+	return detected
+}
+
+// CheckKeyFormat reports an error when the key looks like a key of another provider than the channel's.
+// Keys in an unknown format are accepted, since compatible providers issue keys in their own formats.
+func CheckKeyFormat(channelType, key string) error {
+	detected := DetectKeyFormat(key)
+	if detected == "" || detected == channelType {
+		return nil
+	}
+	return fmt.Errorf("the key format matches the %s channel, but the group uses the %s channel", detected, channelType)
+}
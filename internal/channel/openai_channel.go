@@ -1,16 +1,11 @@
 package channel
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
-	"fmt"
-	app_errors "gpt-load/internal/errors"
 	"gpt-load/internal/models"
-	"gpt-load/internal/utils"
-	"io"
 	"net/http"
-	"net/url"
+	"regexp"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -18,6 +13,7 @@ import (
 
 func init() {
 	Register("openai", newOpenAIChannel)
+	RegisterKeyFormat("openai", regexp.MustCompile(`^sk-[A-Za-z0-9_\-]{20,}$`))
 }
 
 type OpenAIChannel struct {
@@ -72,66 +68,35 @@ func (ch *OpenAIChannel) ExtractModel(c *gin.Context, bodyBytes []byte) string {
 	return ""
 }
 
-// ValidateKey checks if the given API key is valid by making a chat completion request.
+// ValidateKey checks if the given API key is valid using the group's validation method.
 func (ch *OpenAIChannel) ValidateKey(ctx context.Context, apiKey *models.APIKey, group *models.Group) (bool, error) {
-	upstreamURL := ch.getUpstreamURL()
-	if upstreamURL == nil {
-		return false, fmt.Errorf("no upstream URL configured for channel %s", ch.Name)
-	}
-
-	validationEndpoint := ch.ValidationEndpoint
-	if validationEndpoint == "" {
-		validationEndpoint = "/v1/chat/completions"
-	}
-	reqURL, err := url.JoinPath(upstreamURL.String(), validationEndpoint)
-	if err != nil {
-		return false, fmt.Errorf("failed to join upstream URL and validation endpoint: %w", err)
-	}
-
-	// Use a minimal, low-cost payload for validation
-	payload := gin.H{
-		"model": ch.TestModel,
-		"messages": []gin.H{
-			{"role": "user", "content": "hi"},
-		},
-	}
-	body, err := json.Marshal(payload)
-	if err != nil {
-		return false, fmt.Errorf("failed to marshal validation payload: %w", err)
-	}
-
-	req, err := http.NewRequestWithContext(ctx, "POST", reqURL, bytes.NewBuffer(body))
-	if err != nil {
-		return false, fmt.Errorf("failed to create validation request: %w", err)
-	}
-	req.Header.Set("Authorization", "Bearer "+apiKey.KeyValue)
-	req.Header.Set("Content-Type", "application/json")
-
-	// Apply custom header rules if available
-	if len(group.HeaderRuleList) > 0 {
-		headerCtx := utils.NewHeaderVariableContext(group, apiKey)
-		utils.ApplyHeaderRules(req, group.HeaderRuleList, headerCtx)
-	}
-
-	resp, err := ch.HTTPClient.Do(req)
+	vr, err := ch.buildValidationRequest()
 	if err != nil {
-		return false, fmt.Errorf("failed to send validation request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	// Any 2xx status code indicates the key is valid.
-	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
-		return true, nil
+		return false, err
 	}
+	return ch.executeValidation(ctx, vr, apiKey, group, ch.ModifyRequest)
+}
 
-	// For non-200 responses, parse the body to provide a more specific error reason.
-	errorBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return false, fmt.Errorf("key is invalid (status %d), but failed to read error body: %w", resp.StatusCode, err)
+// buildValidationRequest builds the validation request for the configured validation method.
+func (ch *OpenAIChannel) buildValidationRequest() (*validationRequest, error) {
+	switch ch.ValidationConfig.Method {
+	case models.ValidationMethodCompletion:
+		validationEndpoint := ch.ValidationEndpoint
+		if validationEndpoint == "" {
+			validationEndpoint = "/v1/chat/completions"
+		}
+		// Use a minimal, low-cost payload for validation
+		return newJSONValidationRequest(validationEndpoint, gin.H{
+			"model": ch.TestModel,
+			"messages": []gin.H{
+				{"role": "user", "content": "hi"},
+			},
+		})
+	case models.ValidationMethodListModels:
+		return &validationRequest{method: http.MethodGet, path: "/v1/models"}, nil
+	case models.ValidationMethodCustom:
+		return ch.customValidationRequest()
+	default:
+		return nil, ch.unsupportedValidationMethod()
 	}
-
-	// Use the new parser to extract a clean error message.
-	parsedError := app_errors.ParseUpstreamError(errorBody)
-
-	return false, fmt.Errorf("[status %d] %s", resp.StatusCode, parsedError)
 }
@@ -0,0 +1,173 @@
+package channel
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	app_errors "gpt-load/internal/errors"
+	"gpt-load/internal/models"
+	"gpt-load/internal/utils"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// validationMethods lists the key validation methods each channel type can perform.
+var validationMethods = map[string][]string{
+	"openai":    {models.ValidationMethodCompletion, models.ValidationMethodListModels, models.ValidationMethodCustom},
+	"anthropic": {models.ValidationMethodCompletion, models.ValidationMethodCountTokens, models.ValidationMethodListModels, models.ValidationMethodCustom},
+	"gemini":    {models.ValidationMethodCompletion, models.ValidationMethodCountTokens, models.ValidationMethodListModels, models.ValidationMethodCustom},
+}
+
+// SupportsValidationMethod reports whether a channel type can validate keys with the method.
+// An empty method means the default completion request.
+func SupportsValidationMethod(channelType, method string) bool {
+	if method == "" {
+		method = models.ValidationMethodCompletion
+	}
+	return slices.Contains(validationMethods[channelType], method)
+}
+
+// validationRequest describes the upstream request used to validate a key.
+type validationRequest struct {
+	method string
+	path   string
+	body   []byte
+}
+
+// requestModifier applies channel specific authentication to an outgoing request.
+type requestModifier func(req *http.Request, apiKey *models.APIKey, group *models.Group)
+
+// parseValidationConfig parses the group's validation config, defaulting to a real completion.
+func parseValidationConfig(raw []byte) (models.ValidationConfig, error) {
+	var cfg models.ValidationConfig
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &cfg); err != nil {
+			return cfg, err
+		}
+	}
+	if cfg.Method == "" {
+		cfg.Method = models.ValidationMethodCompletion
+	}
+	return cfg, nil
+}
+
+// newJSONValidationRequest builds a POST validation request with a JSON payload.
+func newJSONValidationRequest(path string, payload any) (*validationRequest, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal validation payload: %w", err)
+	}
+	return &validationRequest{method: http.MethodPost, path: path, body: body}, nil
+}
+
+// customValidationRequest builds the validation request for the custom validation method.
+func (b *BaseChannel) customValidationRequest() (*validationRequest, error) {
+	if b.ValidationEndpoint == "" {
+		return nil, fmt.Errorf("custom validation requires a validation endpoint for channel %s", b.Name)
+	}
+
+	method := strings.ToUpper(b.ValidationConfig.HTTPMethod)
+	if method == "" {
+		method = http.MethodPost
+	}
+
+	var body []byte
+	if b.ValidationConfig.Body != "" {
+		body = []byte(b.ValidationConfig.Body)
+	}
+
+	return &validationRequest{method: method, path: b.ValidationEndpoint, body: body}, nil
+}
+
+// unsupportedValidationMethod returns the error for a validation method the channel cannot perform.
+func (b *BaseChannel) unsupportedValidationMethod() error {
+	return fmt.Errorf("validation method '%s' is not supported by %s channel", b.ValidationConfig.Method, b.Name)
+}
+
+// executeValidation sends the validation request and classifies the response with the group's response rules.
+func (b *BaseChannel) executeValidation(ctx context.Context, vr *validationRequest, apiKey *models.APIKey, group *models.Group, modify requestModifier) (bool, error) {
+	upstreamURL, err := b.getUpstreamURLForKey(apiKey)
+	if err != nil {
+		return false, err
+	}
+
+	reqURL, err := url.JoinPath(upstreamURL.String(), vr.path)
+	if err != nil {
+		return false, fmt.Errorf("failed to join upstream URL and validation endpoint: %w", err)
+	}
+
+	var bodyReader io.Reader
+	if vr.body != nil {
+		bodyReader = bytes.NewReader(vr.body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, vr.method, reqURL, bodyReader)
+	if err != nil {
+		return false, fmt.Errorf("failed to create validation request: %w", err)
+	}
+	if vr.body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	modify(req, apiKey, group)
+
+	// Apply custom header rules if available, the key's own rules after the group's
+	headerCtx := utils.NewHeaderVariableContext(group, apiKey)
+	if len(group.HeaderRuleList) > 0 {
+		utils.ApplyHeaderRules(req, group.HeaderRuleList, headerCtx)
+	}
+	utils.ApplyKeyHeaderRules(req, apiKey, headerCtx)
+
+	resp, err := b.GetHTTPClient(apiKey).Do(req)
+	if err != nil {
+		return false, fmt.Errorf("failed to send validation request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return false, fmt.Errorf("key is invalid (status %d), but failed to read response body: %w", resp.StatusCode, err)
+	}
+
+	switch classifyValidationResponse(b.ValidationConfig.ResponseRules, resp.StatusCode, respBody) {
+	case models.ValidationResultValid, models.ValidationResultRateLimited:
+		return true, nil
+	}
+
+	// Use the parser to extract a clean error message.
+	parsedError := app_errors.ParseUpstreamError(respBody)
+	rule := matchValidationRule(b.ValidationConfig.ResponseRules, resp.StatusCode, respBody)
+
+	return false, &app_errors.UpstreamError{StatusCode: resp.StatusCode, Message: parsedError, RuleInvalid: rule != nil}
+}
+
+// matchValidationRule returns the first rule matching the response, or nil if none matches.
+func matchValidationRule(rules []models.ValidationResponseRule, statusCode int, body []byte) *models.ValidationResponseRule {
+	for i := range rules {
+		rule := &rules[i]
+		if len(rule.Statuses) > 0 && !slices.Contains(rule.Statuses, statusCode) {
+			continue
+		}
+		if rule.BodyContains != "" && !bytes.Contains(body, []byte(rule.BodyContains)) {
+			continue
+		}
+		return rule
+	}
+	return nil
+}
+
+// classifyValidationResponse returns the result of the first matching rule.
+// Without a matching rule, any 2xx status code indicates the key is valid.
+func classifyValidationResponse(rules []models.ValidationResponseRule, statusCode int, body []byte) string {
+	if rule := matchValidationRule(rules, statusCode, body); rule != nil {
+		return rule.Result
+	}
+
+	if statusCode >= 200 && statusCode < 300 {
+		return models.ValidationResultValid
+	}
+	return models.ValidationResultInvalid
+}
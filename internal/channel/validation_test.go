@@ -0,0 +1,62 @@
+package channel
+
+import (
+	"testing"
+
+	"gpt-load/internal/models"
+)
+
+func TestSupportsValidationMethod(t *testing.T) {
+	tests := []struct {
+		channelType string
+		method      string
+		want        bool
+	}{
+		{"openai", "", true},
+		{"openai", models.ValidationMethodCompletion, true},
+		{"openai", models.ValidationMethodListModels, true},
+		{"openai", models.ValidationMethodCustom, true},
+		{"openai", models.ValidationMethodCountTokens, false},
+		{"anthropic", models.ValidationMethodCountTokens, true},
+		{"gemini", models.ValidationMethodCountTokens, true},
+		{"gemini", "unknown", false},
+		{"unknown", models.ValidationMethodCompletion, false},
+	}
+	for _, tt := range tests {
+		if got := SupportsValidationMethod(tt.channelType, tt.method); got != tt.want {
+			t.Errorf("SupportsValidationMethod(%q, %q) = %v, want %v", tt.channelType, tt.method, got, tt.want)
+		}
+	}
+}
+
+// Every registered channel must declare the validation methods it supports.
+func TestValidationMethodsCoverRegisteredChannels(t *testing.T) {
+	for _, channelType := range GetChannels() {
+		if !SupportsValidationMethod(channelType, models.ValidationMethodCompletion) {
+			t.Errorf("channel %s does not declare its validation methods", channelType)
+		}
+	}
+}
+
+func TestClassifyValidationResponse(t *testing.T) {
+	rules := []models.ValidationResponseRule{
+		{Statuses: []int{429}, Result: models.ValidationResultRateLimited},
+		{Statuses: []int{400}, BodyContains: "quota", Result: models.ValidationResultValid},
+	}
+	tests := []struct {
+		status int
+		body   string
+		want   string
+	}{
+		{200, "", models.ValidationResultValid},
+		{429, "", models.ValidationResultRateLimited},
+		{400, "insufficient quota", models.ValidationResultValid},
+		{400, "bad request", models.ValidationResultInvalid},
+		{401, "", models.ValidationResultInvalid},
+	}
+	for _, tt := range tests {
+		if got := classifyValidationResponse(rules, tt.status, []byte(tt.body)); got != tt.want {
+			t.Errorf("classifyValidationResponse(%d, %q) = %q, want %q", tt.status, tt.body, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+// Package commands implements the command line subcommands of gpt-load.
+package commands
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.uber.org/dig"
+)
+
+// command runs a subcommand with its arguments, resolving its dependencies from the container.
+type command func(container *dig.Container, args []string) error
+
+var registry = map[string]command{
+	"backup":       runBackup,
+	"config":       runConfig,
+	"encrypt-keys": runEncryptKeys,
+	"groups":       runGroups,
+	"healthcheck":  runHealthcheck,
+	"keys":         runKeys,
+	"logs":         runLogs,
+	"migrate":      runMigrate,
+	"settings":     runSettings,
+	"store":        runStore,
+}
+
+// Run executes the named subcommand.
+func Run(container *dig.Container, name string, args []string) error {
+	cmd, ok := registry[name]
+	if !ok {
+		names := make([]string, 0, len(registry))
+		for n := range registry {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown command '%s', available commands: %s", name, strings.Join(names, ", "))
+	}
+	return cmd(container, args)
+}
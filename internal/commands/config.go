@@ -0,0 +1,190 @@
+package commands
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"gpt-load/internal/services"
+
+	"github.com/sirupsen/logrus"
+	"go.uber.org/dig"
+)
+
+// configParams defines the dependencies of the config command.
+type configParams struct {
+	dig.In
+	Runtime       runtimeParams
+	ConfigService *services.ConfigService
+	AuditService  *services.AuditService
+}
+
+// runConfig exports the settings and groups as a config document, or applies one.
+//
+// Usage:
+//
+//	gpt-load config export [--format yaml|json] [--include-keys] [--output FILE]
+//	gpt-load config apply --file FILE [--dry-run] [--include-keys] [--prune]
+func runConfig(container *dig.Container, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: config export|apply [flags]")
+	}
+
+	switch args[0] {
+	case "export":
+		return runConfigExport(container, args[1:])
+	case "apply":
+		return runConfigApply(container, args[1:])
+	default:
+		return fmt.Errorf("unknown config subcommand '%s', available subcommands: export, apply", args[0])
+	}
+}
+
+func runConfigExport(container *dig.Container, args []string) error {
+	flags := flag.NewFlagSet("config export", flag.ContinueOnError)
+	format := flags.String("format", "yaml", "output format, yaml or json")
+	includeKeys := flags.Bool("include-keys", false, "include the proxy keys and API keys")
+	output := flags.String("output", "", "write the document to this file instead of stdout")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *output == "" {
+		// 文档写入标准输出时，日志改写到标准错误
+		logrus.SetOutput(os.Stderr)
+	}
+
+	return container.Invoke(func(params configParams) error {
+		if err := params.Runtime.start(); err != nil {
+			return err
+		}
+		defer params.Runtime.stop()
+
+		doc, err := params.ConfigService.Export(*includeKeys)
+		if err != nil {
+			return fmt.Errorf("failed to export config: %w", err)
+		}
+		data, err := services.MarshalConfigDocument(doc, *format)
+		if err != nil {
+			return err
+		}
+
+		if *output == "" {
+			_, err := os.Stdout.Write(data)
+			return err
+		}
+		if err := os.WriteFile(*output, data, 0o600); err != nil {
+			return fmt.Errorf("failed to write %s: %w", *output, err)
+		}
+		logrus.Infof("Exported %d groups to %s.", len(doc.Groups), *output)
+		return nil
+	})
+}
+
+func runConfigApply(container *dig.Container, args []string) error {
+	flags := flag.NewFlagSet("config apply", flag.ContinueOnError)
+	file := flags.String("file", "", "the YAML or JSON config document to apply, - for stdin")
+	dryRun := flags.Bool("dry-run", false, "only print the changes that would be made")
+	includeKeys := flags.Bool("include-keys", false, "synchronize the keys of the groups that list them")
+	prune := flags.Bool("prune", false, "delete the groups, and keys with --include-keys, missing from the document")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *file == "" {
+		return fmt.Errorf("--file is required")
+	}
+
+	var data []byte
+	var err error
+	if *file == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(*file)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read config document: %w", err)
+	}
+	doc, err := services.ParseConfigDocument(data)
+	if err != nil {
+		return err
+	}
+
+	return container.Invoke(func(params configParams) error {
+		if err := params.Runtime.start(); err != nil {
+			return err
+		}
+		defer params.Runtime.stop()
+
+		plan, err := params.ConfigService.Apply(doc, services.ConfigApplyOptions{
+			DryRun:      *dryRun,
+			IncludeKeys: *includeKeys,
+			Prune:       *prune,
+			Actor:       services.GroupVersionActor{Name: "cli"},
+		})
+		if err != nil {
+			return err
+		}
+
+		printConfigPlan(plan)
+		if *dryRun || len(plan.Changes) == 0 {
+			return nil
+		}
+		params.AuditService.RecordSystem("cli", plan.AuditEntry())
+		logrus.Info("Config applied. Instances sharing a Redis store reload it automatically, others need a restart.")
+		return nil
+	})
+}
+
+// printConfigPlan prints the changes of a plan as "+" (create), "~" (update) and "-" (delete) lines.
+func printConfigPlan(plan *services.ConfigPlan) {
+	if len(plan.Changes) == 0 {
+		fmt.Println("No changes.")
+		return
+	}
+
+	symbols := map[string]string{
+		services.ConfigActionCreate: "+",
+		services.ConfigActionUpdate: "~",
+		services.ConfigActionDelete: "-",
+	}
+	for _, change := range plan.Changes {
+		line := fmt.Sprintf("%s %s %s", symbols[change.Action], change.Kind, change.Name)
+		var keyCounts []string
+		if change.KeysAdded > 0 {
+			keyCounts = append(keyCounts, fmt.Sprintf("+%d keys", change.KeysAdded))
+		}
+		if change.KeysDeleted > 0 {
+			keyCounts = append(keyCounts, fmt.Sprintf("-%d keys", change.KeysDeleted))
+		}
+		if len(keyCounts) > 0 {
+			line += " (" + strings.Join(keyCounts, ", ") + ")"
+		}
+		fmt.Println(line)
+
+		fields := make([]string, 0, len(change.Fields))
+		for name := range change.Fields {
+			fields = append(fields, name)
+		}
+		sort.Strings(fields)
+		for _, name := range fields {
+			field := change.Fields[name]
+			fmt.Printf("    %s: %v -> %v\n", name, formatConfigValue(field.Before), formatConfigValue(field.After))
+		}
+	}
+
+	if plan.DryRun {
+		fmt.Printf("Dry run, %d changes not applied.\n", len(plan.Changes))
+	}
+}
+
+// formatConfigValue formats a changed value as compact JSON.
+func formatConfigValue(value any) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
@@ -0,0 +1,86 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+
+	"gpt-load/internal/app"
+	"gpt-load/internal/encryption"
+	"gpt-load/internal/keypool"
+	"gpt-load/internal/types"
+
+	"github.com/sirupsen/logrus"
+	"go.uber.org/dig"
+	"gorm.io/gorm"
+)
+
+// encryptKeysParams defines the dependencies of the encrypt-keys command.
+type encryptKeysParams struct {
+	dig.In
+	App               *app.App
+	ConfigManager     types.ConfigManager
+	DB                *gorm.DB
+	EncryptionService *encryption.Service
+	KeyProvider       *keypool.KeyProvider
+}
+
+// runEncryptKeys encrypts the keys and request logs stored in plaintext. With --rotate-data-key,
+// it re-encrypts all encrypted values with a new data key, and with --rotate-master-key, it
+// re-wraps the data key with ENCRYPTION_NEW_KEY (or ENCRYPTION_NEW_KEY_FILE).
+//
+// Usage: gpt-load encrypt-keys [--rotate-data-key] [--rotate-master-key] [--skip-logs]
+func runEncryptKeys(container *dig.Container, args []string) error {
+	flags := flag.NewFlagSet("encrypt-keys", flag.ContinueOnError)
+	rotateDataKey := flags.Bool("rotate-data-key", false, "re-encrypt all encrypted values with a new data key, stop all other nodes first")
+	rotateMasterKey := flags.Bool("rotate-master-key", false, "re-wrap the data key with ENCRYPTION_NEW_KEY or ENCRYPTION_NEW_KEY_FILE, the encrypted values are not rewritten")
+	skipLogs := flags.Bool("skip-logs", false, "do not encrypt the keys stored in existing request logs")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	return container.Invoke(func(params encryptKeysParams) error {
+		if !params.EncryptionService.IsEnabled() {
+			return fmt.Errorf("ENCRYPTION_KEY or ENCRYPTION_KEY_FILE must be configured")
+		}
+		newMasterKey := params.ConfigManager.GetEncryptionConfig().NewMasterKey
+		if *rotateMasterKey && newMasterKey == "" {
+			return fmt.Errorf("ENCRYPTION_NEW_KEY or ENCRYPTION_NEW_KEY_FILE must be configured to rotate the master key")
+		}
+
+		keyCount, err := params.App.MigrateDatabase()
+		if err != nil {
+			return err
+		}
+		logrus.Infof("Encrypted %d API keys.", keyCount)
+
+		if !*skipLogs {
+			logCount, err := params.EncryptionService.EncryptExistingLogs(params.DB)
+			if err != nil {
+				return fmt.Errorf("failed to encrypt request logs: %w", err)
+			}
+			logrus.Infof("Encrypted %d request logs.", logCount)
+		}
+
+		if *rotateDataKey {
+			count, err := params.EncryptionService.RotateDataKey(params.DB)
+			if err != nil {
+				return fmt.Errorf("failed to rotate the data key: %w", err)
+			}
+			logrus.Infof("Re-encrypted %d values with a new data key.", count)
+		}
+
+		if *rotateMasterKey {
+			if err := params.EncryptionService.RotateMasterKey(params.DB, newMasterKey); err != nil {
+				return err
+			}
+			logrus.Info("Data key re-wrapped with the new master key. Set ENCRYPTION_KEY to the new key before restarting.")
+		}
+
+		// 用加密后的值覆盖 store 中的密钥
+		if err := params.KeyProvider.ReloadKeysIntoStore(); err != nil {
+			return fmt.Errorf("failed to reload keys into store: %w", err)
+		}
+		logrus.Info("Keys reloaded into store.")
+		return nil
+	})
+}
@@ -0,0 +1,105 @@
+package commands
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"gpt-load/internal/models"
+
+	"github.com/sirupsen/logrus"
+	"go.uber.org/dig"
+	"gorm.io/gorm"
+)
+
+// groupsParams defines the dependencies of the groups command.
+type groupsParams struct {
+	dig.In
+	Runtime runtimeParams
+	DB      *gorm.DB
+}
+
+// groupSummary is a group as listed by the groups command.
+type groupSummary struct {
+	ID          uint   `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+	ChannelType string `json:"channel_type"`
+	ActiveKeys  int64  `json:"active_keys"`
+	InvalidKeys int64  `json:"invalid_keys"`
+}
+
+// runGroups lists the groups with their key counts.
+//
+// Usage: gpt-load groups list [--json]
+func runGroups(container *dig.Container, args []string) error {
+	if len(args) == 0 || args[0] != "list" {
+		return fmt.Errorf("usage: groups list [--json]")
+	}
+	flags := flag.NewFlagSet("groups list", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print the groups as JSON")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	logrus.SetOutput(os.Stderr)
+
+	return container.Invoke(func(params groupsParams) error {
+		if err := params.Runtime.start(); err != nil {
+			return err
+		}
+		defer params.Runtime.stop()
+
+		var groups []models.Group
+		if err := params.DB.Order("sort asc, id desc").Find(&groups).Error; err != nil {
+			return err
+		}
+
+		var counts []struct {
+			GroupID uint
+			PoolID  uint
+			Status  string
+			Count   int64
+		}
+		if err := params.DB.Model(&models.APIKey{}).Select("group_id, pool_id, status, COUNT(*) as count").
+			Group("group_id, pool_id, status").Scan(&counts).Error; err != nil {
+			return err
+		}
+		countsByOwner := make(map[models.KeyOwner]map[string]int64)
+		for _, count := range counts {
+			owner := models.KeyOwner{GroupID: count.GroupID, PoolID: count.PoolID}
+			if countsByOwner[owner] == nil {
+				countsByOwner[owner] = make(map[string]int64)
+			}
+			countsByOwner[owner][count.Status] = count.Count
+		}
+
+		// 引用密钥池的分组显示池中的 Key 数量
+		summaries := make([]groupSummary, 0, len(groups))
+		for _, group := range groups {
+			ownerCounts := countsByOwner[group.KeyOwner()]
+			summaries = append(summaries, groupSummary{
+				ID:          group.ID,
+				Name:        group.Name,
+				DisplayName: group.DisplayName,
+				ChannelType: group.ChannelType,
+				ActiveKeys:  ownerCounts[models.KeyStatusActive],
+				InvalidKeys: ownerCounts[models.KeyStatusInvalid],
+			})
+		}
+
+		if *asJSON {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(summaries)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tCHANNEL\tACTIVE\tINVALID\tDISPLAY NAME")
+		for _, s := range summaries {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%d\t%s\n", s.ID, s.Name, s.ChannelType, s.ActiveKeys, s.InvalidKeys, s.DisplayName)
+		}
+		return w.Flush()
+	})
+}
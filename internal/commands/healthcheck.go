@@ -0,0 +1,50 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gpt-load/internal/types"
+
+	"go.uber.org/dig"
+)
+
+// runHealthcheck checks that the local server answers its health endpoint, for the Docker HEALTHCHECK.
+// It only reads the configuration and never touches the database or the store.
+//
+// Usage: gpt-load healthcheck [--url URL] [--timeout DURATION]
+func runHealthcheck(container *dig.Container, args []string) error {
+	flags := flag.NewFlagSet("healthcheck", flag.ContinueOnError)
+	healthURL := flags.String("url", "", "the health endpoint to check, defaults to the configured host and port")
+	timeout := flags.Duration("timeout", 5*time.Second, "the request timeout")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	return container.Invoke(func(configManager types.ConfigManager) error {
+		target := *healthURL
+		if target == "" {
+			serverConfig := configManager.GetEffectiveServerConfig()
+			host := serverConfig.Host
+			if host == "" || host == "0.0.0.0" || host == "::" {
+				host = "127.0.0.1"
+			}
+			target = "http://" + net.JoinHostPort(host, strconv.Itoa(serverConfig.Port)) + "/health"
+		}
+
+		client := &http.Client{Timeout: *timeout}
+		resp, err := client.Get(target)
+		if err != nil {
+			return fmt.Errorf("health check failed: %w", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("health check failed: %s returned status %d", target, resp.StatusCode)
+		}
+		return nil
+	})
+}
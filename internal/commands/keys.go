@@ -0,0 +1,179 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"gpt-load/internal/models"
+	"gpt-load/internal/services"
+
+	"github.com/sirupsen/logrus"
+	"go.uber.org/dig"
+)
+
+// keysParams defines the dependencies of the keys command.
+type keysParams struct {
+	dig.In
+	Runtime           runtimeParams
+	KeyService        *services.KeyService
+	ValidationService *services.KeyManualValidationService
+	AuditService      *services.AuditService
+}
+
+// runKeys imports, exports or validates the keys of a group.
+//
+// Usage:
+//
+//	gpt-load keys import --group NAME [--file FILE]
+//	gpt-load keys export --group NAME [--status all|active|invalid] [--output FILE]
+//	gpt-load keys validate --group NAME [--status active|invalid]
+func runKeys(container *dig.Container, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: keys import|export|validate --group NAME [flags]")
+	}
+
+	switch args[0] {
+	case "import":
+		return runKeysImport(container, args[1:])
+	case "export":
+		return runKeysExport(container, args[1:])
+	case "validate":
+		return runKeysValidate(container, args[1:])
+	default:
+		return fmt.Errorf("unknown keys subcommand '%s', available subcommands: import, export, validate", args[0])
+	}
+}
+
+func runKeysImport(container *dig.Container, args []string) error {
+	flags := flag.NewFlagSet("keys import", flag.ContinueOnError)
+	groupName := flags.String("group", "", "the group to import the keys into")
+	file := flags.String("file", "-", "the file with the keys, separated by newlines, commas or spaces, - for stdin")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	var data []byte
+	var err error
+	if *file == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(*file)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read keys: %w", err)
+	}
+
+	return container.Invoke(func(params keysParams) error {
+		if err := params.Runtime.start(); err != nil {
+			return err
+		}
+		defer params.Runtime.stop()
+
+		group, err := params.Runtime.findGroup(*groupName)
+		if err != nil {
+			return err
+		}
+
+		keys := params.KeyService.ParseKeysFromText(string(data))
+		if len(keys) == 0 {
+			return fmt.Errorf("no valid keys found in the input")
+		}
+		addedCount, err := params.KeyService.AddKeys(group.KeyOwner(), keys)
+		if err != nil {
+			return err
+		}
+
+		params.AuditService.RecordSystem("cli", services.AuditEntry{
+			Action:     services.AuditKeysAdd,
+			TargetType: services.AuditTargetGroup,
+			TargetID:   group.ID,
+			TargetName: group.Name,
+			Details:    map[string]any{"added_count": addedCount, "ignored_count": len(keys) - addedCount},
+		})
+		fmt.Printf("Added %d keys to group %s, ignored %d.\n", addedCount, group.Name, len(keys)-addedCount)
+		return nil
+	})
+}
+
+func runKeysExport(container *dig.Container, args []string) error {
+	flags := flag.NewFlagSet("keys export", flag.ContinueOnError)
+	groupName := flags.String("group", "", "the group to export the keys of")
+	status := flags.String("status", "all", "only export the keys with this status: all, active or invalid")
+	output := flags.String("output", "", "write the keys to this file instead of stdout")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	switch *status {
+	case "all", models.KeyStatusActive, models.KeyStatusInvalid:
+	default:
+		return fmt.Errorf("invalid status '%s', must be all, active or invalid", *status)
+	}
+	if *output == "" {
+		// 密钥写入标准输出时，日志改写到标准错误
+		logrus.SetOutput(os.Stderr)
+	}
+
+	return container.Invoke(func(params keysParams) error {
+		if err := params.Runtime.start(); err != nil {
+			return err
+		}
+		defer params.Runtime.stop()
+
+		group, err := params.Runtime.findGroup(*groupName)
+		if err != nil {
+			return err
+		}
+
+		if *output == "" {
+			return params.KeyService.StreamKeysToWriter(group.KeyOwner(), *status, os.Stdout)
+		}
+		f, err := os.OpenFile(*output, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if err := params.KeyService.StreamKeysToWriter(group.KeyOwner(), *status, f); err != nil {
+			return err
+		}
+		logrus.Infof("Exported the %s keys of group %s to %s.", *status, group.Name, *output)
+		return nil
+	})
+}
+
+func runKeysValidate(container *dig.Container, args []string) error {
+	flags := flag.NewFlagSet("keys validate", flag.ContinueOnError)
+	groupName := flags.String("group", "", "the group to validate the keys of")
+	status := flags.String("status", "", "only validate the keys with this status: active or invalid")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	switch *status {
+	case "", models.KeyStatusActive, models.KeyStatusInvalid:
+	default:
+		return fmt.Errorf("invalid status '%s', must be active or invalid", *status)
+	}
+
+	return container.Invoke(func(params keysParams) error {
+		if err := params.Runtime.start(); err != nil {
+			return err
+		}
+		defer params.Runtime.stop()
+
+		group, err := params.Runtime.findGroup(*groupName)
+		if err != nil {
+			return err
+		}
+
+		result, err := params.ValidationService.ValidateKeys(group, *status, func(processed int) {
+			logrus.Infof("Validated %d keys...", processed)
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Validated %d keys of group %s: %d valid, %d invalid.\n",
+			result.TotalKeys, group.Name, result.ValidKeys, result.InvalidKeys)
+		return nil
+	})
+}
@@ -0,0 +1,58 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"gpt-load/internal/services"
+
+	"go.uber.org/dig"
+)
+
+// logsParams defines the dependencies of the logs command.
+type logsParams struct {
+	dig.In
+	Runtime           runtimeParams
+	LogCleanupService *services.LogCleanupService
+}
+
+// runLogs deletes request logs older than the retention period.
+//
+// Usage: gpt-load logs prune [--days N]
+func runLogs(container *dig.Container, args []string) error {
+	if len(args) == 0 || args[0] != "prune" {
+		return fmt.Errorf("usage: logs prune [--days N]")
+	}
+	flags := flag.NewFlagSet("logs prune", flag.ContinueOnError)
+	days := flags.Int("days", 0, "delete the request logs older than this many days, defaults to the log retention setting")
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	if *days < 0 {
+		return fmt.Errorf("--days must not be negative")
+	}
+
+	return container.Invoke(func(params logsParams) error {
+		if err := params.Runtime.start(); err != nil {
+			return err
+		}
+		defer params.Runtime.stop()
+
+		retentionDays := *days
+		if retentionDays == 0 {
+			retentionDays = params.Runtime.SettingsManager.GetSettings().RequestLogRetentionDays
+		}
+		if retentionDays <= 0 {
+			return fmt.Errorf("log retention is disabled in the settings, pass --days to prune")
+		}
+
+		cutoffTime := time.Now().AddDate(0, 0, -retentionDays).UTC()
+		deletedCount, err := params.LogCleanupService.PruneRequestLogs(cutoffTime)
+		if err != nil {
+			return fmt.Errorf("failed to prune request logs: %w", err)
+		}
+		fmt.Printf("Deleted %d request logs older than %d days.\n", deletedCount, retentionDays)
+		return nil
+	})
+}
@@ -0,0 +1,166 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"gpt-load/internal/app"
+	"gpt-load/internal/config"
+	"gpt-load/internal/types"
+
+	"github.com/sirupsen/logrus"
+	"go.uber.org/dig"
+)
+
+// migrateParams defines the dependencies of the migrate command.
+type migrateParams struct {
+	dig.In
+	App             *app.App
+	ConfigManager   types.ConfigManager
+	SettingsManager *config.SystemSettingsManager
+}
+
+// runMigrate manages the database schema without starting the server.
+//
+// Usage:
+//
+//	gpt-load migrate [up]
+//	gpt-load migrate status [--json]
+//	gpt-load migrate down [--to VERSION]
+func runMigrate(container *dig.Container, args []string) error {
+	if len(args) == 0 {
+		return runMigrateUp(container, args)
+	}
+
+	switch args[0] {
+	case "up":
+		return runMigrateUp(container, args[1:])
+	case "status":
+		return runMigrateStatus(container, args[1:])
+	case "down":
+		return runMigrateDown(container, args[1:])
+	default:
+		return fmt.Errorf("unknown migrate subcommand '%s', available subcommands: up, status, down", args[0])
+	}
+}
+
+// runMigrateUp applies the pending migrations, synchronizes the schema and initializes the system settings.
+func runMigrateUp(container *dig.Container, args []string) error {
+	flags := flag.NewFlagSet("migrate up", flag.ContinueOnError)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	return container.Invoke(func(params migrateParams) error {
+		encryptedCount, err := params.App.MigrateDatabase()
+		if err != nil {
+			return err
+		}
+		if err := params.SettingsManager.EnsureSettingsInitialized(params.ConfigManager.GetAuthConfig()); err != nil {
+			return fmt.Errorf("failed to initialize system settings: %w", err)
+		}
+		logrus.Infof("Database migrated, %d keys encrypted.", encryptedCount)
+		return nil
+	})
+}
+
+func runMigrateStatus(container *dig.Container, args []string) error {
+	flags := flag.NewFlagSet("migrate status", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print the migrations as JSON")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	return container.Invoke(func(params migrateParams) error {
+		statuses, err := params.App.Migrations().Status()
+		if err != nil {
+			return err
+		}
+
+		if *asJSON {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(statuses)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT\tREVERSIBLE")
+		pending := 0
+		for _, status := range statuses {
+			state, appliedAt := "pending", "-"
+			if status.AppliedAt != nil {
+				state, appliedAt = "applied", status.AppliedAt.Format("2006-01-02 15:04:05")
+			} else {
+				pending++
+			}
+			if status.Unknown {
+				state = "unknown"
+			}
+			reversible := "no"
+			if status.Reversible {
+				reversible = "yes"
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", status.Version, status.Name, state, appliedAt, reversible)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		fmt.Printf("%d pending.\n", pending)
+		return nil
+	})
+}
+
+// runMigrateDown rolls back the migrations newer than --to, by default only the latest applied one.
+func runMigrateDown(container *dig.Container, args []string) error {
+	flags := flag.NewFlagSet("migrate down", flag.ContinueOnError)
+	to := flags.Int("to", -1, "roll back the migrations newer than this version, defaults to the version before the latest applied one")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	return container.Invoke(func(params migrateParams) error {
+		runner := params.App.Migrations()
+		return runner.WithLock(func(ctx context.Context) error {
+			target := *to
+			if target < 0 {
+				statuses, err := runner.Status()
+				if err != nil {
+					return err
+				}
+				// 默认回滚最近一次已执行的迁移
+				var applied []uint
+				for _, status := range statuses {
+					if status.AppliedAt != nil {
+						applied = append(applied, status.Version)
+					}
+				}
+				if len(applied) == 0 {
+					fmt.Println("No applied migrations.")
+					return nil
+				}
+				target = 0
+				if len(applied) > 1 {
+					target = int(applied[len(applied)-2])
+				}
+			}
+
+			rolledBack, err := runner.Down(ctx, uint(target))
+			for _, m := range rolledBack {
+				fmt.Printf("Rolled back %d (%s).\n", m.Version, m.Name)
+			}
+			if err != nil {
+				return err
+			}
+			if len(rolledBack) == 0 {
+				fmt.Println("Nothing to roll back.")
+				return nil
+			}
+			logrus.Warn("Starting this release again re-applies the rolled back migrations, run the release matching the schema instead.")
+			return nil
+		})
+	})
+}
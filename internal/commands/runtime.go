@@ -0,0 +1,57 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+
+	"gpt-load/internal/app"
+	"gpt-load/internal/config"
+	"gpt-load/internal/models"
+	"gpt-load/internal/services"
+	"gpt-load/internal/store"
+	"gpt-load/internal/types"
+
+	"go.uber.org/dig"
+)
+
+// runtimeParams defines the dependencies shared by the commands that read or change the configuration.
+type runtimeParams struct {
+	dig.In
+	App             *app.App
+	ConfigManager   types.ConfigManager
+	SettingsManager *config.SystemSettingsManager
+	GroupManager    *services.GroupManager
+	Store           store.Store
+}
+
+// start prepares the database, settings and group cache the way a master node does on startup.
+func (r runtimeParams) start() error {
+	if _, err := r.App.MigrateDatabase(); err != nil {
+		return err
+	}
+	if err := r.SettingsManager.EnsureSettingsInitialized(r.ConfigManager.GetAuthConfig()); err != nil {
+		return fmt.Errorf("failed to initialize system settings: %w", err)
+	}
+	if err := r.SettingsManager.Initialize(r.Store, r.GroupManager, true); err != nil {
+		return err
+	}
+	return r.GroupManager.Initialize()
+}
+
+// stop stops the background syncers started by start.
+func (r runtimeParams) stop() {
+	r.GroupManager.Stop(context.Background())
+	r.SettingsManager.Stop(context.Background())
+}
+
+// findGroup returns the cached group with the given name, including its effective config.
+func (r runtimeParams) findGroup(name string) (*models.Group, error) {
+	if name == "" {
+		return nil, fmt.Errorf("--group is required")
+	}
+	group, err := r.GroupManager.GetGroupByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("group '%s' not found", name)
+	}
+	return group, nil
+}
@@ -0,0 +1,194 @@
+package commands
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gpt-load/internal/services"
+	"gpt-load/internal/utils"
+
+	"github.com/sirupsen/logrus"
+	"go.uber.org/dig"
+)
+
+// settingsParams defines the dependencies of the settings command.
+type settingsParams struct {
+	dig.In
+	Runtime      runtimeParams
+	AuditService *services.AuditService
+}
+
+// runSettings prints or changes the system settings.
+//
+// Usage:
+//
+//	gpt-load settings get [--json] [KEY...]
+//	gpt-load settings set KEY=VALUE...
+func runSettings(container *dig.Container, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: settings get|set [args]")
+	}
+
+	switch args[0] {
+	case "get":
+		return runSettingsGet(container, args[1:])
+	case "set":
+		return runSettingsSet(container, args[1:])
+	default:
+		return fmt.Errorf("unknown settings subcommand '%s', available subcommands: get, set", args[0])
+	}
+}
+
+func runSettingsGet(container *dig.Container, args []string) error {
+	flags := flag.NewFlagSet("settings get", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print the settings as JSON")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	logrus.SetOutput(os.Stderr)
+
+	return container.Invoke(func(params settingsParams) error {
+		if err := params.Runtime.start(); err != nil {
+			return err
+		}
+		defer params.Runtime.stop()
+
+		current, err := currentSettings(params)
+		if err != nil {
+			return err
+		}
+
+		selected := current
+		if flags.NArg() > 0 {
+			selected = make(map[string]any, flags.NArg())
+			for _, key := range flags.Args() {
+				value, ok := current[key]
+				if !ok {
+					return fmt.Errorf("invalid setting key: %s", key)
+				}
+				selected[key] = value
+			}
+		}
+
+		if *asJSON {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(selected)
+		}
+		keys := make([]string, 0, len(selected))
+		for key := range selected {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Printf("%s=%v\n", key, selected[key])
+		}
+		return nil
+	})
+}
+
+func runSettingsSet(container *dig.Container, args []string) error {
+	flags := flag.NewFlagSet("settings set", flag.ContinueOnError)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		return fmt.Errorf("usage: settings set KEY=VALUE...")
+	}
+
+	return container.Invoke(func(params settingsParams) error {
+		if err := params.Runtime.start(); err != nil {
+			return err
+		}
+		defer params.Runtime.stop()
+
+		current, err := currentSettings(params)
+		if err != nil {
+			return err
+		}
+
+		updates := make(map[string]any, flags.NArg())
+		for _, arg := range flags.Args() {
+			key, rawValue, ok := strings.Cut(arg, "=")
+			if !ok {
+				return fmt.Errorf("invalid argument '%s', expected KEY=VALUE", arg)
+			}
+			value, err := parseSettingValue(key, rawValue, current)
+			if err != nil {
+				return err
+			}
+			updates[key] = value
+		}
+		if proxyKeys, ok := updates["proxy_keys"].(string); ok {
+			updates["proxy_keys"] = strings.Join(utils.SplitAndTrim(proxyKeys, ","), ",")
+		}
+
+		if err := params.Runtime.SettingsManager.UpdateSettings(updates); err != nil {
+			return err
+		}
+
+		// 审计日志不记录代理密钥的值
+		before := make(map[string]any, len(updates))
+		after := make(map[string]any, len(updates))
+		for key, value := range updates {
+			if key == "proxy_keys" {
+				continue
+			}
+			before[key] = current[key]
+			after[key] = value
+		}
+		_, proxyKeysChanged := updates["proxy_keys"]
+		params.AuditService.RecordSystem("cli", services.AuditEntry{
+			Action:     services.AuditSettingsUpdate,
+			TargetType: services.AuditTargetSettings,
+			Before:     before,
+			After:      after,
+			Details:    map[string]any{"proxy_keys_changed": proxyKeysChanged},
+		})
+		fmt.Printf("Updated %d settings.\n", len(updates))
+		return nil
+	})
+}
+
+// currentSettings returns the current system settings keyed by their JSON names.
+func currentSettings(params settingsParams) (map[string]any, error) {
+	data, err := json.Marshal(params.Runtime.SettingsManager.GetSettings())
+	if err != nil {
+		return nil, err
+	}
+	var settings map[string]any
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// parseSettingValue converts a command line value to the type of the setting, as the settings API expects it.
+func parseSettingValue(key, rawValue string, current map[string]any) (any, error) {
+	currentValue, ok := current[key]
+	if !ok {
+		return nil, fmt.Errorf("invalid setting key: %s", key)
+	}
+
+	switch currentValue.(type) {
+	case float64:
+		value, err := strconv.ParseFloat(rawValue, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for %s: expected a number", key)
+		}
+		return value, nil
+	case bool:
+		value, err := strconv.ParseBool(rawValue)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for %s: expected true or false", key)
+		}
+		return value, nil
+	default:
+		return rawValue, nil
+	}
+}
@@ -0,0 +1,48 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+
+	"gpt-load/internal/keypool"
+
+	"github.com/sirupsen/logrus"
+	"go.uber.org/dig"
+)
+
+// storeParams defines the dependencies of the store command.
+type storeParams struct {
+	dig.In
+	Runtime     runtimeParams
+	KeyProvider *keypool.KeyProvider
+}
+
+// runStore manages the key pool in the store.
+//
+// Usage: gpt-load store rebuild
+func runStore(container *dig.Container, args []string) error {
+	if len(args) == 0 || args[0] != "rebuild" {
+		return fmt.Errorf("usage: store rebuild")
+	}
+	flags := flag.NewFlagSet("store rebuild", flag.ContinueOnError)
+	if err := flags.Parse(args[1:]); err != nil {
+		return err
+	}
+
+	return container.Invoke(func(params storeParams) error {
+		// 内存存储随进程启动重建，只有 Redis 需要手动重建
+		if params.Runtime.ConfigManager.GetRedisDSN() == "" {
+			return fmt.Errorf("REDIS_DSN is not configured, the memory store is rebuilt every time the server starts")
+		}
+		if err := params.Runtime.start(); err != nil {
+			return err
+		}
+		defer params.Runtime.stop()
+
+		if err := params.KeyProvider.RebuildStore(); err != nil {
+			return err
+		}
+		logrus.Info("Key pool rebuilt from the database.")
+		return nil
+	})
+}
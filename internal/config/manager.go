@@ -3,7 +3,10 @@ package config
 
 import (
 	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"slices"
 	"strings"
 
 	"gpt-load/internal/errors"
@@ -49,6 +52,10 @@ type Config struct {
 	Log         types.LogConfig         `json:"log"`
 	Database    types.DatabaseConfig    `json:"database"`
 	RedisDSN    string                  `json:"redis_dsn"`
+	Encryption  types.EncryptionConfig  `json:"-"`
+	OIDC        types.OIDCConfig        `json:"oidc"`
+	Metrics     types.MetricsConfig     `json:"metrics"`
+	Tracing     types.TracingConfig     `json:"tracing"`
 }
 
 // NewManager creates a new configuration manager
@@ -77,9 +84,15 @@ func (m *Manager) ReloadConfig() error {
 			WriteTimeout:            utils.ParseInteger(os.Getenv("SERVER_WRITE_TIMEOUT"), 600),
 			IdleTimeout:             utils.ParseInteger(os.Getenv("SERVER_IDLE_TIMEOUT"), 120),
 			GracefulShutdownTimeout: utils.ParseInteger(os.Getenv("SERVER_GRACEFUL_SHUTDOWN_TIMEOUT"), 10),
+			TrustedProxies:          utils.ParseArray(os.Getenv("SERVER_TRUSTED_PROXIES"), nil),
 		},
 		Auth: types.AuthConfig{
-			Key: os.Getenv("AUTH_KEY"),
+			Key:                  os.Getenv("AUTH_KEY"),
+			SessionTTLMinutes:    utils.ParseInteger(os.Getenv("AUTH_SESSION_TTL_MINUTES"), 60),
+			RefreshTTLHours:      utils.ParseInteger(os.Getenv("AUTH_REFRESH_TTL_HOURS"), 168),
+			MaxFailedAttempts:    utils.ParseInteger(os.Getenv("AUTH_MAX_FAILED_ATTEMPTS"), 5),
+			LockoutBaseSeconds:   utils.ParseInteger(os.Getenv("AUTH_LOCKOUT_SECONDS"), 60),
+			FailureWindowMinutes: utils.ParseInteger(os.Getenv("AUTH_FAILURE_WINDOW_MINUTES"), 15),
 		},
 		CORS: types.CORSConfig{
 			Enabled:          utils.ParseBoolean(os.Getenv("ENABLE_CORS"), true),
@@ -102,6 +115,49 @@ func (m *Manager) ReloadConfig() error {
 		},
 		RedisDSN: os.Getenv("REDIS_DSN"),
 	}
+
+	masterKey, err := readSecret("ENCRYPTION_KEY", "ENCRYPTION_KEY_FILE")
+	if err != nil {
+		return err
+	}
+	newMasterKey, err := readSecret("ENCRYPTION_NEW_KEY", "ENCRYPTION_NEW_KEY_FILE")
+	if err != nil {
+		return err
+	}
+	config.Encryption = types.EncryptionConfig{
+		MasterKey:    masterKey,
+		NewMasterKey: newMasterKey,
+	}
+	oidcClientSecret, err := readSecret("OIDC_CLIENT_SECRET", "OIDC_CLIENT_SECRET_FILE")
+	if err != nil {
+		return err
+	}
+	config.OIDC = types.OIDCConfig{
+		Issuer:        strings.TrimRight(os.Getenv("OIDC_ISSUER"), "/"),
+		ClientID:      os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret:  oidcClientSecret,
+		RedirectURL:   os.Getenv("OIDC_REDIRECT_URL"),
+		Scopes:        utils.ParseArray(os.Getenv("OIDC_SCOPES"), []string{"openid", "profile", "email"}),
+		UsernameClaim: utils.GetEnvOrDefault("OIDC_USERNAME_CLAIM", "preferred_username"),
+		RoleClaim:     utils.GetEnvOrDefault("OIDC_ROLE_CLAIM", "groups"),
+		RoleMapping:   os.Getenv("OIDC_ROLE_MAPPING"),
+		DefaultRole:   os.Getenv("OIDC_DEFAULT_ROLE"),
+		DisplayName:   utils.GetEnvOrDefault("OIDC_DISPLAY_NAME", "SSO"),
+	}
+	metricsToken, err := readSecret("METRICS_TOKEN", "METRICS_TOKEN_FILE")
+	if err != nil {
+		return err
+	}
+	config.Metrics = types.MetricsConfig{
+		Enabled: utils.ParseBoolean(os.Getenv("METRICS_ENABLED"), true),
+		Token:   metricsToken,
+	}
+	config.Tracing = types.TracingConfig{
+		Endpoint:    strings.TrimRight(os.Getenv("TRACING_OTLP_ENDPOINT"), "/"),
+		Headers:     parseKeyValues(os.Getenv("TRACING_OTLP_HEADERS")),
+		ServiceName: utils.GetEnvOrDefault("TRACING_SERVICE_NAME", "gpt-load"),
+		SampleRatio: utils.ParseFloat(os.Getenv("TRACING_SAMPLE_RATIO"), 1),
+	}
 	m.config = config
 
 	// Validate configuration
@@ -147,6 +203,26 @@ func (m *Manager) GetDatabaseConfig() types.DatabaseConfig {
 	return m.config.Database
 }
 
+// GetOIDCConfig returns the OpenID Connect single sign-on configuration.
+func (m *Manager) GetOIDCConfig() types.OIDCConfig {
+	return m.config.OIDC
+}
+
+// GetMetricsConfig returns the Prometheus metrics endpoint configuration.
+func (m *Manager) GetMetricsConfig() types.MetricsConfig {
+	return m.config.Metrics
+}
+
+// GetTracingConfig returns the OpenTelemetry tracing configuration.
+func (m *Manager) GetTracingConfig() types.TracingConfig {
+	return m.config.Tracing
+}
+
+// GetEncryptionConfig returns the API key encryption configuration.
+func (m *Manager) GetEncryptionConfig() types.EncryptionConfig {
+	return m.config.Encryption
+}
+
 // GetEffectiveServerConfig returns server configuration merged with system settings
 func (m *Manager) GetEffectiveServerConfig() types.ServerConfig {
 	return m.config.Server
@@ -170,6 +246,40 @@ func (m *Manager) Validate() error {
 		validationErrors = append(validationErrors, "AUTH_KEY is required and cannot be empty")
 	}
 
+	if m.config.Auth.SessionTTLMinutes < 1 {
+		validationErrors = append(validationErrors, "AUTH_SESSION_TTL_MINUTES must be at least 1")
+	}
+	if m.config.Auth.RefreshTTLHours < 1 {
+		validationErrors = append(validationErrors, "AUTH_REFRESH_TTL_HOURS must be at least 1")
+	}
+	if m.config.Auth.MaxFailedAttempts < 0 || m.config.Auth.LockoutBaseSeconds < 1 || m.config.Auth.FailureWindowMinutes < 1 {
+		validationErrors = append(validationErrors, "AUTH_MAX_FAILED_ATTEMPTS cannot be negative, AUTH_LOCKOUT_SECONDS and AUTH_FAILURE_WINDOW_MINUTES must be at least 1")
+	}
+
+	for _, proxy := range m.config.Server.TrustedProxies {
+		if net.ParseIP(proxy) == nil {
+			if _, _, err := net.ParseCIDR(proxy); err != nil {
+				validationErrors = append(validationErrors, fmt.Sprintf("SERVER_TRUSTED_PROXIES entry '%s' is not an IP address or CIDR", proxy))
+			}
+		}
+	}
+
+	if oidc := m.config.OIDC; oidc.Issuer != "" || oidc.ClientID != "" {
+		if oidc.Issuer == "" || oidc.ClientID == "" {
+			validationErrors = append(validationErrors, "OIDC_ISSUER and OIDC_CLIENT_ID must be set together")
+		} else if !slices.Contains(oidc.Scopes, "openid") {
+			validationErrors = append(validationErrors, "OIDC_SCOPES must include 'openid'")
+		} else if redirectURL, err := url.Parse(oidc.RedirectURL); oidc.RedirectURL == "" || err != nil || redirectURL.Host == "" ||
+			(redirectURL.Scheme != "http" && redirectURL.Scheme != "https") {
+			// The callback URL is not derived from request headers, which clients control
+			validationErrors = append(validationErrors, "OIDC_REDIRECT_URL must be set to the absolute callback URL when OIDC is enabled")
+		}
+	}
+
+	if ratio := m.config.Tracing.SampleRatio; ratio < 0 || ratio > 1 {
+		validationErrors = append(validationErrors, "TRACING_SAMPLE_RATIO must be between 0 and 1")
+	}
+
 	// Validate GracefulShutdownTimeout and reset if necessary
 	if m.config.Server.GracefulShutdownTimeout < 10 {
 		logrus.Warnf("SERVER_GRACEFUL_SHUTDOWN_TIMEOUT value %ds is too short, resetting to minimum 10s.", m.config.Server.GracefulShutdownTimeout)
@@ -209,11 +319,40 @@ func (m *Manager) DisplayServerConfig() {
 
 	logrus.Info("  --- Security ---")
 	logrus.Infof("    Authentication: enabled (key loaded)")
+	logrus.Infof("    Session TTL: %d minutes (refresh: %d hours)", m.config.Auth.SessionTTLMinutes, m.config.Auth.RefreshTTLHours)
+	lockoutStatus := "disabled"
+	if m.config.Auth.MaxFailedAttempts > 0 {
+		lockoutStatus = fmt.Sprintf("after %d failures within %d minutes", m.config.Auth.MaxFailedAttempts, m.config.Auth.FailureWindowMinutes)
+	}
+	logrus.Infof("    Login Lockout: %s", lockoutStatus)
 	corsStatus := "disabled"
 	if corsConfig.Enabled {
 		corsStatus = fmt.Sprintf("enabled (Origins: %s)", strings.Join(corsConfig.AllowedOrigins, ", "))
 	}
 	logrus.Infof("    CORS: %s", corsStatus)
+	encryptionStatus := "disabled"
+	if m.config.Encryption.MasterKey != "" {
+		encryptionStatus = "enabled (master key loaded)"
+	}
+	logrus.Infof("    Key Encryption: %s", encryptionStatus)
+	ssoStatus := "disabled"
+	if m.config.OIDC.Enabled() {
+		ssoStatus = fmt.Sprintf("enabled (Issuer: %s)", m.config.OIDC.Issuer)
+	}
+	logrus.Infof("    OIDC SSO: %s", ssoStatus)
+	metricsStatus := "disabled"
+	if m.config.Metrics.Enabled {
+		metricsStatus = "enabled at /metrics (no token)"
+		if m.config.Metrics.Token != "" {
+			metricsStatus = "enabled at /metrics (token required)"
+		}
+	}
+	logrus.Infof("    Metrics: %s", metricsStatus)
+	tracingStatus := "disabled"
+	if m.config.Tracing.Endpoint != "" {
+		tracingStatus = fmt.Sprintf("exporting to %s (sample ratio %g)", m.config.Tracing.Endpoint, m.config.Tracing.SampleRatio)
+	}
+	logrus.Infof("    Tracing: %s", tracingStatus)
 
 	logrus.Info("  --- Logging ---")
 	logrus.Infof("    Log Level: %s", logConfig.Level)
@@ -237,3 +376,33 @@ func (m *Manager) DisplayServerConfig() {
 	logrus.Info("====================================")
 	logrus.Info("")
 }
+
+// readSecret reads a secret from an environment variable, or from the file named by another one.
+func readSecret(envKey, fileEnvKey string) (string, error) {
+	if value := strings.TrimSpace(os.Getenv(envKey)); value != "" {
+		return value, nil
+	}
+
+	path := strings.TrimSpace(os.Getenv(fileEnvKey))
+	if path == "" {
+		return "", nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s '%s': %w", fileEnvKey, path, err)
+	}
+	return strings.TrimSpace(string(content)), nil
+}
+
+// parseKeyValues parses comma-separated key=value pairs, such as OTLP headers.
+func parseKeyValues(value string) map[string]string {
+	pairs := make(map[string]string)
+	for _, item := range utils.ParseArray(value, nil) {
+		key, val, ok := strings.Cut(item, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			continue
+		}
+		pairs[strings.TrimSpace(key)] = strings.TrimSpace(val)
+	}
+	return pairs
+}
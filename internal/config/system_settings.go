@@ -17,6 +17,7 @@ import (
 
 	"github.com/sirupsen/logrus"
 	"gorm.io/datatypes"
+	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
 
@@ -180,6 +181,16 @@ func (sm *SystemSettingsManager) GetAppUrl() string {
 
 // UpdateSettings 更新系统配置
 func (sm *SystemSettingsManager) UpdateSettings(settingsMap map[string]any) error {
+	if err := sm.UpdateSettingsInTx(db.DB, settingsMap); err != nil {
+		return err
+	}
+
+	// 触发所有实例重新加载
+	return sm.syncer.Invalidate()
+}
+
+// UpdateSettingsInTx 在调用方的事务中验证并写入配置，提交后需调用 Reload 使其生效
+func (sm *SystemSettingsManager) UpdateSettingsInTx(tx *gorm.DB, settingsMap map[string]any) error {
 	// 验证配置项
 	if err := sm.ValidateSettings(settingsMap); err != nil {
 		return err
@@ -195,15 +206,18 @@ func (sm *SystemSettingsManager) UpdateSettings(settingsMap map[string]any) erro
 	}
 
 	if len(settingsToUpdate) > 0 {
-		if err := db.DB.Clauses(clause.OnConflict{
+		if err := tx.Clauses(clause.OnConflict{
 			Columns:   []clause.Column{{Name: "setting_key"}},
 			DoUpdates: clause.AssignmentColumns([]string{"setting_value", "updated_at"}),
 		}).Create(&settingsToUpdate).Error; err != nil {
 			return fmt.Errorf("failed to update system settings: %w", err)
 		}
 	}
+	return nil
+}
 
-	// 触发所有实例重新加载
+// Reload 从数据库重新加载系统配置，并通知所有实例，用于配置被直接写入数据库之后
+func (sm *SystemSettingsManager) Reload() error {
 	return sm.syncer.Invalidate()
 }
 
@@ -397,6 +411,7 @@ func (sm *SystemSettingsManager) DisplaySystemConfig(settings types.SystemSettin
 	logrus.Info("  --- Basic Settings ---")
 	logrus.Infof("    App URL: %s", settings.AppUrl)
 	logrus.Infof("    Request Log Retention: %d days", settings.RequestLogRetentionDays)
+	logrus.Infof("    Audit Log Retention: %d days", settings.AuditLogRetentionDays)
 	logrus.Infof("    Request Log Write Interval: %d minutes", settings.RequestLogWriteIntervalMinutes)
 
 	logrus.Info("  --- Request Behavior ---")
@@ -411,6 +426,7 @@ func (sm *SystemSettingsManager) DisplaySystemConfig(settings types.SystemSettin
 	logrus.Infof("    Max Retries: %d", settings.MaxRetries)
 	logrus.Infof("    Blacklist Threshold: %d", settings.BlacklistThreshold)
 	logrus.Infof("    Key Validation Interval: %d minutes", settings.KeyValidationIntervalMinutes)
+	logrus.Infof("    Active Key Check Interval: %d minutes", settings.ActiveKeyCheckIntervalMinutes)
 	logrus.Info("====================================")
 	logrus.Info("")
 }
@@ -2,10 +2,12 @@
 package container
 
 import (
+	"gpt-load/internal/alert"
 	"gpt-load/internal/app"
 	"gpt-load/internal/channel"
 	"gpt-load/internal/config"
 	"gpt-load/internal/db"
+	"gpt-load/internal/encryption"
 	"gpt-load/internal/handler"
 	"gpt-load/internal/httpclient"
 	"gpt-load/internal/keypool"
@@ -13,6 +15,7 @@ import (
 	"gpt-load/internal/router"
 	"gpt-load/internal/services"
 	"gpt-load/internal/store"
+	"gpt-load/internal/tracing"
 
 	"go.uber.org/dig"
 )
@@ -28,12 +31,18 @@ func BuildContainer() (*dig.Container, error) {
 	if err := container.Provide(db.NewDB); err != nil {
 		return nil, err
 	}
+	if err := container.Provide(encryption.NewService); err != nil {
+		return nil, err
+	}
 	if err := container.Provide(config.NewSystemSettingsManager); err != nil {
 		return nil, err
 	}
 	if err := container.Provide(store.NewStore); err != nil {
 		return nil, err
 	}
+	if err := container.Provide(tracing.NewProvider); err != nil {
+		return nil, err
+	}
 	if err := container.Provide(httpclient.NewHTTPClientManager); err != nil {
 		return nil, err
 	}
@@ -66,9 +75,45 @@ func BuildContainer() (*dig.Container, error) {
 	if err := container.Provide(services.NewRequestLogService); err != nil {
 		return nil, err
 	}
+	if err := container.Provide(services.NewAdminUserService); err != nil {
+		return nil, err
+	}
+	if err := container.Provide(services.NewSessionService); err != nil {
+		return nil, err
+	}
+	if err := container.Provide(services.NewAuthLimiter); err != nil {
+		return nil, err
+	}
+	if err := container.Provide(services.NewSSOService); err != nil {
+		return nil, err
+	}
+	if err := container.Provide(services.NewAuditService); err != nil {
+		return nil, err
+	}
+	if err := container.Provide(services.NewGroupVersionService); err != nil {
+		return nil, err
+	}
+	if err := container.Provide(services.NewGroupService); err != nil {
+		return nil, err
+	}
+	if err := container.Provide(services.NewConfigService); err != nil {
+		return nil, err
+	}
+	if err := container.Provide(services.NewBackupService); err != nil {
+		return nil, err
+	}
+	if err := container.Provide(services.NewMetricsService); err != nil {
+		return nil, err
+	}
 	if err := container.Provide(services.NewGroupManager); err != nil {
 		return nil, err
 	}
+	if err := container.Provide(services.NewProbeService); err != nil {
+		return nil, err
+	}
+	if err := container.Provide(alert.NewService); err != nil {
+		return nil, err
+	}
 	if err := container.Provide(keypool.NewProvider); err != nil {
 		return nil, err
 	}
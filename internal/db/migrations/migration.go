@@ -1,9 +1,327 @@
 package db
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"gpt-load/internal/models"
+	"gpt-load/internal/store"
+
+	"github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 )
 
-func MigrateDatabase(db *gorm.DB) error {
-	return V1_0_22_DropRetriesColumn(db)
+// KeyHasher computes the deduplication hash of a key value.
+type KeyHasher interface {
+	Hash(value string) string
+}
+
+// Deps are the services available to migrations.
+type Deps struct {
+	Hasher KeyHasher
+}
+
+// Migration 是一个带版本号的数据库迁移。
+// 版本化迁移在 AutoMigrate 之前执行，因此可以重命名列、回填数据；
+// 需要新列或新表时，迁移应自行通过 Migrator 创建，AutoMigrate 只负责补齐新增的表、列和索引。
+type Migration struct {
+	Version uint
+	Name    string
+	Up      func(tx *gorm.DB, deps Deps) error
+	Down    func(tx *gorm.DB, deps Deps) error // 为空表示不可回滚
+}
+
+// registry 按版本号升序列出所有迁移，新迁移只能追加在末尾，已发布的迁移不可修改
+var registry = []Migration{
+	{
+		Version: 1,
+		Name:    "drop_request_logs_retries",
+		Up: func(tx *gorm.DB, _ Deps) error {
+			return V1_0_22_DropRetriesColumn(tx)
+		},
+		Down: func(tx *gorm.DB, _ Deps) error {
+			return V1_0_22_RestoreRetriesColumn(tx)
+		},
+	},
+	{
+		Version: 2,
+		Name:    "add_api_keys_key_hash",
+		Up: func(tx *gorm.DB, deps Deps) error {
+			return V1_1_0_AddKeyHash(tx, deps.Hasher)
+		},
+		// 不可回滚：此后的 Key 以加密形式存储，旧版本的明文唯一索引无法重建
+	},
+	{
+		Version: 3,
+		Name:    "add_api_keys_pool_id",
+		Up: func(tx *gorm.DB, _ Deps) error {
+			return V1_2_0_AddKeyPoolID(tx)
+		},
+		Down: func(tx *gorm.DB, _ Deps) error {
+			return V1_2_0_RemoveKeyPoolID(tx)
+		},
+	},
+}
+
+// 迁移锁，保证集群中只有一个 Master 节点执行迁移
+const (
+	migrationLockKey       = "schema_migrations:lock"
+	migrationLockTTL       = 2 * time.Minute
+	migrationLockWait      = 15 * time.Minute
+	migrationLockRetryWait = time.Second
+)
+
+// ErrMigrationLockLost is returned when the migration lock cannot be extended while migrating,
+// another node may have taken it over.
+var ErrMigrationLockLost = errors.New("the migration lock was lost")
+
+// MigrationStatus is the state of a migration in the database.
+type MigrationStatus struct {
+	Version    uint       `json:"version"`
+	Name       string     `json:"name"`
+	Reversible bool       `json:"reversible"`
+	AppliedAt  *time.Time `json:"applied_at"`
+	Unknown    bool       `json:"unknown"` // Applied by a newer release, missing from this one
+}
+
+// Runner applies and rolls back the versioned migrations, recording them in the schema_migrations table.
+type Runner struct {
+	db         *gorm.DB
+	store      store.Store
+	deps       Deps
+	migrations []Migration
+	lockTTL    time.Duration
+}
+
+// NewRunner creates a Runner for the registered migrations.
+func NewRunner(db *gorm.DB, store store.Store, hasher KeyHasher) *Runner {
+	return &Runner{
+		db:         db,
+		store:      store,
+		deps:       Deps{Hasher: hasher},
+		migrations: registry,
+		lockTTL:    migrationLockTTL,
+	}
+}
+
+// WithLock runs fn while holding the cross-node migration lock in the store.
+// Nodes that start at the same time wait for the node holding the lock, then find nothing left to migrate.
+// The context of fn is cancelled when the lock cannot be extended, and WithLock then returns ErrMigrationLockLost.
+func (r *Runner) WithLock(fn func(ctx context.Context) error) error {
+	hostname, _ := os.Hostname()
+	owner := []byte(fmt.Sprintf("%s:%d:%d", hostname, os.Getpid(), time.Now().UnixNano()))
+
+	deadline := time.Now().Add(migrationLockWait)
+	for waiting := false; ; waiting = true {
+		acquired, err := r.store.SetNX(migrationLockKey, owner, r.lockTTL)
+		if err != nil {
+			return fmt.Errorf("failed to acquire the migration lock: %w", err)
+		}
+		if acquired {
+			break
+		}
+		if !waiting {
+			holder, _ := r.store.Get(migrationLockKey)
+			logrus.Infof("Waiting for the database migration running on %s...", holder)
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out after %s waiting for the migration lock", migrationLockWait)
+		}
+		time.Sleep(migrationLockRetryWait)
+	}
+
+	// 数据迁移可能超过锁的有效期，持有期间定期续期；续期失败时其他节点可能已接手，取消当前迁移
+	ctx, cancel := context.WithCancelCause(context.Background())
+	stop := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(r.lockTTL / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				extended, err := r.store.CompareAndSet(migrationLockKey, owner, owner, r.lockTTL)
+				if err != nil {
+					cancel(fmt.Errorf("%w: failed to extend it: %v", ErrMigrationLockLost, err))
+					return
+				}
+				if !extended {
+					cancel(fmt.Errorf("%w: it expired and may have been taken by another node", ErrMigrationLockLost))
+					return
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	defer func() {
+		close(stop)
+		cancel(nil)
+		if _, err := r.store.CompareAndDelete(migrationLockKey, owner); err != nil {
+			logrus.WithError(err).Warn("Failed to release the migration lock")
+		}
+	}()
+
+	err := fn(ctx)
+	if cause := context.Cause(ctx); errors.Is(cause, ErrMigrationLockLost) {
+		return cause
+	}
+	return err
+}
+
+// Up applies the pending migrations in version order. Each migration and its record are committed together.
+// It stops before the next migration, and rolls back the running one, when the context is done.
+func (r *Runner) Up(ctx context.Context) ([]Migration, error) {
+	applied, err := r.applied()
+	if err != nil {
+		return nil, err
+	}
+	if unknown := r.unknownVersions(applied); len(unknown) > 0 {
+		logrus.Warnf("The database has migrations %v that this release does not know, it was migrated by a newer release.", unknown)
+	}
+
+	var done []Migration
+	for _, m := range r.migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return done, err
+		}
+		err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := m.Up(tx, r.deps); err != nil {
+				return err
+			}
+			return tx.Create(&models.SchemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("migration %d (%s) failed: %w", m.Version, m.Name, err)
+		}
+		logrus.Infof("Applied database migration %d (%s).", m.Version, m.Name)
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+// Down rolls back the applied migrations newer than the target version, newest first.
+// Nothing is rolled back if one of them is irreversible. It stops like Up when the context is done.
+func (r *Runner) Down(ctx context.Context, target uint) ([]Migration, error) {
+	applied, err := r.applied()
+	if err != nil {
+		return nil, err
+	}
+	if unknown := r.unknownVersions(applied); len(unknown) > 0 {
+		return nil, fmt.Errorf("the database has migrations %v unknown to this release, roll them back with the release that applied them", unknown)
+	}
+
+	var pending []Migration
+	for i := len(r.migrations) - 1; i >= 0; i-- {
+		m := r.migrations[i]
+		if m.Version <= target {
+			break
+		}
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		if m.Down == nil {
+			return nil, fmt.Errorf("migration %d (%s) is irreversible", m.Version, m.Name)
+		}
+		pending = append(pending, m)
+	}
+
+	var done []Migration
+	for _, m := range pending {
+		if err := ctx.Err(); err != nil {
+			return done, err
+		}
+		err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			if err := m.Down(tx, r.deps); err != nil {
+				return err
+			}
+			return tx.Delete(&models.SchemaMigration{}, m.Version).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("rollback of migration %d (%s) failed: %w", m.Version, m.Name, err)
+		}
+		logrus.Infof("Rolled back database migration %d (%s).", m.Version, m.Name)
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+// Status lists the registered migrations and whether they are applied, followed by the unknown applied versions.
+func (r *Runner) Status() ([]MigrationStatus, error) {
+	applied, err := r.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, 0, len(r.migrations))
+	for _, m := range r.migrations {
+		status := MigrationStatus{Version: m.Version, Name: m.Name, Reversible: m.Down != nil}
+		if record, ok := applied[m.Version]; ok {
+			status.AppliedAt = &record.AppliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	for _, version := range r.unknownVersions(applied) {
+		record := applied[version]
+		statuses = append(statuses, MigrationStatus{Version: version, Name: record.Name, AppliedAt: &record.AppliedAt, Unknown: true})
+	}
+	return statuses, nil
+}
+
+// applied returns the applied migrations by version, creating the schema_migrations table if needed.
+func (r *Runner) applied() (map[uint]models.SchemaMigration, error) {
+	if err := validateRegistry(r.migrations); err != nil {
+		return nil, err
+	}
+	if err := r.db.AutoMigrate(&models.SchemaMigration{}); err != nil {
+		return nil, fmt.Errorf("failed to create the schema_migrations table: %w", err)
+	}
+
+	var records []models.SchemaMigration
+	if err := r.db.Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("failed to load applied migrations: %w", err)
+	}
+	applied := make(map[uint]models.SchemaMigration, len(records))
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+	return applied, nil
+}
+
+// unknownVersions returns the applied versions missing from the registry, in ascending order.
+func (r *Runner) unknownVersions(applied map[uint]models.SchemaMigration) []uint {
+	known := make(map[uint]bool, len(r.migrations))
+	for _, m := range r.migrations {
+		known[m.Version] = true
+	}
+	var unknown []uint
+	for version := range applied {
+		if !known[version] {
+			unknown = append(unknown, version)
+		}
+	}
+	sort.Slice(unknown, func(i, j int) bool { return unknown[i] < unknown[j] })
+	return unknown
+}
+
+// validateRegistry checks that the migrations are in strictly ascending version order.
+func validateRegistry(migrations []Migration) error {
+	var last uint
+	for _, m := range migrations {
+		if m.Version <= last {
+			return errors.New("migrations must be registered in strictly ascending version order")
+		}
+		if m.Up == nil {
+			return fmt.Errorf("migration %d (%s) has no up step", m.Version, m.Name)
+		}
+		last = m.Version
+	}
+	return nil
 }
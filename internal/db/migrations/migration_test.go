@@ -0,0 +1,267 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"gpt-load/internal/models"
+	"gpt-load/internal/store"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// testItem is the table the test migrations change.
+type testItem struct {
+	ID   uint
+	Name string
+}
+
+func (testItem) TableName() string {
+	return "test_items"
+}
+
+// testMigrations creates the items table, adds its name column, then adds an index that cannot be rolled back.
+func testMigrations() []Migration {
+	return []Migration{
+		{
+			Version: 1,
+			Name:    "create_items",
+			Up: func(tx *gorm.DB, _ Deps) error {
+				return tx.Exec("CREATE TABLE test_items (id INTEGER PRIMARY KEY)").Error
+			},
+			Down: func(tx *gorm.DB, _ Deps) error {
+				return tx.Migrator().DropTable("test_items")
+			},
+		},
+		{
+			Version: 2,
+			Name:    "add_items_name",
+			Up: func(tx *gorm.DB, _ Deps) error {
+				return tx.Migrator().AddColumn(&testItem{}, "Name")
+			},
+			Down: func(tx *gorm.DB, _ Deps) error {
+				return tx.Migrator().DropColumn(&testItem{}, "Name")
+			},
+		},
+		{
+			Version: 3,
+			Name:    "index_items_name",
+			Up: func(tx *gorm.DB, _ Deps) error {
+				return tx.Exec("CREATE INDEX idx_test_items_name ON test_items (name)").Error
+			},
+		},
+	}
+}
+
+func newTestRunner(t *testing.T, migrations []Migration) *Runner {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewRunner(db, store.NewMemoryStore(), nil)
+	r.migrations = migrations
+	return r
+}
+
+func versions(migrations []Migration) []uint {
+	var result []uint
+	for _, m := range migrations {
+		result = append(result, m.Version)
+	}
+	return result
+}
+
+func appliedVersions(t *testing.T, r *Runner) []uint {
+	t.Helper()
+	statuses, err := r.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result []uint
+	for _, status := range statuses {
+		if status.AppliedAt != nil {
+			result = append(result, status.Version)
+		}
+	}
+	return result
+}
+
+func TestRunnerUpAndDown(t *testing.T) {
+	ctx := context.Background()
+	r := newTestRunner(t, testMigrations()[:2])
+
+	done, err := r.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := versions(done); !slices.Equal(got, []uint{1, 2}) {
+		t.Fatalf("applied %v, want 1 and 2", got)
+	}
+	if !r.db.Migrator().HasColumn(&testItem{}, "Name") {
+		t.Error("the name column should be added")
+	}
+	if done, err := r.Up(ctx); err != nil || len(done) != 0 {
+		t.Errorf("a second run applied %v, %v, want nothing", versions(done), err)
+	}
+
+	// 回滚时按版本从新到旧执行
+	done, err = r.Down(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := versions(done); !slices.Equal(got, []uint{2, 1}) {
+		t.Errorf("rolled back %v, want 2 then 1", got)
+	}
+	if r.db.Migrator().HasTable(&testItem{}) {
+		t.Error("the items table should be dropped")
+	}
+	if got := appliedVersions(t, r); len(got) != 0 {
+		t.Errorf("applied versions = %v, want none", got)
+	}
+}
+
+func TestRunnerDownIrreversible(t *testing.T) {
+	ctx := context.Background()
+	r := newTestRunner(t, testMigrations())
+	if _, err := r.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if done, err := r.Down(ctx, 1); err == nil || len(done) != 0 {
+		t.Fatalf("rolled back %v, %v, want an error for the irreversible migration 3", versions(done), err)
+	}
+	if got := appliedVersions(t, r); !slices.Equal(got, []uint{1, 2, 3}) {
+		t.Errorf("applied versions = %v, want all kept", got)
+	}
+
+	// 目标版本之后没有不可回滚的迁移时不受影响
+	if _, err := r.Down(ctx, 3); err != nil {
+		t.Errorf("rolling back nothing: %v", err)
+	}
+}
+
+func TestRunnerUpFailure(t *testing.T) {
+	migrations := testMigrations()[:2]
+	migrations[1].Up = func(tx *gorm.DB, _ Deps) error {
+		if err := tx.Migrator().AddColumn(&testItem{}, "Name"); err != nil {
+			return err
+		}
+		return errors.New("backfill failed")
+	}
+	r := newTestRunner(t, migrations)
+
+	done, err := r.Up(context.Background())
+	if err == nil {
+		t.Fatal("expected the failing migration to return an error")
+	}
+	if got := versions(done); !slices.Equal(got, []uint{1}) {
+		t.Errorf("applied %v, want only 1", got)
+	}
+	if r.db.Migrator().HasColumn(&testItem{}, "Name") {
+		t.Error("the failed migration should be rolled back")
+	}
+	if got := appliedVersions(t, r); !slices.Equal(got, []uint{1}) {
+		t.Errorf("applied versions = %v, want only 1 recorded", got)
+	}
+}
+
+func TestRunnerUnknownVersions(t *testing.T) {
+	ctx := context.Background()
+	r := newTestRunner(t, testMigrations()[:1])
+	if _, err := r.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// 较新版本执行过的迁移
+	if err := r.db.Create(&models.SchemaMigration{Version: 9, Name: "newer", AppliedAt: time.Now()}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.Up(ctx); err != nil {
+		t.Errorf("up with unknown versions: %v, want only a warning", err)
+	}
+	if _, err := r.Down(ctx, 0); err == nil {
+		t.Error("down should refuse to run with unknown versions")
+	}
+	statuses, err := r.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := statuses[len(statuses)-1]; last.Version != 9 || !last.Unknown {
+		t.Errorf("statuses = %+v, want the unknown version 9 listed last", statuses)
+	}
+}
+
+func TestRunnerStopsWhenCancelled(t *testing.T) {
+	r := newTestRunner(t, testMigrations())
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	done, err := r.Up(ctx)
+	if !errors.Is(err, context.Canceled) || len(done) != 0 {
+		t.Errorf("applied %v, %v, want nothing after the cancellation", versions(done), err)
+	}
+}
+
+func TestValidateRegistry(t *testing.T) {
+	if err := validateRegistry(registry); err != nil {
+		t.Errorf("registered migrations: %v", err)
+	}
+	migrations := testMigrations()
+	migrations[1].Version = 1
+	if err := validateRegistry(migrations); err == nil {
+		t.Error("duplicate versions should be rejected")
+	}
+	migrations = testMigrations()
+	migrations[0].Up = nil
+	if err := validateRegistry(migrations); err == nil {
+		t.Error("a migration without an up step should be rejected")
+	}
+}
+
+func TestWithLockExtendsLock(t *testing.T) {
+	r := newTestRunner(t, nil)
+	r.lockTTL = 30 * time.Millisecond
+
+	err := r.WithLock(func(ctx context.Context) error {
+		time.Sleep(4 * r.lockTTL)
+		if exists, _ := r.store.Exists(migrationLockKey); !exists {
+			t.Error("the lock should be extended while migrating")
+		}
+		return ctx.Err()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists, _ := r.store.Exists(migrationLockKey); exists {
+		t.Error("the lock should be released after migrating")
+	}
+}
+
+func TestWithLockAbortsWhenLockLost(t *testing.T) {
+	r := newTestRunner(t, nil)
+	r.lockTTL = 30 * time.Millisecond
+
+	err := r.WithLock(func(ctx context.Context) error {
+		// 锁被其他节点接手
+		if err := r.store.Set(migrationLockKey, []byte("other-node"), time.Minute); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Second):
+			return errors.New("the migration kept running without the lock")
+		}
+	})
+	if !errors.Is(err, ErrMigrationLockLost) {
+		t.Fatalf("err = %v, want ErrMigrationLockLost", err)
+	}
+	if holder, _ := r.store.Get(migrationLockKey); string(holder) != "other-node" {
+		t.Errorf("lock holder = %q, the lock of the other node should be kept", holder)
+	}
+}
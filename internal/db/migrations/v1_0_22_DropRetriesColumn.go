@@ -4,7 +4,7 @@ import "gorm.io/gorm"
 
 // RequestLog 用于迁移的临时结构体
 type RequestLog struct {
-	Retries int `gorm:"column:retries"`
+	Retries int `gorm:"column:retries;not null;default:0"`
 }
 
 // V1_0_22_DropRetriesColumn 删除request_logs表的retries字段
@@ -18,3 +18,12 @@ func V1_0_22_DropRetriesColumn(db *gorm.DB) error {
 	}
 	return nil
 }
+
+// V1_0_22_RestoreRetriesColumn 回滚时恢复request_logs表的retries字段
+func V1_0_22_RestoreRetriesColumn(db *gorm.DB) error {
+	migrator := db.Migrator()
+	if !migrator.HasTable(&RequestLog{}) || migrator.HasColumn(&RequestLog{}, "retries") {
+		return nil
+	}
+	return migrator.AddColumn(&RequestLog{}, "Retries")
+}
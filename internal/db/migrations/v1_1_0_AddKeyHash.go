@@ -0,0 +1,48 @@
+package db
+
+import "gorm.io/gorm"
+
+// apiKeyHashColumn 用于迁移的临时结构体
+type apiKeyHashColumn struct {
+	ID       uint
+	KeyValue string
+	KeyHash  string `gorm:"type:varchar(64);not null;default:''"`
+}
+
+func (apiKeyHashColumn) TableName() string {
+	return "api_keys"
+}
+
+// V1_1_0_AddKeyHash 为 api_keys 表添加 key_hash 字段并回填，替换基于明文的唯一索引 idx_group_key
+func V1_1_0_AddKeyHash(db *gorm.DB, hasher KeyHasher) error {
+	migrator := db.Migrator()
+	if !migrator.HasTable(&apiKeyHashColumn{}) || migrator.HasColumn(&apiKeyHashColumn{}, "key_hash") {
+		return nil
+	}
+
+	if err := migrator.AddColumn(&apiKeyHashColumn{}, "KeyHash"); err != nil {
+		return err
+	}
+
+	// 回填已有 Key 的哈希
+	var keys []apiKeyHashColumn
+	err := db.Select("id, key_value").FindInBatches(&keys, 1000, func(tx *gorm.DB, batch int) error {
+		for _, key := range keys {
+			if err := db.Model(&apiKeyHashColumn{}).Where("id = ?", key.ID).Update("key_hash", hasher.Hash(key.KeyValue)).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return err
+	}
+
+	// 删除旧的明文唯一索引，由 AutoMigrate 创建 idx_group_key_hash
+	if migrator.HasIndex(&apiKeyHashColumn{}, "idx_group_key") {
+		if err := migrator.DropIndex(&apiKeyHashColumn{}, "idx_group_key"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package db
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// apiKeyPoolColumn 用于迁移的临时结构体
+type apiKeyPoolColumn struct {
+	PoolID uint `gorm:"not null;default:0"`
+}
+
+func (apiKeyPoolColumn) TableName() string {
+	return "api_keys"
+}
+
+// V1_2_0_AddKeyPoolID 为 api_keys 表添加 pool_id 字段，唯一索引 idx_group_key_hash 替换为包含 pool_id 的 idx_owner_key_hash
+func V1_2_0_AddKeyPoolID(db *gorm.DB) error {
+	migrator := db.Migrator()
+	if !migrator.HasTable(&apiKeyPoolColumn{}) || migrator.HasColumn(&apiKeyPoolColumn{}, "pool_id") {
+		return nil
+	}
+
+	if err := migrator.AddColumn(&apiKeyPoolColumn{}, "PoolID"); err != nil {
+		return err
+	}
+
+	// 删除旧的唯一索引，由 AutoMigrate 创建 idx_owner_key_hash
+	if migrator.HasIndex(&apiKeyPoolColumn{}, "idx_group_key_hash") {
+		if err := migrator.DropIndex(&apiKeyPoolColumn{}, "idx_group_key_hash"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// V1_2_0_RemoveKeyPoolID 回滚时删除 pool_id 字段，旧版本的 AutoMigrate 会重建 idx_group_key_hash。
+// 密钥池中还有 Key 时拒绝回滚，否则这些 Key 会失去归属。
+func V1_2_0_RemoveKeyPoolID(db *gorm.DB) error {
+	migrator := db.Migrator()
+	if !migrator.HasTable(&apiKeyPoolColumn{}) || !migrator.HasColumn(&apiKeyPoolColumn{}, "pool_id") {
+		return nil
+	}
+
+	var poolKeys int64
+	if err := db.Model(&apiKeyPoolColumn{}).Where("pool_id <> 0").Count(&poolKeys).Error; err != nil {
+		return err
+	}
+	if poolKeys > 0 {
+		return errors.New("key pools still hold keys, remove the key pools before rolling back")
+	}
+
+	if migrator.HasIndex(&apiKeyPoolColumn{}, "idx_owner_key_hash") {
+		if err := migrator.DropIndex(&apiKeyPoolColumn{}, "idx_owner_key_hash"); err != nil {
+			return err
+		}
+	}
+	return migrator.DropColumn(&apiKeyPoolColumn{}, "pool_id")
+}
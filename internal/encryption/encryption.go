@@ -0,0 +1,509 @@
+// Package encryption provides at-rest encryption for API keys.
+//
+// Keys are encrypted with a random data key using AES-GCM. The data key is stored
+// in the database, wrapped by a master key that only lives in the environment or
+// in a key file. Rotating the master key only re-wraps the data key, while rotating
+// the data key re-encrypts every encrypted column.
+package encryption
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gpt-load/internal/models"
+	"gpt-load/internal/types"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// SerializerName is the GORM serializer name used by encrypted columns.
+const SerializerName = "encrypted"
+
+const (
+	ciphertextPrefix = "enc:v1:"
+	dataKeySize      = 32
+)
+
+// ErrNotInitialized is returned when encryption is enabled but the data key has not been loaded.
+var ErrNotInitialized = errors.New("encryption service is not initialized")
+
+// Service encrypts and hashes API keys.
+type Service struct {
+	masterKey []byte
+	aead      cipher.AEAD
+	hashKey   []byte
+}
+
+// NewService creates the encryption service and registers it as the GORM "encrypted" serializer.
+// Encryption is enabled only when a master key is configured.
+func NewService(configManager types.ConfigManager) *Service {
+	s := &Service{}
+	if masterKey := configManager.GetEncryptionConfig().MasterKey; masterKey != "" {
+		s.masterKey = deriveMasterKey(masterKey)
+	}
+	schema.RegisterSerializer(SerializerName, fieldSerializer{service: s})
+	return s
+}
+
+// IsEnabled reports whether a master key is configured.
+func (s *Service) IsEnabled() bool {
+	return s.masterKey != nil
+}
+
+// Initialize loads the data key from the database.
+// When create is true and no data key exists yet, a new one is generated and stored.
+func (s *Service) Initialize(db *gorm.DB, create bool) error {
+	if !s.IsEnabled() {
+		if !db.Migrator().HasTable(&models.APIKey{}) {
+			return nil
+		}
+		var count int64
+		if err := db.Model(&models.APIKey{}).Where("key_value LIKE ?", ciphertextPrefix+"%").Limit(1).Count(&count).Error; err != nil {
+			return fmt.Errorf("failed to check for encrypted keys: %w", err)
+		}
+		if count > 0 {
+			return fmt.Errorf("encrypted keys found in the database but ENCRYPTION_KEY is not configured")
+		}
+		return nil
+	}
+
+	var dataKeyRecords []models.DataKey
+	if err := db.Order("id desc").Limit(1).Find(&dataKeyRecords).Error; err != nil {
+		return fmt.Errorf("failed to load data key: %w", err)
+	}
+	if len(dataKeyRecords) == 0 {
+		if !create {
+			return fmt.Errorf("data key not found, start the master node first to initialize encryption")
+		}
+		return s.createDataKey(db)
+	}
+
+	dataKey, err := unwrapDataKey(s.masterKey, dataKeyRecords[0])
+	if err != nil {
+		return err
+	}
+	return s.setDataKey(dataKey)
+}
+
+// RotateMasterKey re-wraps the data key with a new master key.
+// The service keeps working with the same data key, so no key rows are rewritten and values
+// encrypted with a leaked data key stay readable with it; use RotateDataKey for that.
+func (s *Service) RotateMasterKey(db *gorm.DB, newMasterKey string) error {
+	if !s.IsEnabled() {
+		return fmt.Errorf("encryption is not enabled, configure ENCRYPTION_KEY first")
+	}
+	if newMasterKey == "" {
+		return fmt.Errorf("new master key is empty")
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		var dataKeyRecord models.DataKey
+		if err := tx.Order("id desc").First(&dataKeyRecord).Error; err != nil {
+			return fmt.Errorf("failed to load data key: %w", err)
+		}
+
+		dataKey, err := unwrapDataKey(s.masterKey, dataKeyRecord)
+		if err != nil {
+			return err
+		}
+
+		newKey := deriveMasterKey(newMasterKey)
+		wrapped, err := seal(newKey, dataKey)
+		if err != nil {
+			return fmt.Errorf("failed to wrap data key: %w", err)
+		}
+
+		if err := tx.Model(&dataKeyRecord).Updates(map[string]any{
+			"wrapped_key":   wrapped,
+			"master_key_id": fingerprint(newKey),
+		}).Error; err != nil {
+			return fmt.Errorf("failed to save re-wrapped data key: %w", err)
+		}
+
+		s.masterKey = newKey
+		return nil
+	})
+}
+
+// encryptedColumn is a column encrypted with the data key, with the key hash column derived from it.
+type encryptedColumn struct {
+	table      string
+	column     string
+	hashColumn string
+}
+
+// encryptedColumns lists every column written through the encrypted serializer.
+var encryptedColumns = []encryptedColumn{
+	{table: "api_keys", column: "key_value", hashColumn: "key_hash"},
+	{table: "request_logs", column: "key_value", hashColumn: "key_hash"},
+	{table: "alert_channels", column: "url"},
+	{table: "alert_channels", column: "secret"},
+}
+
+// RotateDataKey replaces the data key with a new one and re-encrypts every encrypted column and
+// recomputes the key hashes in a single transaction, so values encrypted with the old data key
+// are no longer used. Other nodes keep the old data key in memory, so they must be stopped first.
+// It returns the number of values re-encrypted.
+func (s *Service) RotateDataKey(db *gorm.DB) (int64, error) {
+	if !s.IsEnabled() {
+		return 0, fmt.Errorf("encryption is not enabled, configure ENCRYPTION_KEY first")
+	}
+	if s.aead == nil {
+		return 0, ErrNotInitialized
+	}
+
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return 0, fmt.Errorf("failed to generate data key: %w", err)
+	}
+	next := &Service{masterKey: s.masterKey}
+	if err := next.setDataKey(dataKey); err != nil {
+		return 0, err
+	}
+	wrapped, err := seal(s.masterKey, dataKey)
+	if err != nil {
+		return 0, fmt.Errorf("failed to wrap data key: %w", err)
+	}
+
+	var total int64
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for _, col := range encryptedColumns {
+			if !tx.Migrator().HasTable(col.table) {
+				continue
+			}
+			count, err := s.reencryptColumn(tx, next, col)
+			if err != nil {
+				return err
+			}
+			total += count
+		}
+
+		if err := tx.Where("1 = 1").Delete(&models.DataKey{}).Error; err != nil {
+			return fmt.Errorf("failed to delete the old data key: %w", err)
+		}
+		if err := tx.Create(&models.DataKey{WrappedKey: wrapped, MasterKeyID: fingerprint(s.masterKey)}).Error; err != nil {
+			return fmt.Errorf("failed to save data key: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	s.aead, s.hashKey = next.aead, next.hashKey
+	return total, nil
+}
+
+// reencryptColumn decrypts the values of a column with the current data key and encrypts them with next.
+// Plaintext values written before encryption was enabled are encrypted as well.
+func (s *Service) reencryptColumn(tx *gorm.DB, next *Service, col encryptedColumn) (int64, error) {
+	type encryptedRow struct {
+		ID    string
+		Value string
+	}
+
+	var total int64
+	// 行数在事务内不变，按 id 排序分页即可遍历所有行
+	for offset := 0; ; offset += 1000 {
+		var rows []encryptedRow
+		if err := tx.Table(col.table).
+			Select(fmt.Sprintf("id, %s AS value", col.column)).
+			Where(fmt.Sprintf("%s IS NOT NULL AND %s <> ''", col.column, col.column)).
+			Order("id").
+			Limit(1000).
+			Offset(offset).
+			Find(&rows).Error; err != nil {
+			return total, fmt.Errorf("failed to load %s.%s: %w", col.table, col.column, err)
+		}
+		if len(rows) == 0 {
+			return total, nil
+		}
+
+		for _, row := range rows {
+			plaintext, err := s.Decrypt(row.Value)
+			if err != nil {
+				return total, fmt.Errorf("failed to decrypt row %s of %s: %w", row.ID, col.table, err)
+			}
+			ciphertext, err := next.Encrypt(plaintext)
+			if err != nil {
+				return total, err
+			}
+			updates := map[string]any{col.column: ciphertext}
+			if col.hashColumn != "" {
+				updates[col.hashColumn] = next.Hash(plaintext)
+			}
+			if err := tx.Table(col.table).Where("id = ?", row.ID).Updates(updates).Error; err != nil {
+				return total, fmt.Errorf("failed to re-encrypt row %s of %s: %w", row.ID, col.table, err)
+			}
+		}
+		total += int64(len(rows))
+	}
+}
+
+// Encrypt encrypts a value. When encryption is disabled the value is returned unchanged.
+func (s *Service) Encrypt(plaintext string) (string, error) {
+	if !s.IsEnabled() || plaintext == "" {
+		return plaintext, nil
+	}
+	if s.aead == nil {
+		return "", ErrNotInitialized
+	}
+
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := s.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return ciphertextPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt decrypts a value produced by Encrypt. Values without the ciphertext prefix are
+// returned unchanged, so rows written before encryption was enabled remain readable.
+func (s *Service) Decrypt(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	if !s.IsEnabled() {
+		return "", fmt.Errorf("cannot decrypt value, ENCRYPTION_KEY is not configured")
+	}
+	if s.aead == nil {
+		return "", ErrNotInitialized
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, ciphertextPrefix))
+	if err != nil {
+		return "", fmt.Errorf("failed to decode ciphertext: %w", err)
+	}
+	nonceSize := s.aead.NonceSize()
+	if len(sealed) < nonceSize {
+		return "", fmt.Errorf("ciphertext is too short")
+	}
+
+	plaintext, err := s.aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt value: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// Hash returns the deduplication hash of a key value.
+// With encryption enabled it is an HMAC keyed by the data key, otherwise a plain SHA-256.
+func (s *Service) Hash(value string) string {
+	if s.hashKey == nil {
+		sum := sha256.Sum256([]byte(value))
+		return hex.EncodeToString(sum[:])
+	}
+	mac := hmac.New(sha256.New, s.hashKey)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// IsEncrypted reports whether a value was produced by Encrypt.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, ciphertextPrefix)
+}
+
+// fieldSerializer encrypts and decrypts columns tagged with serializer:encrypted.
+// GORM copies serializers by value, so it only holds a pointer to the service.
+type fieldSerializer struct {
+	service *Service
+}
+
+// Scan implements schema.SerializerInterface, decrypting the column value.
+func (f fieldSerializer) Scan(ctx context.Context, field *schema.Field, dst reflect.Value, dbValue any) error {
+	var value string
+	switch v := dbValue.(type) {
+	case nil:
+	case []byte:
+		value = string(v)
+	case string:
+		value = v
+	default:
+		return fmt.Errorf("unsupported type %T for encrypted field %s", dbValue, field.Name)
+	}
+
+	plaintext, err := f.service.Decrypt(value)
+	if err != nil {
+		return err
+	}
+	field.ReflectValueOf(ctx, dst).SetString(plaintext)
+	return nil
+}
+
+// Value implements schema.SerializerValuerInterface, encrypting the field value.
+func (f fieldSerializer) Value(ctx context.Context, field *schema.Field, dst reflect.Value, fieldValue any) (any, error) {
+	plaintext, ok := fieldValue.(string)
+	if !ok {
+		return nil, fmt.Errorf("unsupported type %T for encrypted field %s", fieldValue, field.Name)
+	}
+	return f.service.Encrypt(plaintext)
+}
+
+// createDataKey generates a new data key and stores it wrapped by the master key.
+func (s *Service) createDataKey(db *gorm.DB) error {
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return fmt.Errorf("failed to generate data key: %w", err)
+	}
+
+	wrapped, err := seal(s.masterKey, dataKey)
+	if err != nil {
+		return fmt.Errorf("failed to wrap data key: %w", err)
+	}
+
+	if err := db.Create(&models.DataKey{WrappedKey: wrapped, MasterKeyID: fingerprint(s.masterKey)}).Error; err != nil {
+		return fmt.Errorf("failed to save data key: %w", err)
+	}
+	return s.setDataKey(dataKey)
+}
+
+// setDataKey prepares the cipher and hash key derived from the data key.
+func (s *Service) setDataKey(dataKey []byte) error {
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return err
+	}
+
+	mac := hmac.New(sha256.New, dataKey)
+	mac.Write([]byte("gpt-load key hash"))
+
+	s.aead = aead
+	s.hashKey = mac.Sum(nil)
+	return nil
+}
+
+// unwrapDataKey decrypts a stored data key with the master key.
+func unwrapDataKey(masterKey []byte, record models.DataKey) ([]byte, error) {
+	if record.MasterKeyID != fingerprint(masterKey) {
+		return nil, fmt.Errorf("ENCRYPTION_KEY does not match the master key used to wrap the data key (expected fingerprint %s)", record.MasterKeyID)
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(record.WrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode wrapped data key: %w", err)
+	}
+	aead, err := newAEAD(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	nonceSize := aead.NonceSize()
+	if len(sealed) < nonceSize {
+		return nil, fmt.Errorf("wrapped data key is too short")
+	}
+
+	dataKey, err := aead.Open(nil, sealed[:nonceSize], sealed[nonceSize:], nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+	return dataKey, nil
+}
+
+// seal encrypts data with AES-GCM and returns base64(nonce || ciphertext).
+func seal(key, data []byte) (string, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, data, nil)), nil
+}
+
+// newAEAD creates an AES-GCM cipher for a 32-byte key.
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+	return aead, nil
+}
+
+// deriveMasterKey turns the configured master key into a 32-byte AES key.
+func deriveMasterKey(masterKey string) []byte {
+	sum := sha256.Sum256([]byte(masterKey))
+	return sum[:]
+}
+
+// fingerprint identifies a master key without revealing it.
+func fingerprint(masterKey []byte) string {
+	sum := sha256.Sum256(append([]byte("gpt-load master key:"), masterKey...))
+	return hex.EncodeToString(sum[:8])
+}
+
+// EncryptExistingKeys encrypts key values stored before encryption was enabled and
+// recomputes their hashes. It returns the number of keys updated.
+func (s *Service) EncryptExistingKeys(db *gorm.DB) (int64, error) {
+	return s.encryptTable(db, "api_keys")
+}
+
+// EncryptExistingLogs encrypts the key values of request logs written before encryption was enabled.
+func (s *Service) EncryptExistingLogs(db *gorm.DB) (int64, error) {
+	return s.encryptTable(db, "request_logs")
+}
+
+// encryptTable encrypts the plaintext key_value column of a table in batches.
+func (s *Service) encryptTable(db *gorm.DB, table string) (int64, error) {
+	if !s.IsEnabled() {
+		return 0, nil
+	}
+	if s.aead == nil {
+		return 0, ErrNotInitialized
+	}
+
+	type plaintextRow struct {
+		ID       string
+		KeyValue string
+	}
+
+	var total int64
+	for {
+		var rows []plaintextRow
+		if err := db.Table(table).
+			Select("id, key_value").
+			Where("key_value <> '' AND key_value NOT LIKE ?", ciphertextPrefix+"%").
+			Limit(1000).
+			Find(&rows).Error; err != nil {
+			return total, fmt.Errorf("failed to load plaintext rows from %s: %w", table, err)
+		}
+		if len(rows) == 0 {
+			return total, nil
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			for _, row := range rows {
+				ciphertext, err := s.Encrypt(row.KeyValue)
+				if err != nil {
+					return err
+				}
+				if err := tx.Table(table).Where("id = ?", row.ID).Updates(map[string]any{
+					"key_value": ciphertext,
+					"key_hash":  s.Hash(row.KeyValue),
+				}).Error; err != nil {
+					return fmt.Errorf("failed to encrypt row %s of %s: %w", row.ID, table, err)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return total, err
+		}
+		total += int64(len(rows))
+	}
+}
@@ -0,0 +1,214 @@
+package encryption
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gpt-load/internal/models"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// newTestService returns a service with a random data key.
+func newTestService(t *testing.T) *Service {
+	t.Helper()
+	s := &Service{masterKey: deriveMasterKey("test-master-key")}
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.setDataKey(dataKey); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestEncryptDecryptRoundTrip(t *testing.T) {
+	s := newTestService(t)
+
+	first, err := s.Encrypt("sk-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := s.Encrypt("sk-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsEncrypted(first) || strings.Contains(first, "sk-secret") {
+		t.Fatalf("ciphertext = %q, want an encrypted value", first)
+	}
+	if first == second {
+		t.Error("encrypting twice should use different nonces")
+	}
+
+	for _, ciphertext := range []string{first, second} {
+		plaintext, err := s.Decrypt(ciphertext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if plaintext != "sk-secret" {
+			t.Errorf("Decrypt = %q, want sk-secret", plaintext)
+		}
+	}
+
+	if plaintext, err := s.Decrypt("sk-plain"); err != nil || plaintext != "sk-plain" {
+		t.Errorf("plaintext values should be returned unchanged, got %q, %v", plaintext, err)
+	}
+}
+
+func TestDecryptRejectsTamperedValues(t *testing.T) {
+	s := newTestService(t)
+	ciphertext, err := s.Encrypt("sk-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(ciphertext, ciphertextPrefix))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flipped := append([]byte(nil), sealed...)
+	flipped[len(flipped)-1] ^= 0x01
+	truncated := sealed[:s.aead.NonceSize()-1]
+
+	tests := map[string]string{
+		"flipped byte":   ciphertextPrefix + base64.StdEncoding.EncodeToString(flipped),
+		"truncated":      ciphertextPrefix + base64.StdEncoding.EncodeToString(truncated),
+		"invalid base64": ciphertextPrefix + "not base64!",
+	}
+	for name, value := range tests {
+		if _, err := s.Decrypt(value); err == nil {
+			t.Errorf("%s: expected Decrypt to fail", name)
+		}
+	}
+
+	if _, err := newTestService(t).Decrypt(ciphertext); err == nil {
+		t.Error("a value encrypted with another data key should not decrypt")
+	}
+}
+
+func TestHash(t *testing.T) {
+	s := newTestService(t)
+	if s.Hash("sk-secret") != s.Hash("sk-secret") {
+		t.Error("the hash should be deterministic")
+	}
+	if s.Hash("sk-secret") == s.Hash("sk-other") {
+		t.Error("different values should have different hashes")
+	}
+	if s.Hash("sk-secret") == (&Service{}).Hash("sk-secret") {
+		t.Error("the keyed hash should differ from the plain SHA-256")
+	}
+	if s.Hash("sk-secret") == newTestService(t).Hash("sk-secret") {
+		t.Error("the hash should depend on the data key")
+	}
+}
+
+func TestUnwrapDataKey(t *testing.T) {
+	masterKey := deriveMasterKey("test-master-key")
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		t.Fatal(err)
+	}
+	wrapped, err := seal(masterKey, dataKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := models.DataKey{WrappedKey: wrapped, MasterKeyID: fingerprint(masterKey)}
+
+	unwrapped, err := unwrapDataKey(masterKey, record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(unwrapped) != string(dataKey) {
+		t.Error("the unwrapped data key differs from the original")
+	}
+
+	if _, err := unwrapDataKey(deriveMasterKey("other-master-key"), record); err == nil {
+		t.Error("a different master key should be rejected")
+	}
+
+	tampered := record
+	sealed, _ := base64.StdEncoding.DecodeString(wrapped)
+	sealed[len(sealed)-1] ^= 0x01
+	tampered.WrappedKey = base64.StdEncoding.EncodeToString(sealed)
+	if _, err := unwrapDataKey(masterKey, tampered); err == nil {
+		t.Error("a tampered wrapped key should be rejected")
+	}
+}
+
+func TestRotateDataKey(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.DataKey{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Exec("CREATE TABLE api_keys (id integer PRIMARY KEY, key_value text, key_hash text)").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Service{masterKey: deriveMasterKey("test-master-key")}
+	if err := s.createDataKey(db); err != nil {
+		t.Fatal(err)
+	}
+	oldCiphertext, err := s.Encrypt("sk-encrypted")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldService := &Service{masterKey: s.masterKey, aead: s.aead, hashKey: s.hashKey}
+	if err := db.Exec("INSERT INTO api_keys (id, key_value, key_hash) VALUES (1, ?, ?), (2, ?, ?)",
+		oldCiphertext, s.Hash("sk-encrypted"), "sk-plain", s.Hash("sk-plain")).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	count, err := s.RotateDataKey(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("re-encrypted %d values, want 2", count)
+	}
+
+	var rows []struct {
+		ID       uint
+		KeyValue string
+		KeyHash  string
+	}
+	if err := db.Table("api_keys").Order("id").Find(&rows).Error; err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []string{"sk-encrypted", "sk-plain"} {
+		if !IsEncrypted(rows[i].KeyValue) {
+			t.Errorf("row %d is not encrypted: %q", rows[i].ID, rows[i].KeyValue)
+		}
+		plaintext, err := s.Decrypt(rows[i].KeyValue)
+		if err != nil || plaintext != want {
+			t.Errorf("row %d decrypts to %q, %v, want %q", rows[i].ID, plaintext, err, want)
+		}
+		if rows[i].KeyHash != s.Hash(want) {
+			t.Errorf("row %d hash was not recomputed", rows[i].ID)
+		}
+		if _, err := oldService.Decrypt(rows[i].KeyValue); err == nil {
+			t.Errorf("row %d still decrypts with the old data key", rows[i].ID)
+		}
+	}
+
+	// 重新加载数据密钥后仍可解密
+	reloaded := &Service{masterKey: s.masterKey}
+	if err := reloaded.Initialize(db, false); err != nil {
+		t.Fatal(err)
+	}
+	if plaintext, err := reloaded.Decrypt(rows[0].KeyValue); err != nil || plaintext != "sk-encrypted" {
+		t.Errorf("reloaded service decrypts to %q, %v", plaintext, err)
+	}
+	var dataKeys int64
+	db.Model(&models.DataKey{}).Count(&dataKeys)
+	if dataKeys != 1 {
+		t.Errorf("data keys = %d, want only the new one", dataKeys)
+	}
+}
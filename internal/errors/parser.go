@@ -2,6 +2,7 @@ package errors
 
 import (
 	"encoding/json"
+	"fmt"
 	"strings"
 )
 
@@ -32,6 +33,18 @@ type rootMessageErrorResponse struct {
 	Message string `json:"message"`
 }
 
+// UpstreamError carries the status code and parsed message of a failed upstream response.
+type UpstreamError struct {
+	StatusCode  int
+	Message     string
+	RuleInvalid bool // A validation response rule classified the response as invalid
+}
+
+// Error implements the error interface.
+func (e *UpstreamError) Error() string {
+	return fmt.Sprintf("[status %d] %s", e.StatusCode, e.Message)
+}
+
 // ParseUpstreamError attempts to parse a structured error message from an upstream response body
 func ParseUpstreamError(body []byte) string {
 	// 1. Attempt to parse the standard OpenAI/Gemini format.
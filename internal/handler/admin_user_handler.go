@@ -0,0 +1,308 @@
+package handler
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"gpt-load/internal/auth"
+	app_errors "gpt-load/internal/errors"
+	"gpt-load/internal/response"
+	"gpt-load/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// CreateTokenRequest defines the payload for creating an API token.
+type CreateTokenRequest struct {
+	Name      string     `json:"name" binding:"required"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// CurrentUserResponse describes the authenticated caller.
+type CurrentUserResponse struct {
+	*auth.Principal
+	Permissions []auth.Permission `json:"permissions"`
+}
+
+// accessibleGroupsScope restricts a query on a table with a group_id column to the groups of a maintainer.
+func accessibleGroupsScope(c *gin.Context) func(*gorm.DB) *gorm.DB {
+	return groupScope(c, "group_id")
+}
+
+// accessibleGroupsScopeByID restricts a query on the groups table to the groups of a maintainer.
+func accessibleGroupsScopeByID(c *gin.Context) func(*gorm.DB) *gorm.DB {
+	return groupScope(c, "id")
+}
+
+func groupScope(c *gin.Context, column string) func(*gorm.DB) *gorm.DB {
+	principal := auth.GetPrincipal(c)
+	return func(db *gorm.DB) *gorm.DB {
+		if !principal.IsGroupScoped() {
+			return db
+		}
+		return db.Where(column+" IN ?", principal.GroupIDs)
+	}
+}
+
+// parseIDParam parses a positive numeric path parameter.
+func parseIDParam(c *gin.Context, name string) (uint, bool) {
+	id, err := strconv.Atoi(c.Param(name))
+	if err != nil || id <= 0 {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrBadRequest, "Invalid ID format"))
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// adminUserError converts an admin user service error into an API error.
+func adminUserError(c *gin.Context, err error) {
+	if errors.Is(err, services.ErrInvalidAdminUser) {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
+		return
+	}
+	response.Error(c, app_errors.ParseDBError(err))
+}
+
+// GetCurrentUser returns the authenticated caller and its permissions.
+func (s *Server) GetCurrentUser(c *gin.Context) {
+	principal := auth.GetPrincipal(c)
+	response.Success(c, CurrentUserResponse{
+		Principal:   principal,
+		Permissions: principal.Permissions(),
+	})
+}
+
+// ListOwnTokens lists the API tokens of the authenticated user.
+func (s *Server) ListOwnTokens(c *gin.Context) {
+	principal, ok := requireUserPrincipal(c)
+	if !ok {
+		return
+	}
+	s.listTokens(c, principal.UserID)
+}
+
+// CreateOwnToken creates an API token for the authenticated user.
+func (s *Server) CreateOwnToken(c *gin.Context) {
+	principal, ok := requireUserPrincipal(c)
+	if !ok {
+		return
+	}
+	s.createToken(c, principal.UserID)
+}
+
+// DeleteOwnToken revokes an API token of the authenticated user.
+func (s *Server) DeleteOwnToken(c *gin.Context) {
+	principal, ok := requireUserPrincipal(c)
+	if !ok {
+		return
+	}
+	tokenID, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+	s.deleteToken(c, principal.UserID, tokenID)
+}
+
+// ListAdminUsers lists all admin users.
+func (s *Server) ListAdminUsers(c *gin.Context) {
+	users, err := s.AdminUserService.ListUsers()
+	if err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+	response.Success(c, users)
+}
+
+// CreateAdminUser creates an admin user.
+func (s *Server) CreateAdminUser(c *gin.Context) {
+	var req services.AdminUserInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrInvalidJSON, err.Error()))
+		return
+	}
+
+	user, err := s.AdminUserService.CreateUser(req)
+	if err != nil {
+		adminUserError(c, err)
+		return
+	}
+	s.AuditService.Record(c, services.AuditEntry{
+		Action:     services.AuditUserCreate,
+		TargetType: services.AuditTargetUser,
+		TargetID:   user.ID,
+		TargetName: user.Username,
+		After:      auditUser(user),
+	})
+	response.Success(c, user)
+}
+
+// UpdateAdminUser updates an admin user.
+func (s *Server) UpdateAdminUser(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var req services.AdminUserInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrInvalidJSON, err.Error()))
+		return
+	}
+
+	before, err := s.AdminUserService.GetUser(id)
+	if err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+
+	user, err := s.AdminUserService.UpdateUser(id, req)
+	if err != nil {
+		adminUserError(c, err)
+		return
+	}
+	if req.Password != nil || !user.Enabled {
+		s.revokeUserSessions(id)
+	}
+	s.AuditService.Record(c, services.AuditEntry{
+		Action:     services.AuditUserUpdate,
+		TargetType: services.AuditTargetUser,
+		TargetID:   user.ID,
+		TargetName: user.Username,
+		Before:     auditUser(before),
+		After:      auditUser(user),
+		Details:    map[string]any{"password_changed": req.Password != nil},
+	})
+	response.Success(c, user)
+}
+
+// DeleteAdminUser deletes an admin user.
+func (s *Server) DeleteAdminUser(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	if principal := auth.GetPrincipal(c); !principal.IsRoot && principal.UserID == id {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, "You cannot delete your own account"))
+		return
+	}
+
+	before, err := s.AdminUserService.GetUser(id)
+	if err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+
+	if err := s.AdminUserService.DeleteUser(id); err != nil {
+		adminUserError(c, err)
+		return
+	}
+	s.revokeUserSessions(id)
+	s.AuditService.Record(c, services.AuditEntry{
+		Action:     services.AuditUserDelete,
+		TargetType: services.AuditTargetUser,
+		TargetID:   id,
+		TargetName: before.Username,
+		Before:     auditUser(before),
+	})
+	response.Success(c, gin.H{"message": "Admin user deleted successfully"})
+}
+
+// ListAdminUserTokens lists the API tokens of an admin user.
+func (s *Server) ListAdminUserTokens(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+	s.listTokens(c, id)
+}
+
+// CreateAdminUserToken creates an API token for an admin user.
+func (s *Server) CreateAdminUserToken(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+	if _, err := s.AdminUserService.GetUser(id); err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+	s.createToken(c, id)
+}
+
+// DeleteAdminUserToken revokes an API token of an admin user.
+func (s *Server) DeleteAdminUserToken(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+	tokenID, ok := parseIDParam(c, "token_id")
+	if !ok {
+		return
+	}
+	s.deleteToken(c, id, tokenID)
+}
+
+// requireUserPrincipal rejects callers that are not admin users, e.g. AUTH_KEY sessions.
+func requireUserPrincipal(c *gin.Context) (*auth.Principal, bool) {
+	principal := auth.GetPrincipal(c)
+	if principal.IsRoot || principal.UserID == 0 {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrBadRequest, "API tokens are only available to admin users"))
+		return nil, false
+	}
+	return principal, true
+}
+
+func (s *Server) listTokens(c *gin.Context, userID uint) {
+	tokens, err := s.AdminUserService.ListTokens(userID)
+	if err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+	response.Success(c, tokens)
+}
+
+func (s *Server) createToken(c *gin.Context, userID uint) {
+	var req CreateTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrInvalidJSON, err.Error()))
+		return
+	}
+
+	token, err := s.AdminUserService.CreateToken(userID, req.Name, req.ExpiresAt)
+	if err != nil {
+		adminUserError(c, err)
+		return
+	}
+	s.AuditService.Record(c, services.AuditEntry{
+		Action:     services.AuditTokenCreate,
+		TargetType: services.AuditTargetToken,
+		TargetID:   token.ID,
+		TargetName: token.Name,
+		Details:    map[string]any{"user_id": userID, "token_prefix": token.TokenPrefix, "expires_at": token.ExpiresAt},
+	})
+	response.Success(c, token)
+}
+
+func (s *Server) deleteToken(c *gin.Context, userID, tokenID uint) {
+	if err := s.AdminUserService.DeleteToken(userID, tokenID); err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+	s.AuditService.Record(c, services.AuditEntry{
+		Action:     services.AuditTokenDelete,
+		TargetType: services.AuditTargetToken,
+		TargetID:   tokenID,
+		Details:    map[string]any{"user_id": userID},
+	})
+	response.Success(c, gin.H{"message": "Token revoked successfully"})
+}
+
+func (s *Server) revokeUserSessions(userID uint) {
+	if err := s.SessionService.RevokeUserSessions(userID); err != nil {
+		logrus.WithError(err).Errorf("Failed to revoke sessions of admin user %d", userID)
+	}
+}
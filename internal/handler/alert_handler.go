@@ -0,0 +1,367 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"gpt-load/internal/alert"
+	"gpt-load/internal/auth"
+	app_errors "gpt-load/internal/errors"
+	"gpt-load/internal/models"
+	"gpt-load/internal/response"
+	"gpt-load/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/datatypes"
+)
+
+// AlertChannelRequest defines the payload for creating or updating an alert channel.
+// On update an empty URL keeps the stored one, and an omitted secret keeps the stored secret.
+type AlertChannelRequest struct {
+	Name       string   `json:"name"`
+	Type       string   `json:"type"`
+	URL        string   `json:"url"`
+	Secret     *string  `json:"secret"`
+	ChatID     string   `json:"chat_id"`
+	EventTypes []string `json:"event_types"`
+	GroupIDs   []uint   `json:"group_ids"`
+	Enabled    *bool    `json:"enabled"`
+}
+
+// AlertChannelResponse is an alert channel with its URL masked.
+type AlertChannelResponse struct {
+	models.AlertChannel
+	HasSecret bool `json:"has_secret"`
+}
+
+// AlertSilenceRequest defines the payload for creating an alert silence.
+type AlertSilenceRequest struct {
+	GroupID   uint       `json:"group_id"`
+	EventType string     `json:"event_type"`
+	StartsAt  *time.Time `json:"starts_at"`
+	EndsAt    time.Time  `json:"ends_at" binding:"required"`
+	Reason    string     `json:"reason"`
+}
+
+// maskAlertURL hides the path and query of a channel URL, which usually embed the bot token.
+func maskAlertURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return "******"
+	}
+	return u.Scheme + "://" + u.Host + "/******"
+}
+
+func newAlertChannelResponse(channel models.AlertChannel) AlertChannelResponse {
+	hasSecret := channel.Secret != ""
+	channel.URL = maskAlertURL(channel.URL)
+	return AlertChannelResponse{AlertChannel: channel, HasSecret: hasSecret}
+}
+
+// auditAlertChannel returns the audited fields of a channel, without the URL and secret.
+func auditAlertChannel(channel *models.AlertChannel) map[string]any {
+	return map[string]any{
+		"name":        channel.Name,
+		"type":        channel.Type,
+		"chat_id":     channel.ChatID,
+		"event_types": channel.EventTypes,
+		"group_ids":   channel.GroupIDs,
+		"enabled":     channel.Enabled,
+	}
+}
+
+// applyAlertChannelRequest validates the request and applies it to the channel.
+func applyAlertChannelRequest(channel *models.AlertChannel, req *AlertChannelRequest) error {
+	channel.Name = strings.TrimSpace(req.Name)
+	if channel.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+
+	channel.Type = req.Type
+	if !slices.Contains(alert.ChannelTypes, channel.Type) {
+		return fmt.Errorf("type must be one of: %s", strings.Join(alert.ChannelTypes, ", "))
+	}
+
+	if rawURL := strings.TrimSpace(req.URL); rawURL != "" {
+		channel.URL = rawURL
+	}
+	u, err := url.Parse(channel.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url must be a valid http or https URL")
+	}
+
+	if req.Secret != nil {
+		channel.Secret = strings.TrimSpace(*req.Secret)
+	}
+
+	channel.ChatID = strings.TrimSpace(req.ChatID)
+	if channel.Type == models.AlertChannelTelegram && channel.ChatID == "" {
+		return fmt.Errorf("chat_id is required for telegram channels")
+	}
+
+	for _, eventType := range req.EventTypes {
+		if !slices.Contains(alert.EventTypes, eventType) {
+			return fmt.Errorf("invalid event type %q, must be one of: %s", eventType, strings.Join(alert.EventTypes, ", "))
+		}
+	}
+	eventTypes, err := json.Marshal(nonNilSlice(req.EventTypes))
+	if err != nil {
+		return err
+	}
+	channel.EventTypes = datatypes.JSON(eventTypes)
+
+	groupIDs, err := json.Marshal(nonNilSlice(req.GroupIDs))
+	if err != nil {
+		return err
+	}
+	channel.GroupIDs = datatypes.JSON(groupIDs)
+
+	if req.Enabled != nil {
+		channel.Enabled = *req.Enabled
+	}
+	return nil
+}
+
+// nonNilSlice stores an empty list as [] rather than null.
+func nonNilSlice[T any](s []T) []T {
+	if s == nil {
+		return []T{}
+	}
+	return s
+}
+
+// ListAlertChannels lists all alert channels.
+func (s *Server) ListAlertChannels(c *gin.Context) {
+	var channels []models.AlertChannel
+	if err := s.DB.Order("id asc").Find(&channels).Error; err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+
+	result := make([]AlertChannelResponse, 0, len(channels))
+	for _, channel := range channels {
+		result = append(result, newAlertChannelResponse(channel))
+	}
+	response.Success(c, result)
+}
+
+// CreateAlertChannel creates an alert channel.
+func (s *Server) CreateAlertChannel(c *gin.Context) {
+	var req AlertChannelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrInvalidJSON, err.Error()))
+		return
+	}
+
+	channel := models.AlertChannel{Enabled: true}
+	if err := applyAlertChannelRequest(&channel, &req); err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
+		return
+	}
+
+	if err := s.DB.Create(&channel).Error; err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+	// Enabled 的数据库默认值为 true，显式关闭时需要单独更新
+	if !channel.Enabled {
+		if err := s.DB.Model(&channel).Update("enabled", false).Error; err != nil {
+			response.Error(c, app_errors.ParseDBError(err))
+			return
+		}
+	}
+
+	s.AuditService.Record(c, services.AuditEntry{
+		Action:     services.AuditAlertChannelCreate,
+		TargetType: services.AuditTargetAlertChannel,
+		TargetID:   channel.ID,
+		TargetName: channel.Name,
+		After:      auditAlertChannel(&channel),
+	})
+	response.Success(c, newAlertChannelResponse(channel))
+}
+
+// UpdateAlertChannel updates an alert channel.
+func (s *Server) UpdateAlertChannel(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var req AlertChannelRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrInvalidJSON, err.Error()))
+		return
+	}
+
+	var channel models.AlertChannel
+	if err := s.DB.First(&channel, id).Error; err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+	before := auditAlertChannel(&channel)
+	urlChanged := req.URL != ""
+
+	if err := applyAlertChannelRequest(&channel, &req); err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
+		return
+	}
+
+	if err := s.DB.Save(&channel).Error; err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+
+	s.AuditService.Record(c, services.AuditEntry{
+		Action:     services.AuditAlertChannelUpdate,
+		TargetType: services.AuditTargetAlertChannel,
+		TargetID:   channel.ID,
+		TargetName: channel.Name,
+		Before:     before,
+		After:      auditAlertChannel(&channel),
+		Details:    map[string]any{"url_changed": urlChanged, "secret_changed": req.Secret != nil},
+	})
+	response.Success(c, newAlertChannelResponse(channel))
+}
+
+// DeleteAlertChannel deletes an alert channel.
+func (s *Server) DeleteAlertChannel(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var channel models.AlertChannel
+	if err := s.DB.First(&channel, id).Error; err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+	if err := s.DB.Delete(&channel).Error; err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+
+	s.AuditService.Record(c, services.AuditEntry{
+		Action:     services.AuditAlertChannelDelete,
+		TargetType: services.AuditTargetAlertChannel,
+		TargetID:   channel.ID,
+		TargetName: channel.Name,
+		Before:     auditAlertChannel(&channel),
+	})
+	response.Success(c, nil)
+}
+
+// TestAlertChannel sends a test alert to a channel and reports the delivery result.
+func (s *Server) TestAlertChannel(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var channel models.AlertChannel
+	if err := s.DB.First(&channel, id).Error; err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+
+	if err := s.AlertService.SendTest(&channel); err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrBadGateway, err.Error()))
+		return
+	}
+	response.Success(c, nil)
+}
+
+// ListAlertSilences lists alert silences that have not ended yet.
+func (s *Server) ListAlertSilences(c *gin.Context) {
+	var silences []models.AlertSilence
+	query := s.DB.Order("starts_at asc")
+	if c.Query("include_expired") != "true" {
+		query = query.Where("ends_at > ?", time.Now())
+	}
+	if err := query.Find(&silences).Error; err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+	response.Success(c, silences)
+}
+
+// CreateAlertSilence creates an alert silence.
+func (s *Server) CreateAlertSilence(c *gin.Context) {
+	var req AlertSilenceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrInvalidJSON, err.Error()))
+		return
+	}
+
+	startsAt := time.Now()
+	if req.StartsAt != nil {
+		startsAt = *req.StartsAt
+	}
+	if !req.EndsAt.After(startsAt) {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, "ends_at must be after starts_at"))
+		return
+	}
+	if req.EventType != "" && !slices.Contains(alert.EventTypes, req.EventType) {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation,
+			fmt.Sprintf("event_type must be one of: %s", strings.Join(alert.EventTypes, ", "))))
+		return
+	}
+	if req.GroupID != 0 {
+		var group models.Group
+		if err := s.DB.Select("id").First(&group, req.GroupID).Error; err != nil {
+			response.Error(c, app_errors.ParseDBError(err))
+			return
+		}
+	}
+
+	silence := models.AlertSilence{
+		GroupID:   req.GroupID,
+		EventType: req.EventType,
+		StartsAt:  startsAt,
+		EndsAt:    req.EndsAt,
+		Reason:    strings.TrimSpace(req.Reason),
+		CreatedBy: auth.GetPrincipal(c).Username,
+	}
+	if err := s.DB.Create(&silence).Error; err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+
+	s.AuditService.Record(c, services.AuditEntry{
+		Action:     services.AuditAlertSilenceCreate,
+		TargetType: services.AuditTargetAlertSilence,
+		TargetID:   silence.ID,
+		After:      silence,
+	})
+	response.Success(c, silence)
+}
+
+// DeleteAlertSilence deletes an alert silence, ending it early.
+func (s *Server) DeleteAlertSilence(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var silence models.AlertSilence
+	if err := s.DB.First(&silence, id).Error; err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+	if err := s.DB.Delete(&silence).Error; err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+
+	s.AuditService.Record(c, services.AuditEntry{
+		Action:     services.AuditAlertSilenceDelete,
+		TargetType: services.AuditTargetAlertSilence,
+		TargetID:   silence.ID,
+		Before:     silence,
+	})
+	response.Success(c, nil)
+}
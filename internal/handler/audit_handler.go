@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"encoding/json"
+
+	app_errors "gpt-load/internal/errors"
+	"gpt-load/internal/models"
+	"gpt-load/internal/response"
+	"gpt-load/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// keyCountSnapshot is the audit snapshot of key operations, the number of keys per status.
+type keyCountSnapshot struct {
+	ActiveKeys  int64 `json:"active_keys"`
+	InvalidKeys int64 `json:"invalid_keys"`
+}
+
+// GetAuditLogs handles fetching the audit log with filtering and pagination.
+func (s *Server) GetAuditLogs(c *gin.Context) {
+	query := s.AuditService.GetAuditLogsQuery(c).Order("created_at desc, id desc")
+
+	var logs []models.AuditLog
+	pagination, err := response.Paginate(c, query, &logs)
+	if err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+
+	pagination.Items = logs
+	response.Success(c, pagination)
+}
+
+// keyCounts returns the key counts of a group or key pool for the audit log of key operations.
+func (s *Server) keyCounts(owner models.KeyOwner) *keyCountSnapshot {
+	var rows []struct {
+		Status string
+		Count  int64
+	}
+	if err := s.DB.Model(&models.APIKey{}).Select("status, COUNT(*) as count").
+		Scopes(owner.Scope).Group("status").Scan(&rows).Error; err != nil {
+		logrus.WithError(err).Warnf("Failed to count keys of %s for audit log", owner)
+		return nil
+	}
+
+	counts := &keyCountSnapshot{}
+	for _, row := range rows {
+		switch row.Status {
+		case models.KeyStatusActive:
+			counts.ActiveKeys = row.Count
+		case models.KeyStatusInvalid:
+			counts.InvalidKeys = row.Count
+		}
+	}
+	return counts
+}
+
+// auditKeys records a key operation on a group with the key counts before and after it.
+func (s *Server) auditKeys(c *gin.Context, action string, group *models.Group, before *keyCountSnapshot, details map[string]any) {
+	s.AuditService.Record(c, services.AuditEntry{
+		Action:     action,
+		TargetType: services.AuditTargetGroup,
+		TargetID:   group.ID,
+		TargetName: group.Name,
+		Before:     before,
+		After:      s.keyCounts(group.KeyOwner()),
+		Details:    details,
+	})
+}
+
+// settingsAuditSnapshot returns the current values of the given settings. Proxy keys are masked.
+func (s *Server) settingsAuditSnapshot(keys map[string]any) map[string]any {
+	current := s.SettingsManager.GetSettings()
+	data, err := json.Marshal(current)
+	if err != nil {
+		return nil
+	}
+	var all map[string]any
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil
+	}
+
+	snapshot := make(map[string]any, len(keys))
+	for key := range keys {
+		if value, ok := all[key]; ok {
+			snapshot[key] = value
+		}
+	}
+	return maskSettingsSnapshot(snapshot)
+}
+
+// maskSettingsSnapshot returns a copy of a settings snapshot with proxy keys masked.
+func maskSettingsSnapshot(settings map[string]any) map[string]any {
+	snapshot := make(map[string]any, len(settings))
+	for key, value := range settings {
+		snapshot[key] = value
+	}
+	if proxyKeys, ok := snapshot["proxy_keys"].(string); ok {
+		snapshot["proxy_keys"] = services.MaskProxyKeys(proxyKeys)
+	}
+	return snapshot
+}
+
+// auditUser is the audit snapshot of an admin user, which never contains credentials.
+func auditUser(user *services.AdminUserInfo) map[string]any {
+	if user == nil {
+		return nil
+	}
+	return map[string]any{
+		"username":  user.Username,
+		"role":      user.Role,
+		"enabled":   user.Enabled,
+		"group_ids": user.GroupIDs,
+	}
+}
@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	app_errors "gpt-load/internal/errors"
+	"gpt-load/internal/response"
+	"gpt-load/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// ExportBackup streams a backup of the database, gzip compressed unless gzip=false.
+func (s *Server) ExportBackup(c *gin.Context) {
+	opts := services.BackupOptions{IncludeLogs: c.Query("include_logs") == "true"}
+	compress := c.Query("gzip") != "false"
+
+	filename := fmt.Sprintf("gpt-load-backup-%s.jsonl", time.Now().Format("20060102150405"))
+	contentType := "application/x-ndjson"
+	if compress {
+		filename += ".gz"
+		contentType = "application/gzip"
+	}
+	c.Header("Content-Disposition", "attachment; filename="+filename)
+	c.Header("Content-Type", contentType)
+
+	var w io.Writer = c.Writer
+	var gz *gzip.Writer
+	if compress {
+		gz = gzip.NewWriter(c.Writer)
+		w = gz
+	}
+
+	// 数据已开始写出，失败时只能记录日志，缺少结尾记录的文件在恢复时会被拒绝
+	summary, err := s.BackupService.Export(w, opts)
+	if err == nil && gz != nil {
+		err = gz.Close()
+	}
+	if err != nil {
+		logrus.WithError(err).Error("Failed to export backup")
+		return
+	}
+
+	s.AuditService.Record(c, services.AuditEntry{
+		Action:     services.AuditBackupExport,
+		TargetType: services.AuditTargetBackup,
+		TargetName: filename,
+		Details:    map[string]any{"include_logs": opts.IncludeLogs, "counts": summary.Counts},
+	})
+}
+
+// RestoreBackup restores a backup uploaded as the request body or as the "file" field of a multipart form.
+// A database that already has data is only replaced with force=true.
+func (s *Server) RestoreBackup(c *gin.Context) {
+	var body io.Reader = c.Request.Body
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		fileHeader, err := c.FormFile("file")
+		if err != nil {
+			response.Error(c, app_errors.NewAPIError(app_errors.ErrBadRequest, "missing backup file"))
+			return
+		}
+		file, err := fileHeader.Open()
+		if err != nil {
+			response.Error(c, app_errors.NewAPIError(app_errors.ErrBadRequest, err.Error()))
+			return
+		}
+		defer file.Close()
+		body = file
+	}
+
+	result, err := s.BackupService.Restore(body, services.RestoreOptions{Force: c.Query("force") == "true"})
+	if err != nil {
+		if errors.Is(err, services.ErrBackupTargetNotEmpty) {
+			response.Error(c, app_errors.NewAPIError(app_errors.ErrDuplicateResource, err.Error()+", use force=true to replace it"))
+			return
+		}
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
+		return
+	}
+
+	if err := s.ReloadRestoredData(); err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrInternalServer, err.Error()))
+		return
+	}
+
+	s.AuditService.Record(c, services.AuditEntry{
+		Action:     services.AuditBackupRestore,
+		TargetType: services.AuditTargetBackup,
+		TargetName: result.Header.CreatedAt.Format(time.RFC3339),
+		Details:    map[string]any{"source": result.Header.Source, "counts": result.Counts, "passed": result.Passed()},
+	})
+	response.Success(c, result)
+}
+
+// ReloadRestoredData reloads the settings, groups and key pool after the database was replaced by a restore.
+func (s *Server) ReloadRestoredData() error {
+	if err := s.SettingsManager.Reload(); err != nil {
+		return fmt.Errorf("failed to reload settings: %w", err)
+	}
+	if err := s.GroupManager.Invalidate(); err != nil {
+		return fmt.Errorf("failed to reload groups: %w", err)
+	}
+	if err := s.KeyService.KeyProvider.RebuildStore(); err != nil {
+		return fmt.Errorf("failed to rebuild the key pool: %w", err)
+	}
+	return nil
+}
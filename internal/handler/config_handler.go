@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"gpt-load/internal/auth"
+	app_errors "gpt-load/internal/errors"
+	"gpt-load/internal/response"
+	"gpt-load/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxConfigDocumentSize limits the size of an applied config document.
+const maxConfigDocumentSize = 64 << 20
+
+// ExportConfigDocument handles downloading the config document of the settings and groups.
+func (s *Server) ExportConfigDocument(c *gin.Context) {
+	format := c.DefaultQuery("format", "yaml")
+	if format != "yaml" && format != "json" {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, "format must be yaml or json"))
+		return
+	}
+
+	includeKeys := c.Query("include_keys") == "true"
+	if includeKeys && !auth.GetPrincipal(c).Can(auth.PermissionRevealKeys) {
+		response.Error(c, app_errors.ErrForbidden)
+		return
+	}
+
+	doc, err := s.ConfigService.Export(includeKeys)
+	if err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+	data, err := services.MarshalConfigDocument(doc, format)
+	if err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrInternalServer, err.Error()))
+		return
+	}
+
+	contentType := "application/yaml; charset=utf-8"
+	if format == "json" {
+		contentType = "application/json; charset=utf-8"
+	}
+	filename := fmt.Sprintf("gpt-load-config-%s.%s", time.Now().Format("20060102150405"), format)
+	c.Header("Content-Disposition", "attachment; filename="+filename)
+	c.Data(http.StatusOK, contentType, data)
+}
+
+// ApplyConfigDocument handles applying a YAML or JSON config document from the request body.
+// With dry_run=true it only returns the changes that would be made.
+func (s *Server) ApplyConfigDocument(c *gin.Context) {
+	data, err := io.ReadAll(io.LimitReader(c.Request.Body, maxConfigDocumentSize+1))
+	if err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrBadRequest, err.Error()))
+		return
+	}
+	if len(data) > maxConfigDocumentSize {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrBadRequest, "config document is too large"))
+		return
+	}
+
+	doc, err := services.ParseConfigDocument(data)
+	if err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
+		return
+	}
+
+	opts := services.ConfigApplyOptions{
+		DryRun:      c.Query("dry_run") == "true",
+		IncludeKeys: c.Query("include_keys") == "true",
+		Prune:       c.Query("prune") == "true",
+		Actor:       groupVersionActor(c),
+	}
+	if opts.IncludeKeys && !auth.GetPrincipal(c).Can(auth.PermissionWriteKeys) {
+		response.Error(c, app_errors.ErrForbidden)
+		return
+	}
+
+	plan, err := s.ConfigService.Apply(doc, opts)
+	if err != nil {
+		configError(c, err)
+		return
+	}
+
+	if !opts.DryRun && len(plan.Changes) > 0 {
+		s.AuditService.Record(c, plan.AuditEntry())
+	}
+	response.Success(c, plan)
+}
+
+// configError converts a config service error into an API error.
+func configError(c *gin.Context, err error) {
+	if errors.Is(err, services.ErrInvalidConfigDocument) {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
+		return
+	}
+	response.Error(c, app_errors.ParseDBError(err))
+}
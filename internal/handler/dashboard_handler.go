@@ -7,16 +7,19 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // Stats Get dashboard statistics
 func (s *Server) Stats(c *gin.Context) {
+	scope := accessibleGroupsScope(c)
+
 	var activeKeys, invalidKeys int64
-	s.DB.Model(&models.APIKey{}).Where("status = ?", models.KeyStatusActive).Count(&activeKeys)
-	s.DB.Model(&models.APIKey{}).Where("status = ?", models.KeyStatusInvalid).Count(&invalidKeys)
+	s.DB.Model(&models.APIKey{}).Scopes(scope).Where("status = ?", models.KeyStatusActive).Count(&activeKeys)
+	s.DB.Model(&models.APIKey{}).Scopes(scope).Where("status = ?", models.KeyStatusInvalid).Count(&invalidKeys)
 
 	now := time.Now()
-	rpmStats, err := s.getRPMStats(now)
+	rpmStats, err := s.getRPMStats(now, scope)
 	if err != nil {
 		response.Error(c, app_errors.NewAPIError(app_errors.ErrDatabase, "failed to get rpm stats"))
 		return
@@ -24,12 +27,12 @@ func (s *Server) Stats(c *gin.Context) {
 	twentyFourHoursAgo := now.Add(-24 * time.Hour)
 	fortyEightHoursAgo := now.Add(-48 * time.Hour)
 
-	currentPeriod, err := s.getHourlyStats(twentyFourHoursAgo, now)
+	currentPeriod, err := s.getHourlyStats(twentyFourHoursAgo, now, scope)
 	if err != nil {
 		response.Error(c, app_errors.NewAPIError(app_errors.ErrDatabase, "failed to get current period stats"))
 		return
 	}
-	previousPeriod, err := s.getHourlyStats(fortyEightHoursAgo, twentyFourHoursAgo)
+	previousPeriod, err := s.getHourlyStats(fortyEightHoursAgo, twentyFourHoursAgo, scope)
 	if err != nil {
 		response.Error(c, app_errors.NewAPIError(app_errors.ErrDatabase, "failed to get previous period stats"))
 		return
@@ -114,7 +117,7 @@ func (s *Server) Chart(c *gin.Context) {
 	startHour := endHour.Add(-23 * time.Hour)
 
 	var hourlyStats []models.GroupHourlyStat
-	query := s.DB.Where("time >= ? AND time < ?", startHour, endHour.Add(time.Hour))
+	query := s.DB.Scopes(accessibleGroupsScope(c)).Where("time >= ? AND time < ?", startHour, endHour.Add(time.Hour))
 	if groupID != "" {
 		query = query.Where("group_id = ?", groupID)
 	}
@@ -173,9 +176,9 @@ type hourlyStatResult struct {
 	TotalFailures int64
 }
 
-func (s *Server) getHourlyStats(startTime, endTime time.Time) (hourlyStatResult, error) {
+func (s *Server) getHourlyStats(startTime, endTime time.Time, scope func(*gorm.DB) *gorm.DB) (hourlyStatResult, error) {
 	var result hourlyStatResult
-	err := s.DB.Model(&models.GroupHourlyStat{}).
+	err := s.DB.Model(&models.GroupHourlyStat{}).Scopes(scope).
 		Select("sum(success_count) + sum(failure_count) as total_requests, sum(failure_count) as total_failures").
 		Where("time >= ? AND time < ?", startTime, endTime).
 		Scan(&result).Error
@@ -187,12 +190,12 @@ type rpmStatResult struct {
 	PreviousRequests int64
 }
 
-func (s *Server) getRPMStats(now time.Time) (models.StatCard, error) {
+func (s *Server) getRPMStats(now time.Time, scope func(*gorm.DB) *gorm.DB) (models.StatCard, error) {
 	tenMinutesAgo := now.Add(-10 * time.Minute)
 	twentyMinutesAgo := now.Add(-20 * time.Minute)
 
 	var result rpmStatResult
-	err := s.DB.Model(&models.RequestLog{}).
+	err := s.DB.Model(&models.RequestLog{}).Scopes(scope).
 		Select("count(case when timestamp >= ? then 1 end) as current_requests, count(case when timestamp >= ? and timestamp < ? then 1 end) as previous_requests", tenMinutesAgo, twentyMinutesAgo, tenMinutesAgo).
 		Where("timestamp >= ? AND request_type = ?", twentyMinutesAgo, models.RequestTypeFinal).
 		Scan(&result).Error
@@ -0,0 +1,71 @@
+package handler
+
+import (
+	app_errors "gpt-load/internal/errors"
+	"gpt-load/internal/models"
+	"gpt-load/internal/response"
+	"gpt-load/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// GroupAvailabilityRequest changes whether a group accepts proxy requests.
+// Omitted fields are left unchanged.
+type GroupAvailabilityRequest struct {
+	Enabled           *bool                     `json:"enabled"`
+	MaintenanceConfig *models.MaintenanceConfig `json:"maintenance_config"`
+}
+
+// UpdateGroupAvailability enables or disables a group and turns its maintenance mode on or off.
+// These are operational states, they are not part of the configuration versions of the group.
+func (s *Server) UpdateGroupAvailability(c *gin.Context) {
+	group, ok := s.findAccessibleGroup(c)
+	if !ok {
+		return
+	}
+
+	var req GroupAvailabilityRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrInvalidJSON, err.Error()))
+		return
+	}
+	if req.Enabled == nil && req.MaintenanceConfig == nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, "enabled or maintenance_config is required"))
+		return
+	}
+
+	before := services.GroupAvailabilitySnapshot(group)
+	updates := map[string]any{}
+	if req.Enabled != nil {
+		updates["enabled"] = *req.Enabled
+		group.Enabled = *req.Enabled
+	}
+	if req.MaintenanceConfig != nil {
+		maintenanceConfig, err := services.ValidateAndCleanMaintenanceConfig(req.MaintenanceConfig)
+		if err != nil {
+			response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
+			return
+		}
+		updates["maintenance_config"] = maintenanceConfig
+		group.MaintenanceConfig = maintenanceConfig
+	}
+
+	if err := s.DB.Model(&models.Group{}).Where("id = ?", group.ID).Updates(updates).Error; err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+	if err := s.GroupManager.Invalidate(); err != nil {
+		logrus.WithContext(c.Request.Context()).WithError(err).Error("failed to invalidate group cache")
+	}
+
+	s.AuditService.Record(c, services.AuditEntry{
+		Action:     services.AuditGroupAvailability,
+		TargetType: services.AuditTargetGroup,
+		TargetID:   group.ID,
+		TargetName: group.Name,
+		Before:     before,
+		After:      services.GroupAvailabilitySnapshot(group),
+	})
+	response.Success(c, s.newGroupResponse(group))
+}
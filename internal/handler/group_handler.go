@@ -4,16 +4,17 @@ package handler
 import (
 	"encoding/json"
 	"fmt"
-	"net/http"
 	"net/url"
 	"sync"
 
+	"gpt-load/internal/auth"
 	app_errors "gpt-load/internal/errors"
+	"gpt-load/internal/keypool"
 	"gpt-load/internal/models"
 	"gpt-load/internal/response"
+	"gpt-load/internal/services"
 	"gpt-load/internal/utils"
 	"reflect"
-	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -23,152 +24,26 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 	"gorm.io/datatypes"
+	"gorm.io/gorm"
 )
 
-// isValidChannelType checks if the channel type is valid by checking against the registered channels.
-func isValidChannelType(channelType string) bool {
-	channels := channel.GetChannels()
-	for _, t := range channels {
-		if t == channelType {
-			return true
-		}
-	}
-	return false
-}
-
-// UpstreamDefinition defines the structure for an upstream in the request.
-type UpstreamDefinition struct {
-	URL    string `json:"url"`
-	Weight int    `json:"weight"`
-}
-
-// validateAndCleanUpstreams validates and cleans the upstreams JSON.
-func validateAndCleanUpstreams(upstreams json.RawMessage) (datatypes.JSON, error) {
-	if len(upstreams) == 0 {
-		return nil, fmt.Errorf("upstreams field is required")
-	}
-
-	var defs []UpstreamDefinition
-	if err := json.Unmarshal(upstreams, &defs); err != nil {
-		return nil, fmt.Errorf("invalid format for upstreams: %w", err)
-	}
-
-	if len(defs) == 0 {
-		return nil, fmt.Errorf("at least one upstream is required")
-	}
-
-	for i := range defs {
-		defs[i].URL = strings.TrimSpace(defs[i].URL)
-		if defs[i].URL == "" {
-			return nil, fmt.Errorf("upstream URL cannot be empty")
-		}
-		// Basic URL format validation
-		if !strings.HasPrefix(defs[i].URL, "http://") && !strings.HasPrefix(defs[i].URL, "https://") {
-			return nil, fmt.Errorf("invalid URL format for upstream: %s", defs[i].URL)
-		}
-		if defs[i].Weight <= 0 {
-			return nil, fmt.Errorf("upstream weight must be a positive integer")
-		}
-	}
-
-	cleanedUpstreams, err := json.Marshal(defs)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal cleaned upstreams: %w", err)
-	}
-
-	return cleanedUpstreams, nil
-}
-
-// isValidGroupName checks if the group name is valid.
-func isValidGroupName(name string) bool {
-	if name == "" {
-		return false
-	}
-	// 允许使用小写字母、数字、下划线和中划线，长度在 3 到 30 个字符之间
-	match, _ := regexp.MatchString("^[a-z0-9_-]{3,30}$", name)
-	return match
-}
-
-// isValidValidationEndpoint checks if the validation endpoint is a valid path.
-func isValidValidationEndpoint(endpoint string) bool {
-	if endpoint == "" {
-		return true
-	}
-	if !strings.HasPrefix(endpoint, "/") {
-		return false
-	}
-	if strings.Contains(endpoint, "://") {
-		return false
-	}
-	return true
-}
-
-// validateAndCleanConfig validates the group config against the GroupConfig struct and system-defined rules.
-func (s *Server) validateAndCleanConfig(configMap map[string]any) (map[string]any, error) {
-	if configMap == nil {
-		return nil, nil
-	}
-
-	// 1. Check for unknown fields by comparing against the GroupConfig struct definition.
-	var tempGroupConfig models.GroupConfig
-	groupConfigType := reflect.TypeOf(tempGroupConfig)
-	validFields := make(map[string]bool)
-	for i := 0; i < groupConfigType.NumField(); i++ {
-		jsonTag := groupConfigType.Field(i).Tag.Get("json")
-		fieldName := strings.Split(jsonTag, ",")[0]
-		if fieldName != "" && fieldName != "-" {
-			validFields[fieldName] = true
-		}
-	}
-
-	for key := range configMap {
-		if !validFields[key] {
-			return nil, fmt.Errorf("unknown config field: '%s'", key)
-		}
-	}
-
-	// 2. Validate the values of the provided fields using the central system settings validator.
-	if err := s.SettingsManager.ValidateGroupConfigOverrides(configMap); err != nil {
-		return nil, err
-	}
-
-	// 3. Unmarshal and marshal back to clean the map and ensure correct types.
-	configBytes, err := json.Marshal(configMap)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal config map: %w", err)
-	}
-
-	var validatedConfig models.GroupConfig
-	if err := json.Unmarshal(configBytes, &validatedConfig); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal into validated config: %w", err)
-	}
-
-	validatedBytes, err := json.Marshal(validatedConfig)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal validated config: %w", err)
-	}
-	var finalMap map[string]any
-	if err := json.Unmarshal(validatedBytes, &finalMap); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal into final map: %w", err)
-	}
-
-	return finalMap, nil
-}
-
 // GroupCreateRequest defines the payload for creating a group.
 type GroupCreateRequest struct {
-	Name               string              `json:"name"`
-	DisplayName        string              `json:"display_name"`
-	Description        string              `json:"description"`
-	Upstreams          json.RawMessage     `json:"upstreams"`
-	ChannelType        string              `json:"channel_type"`
-	Sort               int                 `json:"sort"`
-	TestModel          string              `json:"test_model"`
-	ValidationEndpoint string              `json:"validation_endpoint"`
-	ParamOverrides     map[string]any      `json:"param_overrides"`
-	Config             map[string]any      `json:"config"`
-	HeaderRules        []models.HeaderRule `json:"header_rules"`
-	ProxyKeys          string              `json:"proxy_keys"`
+	Name               string                   `json:"name"`
+	DisplayName        string                   `json:"display_name"`
+	Description        string                   `json:"description"`
+	Upstreams          json.RawMessage          `json:"upstreams"`
+	ChannelType        string                   `json:"channel_type"`
+	Sort               int                      `json:"sort"`
+	TestModel          string                   `json:"test_model"`
+	ValidationEndpoint string                   `json:"validation_endpoint"`
+	ValidationConfig   *models.ValidationConfig `json:"validation_config"`
+	ProbeConfig        *models.ProbeConfig      `json:"probe_config"`
+	ParamOverrides     map[string]any           `json:"param_overrides"`
+	Config             map[string]any           `json:"config"`
+	HeaderRules        []models.HeaderRule      `json:"header_rules"`
+	ProxyKeys          string                   `json:"proxy_keys"`
+	KeyPoolID          *uint                    `json:"key_pool_id"`
 }
 
 // CreateGroup handles the creation of a new group.
@@ -181,13 +56,13 @@ func (s *Server) CreateGroup(c *gin.Context) {
 
 	// Data Cleaning and Validation
 	name := strings.TrimSpace(req.Name)
-	if !isValidGroupName(name) {
+	if !services.IsValidGroupName(name) {
 		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, "无效的分组名称。只能包含小写字母、数字、中划线或下划线，长度3-30位"))
 		return
 	}
 
 	channelType := strings.TrimSpace(req.ChannelType)
-	if !isValidChannelType(channelType) {
+	if !services.IsValidChannelType(channelType) {
 		supported := strings.Join(channel.GetChannels(), ", ")
 		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, fmt.Sprintf("Invalid channel type. Supported types are: %s", supported)))
 		return
@@ -199,64 +74,50 @@ func (s *Server) CreateGroup(c *gin.Context) {
 		return
 	}
 
-	cleanedUpstreams, err := validateAndCleanUpstreams(req.Upstreams)
+	cleanedUpstreams, err := services.ValidateAndCleanUpstreams(req.Upstreams)
 	if err != nil {
 		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
 		return
 	}
 
-	cleanedConfig, err := s.validateAndCleanConfig(req.Config)
+	cleanedConfig, err := services.ValidateAndCleanGroupConfig(s.SettingsManager, req.Config)
 	if err != nil {
 		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, fmt.Sprintf("Invalid config format: %v", err)))
 		return
 	}
 
 	validationEndpoint := strings.TrimSpace(req.ValidationEndpoint)
-	if !isValidValidationEndpoint(validationEndpoint) {
+	if !services.IsValidValidationEndpoint(validationEndpoint) {
 		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, "无效的测试路径。如果提供，必须是以 / 开头的有效路径，且不能是完整的URL。"))
 		return
 	}
 
-	// Validate and normalize header rules if provided
-	var headerRulesJSON datatypes.JSON
-	if len(req.HeaderRules) > 0 {
-		normalizedHeaderRules := make([]models.HeaderRule, 0)
-		seenKeys := make(map[string]bool)
-
-		for _, rule := range req.HeaderRules {
-			key := strings.TrimSpace(rule.Key)
-			if key == "" {
-				continue
-			}
-
-			// Normalize to canonical form
-			canonicalKey := http.CanonicalHeaderKey(key)
+	validationConfig, err := services.ValidateAndCleanValidationConfig(req.ValidationConfig, channelType, validationEndpoint)
+	if err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, fmt.Sprintf("Invalid validation config: %v", err)))
+		return
+	}
 
-			// Check for duplicate keys
-			if seenKeys[canonicalKey] {
-				response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, fmt.Sprintf("Duplicate header key: %s", canonicalKey)))
-				return
-			}
-			seenKeys[canonicalKey] = true
+	probeConfig, err := services.ValidateAndCleanProbeConfig(req.ProbeConfig)
+	if err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, fmt.Sprintf("Invalid probe config: %v", err)))
+		return
+	}
 
-			normalizedHeaderRules = append(normalizedHeaderRules, models.HeaderRule{
-				Key:    canonicalKey,
-				Value:  rule.Value,
-				Action: rule.Action,
-			})
-		}
+	headerRulesJSON, err := services.NormalizeHeaderRules(req.HeaderRules)
+	if err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
+		return
+	}
 
-		if len(normalizedHeaderRules) > 0 {
-			headerRulesBytes, err := json.Marshal(normalizedHeaderRules)
-			if err != nil {
-				response.Error(c, app_errors.NewAPIError(app_errors.ErrInternalServer, fmt.Sprintf("Failed to process header rules: %v", err)))
-				return
-			}
-			headerRulesJSON = headerRulesBytes
-		}
+	if req.KeyPoolID != nil && *req.KeyPoolID == 0 {
+		req.KeyPoolID = nil
 	}
-	if headerRulesJSON == nil {
-		headerRulesJSON = datatypes.JSON("[]")
+	if req.KeyPoolID != nil {
+		if apiErr := s.checkGroupKeyPool(*req.KeyPoolID, channelType); apiErr != nil {
+			response.Error(c, apiErr)
+			return
+		}
 	}
 
 	group := models.Group{
@@ -268,13 +129,26 @@ func (s *Server) CreateGroup(c *gin.Context) {
 		Sort:               req.Sort,
 		TestModel:          testModel,
 		ValidationEndpoint: validationEndpoint,
+		ValidationConfig:   validationConfig,
+		ProbeConfig:        probeConfig,
 		ParamOverrides:     req.ParamOverrides,
 		Config:             cleanedConfig,
 		HeaderRules:        headerRulesJSON,
 		ProxyKeys:          strings.TrimSpace(req.ProxyKeys),
+		KeyPoolID:          req.KeyPoolID,
 	}
 
-	if err := s.DB.Create(&group).Error; err != nil {
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&group).Error; err != nil {
+			return err
+		}
+		_, err := s.GroupVersionService.Record(tx, &group, services.GroupVersionEntry{
+			Action: models.GroupVersionCreate,
+			Actor:  groupVersionActor(c),
+		})
+		return err
+	})
+	if err != nil {
 		response.Error(c, app_errors.ParseDBError(err))
 		return
 	}
@@ -282,20 +156,32 @@ func (s *Server) CreateGroup(c *gin.Context) {
 	if err := s.GroupManager.Invalidate(); err != nil {
 		logrus.WithContext(c.Request.Context()).WithError(err).Error("failed to invalidate group cache")
 	}
+	s.AuditService.Record(c, services.AuditEntry{
+		Action:     services.AuditGroupCreate,
+		TargetType: services.AuditTargetGroup,
+		TargetID:   group.ID,
+		TargetName: group.Name,
+		After:      services.GroupAuditSnapshot(&group),
+	})
 	response.Success(c, s.newGroupResponse(&group))
 }
 
 // ListGroups handles listing all groups.
 func (s *Server) ListGroups(c *gin.Context) {
 	var groups []models.Group
-	if err := s.DB.Order("sort asc, id desc").Find(&groups).Error; err != nil {
+	if err := s.DB.Scopes(accessibleGroupsScopeByID(c)).Order("sort asc, id desc").Find(&groups).Error; err != nil {
 		response.Error(c, app_errors.ParseDBError(err))
 		return
 	}
 
+	canRevealKeys := auth.GetPrincipal(c).Can(auth.PermissionRevealKeys)
 	var groupResponses []GroupResponse
 	for i := range groups {
-		groupResponses = append(groupResponses, *s.newGroupResponse(&groups[i]))
+		groupResponse := s.newGroupResponse(&groups[i])
+		if !canRevealKeys {
+			groupResponse.ProxyKeys = services.MaskProxyKeys(groupResponse.ProxyKeys)
+		}
+		groupResponses = append(groupResponses, *groupResponse)
 	}
 
 	response.Success(c, groupResponses)
@@ -304,18 +190,21 @@ func (s *Server) ListGroups(c *gin.Context) {
 // GroupUpdateRequest defines the payload for updating a group.
 // Using a dedicated struct avoids issues with zero values being ignored by GORM's Update.
 type GroupUpdateRequest struct {
-	Name               *string             `json:"name,omitempty"`
-	DisplayName        *string             `json:"display_name,omitempty"`
-	Description        *string             `json:"description,omitempty"`
-	Upstreams          json.RawMessage     `json:"upstreams"`
-	ChannelType        *string             `json:"channel_type,omitempty"`
-	Sort               *int                `json:"sort"`
-	TestModel          string              `json:"test_model"`
-	ValidationEndpoint *string             `json:"validation_endpoint,omitempty"`
-	ParamOverrides     map[string]any      `json:"param_overrides"`
-	Config             map[string]any      `json:"config"`
-	HeaderRules        []models.HeaderRule `json:"header_rules"`
-	ProxyKeys          *string             `json:"proxy_keys,omitempty"`
+	Name               *string                  `json:"name,omitempty"`
+	DisplayName        *string                  `json:"display_name,omitempty"`
+	Description        *string                  `json:"description,omitempty"`
+	Upstreams          json.RawMessage          `json:"upstreams"`
+	ChannelType        *string                  `json:"channel_type,omitempty"`
+	Sort               *int                     `json:"sort"`
+	TestModel          string                   `json:"test_model"`
+	ValidationEndpoint *string                  `json:"validation_endpoint,omitempty"`
+	ValidationConfig   *models.ValidationConfig `json:"validation_config,omitempty"`
+	ProbeConfig        *models.ProbeConfig      `json:"probe_config,omitempty"`
+	ParamOverrides     map[string]any           `json:"param_overrides"`
+	Config             map[string]any           `json:"config"`
+	HeaderRules        []models.HeaderRule      `json:"header_rules"`
+	ProxyKeys          *string                  `json:"proxy_keys,omitempty"`
+	KeyPoolID          *uint                    `json:"key_pool_id,omitempty"` // 0 stops referencing the key pool
 }
 
 // UpdateGroup handles updating an existing group.
@@ -331,12 +220,18 @@ func (s *Server) UpdateGroup(c *gin.Context) {
 		response.Error(c, app_errors.ParseDBError(err))
 		return
 	}
+	if !auth.GetPrincipal(c).CanAccessGroup(group.ID) {
+		response.Error(c, app_errors.ErrForbidden)
+		return
+	}
 
 	var req GroupUpdateRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		response.Error(c, app_errors.NewAPIError(app_errors.ErrInvalidJSON, err.Error()))
 		return
 	}
+	before := services.GroupAuditSnapshot(&group)
+	previous := group
 
 	// Start a transaction
 	tx := s.DB.Begin()
@@ -349,7 +244,7 @@ func (s *Server) UpdateGroup(c *gin.Context) {
 	// Apply updates from the request, with cleaning and validation
 	if req.Name != nil {
 		cleanedName := strings.TrimSpace(*req.Name)
-		if !isValidGroupName(cleanedName) {
+		if !services.IsValidGroupName(cleanedName) {
 			response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, "无效的分组名称格式。只能包含小写字母、数字、中划线或下划线，长度3-30位"))
 			return
 		}
@@ -365,7 +260,7 @@ func (s *Server) UpdateGroup(c *gin.Context) {
 	}
 
 	if req.Upstreams != nil {
-		cleanedUpstreams, err := validateAndCleanUpstreams(req.Upstreams)
+		cleanedUpstreams, err := services.ValidateAndCleanUpstreams(req.Upstreams)
 		if err != nil {
 			response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
 			return
@@ -375,7 +270,7 @@ func (s *Server) UpdateGroup(c *gin.Context) {
 
 	if req.ChannelType != nil {
 		cleanedChannelType := strings.TrimSpace(*req.ChannelType)
-		if !isValidChannelType(cleanedChannelType) {
+		if !services.IsValidChannelType(cleanedChannelType) {
 			supported := strings.Join(channel.GetChannels(), ", ")
 			response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, fmt.Sprintf("Invalid channel type. Supported types are: %s", supported)))
 			return
@@ -398,15 +293,39 @@ func (s *Server) UpdateGroup(c *gin.Context) {
 	}
 	if req.ValidationEndpoint != nil {
 		validationEndpoint := strings.TrimSpace(*req.ValidationEndpoint)
-		if !isValidValidationEndpoint(validationEndpoint) {
+		if !services.IsValidValidationEndpoint(validationEndpoint) {
 			response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, "无效的测试路径。如果提供，必须是以 / 开头的有效路径，且不能是完整的URL。"))
 			return
 		}
 		group.ValidationEndpoint = validationEndpoint
 	}
 
+	if req.ValidationConfig != nil {
+		validationConfig, err := services.ValidateAndCleanValidationConfig(req.ValidationConfig, group.ChannelType, group.ValidationEndpoint)
+		if err != nil {
+			response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, fmt.Sprintf("Invalid validation config: %v", err)))
+			return
+		}
+		group.ValidationConfig = validationConfig
+	} else if req.ChannelType != nil || req.ValidationEndpoint != nil {
+		// 未修改验证方式时，已有的验证方式也必须适用于新的渠道类型和测试路径
+		if err := services.CheckStoredValidationConfig(group.ValidationConfig, group.ChannelType, group.ValidationEndpoint); err != nil {
+			response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, fmt.Sprintf("Invalid validation config: %v", err)))
+			return
+		}
+	}
+
+	if req.ProbeConfig != nil {
+		probeConfig, err := services.ValidateAndCleanProbeConfig(req.ProbeConfig)
+		if err != nil {
+			response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, fmt.Sprintf("Invalid probe config: %v", err)))
+			return
+		}
+		group.ProbeConfig = probeConfig
+	}
+
 	if req.Config != nil {
-		cleanedConfig, err := s.validateAndCleanConfig(req.Config)
+		cleanedConfig, err := services.ValidateAndCleanGroupConfig(s.SettingsManager, req.Config)
 		if err != nil {
 			response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, fmt.Sprintf("Invalid config format: %v", err)))
 			return
@@ -418,46 +337,31 @@ func (s *Server) UpdateGroup(c *gin.Context) {
 		group.ProxyKeys = strings.TrimSpace(*req.ProxyKeys)
 	}
 
-	// Handle header rules update
 	if req.HeaderRules != nil {
-		var headerRulesJSON datatypes.JSON
-		normalizedHeaderRules := make([]models.HeaderRule, 0)
-		seenKeys := make(map[string]bool)
-
-		for _, rule := range req.HeaderRules {
-			key := strings.TrimSpace(rule.Key)
-			if key == "" {
-				continue
-			}
-
-			// Normalize to canonical form
-			canonicalKey := http.CanonicalHeaderKey(key)
-
-			// Check for duplicate keys
-			if seenKeys[canonicalKey] {
-				response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, fmt.Sprintf("Duplicate header key: %s", canonicalKey)))
-				return
-			}
-			seenKeys[canonicalKey] = true
-
-			normalizedHeaderRules = append(normalizedHeaderRules, models.HeaderRule{
-				Key:    canonicalKey,
-				Value:  rule.Value,
-				Action: rule.Action,
-			})
+		headerRulesJSON, err := services.NormalizeHeaderRules(req.HeaderRules)
+		if err != nil {
+			response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
+			return
 		}
+		group.HeaderRules = headerRulesJSON
+	}
 
-		if len(normalizedHeaderRules) > 0 {
-			headerRulesBytes, err := json.Marshal(normalizedHeaderRules)
-			if err != nil {
-				response.Error(c, app_errors.NewAPIError(app_errors.ErrInternalServer, fmt.Sprintf("Failed to process header rules: %v", err)))
-				return
-			}
-			headerRulesJSON = headerRulesBytes
-		} else {
-			headerRulesJSON = datatypes.JSON("[]")
+	// 引用的密钥池决定分组可访问的 Key，只有可以管理分组的角色才能修改
+	if req.KeyPoolID != nil && *req.KeyPoolID != group.KeyOwner().PoolID {
+		if !auth.GetPrincipal(c).Can(auth.PermissionManageGroups) {
+			response.Error(c, app_errors.NewAPIError(app_errors.ErrForbidden, "changing the key pool of a group requires the groups:manage permission"))
+			return
+		}
+		group.KeyPoolID = req.KeyPoolID
+		if *req.KeyPoolID == 0 {
+			group.KeyPoolID = nil
+		}
+	}
+	if group.KeyPoolID != nil {
+		if apiErr := s.checkGroupKeyPool(*group.KeyPoolID, group.ChannelType); apiErr != nil {
+			response.Error(c, apiErr)
+			return
 		}
-		group.HeaderRules = headerRulesJSON
 	}
 
 	// Save the updated group object
@@ -466,36 +370,74 @@ func (s *Server) UpdateGroup(c *gin.Context) {
 		return
 	}
 
+	if _, err := s.GroupVersionService.Record(tx, &group, services.GroupVersionEntry{
+		Action:   models.GroupVersionUpdate,
+		Actor:    groupVersionActor(c),
+		Previous: &previous,
+	}); err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+
+	// 加入密钥池后，分组自己的 Key 在同一事务中并入池中，store 在提交后再更新
+	changes := &keypool.StoreChanges{}
+	moved, err := s.GroupService.MoveKeysToPoolInTx(tx, &group, changes)
+	if err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrDatabase, fmt.Sprintf("failed to move the keys of the group into the key pool: %v", err)))
+		return
+	}
+
 	if err := tx.Commit().Error; err != nil {
 		response.Error(c, app_errors.ErrDatabase)
 		return
 	}
 
+	if err := s.KeyService.KeyProvider.ApplyStoreChanges(changes); err != nil {
+		logrus.WithContext(c.Request.Context()).WithError(err).Error("failed to update the store after moving keys into the key pool")
+	}
 	if err := s.GroupManager.Invalidate(); err != nil {
 		logrus.WithContext(c.Request.Context()).WithError(err).Error("failed to invalidate group cache")
 	}
+	var details map[string]any
+	if moved != nil {
+		details = map[string]any{"moved_to_key_pool": moved}
+	}
+	s.AuditService.Record(c, services.AuditEntry{
+		Action:     services.AuditGroupUpdate,
+		TargetType: services.AuditTargetGroup,
+		TargetID:   group.ID,
+		TargetName: group.Name,
+		Before:     before,
+		After:      services.GroupAuditSnapshot(&group),
+		Details:    details,
+	})
 	response.Success(c, s.newGroupResponse(&group))
 }
 
 // GroupResponse defines the structure for a group response, excluding sensitive or large fields.
 type GroupResponse struct {
-	ID                 uint                `json:"id"`
-	Name               string              `json:"name"`
-	Endpoint           string              `json:"endpoint"`
-	DisplayName        string              `json:"display_name"`
-	Description        string              `json:"description"`
-	Upstreams          datatypes.JSON      `json:"upstreams"`
-	ChannelType        string              `json:"channel_type"`
-	Sort               int                 `json:"sort"`
-	TestModel          string              `json:"test_model"`
-	ValidationEndpoint string              `json:"validation_endpoint"`
-	ParamOverrides     datatypes.JSONMap   `json:"param_overrides"`
-	Config             datatypes.JSONMap   `json:"config"`
-	HeaderRules        []models.HeaderRule `json:"header_rules"`
-	ProxyKeys          string              `json:"proxy_keys"`
-	LastValidatedAt    *time.Time          `json:"last_validated_at"`
-	CreatedAt          time.Time           `json:"created_at"`
-	UpdatedAt          time.Time           `json:"updated_at"`
+	ID                 uint                      `json:"id"`
+	Name               string                    `json:"name"`
+	Endpoint           string                    `json:"endpoint"`
+	DisplayName        string                    `json:"display_name"`
+	Description        string                    `json:"description"`
+	Upstreams          datatypes.JSON            `json:"upstreams"`
+	ChannelType        string                    `json:"channel_type"`
+	Sort               int                       `json:"sort"`
+	TestModel          string                    `json:"test_model"`
+	ValidationEndpoint string                    `json:"validation_endpoint"`
+	ValidationConfig   *models.ValidationConfig  `json:"validation_config"`
+	ProbeConfig        *models.ProbeConfig       `json:"probe_config"`
+	ParamOverrides     datatypes.JSONMap         `json:"param_overrides"`
+	Config             datatypes.JSONMap         `json:"config"`
+	HeaderRules        []models.HeaderRule       `json:"header_rules"`
+	ProxyKeys          string                    `json:"proxy_keys"`
+	KeyPoolID          *uint                     `json:"key_pool_id"`
+	Enabled            bool                      `json:"enabled"`
+	MaintenanceConfig  *models.MaintenanceConfig `json:"maintenance_config"`
+	LastValidatedAt    *time.Time                `json:"last_validated_at"`
+	CreatedAt          time.Time                 `json:"created_at"`
+	UpdatedAt          time.Time                 `json:"updated_at"`
 }
 
 // newGroupResponse creates a new GroupResponse from a models.Group.
@@ -519,6 +461,15 @@ func (s *Server) newGroupResponse(group *models.Group) *GroupResponse {
 		}
 	}
 
+	// Parse validation config from JSON
+	var validationConfig *models.ValidationConfig
+	if len(group.ValidationConfig) > 0 {
+		if err := json.Unmarshal(group.ValidationConfig, &validationConfig); err != nil {
+			logrus.WithError(err).Error("Failed to unmarshal validation config")
+			validationConfig = nil
+		}
+	}
+
 	return &GroupResponse{
 		ID:                 group.ID,
 		Name:               group.Name,
@@ -530,10 +481,15 @@ func (s *Server) newGroupResponse(group *models.Group) *GroupResponse {
 		Sort:               group.Sort,
 		TestModel:          group.TestModel,
 		ValidationEndpoint: group.ValidationEndpoint,
+		ValidationConfig:   validationConfig,
+		ProbeConfig:        services.ParseProbeConfig(group.ProbeConfig),
 		ParamOverrides:     group.ParamOverrides,
 		Config:             group.Config,
 		HeaderRules:        headerRules,
 		ProxyKeys:          group.ProxyKeys,
+		KeyPoolID:          group.KeyPoolID,
+		Enabled:            group.Enabled,
+		MaintenanceConfig:  services.ParseMaintenanceConfig(group.MaintenanceConfig),
 		LastValidatedAt:    group.LastValidatedAt,
 		CreatedAt:          group.CreatedAt,
 		UpdatedAt:          group.UpdatedAt,
@@ -548,83 +504,36 @@ func (s *Server) DeleteGroup(c *gin.Context) {
 		return
 	}
 
-	// First, get all API keys for this group to clean up from memory store
-	var apiKeys []models.APIKey
-	if err := s.DB.Where("group_id = ?", id).Find(&apiKeys).Error; err != nil {
-		response.Error(c, app_errors.ParseDBError(err))
-		return
-	}
-
-	// Extract key IDs for memory store cleanup
-	var keyIDs []uint
-	for _, key := range apiKeys {
-		keyIDs = append(keyIDs, key.ID)
-	}
-
-	// Use a transaction to ensure atomicity
-	tx := s.DB.Begin()
-	if tx.Error != nil {
-		response.Error(c, app_errors.ErrDatabase)
-		return
-	}
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
-		}
-	}()
-
-	// First check if the group exists
-	var group models.Group
-	if err := tx.First(&group, id).Error; err != nil {
-		tx.Rollback()
-		response.Error(c, app_errors.ParseDBError(err))
-		return
-	}
-
-	// Delete associated API keys first due to foreign key constraint
-	if err := tx.Where("group_id = ?", id).Delete(&models.APIKey{}).Error; err != nil {
-		tx.Rollback()
-		response.Error(c, app_errors.ErrDatabase)
-		return
-	}
-
-	// Then delete the group
-	if err := tx.Delete(&models.Group{}, id).Error; err != nil {
-		tx.Rollback()
-		response.Error(c, app_errors.ParseDBError(err))
-		return
-	}
-
-	// Clean up memory store (Redis) within the transaction to ensure atomicity
-	// If Redis cleanup fails, the entire transaction will be rolled back
-	if len(keyIDs) > 0 {
-		if err := s.KeyService.KeyProvider.RemoveKeysFromStore(uint(id), keyIDs); err != nil {
-			tx.Rollback()
-			logrus.WithFields(logrus.Fields{
-				"groupID":  id,
-				"keyCount": len(keyIDs),
-				"error":    err,
-			}).Error("Failed to remove keys from memory store, rolling back transaction")
-
-			response.Error(c, app_errors.NewAPIError(app_errors.ErrDatabase,
-				"Failed to delete group: unable to clean up cache"))
-			return
-		}
-	}
-
-	// Commit the transaction only if both DB and Redis operations succeed
-	if err := tx.Commit().Error; err != nil {
-		tx.Rollback()
-		response.Error(c, app_errors.ErrDatabase)
+	group, deletedKeys, apiErr := s.deleteGroup(uint(id))
+	if apiErr != nil {
+		response.Error(c, apiErr)
 		return
 	}
 
 	if err := s.GroupManager.Invalidate(); err != nil {
 		logrus.WithContext(c.Request.Context()).WithError(err).Error("failed to invalidate group cache")
 	}
+	s.AuditService.Record(c, services.AuditEntry{
+		Action:     services.AuditGroupDelete,
+		TargetType: services.AuditTargetGroup,
+		TargetID:   group.ID,
+		TargetName: group.Name,
+		Before:     services.GroupAuditSnapshot(group),
+		Details:    map[string]any{"deleted_keys": deletedKeys},
+	})
 	response.Success(c, gin.H{"message": "Group and associated keys deleted successfully"})
 }
 
+// deleteGroup deletes a group with its keys and related records.
+// It returns the deleted group and the number of deleted keys.
+func (s *Server) deleteGroup(id uint) (*models.Group, int, *app_errors.APIError) {
+	group, deletedKeys, err := s.GroupService.Delete(id)
+	if err != nil {
+		return nil, 0, app_errors.ParseDBError(err)
+	}
+	return group, deletedKeys, nil
+}
+
 // ConfigOption represents a single configurable option for a group.
 type ConfigOption struct {
 	Key          string `json:"key"`
@@ -738,6 +647,10 @@ func (s *Server) GetGroupStats(c *gin.Context) {
 		response.Error(c, app_errors.ParseDBError(err))
 		return
 	}
+	if !auth.GetPrincipal(c).CanAccessGroup(group.ID) {
+		response.Error(c, app_errors.ErrForbidden)
+		return
+	}
 
 	var resp GroupStatsResponse
 	var wg sync.WaitGroup
@@ -752,13 +665,13 @@ func (s *Server) GetGroupStats(c *gin.Context) {
 		defer wg.Done()
 		var totalKeys, activeKeys int64
 
-		if err := s.DB.Model(&models.APIKey{}).Where("group_id = ?", groupID).Count(&totalKeys).Error; err != nil {
+		if err := s.DB.Model(&models.APIKey{}).Scopes(group.KeyOwner().Scope).Count(&totalKeys).Error; err != nil {
 			mu.Lock()
 			errors = append(errors, fmt.Errorf("failed to get total keys: %w", err))
 			mu.Unlock()
 			return
 		}
-		if err := s.DB.Model(&models.APIKey{}).Where("group_id = ? AND status = ?", groupID, models.KeyStatusActive).Count(&activeKeys).Error; err != nil {
+		if err := s.DB.Model(&models.APIKey{}).Scopes(group.KeyOwner().Scope).Where("status = ?", models.KeyStatusActive).Count(&activeKeys).Error; err != nil {
 			mu.Lock()
 			errors = append(errors, fmt.Errorf("failed to get active keys: %w", err))
 			mu.Unlock()
@@ -956,19 +869,30 @@ func (s *Server) CopyGroup(c *gin.Context) {
 	newGroup.CreatedAt = time.Time{}
 	newGroup.UpdatedAt = time.Time{}
 	newGroup.LastValidatedAt = nil
+	newGroup.LastActiveCheckAt = nil
+	newGroup.Enabled = true
+	newGroup.MaintenanceConfig = nil
 
 	// Create the new group
 	if err := tx.Create(&newGroup).Error; err != nil {
 		response.Error(c, app_errors.ParseDBError(err))
 		return
 	}
+	if _, err := s.GroupVersionService.Record(tx, &newGroup, services.GroupVersionEntry{
+		Action: models.GroupVersionCopy,
+		Actor:  groupVersionActor(c),
+	}); err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
 
-	// Prepare key data for async import task
+	// Prepare key data for async import task.
+	// A copy of a group referencing a key pool references the same pool, its keys are shared rather than copied.
 	var sourceKeyValues []string
 
-	if req.CopyKeys != "none" {
+	if req.CopyKeys != "none" && !sourceGroup.KeyOwner().IsPool() {
 		var sourceKeys []models.APIKey
-		query := tx.Where("group_id = ?", sourceGroupID)
+		query := tx.Scopes(sourceGroup.KeyOwner().Scope)
 
 		// Filter by status if only copying valid keys
 		if req.CopyKeys == "valid_only" {
@@ -1017,6 +941,20 @@ func (s *Server) CopyGroup(c *gin.Context) {
 		}
 	}
 
+	s.AuditService.Record(c, services.AuditEntry{
+		Action:     services.AuditGroupCopy,
+		TargetType: services.AuditTargetGroup,
+		TargetID:   newGroup.ID,
+		TargetName: newGroup.Name,
+		After:      services.GroupAuditSnapshot(&newGroup),
+		Details: map[string]any{
+			"source_group_id":   sourceGroup.ID,
+			"source_group_name": sourceGroup.Name,
+			"copy_keys":         req.CopyKeys,
+			"key_count":         len(sourceKeyValues),
+		},
+	})
+
 	// Prepare response
 	groupResponse := s.newGroupResponse(&newGroup)
 	copyResponse := &GroupCopyResponse{
@@ -1029,7 +967,7 @@ func (s *Server) CopyGroup(c *gin.Context) {
 // List godoc
 func (s *Server) List(c *gin.Context) {
 	var groups []models.Group
-	if err := s.DB.Select("id, name,display_name").Find(&groups).Error; err != nil {
+	if err := s.DB.Scopes(accessibleGroupsScopeByID(c)).Select("id, name,display_name").Find(&groups).Error; err != nil {
 		response.Error(c, app_errors.NewAPIError(app_errors.ErrDatabase, "无法获取分组列表"))
 		return
 	}
@@ -0,0 +1,263 @@
+package handler
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"gpt-load/internal/auth"
+	app_errors "gpt-load/internal/errors"
+	"gpt-load/internal/models"
+	"gpt-load/internal/response"
+	"gpt-load/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// GroupVersionResponse is a version of a group with the fields changed since the previous version.
+type GroupVersionResponse struct {
+	Version      int                             `json:"version"`
+	Action       string                          `json:"action"`
+	ActorID      uint                            `json:"actor_id"`
+	Actor        string                          `json:"actor"`
+	RestoredFrom int                             `json:"restored_from,omitempty"`
+	CreatedAt    time.Time                       `json:"created_at"`
+	Changes      map[string]services.AuditChange `json:"changes,omitempty"`
+	Config       map[string]any                  `json:"config,omitempty"`
+}
+
+// GroupVersionDiffResponse is the difference between two configurations of a group.
+// To is 0 when comparing with the current configuration.
+type GroupVersionDiffResponse struct {
+	From    int                             `json:"from"`
+	To      int                             `json:"to"`
+	Changes map[string]services.AuditChange `json:"changes"`
+}
+
+// groupVersionActor returns the caller of the request as the author of a group version.
+func groupVersionActor(c *gin.Context) services.GroupVersionActor {
+	principal := auth.GetPrincipal(c)
+	return services.GroupVersionActor{ID: principal.UserID, Name: principal.Username}
+}
+
+// ListGroupVersions lists the configuration versions of a group, newest first, with the changes of each version.
+func (s *Server) ListGroupVersions(c *gin.Context) {
+	group, ok := s.findAccessibleGroup(c)
+	if !ok {
+		return
+	}
+
+	versions, err := s.GroupVersionService.List(group.ID)
+	if err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+
+	// 版本按从新到旧排列，与下一项（上一个版本）比较得出变更
+	items := make([]GroupVersionResponse, 0, len(versions))
+	for i := range versions {
+		item := newGroupVersionResponse(&versions[i])
+		if i+1 < len(versions) {
+			changes, err := s.diffGroupVersions(&versions[i+1], &versions[i])
+			if err != nil {
+				response.Error(c, app_errors.NewAPIError(app_errors.ErrInternalServer, err.Error()))
+				return
+			}
+			item.Changes = changes
+		}
+		items = append(items, item)
+	}
+
+	currentVersion := 0
+	if len(versions) > 0 {
+		currentVersion = versions[0].Version
+	}
+	response.Success(c, gin.H{
+		"group_id":        group.ID,
+		"current_version": currentVersion,
+		"versions":        items,
+	})
+}
+
+// GetGroupVersion returns the configuration stored in a version of a group.
+// Proxy keys are masked unless the caller can reveal keys.
+func (s *Server) GetGroupVersion(c *gin.Context) {
+	group, ok := s.findAccessibleGroup(c)
+	if !ok {
+		return
+	}
+	version, ok := s.findGroupVersion(c, group.ID, c.Param("version"))
+	if !ok {
+		return
+	}
+
+	snapshot, err := s.GroupVersionService.Snapshot(version)
+	if err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrInternalServer, err.Error()))
+		return
+	}
+	var versionGroup models.Group
+	snapshot.ApplyTo(&versionGroup)
+
+	item := newGroupVersionResponse(version)
+	item.Config = services.GroupAuditSnapshot(&versionGroup)
+	if auth.GetPrincipal(c).Can(auth.PermissionRevealKeys) {
+		item.Config["proxy_keys"] = snapshot.ProxyKeys
+	}
+	response.Success(c, item)
+}
+
+// DiffGroupVersions compares two versions of a group, or a version with the current configuration when to is omitted.
+func (s *Server) DiffGroupVersions(c *gin.Context) {
+	group, ok := s.findAccessibleGroup(c)
+	if !ok {
+		return
+	}
+	from, ok := s.findGroupVersion(c, group.ID, c.Query("from"))
+	if !ok {
+		return
+	}
+
+	fromGroup, err := s.groupVersionState(from)
+	if err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrInternalServer, err.Error()))
+		return
+	}
+	toGroup, toVersion := group, 0
+	if c.Query("to") != "" {
+		to, ok := s.findGroupVersion(c, group.ID, c.Query("to"))
+		if !ok {
+			return
+		}
+		if toGroup, err = s.groupVersionState(to); err != nil {
+			response.Error(c, app_errors.NewAPIError(app_errors.ErrInternalServer, err.Error()))
+			return
+		}
+		toVersion = to.Version
+	}
+
+	changes, err := services.GroupChanges(fromGroup, toGroup)
+	if err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrInternalServer, err.Error()))
+		return
+	}
+	response.Success(c, GroupVersionDiffResponse{From: from.Version, To: toVersion, Changes: changes})
+}
+
+// RollbackGroupVersion restores the configuration of a version as a new version of the group.
+// Keys and runtime state are not affected.
+func (s *Server) RollbackGroupVersion(c *gin.Context) {
+	group, ok := s.findAccessibleGroup(c)
+	if !ok {
+		return
+	}
+	version, ok := s.findGroupVersion(c, group.ID, c.Param("version"))
+	if !ok {
+		return
+	}
+	snapshot, err := s.GroupVersionService.Snapshot(version)
+	if err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrInternalServer, err.Error()))
+		return
+	}
+
+	previous := *group
+	before := services.GroupAuditSnapshot(&previous)
+	snapshot.ApplyTo(group)
+
+	changes, err := services.GroupChanges(&previous, group)
+	if err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrInternalServer, err.Error()))
+		return
+	}
+	if len(changes) == 0 {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, fmt.Sprintf("the group already has the configuration of version %d", version.Version)))
+		return
+	}
+
+	// 版本中的名称可能已被其他分组占用，由唯一索引拒绝
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(group).Error; err != nil {
+			return err
+		}
+		_, err := s.GroupVersionService.Record(tx, group, services.GroupVersionEntry{
+			Action:       models.GroupVersionRollback,
+			Actor:        groupVersionActor(c),
+			Previous:     &previous,
+			RestoredFrom: version.Version,
+		})
+		return err
+	})
+	if err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+
+	if err := s.GroupManager.Invalidate(); err != nil {
+		logrus.WithContext(c.Request.Context()).WithError(err).Error("failed to invalidate group cache")
+	}
+	s.ChannelFactory.Invalidate(group.ID)
+
+	s.AuditService.Record(c, services.AuditEntry{
+		Action:     services.AuditGroupRollback,
+		TargetType: services.AuditTargetGroup,
+		TargetID:   group.ID,
+		TargetName: group.Name,
+		Before:     before,
+		After:      services.GroupAuditSnapshot(group),
+		Details:    map[string]any{"version": version.Version},
+	})
+	response.Success(c, s.newGroupResponse(group))
+}
+
+// findGroupVersion loads a version of the group and writes the error response if it does not exist.
+func (s *Server) findGroupVersion(c *gin.Context, groupID uint, value string) (*models.GroupVersion, bool) {
+	number, err := strconv.Atoi(value)
+	if err != nil || number <= 0 {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrBadRequest, "Invalid version number"))
+		return nil, false
+	}
+	version, err := s.GroupVersionService.Get(groupID, number)
+	if err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return nil, false
+	}
+	return version, true
+}
+
+// groupVersionState returns a group with the configuration of a version.
+func (s *Server) groupVersionState(version *models.GroupVersion) (*models.Group, error) {
+	snapshot, err := s.GroupVersionService.Snapshot(version)
+	if err != nil {
+		return nil, err
+	}
+	group := &models.Group{ID: version.GroupID}
+	snapshot.ApplyTo(group)
+	return group, nil
+}
+
+// diffGroupVersions returns the fields changed between two versions.
+func (s *Server) diffGroupVersions(from, to *models.GroupVersion) (map[string]services.AuditChange, error) {
+	fromGroup, err := s.groupVersionState(from)
+	if err != nil {
+		return nil, err
+	}
+	toGroup, err := s.groupVersionState(to)
+	if err != nil {
+		return nil, err
+	}
+	return services.GroupChanges(fromGroup, toGroup)
+}
+
+func newGroupVersionResponse(version *models.GroupVersion) GroupVersionResponse {
+	return GroupVersionResponse{
+		Version:      version.Version,
+		Action:       version.Action,
+		ActorID:      version.ActorID,
+		Actor:        version.Actor,
+		RestoredFrom: version.RestoredFrom,
+		CreatedAt:    version.CreatedAt,
+	}
+}
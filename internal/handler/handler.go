@@ -3,14 +3,22 @@ package handler
 
 import (
 	"crypto/subtle"
+	"errors"
 	"net/http"
+	"strconv"
 	"time"
 
+	"gpt-load/internal/alert"
+	"gpt-load/internal/auth"
+	"gpt-load/internal/channel"
 	"gpt-load/internal/config"
+	app_errors "gpt-load/internal/errors"
+	"gpt-load/internal/response"
 	"gpt-load/internal/services"
 	"gpt-load/internal/types"
 
 	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
 	"go.uber.org/dig"
 	"gorm.io/gorm"
 )
@@ -27,6 +35,18 @@ type Server struct {
 	KeyImportService           *services.KeyImportService
 	KeyDeleteService           *services.KeyDeleteService
 	LogService                 *services.LogService
+	AdminUserService           *services.AdminUserService
+	SessionService             *services.SessionService
+	AuthLimiter                *services.AuthLimiter
+	SSOService                 *services.SSOService
+	AuditService               *services.AuditService
+	AlertService               *alert.Service
+	ProbeService               *services.ProbeService
+	BackupService              *services.BackupService
+	GroupVersionService        *services.GroupVersionService
+	GroupService               *services.GroupService
+	ConfigService              *services.ConfigService
+	ChannelFactory             *channel.Factory
 	CommonHandler              *CommonHandler
 }
 
@@ -43,6 +63,18 @@ type NewServerParams struct {
 	KeyImportService           *services.KeyImportService
 	KeyDeleteService           *services.KeyDeleteService
 	LogService                 *services.LogService
+	AdminUserService           *services.AdminUserService
+	SessionService             *services.SessionService
+	AuthLimiter                *services.AuthLimiter
+	SSOService                 *services.SSOService
+	AuditService               *services.AuditService
+	AlertService               *alert.Service
+	ProbeService               *services.ProbeService
+	BackupService              *services.BackupService
+	GroupVersionService        *services.GroupVersionService
+	GroupService               *services.GroupService
+	ConfigService              *services.ConfigService
+	ChannelFactory             *channel.Factory
 	CommonHandler              *CommonHandler
 }
 
@@ -59,25 +91,57 @@ func NewServer(params NewServerParams) *Server {
 		KeyImportService:           params.KeyImportService,
 		KeyDeleteService:           params.KeyDeleteService,
 		LogService:                 params.LogService,
+		AdminUserService:           params.AdminUserService,
+		SessionService:             params.SessionService,
+		AuthLimiter:                params.AuthLimiter,
+		SSOService:                 params.SSOService,
+		AuditService:               params.AuditService,
+		AlertService:               params.AlertService,
+		ProbeService:               params.ProbeService,
+		BackupService:              params.BackupService,
+		GroupVersionService:        params.GroupVersionService,
+		GroupService:               params.GroupService,
+		ConfigService:              params.ConfigService,
+		ChannelFactory:             params.ChannelFactory,
 		CommonHandler:              params.CommonHandler,
 	}
 }
 
-// LoginRequest represents the login request payload
+// LoginRequest represents the login request payload.
+// Either auth_key or username and password must be provided.
 type LoginRequest struct {
-	AuthKey string `json:"auth_key" binding:"required"`
+	AuthKey  string `json:"auth_key"`
+	Username string `json:"username"`
+	Password string `json:"password"`
 }
 
 // LoginResponse represents the login response
 type LoginResponse struct {
-	Success bool   `json:"success"`
-	Message string `json:"message"`
+	Success bool                    `json:"success"`
+	Message string                  `json:"message"`
+	Session *services.Session       `json:"session,omitempty"`
+	User    *services.AdminUserInfo `json:"user,omitempty"`
 }
 
-// Login handles authentication verification
+// RefreshRequest represents the session refresh payload
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// Login handles authentication verification and starts a session
 func (s *Server) Login(c *gin.Context) {
+	clientIP := c.ClientIP()
+	if lockedFor := s.AuthLimiter.LockedFor(clientIP); lockedFor > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(lockedFor.Seconds())+1))
+		c.JSON(http.StatusTooManyRequests, LoginResponse{
+			Success: false,
+			Message: "Too many failed attempts, please try again later",
+		})
+		return
+	}
+
 	var req LoginRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
+	if err := c.ShouldBindJSON(&req); err != nil || (req.AuthKey == "" && req.Username == "") {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"success": false,
 			"message": "Invalid request format",
@@ -85,21 +149,88 @@ func (s *Server) Login(c *gin.Context) {
 		return
 	}
 
-	authConfig := s.config.GetAuthConfig()
-
-	isValid := subtle.ConstantTimeCompare([]byte(req.AuthKey), []byte(authConfig.Key)) == 1
+	var principal *auth.Principal
+	var user *services.AdminUserInfo
+	if req.Username != "" {
+		var err error
+		user, err = s.AdminUserService.Login(req.Username, req.Password)
+		if err != nil && !errors.Is(err, services.ErrInvalidCredentials) {
+			logrus.WithError(err).Error("Failed to log in admin user")
+			response.Error(c, app_errors.ErrInternalServer)
+			return
+		}
+		if err == nil {
+			principal = &auth.Principal{UserID: user.ID, Username: user.Username, Role: user.Role}
+		}
+	} else if subtle.ConstantTimeCompare([]byte(req.AuthKey), []byte(s.config.GetAuthConfig().Key)) == 1 {
+		principal = auth.RootPrincipal()
+	}
 
-	if isValid {
-		c.JSON(http.StatusOK, LoginResponse{
-			Success: true,
-			Message: "Authentication successful",
-		})
-	} else {
+	if principal == nil {
+		s.AuthLimiter.RecordFailure(clientIP)
 		c.JSON(http.StatusUnauthorized, LoginResponse{
 			Success: false,
 			Message: "Authentication failed",
 		})
+		return
+	}
+
+	session, err := s.SessionService.Create(principal)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to create session")
+		response.Error(c, app_errors.ErrInternalServer)
+		return
+	}
+	s.AuthLimiter.Reset(clientIP)
+
+	c.JSON(http.StatusOK, LoginResponse{
+		Success: true,
+		Message: "Authentication successful",
+		Session: session,
+		User:    user,
+	})
+}
+
+// RefreshSession exchanges a refresh token for a new session token pair
+func (s *Server) RefreshSession(c *gin.Context) {
+	clientIP := c.ClientIP()
+	if lockedFor := s.AuthLimiter.LockedFor(clientIP); lockedFor > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(lockedFor.Seconds())+1))
+		response.Error(c, app_errors.ErrTooManyRequests)
+		return
+	}
+
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrInvalidJSON, err.Error()))
+		return
+	}
+
+	session, err := s.SessionService.Refresh(req.RefreshToken)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidCredentials) {
+			s.AuthLimiter.RecordFailure(clientIP)
+			response.Error(c, app_errors.ErrUnauthorized)
+		} else {
+			logrus.WithError(err).Error("Failed to refresh session")
+			response.Error(c, app_errors.ErrInternalServer)
+		}
+		return
+	}
+
+	response.Success(c, session)
+}
+
+// Logout ends the current session
+func (s *Server) Logout(c *gin.Context) {
+	if sessionID := auth.GetPrincipal(c).SessionID; sessionID != "" {
+		if err := s.SessionService.Revoke(sessionID); err != nil {
+			logrus.WithError(err).Error("Failed to revoke session")
+			response.Error(c, app_errors.ErrInternalServer)
+			return
+		}
 	}
+	response.Success(c, gin.H{"message": "Logged out successfully"})
 }
 
 // Health handles health check requests
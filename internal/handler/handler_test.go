@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"gpt-load/internal/auth"
+	"gpt-load/internal/encryption"
+	"gpt-load/internal/models"
+	"gpt-load/internal/services"
+	"gpt-load/internal/store"
+	"gpt-load/internal/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// testConfig is a config manager without a master key, so keys are stored in plaintext.
+type testConfig struct {
+	types.ConfigManager
+}
+
+func (testConfig) GetEncryptionConfig() types.EncryptionConfig {
+	return types.EncryptionConfig{}
+}
+
+// newTestServer returns a server on an empty sqlite database.
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	// 加密服务注册 encrypted 序列化器，需在建表前创建
+	encryptionService := encryption.NewService(testConfig{})
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.Group{}, &models.APIKey{}, &models.KeyEvent{}, &models.RequestLog{}, &models.Task{}); err != nil {
+		t.Fatal(err)
+	}
+	return &Server{
+		DB:          db,
+		KeyService:  services.NewKeyService(db, nil, nil, encryptionService),
+		LogService:  services.NewLogService(db, encryptionService),
+		TaskService: services.NewTaskService(db, store.NewMemoryStore()),
+	}
+}
+
+// createTestGroups creates groups with the given key pools, nil for groups with their own keys.
+func createTestGroups(t *testing.T, s *Server, keyPoolIDs ...*uint) []models.Group {
+	t.Helper()
+	groups := make([]models.Group, len(keyPoolIDs))
+	for i, keyPoolID := range keyPoolIDs {
+		groups[i] = models.Group{Name: fmt.Sprintf("group-%d", i), Upstreams: datatypes.JSON(`[]`), KeyPoolID: keyPoolID}
+	}
+	if err := s.DB.Create(&groups).Error; err != nil {
+		t.Fatal(err)
+	}
+	return groups
+}
+
+// serve handles a GET request as the principal and returns the status and the data of the response.
+func serve(t *testing.T, principal *auth.Principal, handler gin.HandlerFunc, target string) (int, json.RawMessage) {
+	t.Helper()
+	router := gin.New()
+	router.GET("/", func(c *gin.Context) {
+		auth.SetPrincipal(c, principal)
+		handler(c)
+	})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+
+	var body struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return w.Code, body.Data
+}
+
+// pageItems decodes the items of a paginated response.
+func pageItems[T any](t *testing.T, data json.RawMessage) []T {
+	t.Helper()
+	var page struct {
+		Items []T `json:"items"`
+	}
+	if err := json.Unmarshal(data, &page); err != nil {
+		t.Fatal(err)
+	}
+	return page.Items
+}
@@ -1,10 +1,14 @@
 package handler
 
 import (
+	"errors"
 	"fmt"
+	"gpt-load/internal/auth"
 	app_errors "gpt-load/internal/errors"
+	"gpt-load/internal/keypool"
 	"gpt-load/internal/models"
 	"gpt-load/internal/response"
+	"gpt-load/internal/services"
 	"log"
 	"strconv"
 	"strings"
@@ -49,9 +53,54 @@ func (s *Server) findGroupByID(c *gin.Context, groupID uint) (*models.Group, boo
 		}
 		return nil, false
 	}
+	if !auth.GetPrincipal(c).CanAccessGroup(group.ID) {
+		response.Error(c, app_errors.ErrForbidden)
+		return nil, false
+	}
 	return &group, true
 }
 
+// canAccessKeyOwner reports whether the principal may access the keys of a group or key pool.
+// The keys of a key pool are accessible through any group referencing the pool.
+func (s *Server) canAccessKeyOwner(c *gin.Context, owner models.KeyOwner) bool {
+	principal := auth.GetPrincipal(c)
+	if !owner.IsPool() {
+		return principal.CanAccessGroup(owner.GroupID)
+	}
+	if !principal.IsGroupScoped() {
+		return true
+	}
+
+	var count int64
+	if err := s.DB.Model(&models.Group{}).Where("key_pool_id = ? AND id IN ?", owner.PoolID, principal.GroupIDs).Count(&count).Error; err != nil {
+		return false
+	}
+	return count > 0
+}
+
+// canModifyPoolKeys reports whether the principal may delete or overwrite the keys the group uses.
+// The keys of a key pool are shared by every group referencing it, so destructive actions on them
+// require access to all of these groups or the groups:manage permission. It reports the error itself.
+func (s *Server) canModifyPoolKeys(c *gin.Context, group *models.Group) bool {
+	owner := group.KeyOwner()
+	principal := auth.GetPrincipal(c)
+	if !owner.IsPool() || !principal.IsGroupScoped() || principal.Can(auth.PermissionManageGroups) {
+		return true
+	}
+
+	var count int64
+	if err := s.DB.Model(&models.Group{}).Where("key_pool_id = ? AND id NOT IN ?", owner.PoolID, principal.GroupIDs).Count(&count).Error; err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return false
+	}
+	if count > 0 {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrForbidden,
+			"the key pool of this group is shared with groups you cannot access, changing its keys requires the groups:manage permission"))
+		return false
+	}
+	return true
+}
+
 // KeyTextRequest defines a generic payload for operations requiring a group ID and a text block of keys.
 type KeyTextRequest struct {
 	GroupID  uint   `json:"group_id" binding:"required"`
@@ -63,6 +112,20 @@ type GroupIDRequest struct {
 	GroupID uint `json:"group_id" binding:"required"`
 }
 
+// UpdateKeysMetadataRequest defines the payload for bulk-editing the metadata of keys in a group.
+type UpdateKeysMetadataRequest struct {
+	GroupID  uint   `json:"group_id" binding:"required"`
+	KeysText string `json:"keys_text" binding:"required"`
+	services.KeyMetadataUpdate
+}
+
+// TransferKeysRequest defines the payload for moving or copying keys between groups.
+type TransferKeysRequest struct {
+	SourceGroupID uint `json:"source_group_id" binding:"required"`
+	TargetGroupID uint `json:"target_group_id" binding:"required"`
+	services.KeyTransferOptions
+}
+
 // ValidateGroupKeysRequest defines the payload for validating keys in a group.
 type ValidateGroupKeysRequest struct {
 	GroupID uint   `json:"group_id" binding:"required"`
@@ -77,7 +140,8 @@ func (s *Server) AddMultipleKeys(c *gin.Context) {
 		return
 	}
 
-	if _, ok := s.findGroupByID(c, req.GroupID); !ok {
+	group, ok := s.findGroupByID(c, req.GroupID)
+	if !ok {
 		return
 	}
 
@@ -86,7 +150,8 @@ func (s *Server) AddMultipleKeys(c *gin.Context) {
 		return
 	}
 
-	result, err := s.KeyService.AddMultipleKeys(req.GroupID, req.KeysText)
+	before := s.keyCounts(group.KeyOwner())
+	result, err := s.KeyService.AddMultipleKeys(group.KeyOwner(), req.KeysText)
 	if err != nil {
 		if strings.Contains(err.Error(), "batch size exceeds the limit") {
 			response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
@@ -98,6 +163,7 @@ func (s *Server) AddMultipleKeys(c *gin.Context) {
 		return
 	}
 
+	s.auditKeys(c, services.AuditKeysAdd, group, before, map[string]any{"added_count": result.AddedCount, "ignored_count": result.IgnoredCount})
 	response.Success(c, result)
 }
 
@@ -125,6 +191,14 @@ func (s *Server) AddMultipleKeysAsync(c *gin.Context) {
 		return
 	}
 
+	s.AuditService.Record(c, services.AuditEntry{
+		Action:     services.AuditTaskImportKeys,
+		TargetType: services.AuditTargetGroup,
+		TargetID:   group.ID,
+		TargetName: group.Name,
+		Details:    map[string]any{"total": taskStatus.Total},
+	})
+
 	response.Success(c, taskStatus)
 }
 
@@ -136,7 +210,8 @@ func (s *Server) ListKeysInGroup(c *gin.Context) {
 		return
 	}
 
-	if _, ok := s.findGroupByID(c, groupID); !ok {
+	group, ok := s.findGroupByID(c, groupID)
+	if !ok {
 		return
 	}
 
@@ -146,9 +221,24 @@ func (s *Server) ListKeysInGroup(c *gin.Context) {
 		return
 	}
 
-	searchKeyword := c.Query("key_value")
+	filter := services.KeyListFilter{
+		Status:   statusFilter,
+		KeyValue: c.Query("key_value"),
+		Label:    strings.TrimSpace(c.Query("label")),
+		Owner:    strings.TrimSpace(c.Query("owner")),
+		Note:     c.Query("note"),
+	}
+
+	if expiresBefore := c.Query("expires_before"); expiresBefore != "" {
+		t, err := time.Parse(time.RFC3339, expiresBefore)
+		if err != nil {
+			response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, "Invalid expires_before format, expected RFC3339"))
+			return
+		}
+		filter.ExpiresBefore = &t
+	}
 
-	query := s.KeyService.ListKeysInGroupQuery(groupID, statusFilter, searchKeyword)
+	query := s.KeyService.ListKeysInGroupQuery(group.KeyOwner(), filter)
 
 	var keys []models.APIKey
 	paginatedResult, err := response.Paginate(c, query, &keys)
@@ -157,6 +247,42 @@ func (s *Server) ListKeysInGroup(c *gin.Context) {
 		return
 	}
 
+	if !auth.GetPrincipal(c).Can(auth.PermissionRevealKeys) {
+		for i := range keys {
+			keys[i].KeyValue = auth.MaskKey(keys[i].KeyValue)
+		}
+	}
+
+	response.Success(c, paginatedResult)
+}
+
+// ListKeyEvents handles listing the status change history of a single key with pagination.
+func (s *Server) ListKeyEvents(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrBadRequest, "Invalid key ID format"))
+		return
+	}
+
+	var key models.APIKey
+	if err := s.DB.Select("id, group_id, pool_id").First(&key, id).Error; err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+	if !s.canAccessKeyOwner(c, key.KeyOwner()) {
+		response.Error(c, app_errors.ErrForbidden)
+		return
+	}
+
+	query := s.KeyService.ListKeyEventsQuery(key.ID)
+
+	var events []models.KeyEvent
+	paginatedResult, err := response.Paginate(c, query, &events)
+	if err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+
 	response.Success(c, paginatedResult)
 }
 
@@ -168,7 +294,11 @@ func (s *Server) DeleteMultipleKeys(c *gin.Context) {
 		return
 	}
 
-	if _, ok := s.findGroupByID(c, req.GroupID); !ok {
+	group, ok := s.findGroupByID(c, req.GroupID)
+	if !ok {
+		return
+	}
+	if !s.canModifyPoolKeys(c, group) {
 		return
 	}
 
@@ -177,7 +307,8 @@ func (s *Server) DeleteMultipleKeys(c *gin.Context) {
 		return
 	}
 
-	result, err := s.KeyService.DeleteMultipleKeys(req.GroupID, req.KeysText)
+	before := s.keyCounts(group.KeyOwner())
+	result, err := s.KeyService.DeleteMultipleKeys(group.KeyOwner(), req.KeysText)
 	if err != nil {
 		if strings.Contains(err.Error(), "batch size exceeds the limit") {
 			response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
@@ -189,6 +320,7 @@ func (s *Server) DeleteMultipleKeys(c *gin.Context) {
 		return
 	}
 
+	s.auditKeys(c, services.AuditKeysDelete, group, before, map[string]any{"deleted_count": result.DeletedCount, "ignored_count": result.IgnoredCount})
 	response.Success(c, result)
 }
 
@@ -204,6 +336,9 @@ func (s *Server) DeleteMultipleKeysAsync(c *gin.Context) {
 	if !ok {
 		return
 	}
+	if !s.canModifyPoolKeys(c, group) {
+		return
+	}
 
 	if err := validateKeysText(req.KeysText); err != nil {
 		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
@@ -216,6 +351,14 @@ func (s *Server) DeleteMultipleKeysAsync(c *gin.Context) {
 		return
 	}
 
+	s.AuditService.Record(c, services.AuditEntry{
+		Action:     services.AuditTaskDeleteKeys,
+		TargetType: services.AuditTargetGroup,
+		TargetID:   group.ID,
+		TargetName: group.Name,
+		Details:    map[string]any{"total": taskStatus.Total},
+	})
+
 	response.Success(c, taskStatus)
 }
 
@@ -227,7 +370,8 @@ func (s *Server) RestoreMultipleKeys(c *gin.Context) {
 		return
 	}
 
-	if _, ok := s.findGroupByID(c, req.GroupID); !ok {
+	group, ok := s.findGroupByID(c, req.GroupID)
+	if !ok {
 		return
 	}
 
@@ -236,7 +380,8 @@ func (s *Server) RestoreMultipleKeys(c *gin.Context) {
 		return
 	}
 
-	result, err := s.KeyService.RestoreMultipleKeys(req.GroupID, req.KeysText)
+	before := s.keyCounts(group.KeyOwner())
+	result, err := s.KeyService.RestoreMultipleKeys(group.KeyOwner(), req.KeysText)
 	if err != nil {
 		if strings.Contains(err.Error(), "batch size exceeds the limit") {
 			response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
@@ -248,6 +393,112 @@ func (s *Server) RestoreMultipleKeys(c *gin.Context) {
 		return
 	}
 
+	s.auditKeys(c, services.AuditKeysRestore, group, before, map[string]any{"restored_count": result.RestoredCount, "ignored_count": result.IgnoredCount})
+	response.Success(c, result)
+}
+
+// UpdateKeysMetadata handles bulk-editing the metadata of keys from a text block within a specific group.
+func (s *Server) UpdateKeysMetadata(c *gin.Context) {
+	var req UpdateKeysMetadataRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrInvalidJSON, err.Error()))
+		return
+	}
+
+	group, ok := s.findGroupByID(c, req.GroupID)
+	if !ok {
+		return
+	}
+	if !s.canModifyPoolKeys(c, group) {
+		return
+	}
+
+	if err := validateKeysText(req.KeysText); err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
+		return
+	}
+
+	result, err := s.KeyService.UpdateKeysMetadata(group.KeyOwner(), req.KeysText, req.KeyMetadataUpdate)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidKeyMetadata) ||
+			strings.Contains(err.Error(), "batch size exceeds the limit") ||
+			err.Error() == "no valid keys found in the input text" {
+			response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
+		} else {
+			response.Error(c, app_errors.ParseDBError(err))
+		}
+		return
+	}
+
+	s.AuditService.Record(c, services.AuditEntry{
+		Action:     services.AuditKeysUpdate,
+		TargetType: services.AuditTargetGroup,
+		TargetID:   group.ID,
+		TargetName: group.Name,
+		Details: map[string]any{
+			"updated_count": result.UpdatedCount,
+			"ignored_count": result.IgnoredCount,
+			"metadata":      services.KeyMetadataAuditDetails(req.KeyMetadataUpdate),
+		},
+	})
+	response.Success(c, result)
+}
+
+// TransferKeys handles moving or copying keys from one group to another, keeping their status, counts and metadata.
+func (s *Server) TransferKeys(c *gin.Context) {
+	var req TransferKeysRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrInvalidJSON, err.Error()))
+		return
+	}
+
+	sourceGroup, ok := s.findGroupByID(c, req.SourceGroupID)
+	if !ok {
+		return
+	}
+	targetGroup, ok := s.findGroupByID(c, req.TargetGroupID)
+	if !ok {
+		return
+	}
+	// 移动会删除源分组的 Key，覆盖会修改目标分组的 Key
+	if req.Mode == keypool.KeyTransferMove && !s.canModifyPoolKeys(c, sourceGroup) {
+		return
+	}
+	if req.OnConflict == keypool.KeyConflictOverwrite && !s.canModifyPoolKeys(c, targetGroup) {
+		return
+	}
+	if sourceGroup.ChannelType != targetGroup.ChannelType {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation,
+			fmt.Sprintf("keys can only be transferred between groups of the same channel type, got %s and %s", sourceGroup.ChannelType, targetGroup.ChannelType)))
+		return
+	}
+
+	sourceBefore := s.keyCounts(sourceGroup.KeyOwner())
+	targetBefore := s.keyCounts(targetGroup.KeyOwner())
+	result, err := s.KeyService.TransferKeys(sourceGroup.KeyOwner(), targetGroup.KeyOwner(), req.KeyTransferOptions)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidKeyTransfer) ||
+			strings.Contains(err.Error(), "batch size exceeds the limit") ||
+			err.Error() == "no valid keys found in the input text" {
+			response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
+		} else {
+			response.Error(c, app_errors.ParseDBError(err))
+		}
+		return
+	}
+
+	action := services.AuditKeysCopy
+	if req.Mode == keypool.KeyTransferMove {
+		action = services.AuditKeysMove
+	}
+	s.auditKeys(c, action, targetGroup, targetBefore, map[string]any{
+		"source_group_id":   sourceGroup.ID,
+		"source_group_name": sourceGroup.Name,
+		"source_before":     sourceBefore,
+		"source_after":      s.keyCounts(sourceGroup.KeyOwner()),
+		"on_conflict":       req.OnConflict,
+		"result":            result,
+	})
 	response.Success(c, result)
 }
 
@@ -326,6 +577,14 @@ func (s *Server) ValidateGroupKeys(c *gin.Context) {
 		return
 	}
 
+	s.AuditService.Record(c, services.AuditEntry{
+		Action:     services.AuditTaskValidateKeys,
+		TargetType: services.AuditTargetGroup,
+		TargetID:   group.ID,
+		TargetName: group.Name,
+		Details:    map[string]any{"status": req.Status, "total": taskStatus.Total},
+	})
+
 	response.Success(c, taskStatus)
 }
 
@@ -337,16 +596,19 @@ func (s *Server) RestoreAllInvalidKeys(c *gin.Context) {
 		return
 	}
 
-	if _, ok := s.findGroupByID(c, req.GroupID); !ok {
+	group, ok := s.findGroupByID(c, req.GroupID)
+	if !ok {
 		return
 	}
 
-	rowsAffected, err := s.KeyService.RestoreAllInvalidKeys(req.GroupID)
+	before := s.keyCounts(group.KeyOwner())
+	rowsAffected, err := s.KeyService.RestoreAllInvalidKeys(group.KeyOwner())
 	if err != nil {
 		response.Error(c, app_errors.ParseDBError(err))
 		return
 	}
 
+	s.auditKeys(c, services.AuditKeysRestoreAll, group, before, map[string]any{"restored_count": rowsAffected})
 	response.Success(c, gin.H{"message": fmt.Sprintf("%d keys restored.", rowsAffected)})
 }
 
@@ -358,16 +620,22 @@ func (s *Server) ClearAllInvalidKeys(c *gin.Context) {
 		return
 	}
 
-	if _, ok := s.findGroupByID(c, req.GroupID); !ok {
+	group, ok := s.findGroupByID(c, req.GroupID)
+	if !ok {
+		return
+	}
+	if !s.canModifyPoolKeys(c, group) {
 		return
 	}
 
-	rowsAffected, err := s.KeyService.ClearAllInvalidKeys(req.GroupID)
+	before := s.keyCounts(group.KeyOwner())
+	rowsAffected, err := s.KeyService.ClearAllInvalidKeys(group.KeyOwner())
 	if err != nil {
 		response.Error(c, app_errors.ParseDBError(err))
 		return
 	}
 
+	s.auditKeys(c, services.AuditKeysClearInvalid, group, before, map[string]any{"deleted_count": rowsAffected})
 	response.Success(c, gin.H{"message": fmt.Sprintf("%d invalid keys cleared.", rowsAffected)})
 }
 
@@ -379,16 +647,22 @@ func (s *Server) ClearAllKeys(c *gin.Context) {
 		return
 	}
 
-	if _, ok := s.findGroupByID(c, req.GroupID); !ok {
+	group, ok := s.findGroupByID(c, req.GroupID)
+	if !ok {
+		return
+	}
+	if !s.canModifyPoolKeys(c, group) {
 		return
 	}
 
-	rowsAffected, err := s.KeyService.ClearAllKeys(req.GroupID)
+	before := s.keyCounts(group.KeyOwner())
+	rowsAffected, err := s.KeyService.ClearAllKeys(group.KeyOwner())
 	if err != nil {
 		response.Error(c, app_errors.ParseDBError(err))
 		return
 	}
 
+	s.auditKeys(c, services.AuditKeysClearAll, group, before, map[string]any{"deleted_count": rowsAffected})
 	response.Success(c, gin.H{"message": fmt.Sprintf("%d keys cleared.", rowsAffected)})
 }
 
@@ -421,7 +695,7 @@ func (s *Server) ExportKeys(c *gin.Context) {
 	c.Header("Content-Disposition", "attachment; filename="+filename)
 	c.Header("Content-Type", "text/plain; charset=utf-8")
 
-	err = s.KeyService.StreamKeysToWriter(groupID, statusFilter, c.Writer)
+	err = s.KeyService.StreamKeysToWriter(group.KeyOwner(), statusFilter, c.Writer)
 	if err != nil {
 		log.Printf("Failed to stream keys: %v", err)
 	}
@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"gpt-load/internal/auth"
+	"gpt-load/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCanAccessKeyOwner(t *testing.T) {
+	s := newTestServer(t)
+	shared, other := uint(1), uint(2)
+	groups := createTestGroups(t, s, &shared, &shared, nil, &other)
+
+	maintainer := &auth.Principal{Role: models.RoleMaintainer, GroupIDs: []uint{groups[0].ID, groups[2].ID}}
+	tests := []struct {
+		owner models.KeyOwner
+		want  bool
+	}{
+		{models.KeyOwner{GroupID: groups[0].ID}, true},
+		{models.KeyOwner{GroupID: groups[1].ID}, false},
+		{models.KeyOwner{GroupID: groups[2].ID}, true},
+		// 密钥池的 Key 可通过任一引用它的已分配分组访问
+		{models.PoolKeyOwner(shared), true},
+		{models.PoolKeyOwner(other), false},
+	}
+	for _, tt := range tests {
+		for _, principal := range []*auth.Principal{maintainer, {Role: models.RoleViewer}} {
+			c, _ := gin.CreateTestContext(nil)
+			auth.SetPrincipal(c, principal)
+			want := tt.want || !principal.IsGroupScoped()
+			if got := s.canAccessKeyOwner(c, tt.owner); got != want {
+				t.Errorf("%s canAccessKeyOwner(%s) = %v, want %v", principal.Role, tt.owner, got, want)
+			}
+		}
+	}
+}
+
+func TestListKeysInGroupMasksKeys(t *testing.T) {
+	s := newTestServer(t)
+	groups := createTestGroups(t, s, nil, nil)
+	key := models.APIKey{KeyValue: "sk-1234567890ab", KeyHash: "hash", GroupID: groups[0].ID, Status: models.KeyStatusActive}
+	if err := s.DB.Create(&key).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		principal  *auth.Principal
+		groupID    uint
+		wantStatus int
+		wantKey    string
+	}{
+		{&auth.Principal{Role: models.RoleViewer}, groups[0].ID, http.StatusOK, "sk-1****90ab"},
+		{&auth.Principal{Role: models.RoleOperator}, groups[0].ID, http.StatusOK, key.KeyValue},
+		{&auth.Principal{Role: models.RoleMaintainer, GroupIDs: []uint{groups[0].ID}}, groups[0].ID, http.StatusOK, key.KeyValue},
+		{&auth.Principal{Role: models.RoleMaintainer, GroupIDs: []uint{groups[1].ID}}, groups[0].ID, http.StatusForbidden, ""},
+	}
+	for _, tt := range tests {
+		status, data := serve(t, tt.principal, s.ListKeysInGroup, fmt.Sprintf("/?group_id=%d", tt.groupID))
+		if status != tt.wantStatus {
+			t.Errorf("%s: status = %d, want %d", tt.principal.Role, status, tt.wantStatus)
+			continue
+		}
+		if status != http.StatusOK {
+			continue
+		}
+		keys := pageItems[models.APIKey](t, data)
+		if len(keys) != 1 || keys[0].KeyValue != tt.wantKey {
+			t.Errorf("%s sees keys %+v, want %q", tt.principal.Role, keys, tt.wantKey)
+		}
+	}
+}
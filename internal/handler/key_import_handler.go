@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"fmt"
+	"strconv"
+
+	app_errors "gpt-load/internal/errors"
+	"gpt-load/internal/response"
+	"gpt-load/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ImportKeysFromFile starts an asynchronous import of the keys of a file uploaded as the "file" field of a multipart form.
+// The form also takes group_id, and optionally format (txt, csv, json or jsonl), validate and check_format.
+func (s *Server) ImportKeysFromFile(c *gin.Context) {
+	groupID, err := strconv.Atoi(c.PostForm("group_id"))
+	if err != nil || groupID <= 0 {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrBadRequest, "invalid group_id format"))
+		return
+	}
+	validate, err := parseImportFlag(c, "validate", false)
+	if err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
+		return
+	}
+	checkFormat, err := parseImportFlag(c, "check_format", true)
+	if err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
+		return
+	}
+
+	groupDB, ok := s.findGroupByID(c, uint(groupID))
+	if !ok {
+		return
+	}
+	group, err := s.GroupManager.GetGroupByName(groupDB.Name)
+	if err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrResourceNotFound, fmt.Sprintf("Group '%s' not found", groupDB.Name)))
+		return
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrBadRequest, "missing key file"))
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrBadRequest, err.Error()))
+		return
+	}
+	defer file.Close()
+
+	parsed, err := s.KeyService.ParseKeyFile(file, fileHeader.Filename, c.PostForm("format"), group.ChannelType, checkFormat)
+	if err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
+		return
+	}
+
+	if len(parsed.Entries) == 0 && len(parsed.Rejected) == 0 {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, "no keys found in the file"))
+		return
+	}
+
+	taskStatus, err := s.KeyImportService.StartFileImportTask(group, parsed, services.KeyFileImportOptions{Validate: validate})
+	if err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrTaskInProgress, err.Error()))
+		return
+	}
+
+	s.AuditService.Record(c, services.AuditEntry{
+		Action:     services.AuditTaskImportKeys,
+		TargetType: services.AuditTargetGroup,
+		TargetID:   group.ID,
+		TargetName: group.Name,
+		Details: map[string]any{
+			"total":    taskStatus.Total,
+			"file":     fileHeader.Filename,
+			"format":   parsed.Format,
+			"rejected": len(parsed.Rejected),
+			"validate": validate,
+		},
+	})
+
+	response.Success(c, taskStatus)
+}
+
+// parseImportFlag reads a boolean field of the import form, falling back to the default when it is omitted.
+func parseImportFlag(c *gin.Context, name string, defaultValue bool) (bool, error) {
+	value := c.PostForm(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+	flag, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("%s must be true or false", name)
+	}
+	return flag, nil
+}
@@ -0,0 +1,302 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gpt-load/internal/auth"
+	"gpt-load/internal/channel"
+	app_errors "gpt-load/internal/errors"
+	"gpt-load/internal/models"
+	"gpt-load/internal/response"
+	"gpt-load/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// KeyPoolRequest defines the payload for creating or updating a key pool.
+type KeyPoolRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	ChannelType string `json:"channel_type"`
+}
+
+// KeyPoolGroup is a group referencing a key pool.
+type KeyPoolGroup struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name"`
+}
+
+// KeyPoolResponse is a key pool with its key counts and the groups referencing it.
+type KeyPoolResponse struct {
+	models.KeyPool
+	ActiveKeys  int64          `json:"active_keys"`
+	InvalidKeys int64          `json:"invalid_keys"`
+	Groups      []KeyPoolGroup `json:"groups"`
+}
+
+// auditKeyPool returns the audited fields of a key pool.
+func auditKeyPool(pool *models.KeyPool) map[string]any {
+	return map[string]any{
+		"name":         pool.Name,
+		"description":  pool.Description,
+		"channel_type": pool.ChannelType,
+	}
+}
+
+// applyKeyPoolRequest validates the request and applies it to the pool.
+func applyKeyPoolRequest(pool *models.KeyPool, req *KeyPoolRequest) error {
+	pool.Name = strings.TrimSpace(req.Name)
+	if !services.IsValidGroupName(pool.Name) {
+		return fmt.Errorf("invalid key pool name, it may only contain lowercase letters, digits, hyphens and underscores, 3-30 characters")
+	}
+
+	pool.ChannelType = strings.TrimSpace(req.ChannelType)
+	if !services.IsValidChannelType(pool.ChannelType) {
+		return fmt.Errorf("invalid channel type, supported types are: %s", strings.Join(channel.GetChannels(), ", "))
+	}
+
+	pool.Description = strings.TrimSpace(req.Description)
+	return nil
+}
+
+// keyPoolGroups returns the groups referencing each key pool.
+func (s *Server) keyPoolGroups(poolIDs []uint) (map[uint][]KeyPoolGroup, error) {
+	var groups []models.Group
+	if err := s.DB.Select("id, name, key_pool_id").Where("key_pool_id IN ?", poolIDs).Order("id asc").Find(&groups).Error; err != nil {
+		return nil, err
+	}
+	result := make(map[uint][]KeyPoolGroup, len(poolIDs))
+	for _, group := range groups {
+		result[*group.KeyPoolID] = append(result[*group.KeyPoolID], KeyPoolGroup{ID: group.ID, Name: group.Name})
+	}
+	return result, nil
+}
+
+// newKeyPoolResponses adds the key counts and referencing groups to the pools.
+func (s *Server) newKeyPoolResponses(pools []models.KeyPool) ([]KeyPoolResponse, error) {
+	poolIDs := make([]uint, len(pools))
+	for i, pool := range pools {
+		poolIDs[i] = pool.ID
+	}
+
+	groups, err := s.keyPoolGroups(poolIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []struct {
+		PoolID uint
+		Status string
+		Count  int64
+	}
+	if err := s.DB.Model(&models.APIKey{}).Select("pool_id, status, COUNT(*) as count").
+		Where("group_id = 0 AND pool_id IN ?", poolIDs).Group("pool_id, status").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	result := make([]KeyPoolResponse, len(pools))
+	indexByID := make(map[uint]int, len(pools))
+	for i, pool := range pools {
+		indexByID[pool.ID] = i
+		result[i] = KeyPoolResponse{KeyPool: pool, Groups: nonNilSlice(groups[pool.ID])}
+	}
+	for _, row := range rows {
+		i := indexByID[row.PoolID]
+		switch row.Status {
+		case models.KeyStatusActive:
+			result[i].ActiveKeys = row.Count
+		case models.KeyStatusInvalid:
+			result[i].InvalidKeys = row.Count
+		}
+	}
+	return result, nil
+}
+
+// findKeyPool loads a key pool, reporting a validation error when it does not exist.
+func (s *Server) findKeyPool(id uint) (*models.KeyPool, *app_errors.APIError) {
+	var pool models.KeyPool
+	if err := s.DB.First(&pool, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, app_errors.NewAPIError(app_errors.ErrValidation, fmt.Sprintf("key pool %d not found", id))
+		}
+		return nil, app_errors.ParseDBError(err)
+	}
+	return &pool, nil
+}
+
+// checkGroupKeyPool checks that a group of the channel type may reference the key pool.
+func (s *Server) checkGroupKeyPool(poolID uint, channelType string) *app_errors.APIError {
+	pool, apiErr := s.findKeyPool(poolID)
+	if apiErr != nil {
+		return apiErr
+	}
+	if pool.ChannelType != channelType {
+		return app_errors.NewAPIError(app_errors.ErrValidation,
+			fmt.Sprintf("key pool '%s' holds %s keys, but the group uses the %s channel", pool.Name, pool.ChannelType, channelType))
+	}
+	return nil
+}
+
+// ListKeyPools lists the key pools with their key counts and the groups referencing them.
+// Maintainers only see the pools referenced by their groups.
+func (s *Server) ListKeyPools(c *gin.Context) {
+	query := s.DB.Order("id asc")
+	if principal := auth.GetPrincipal(c); principal.IsGroupScoped() {
+		query = query.Where("id IN (?)", s.DB.Model(&models.Group{}).Select("key_pool_id").Where("id IN ?", principal.GroupIDs))
+	}
+
+	var pools []models.KeyPool
+	if err := query.Find(&pools).Error; err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+
+	result, err := s.newKeyPoolResponses(pools)
+	if err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+	response.Success(c, result)
+}
+
+// CreateKeyPool creates a key pool. Keys are added through any group referencing it.
+func (s *Server) CreateKeyPool(c *gin.Context) {
+	var req KeyPoolRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrInvalidJSON, err.Error()))
+		return
+	}
+
+	var pool models.KeyPool
+	if err := applyKeyPoolRequest(&pool, &req); err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
+		return
+	}
+
+	if err := s.DB.Create(&pool).Error; err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+
+	s.AuditService.Record(c, services.AuditEntry{
+		Action:     services.AuditKeyPoolCreate,
+		TargetType: services.AuditTargetKeyPool,
+		TargetID:   pool.ID,
+		TargetName: pool.Name,
+		After:      auditKeyPool(&pool),
+	})
+	response.Success(c, KeyPoolResponse{KeyPool: pool, Groups: []KeyPoolGroup{}})
+}
+
+// UpdateKeyPool updates a key pool. The channel type cannot change while groups reference the pool.
+func (s *Server) UpdateKeyPool(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var req KeyPoolRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrInvalidJSON, err.Error()))
+		return
+	}
+
+	var pool models.KeyPool
+	if err := s.DB.First(&pool, id).Error; err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+	before := auditKeyPool(&pool)
+	previousChannelType := pool.ChannelType
+
+	if err := applyKeyPoolRequest(&pool, &req); err != nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
+		return
+	}
+
+	if pool.ChannelType != previousChannelType {
+		var referencing int64
+		if err := s.DB.Model(&models.Group{}).Where("key_pool_id = ?", pool.ID).Count(&referencing).Error; err != nil {
+			response.Error(c, app_errors.ParseDBError(err))
+			return
+		}
+		if referencing > 0 {
+			response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation,
+				fmt.Sprintf("the channel type cannot change while %d groups reference the key pool", referencing)))
+			return
+		}
+	}
+
+	if err := s.DB.Save(&pool).Error; err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+
+	s.AuditService.Record(c, services.AuditEntry{
+		Action:     services.AuditKeyPoolUpdate,
+		TargetType: services.AuditTargetKeyPool,
+		TargetID:   pool.ID,
+		TargetName: pool.Name,
+		Before:     before,
+		After:      auditKeyPool(&pool),
+	})
+
+	result, err := s.newKeyPoolResponses([]models.KeyPool{pool})
+	if err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+	response.Success(c, result[0])
+}
+
+// DeleteKeyPool deletes a key pool with its keys. Pools referenced by groups cannot be deleted.
+func (s *Server) DeleteKeyPool(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	var pool models.KeyPool
+	if err := s.DB.First(&pool, id).Error; err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+
+	groups, err := s.keyPoolGroups([]uint{pool.ID})
+	if err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+	if referencing := groups[pool.ID]; len(referencing) > 0 {
+		names := make([]string, len(referencing))
+		for i, group := range referencing {
+			names[i] = group.Name
+		}
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation,
+			fmt.Sprintf("the key pool is referenced by groups: %s", strings.Join(names, ", "))))
+		return
+	}
+
+	deletedKeys, err := s.KeyService.KeyProvider.RemoveAllKeys(models.PoolKeyOwner(pool.ID))
+	if err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+	if err := s.DB.Delete(&pool).Error; err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+
+	s.AuditService.Record(c, services.AuditEntry{
+		Action:     services.AuditKeyPoolDelete,
+		TargetType: services.AuditTargetKeyPool,
+		TargetID:   pool.ID,
+		TargetName: pool.Name,
+		Before:     auditKeyPool(&pool),
+		Details:    map[string]any{"deleted_keys": deletedKeys},
+	})
+	response.Success(c, gin.H{"message": "Key pool and associated keys deleted successfully"})
+}
@@ -2,6 +2,7 @@ package handler
 
 import (
 	"fmt"
+	"gpt-load/internal/auth"
 	app_errors "gpt-load/internal/errors"
 	"gpt-load/internal/models"
 	"gpt-load/internal/response"
@@ -28,10 +29,34 @@ func (s *Server) GetLogs(c *gin.Context) {
 		return
 	}
 
+	maskLogKeys(c, logs)
+
 	pagination.Items = logs
 	response.Success(c, pagination)
 }
 
+// GetRequestTimeline handles fetching all attempts of a request by its request ID.
+func (s *Server) GetRequestTimeline(c *gin.Context) {
+	timeline, err := s.LogService.GetRequestTimeline(c, c.Param("request_id"))
+	if err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+
+	maskLogKeys(c, timeline.Logs)
+	response.Success(c, timeline)
+}
+
+// maskLogKeys masks the keys of request logs for users who may not reveal keys.
+func maskLogKeys(c *gin.Context, logs []models.RequestLog) {
+	if auth.GetPrincipal(c).Can(auth.PermissionRevealKeys) {
+		return
+	}
+	for i := range logs {
+		logs[i].KeyValue = auth.MaskKey(logs[i].KeyValue)
+	}
+}
+
 // ExportLogs handles exporting filtered log keys to a CSV file.
 func (s *Server) ExportLogs(c *gin.Context) {
 	filename := fmt.Sprintf("log_keys_export_%s.csv", time.Now().Format("20060102150405"))
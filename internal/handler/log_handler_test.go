@@ -0,0 +1,33 @@
+package handler
+
+import (
+	"testing"
+	"time"
+
+	"gpt-load/internal/auth"
+	"gpt-load/internal/models"
+)
+
+func TestGetLogsMasksKeysForViewers(t *testing.T) {
+	s := newTestServer(t)
+	log := models.RequestLog{ID: "log-1", RequestID: "request-1", Timestamp: time.Now(), GroupID: 1, KeyValue: "sk-1234567890ab"}
+	if err := s.DB.Create(&log).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		principal *auth.Principal
+		want      string
+	}{
+		{&auth.Principal{Role: models.RoleViewer}, "sk-1****90ab"},
+		{&auth.Principal{Role: models.RoleMaintainer, GroupIDs: []uint{1}}, log.KeyValue},
+		{&auth.Principal{Role: models.RoleAdmin}, log.KeyValue},
+	}
+	for _, tt := range tests {
+		_, data := serve(t, tt.principal, s.GetLogs, "/")
+		logs := pageItems[models.RequestLog](t, data)
+		if len(logs) != 1 || logs[0].KeyValue != tt.want {
+			t.Errorf("%s sees the logs %+v, want the key %q", tt.principal.Role, logs, tt.want)
+		}
+	}
+}
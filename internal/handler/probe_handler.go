@@ -0,0 +1,144 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gpt-load/internal/auth"
+	app_errors "gpt-load/internal/errors"
+	"gpt-load/internal/models"
+	"gpt-load/internal/response"
+	"gpt-load/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxProbeResultHours limits how far back probe results can be listed.
+const maxProbeResultHours = 30 * 24
+
+// GetProbeUptime returns the uptime of the accessible groups that have probes enabled.
+func (s *Server) GetProbeUptime(c *gin.Context) {
+	var groups []models.Group
+	if err := s.DB.Scopes(accessibleGroupsScopeByID(c)).Select("id", "name", "display_name", "probe_config", "enabled", "maintenance_config").
+		Order("sort asc, id desc").Find(&groups).Error; err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+
+	uptimes, err := s.ProbeService.GetUptime(groups)
+	if err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+	response.Success(c, uptimes)
+}
+
+// GetProbeIncidents lists probe incidents, newest first, optionally filtered by group and state.
+func (s *Server) GetProbeIncidents(c *gin.Context) {
+	query := s.DB.Model(&models.ProbeIncident{}).Scopes(accessibleGroupsScope(c))
+	if groupID, err := strconv.Atoi(c.Query("group_id")); err == nil && groupID > 0 {
+		query = query.Where("group_id = ?", groupID)
+	}
+	switch c.Query("state") {
+	case "open":
+		query = query.Where("resolved_at IS NULL")
+	case "resolved":
+		query = query.Where("resolved_at IS NOT NULL")
+	}
+
+	var incidents []models.ProbeIncident
+	pagination, err := response.Paginate(c, query.Order("started_at desc, id desc"), &incidents)
+	if err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+	response.Success(c, pagination)
+}
+
+// GetGroupProbeResults lists the probe results of a group within the last hours, newest first.
+func (s *Server) GetGroupProbeResults(c *gin.Context) {
+	group, ok := s.findAccessibleGroup(c)
+	if !ok {
+		return
+	}
+
+	hours, err := strconv.Atoi(c.DefaultQuery("hours", "24"))
+	if err != nil || hours <= 0 || hours > maxProbeResultHours {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, "hours must be between 1 and 720"))
+		return
+	}
+
+	query := s.DB.Model(&models.ProbeResult{}).
+		Where("group_id = ? AND checked_at >= ?", group.ID, time.Now().Add(-time.Duration(hours)*time.Hour)).
+		Order("checked_at desc, id desc")
+	if c.Query("failed") == "true" {
+		query = query.Where("success = ?", false)
+	}
+
+	var results []models.ProbeResult
+	pagination, err := response.Paginate(c, query, &results)
+	if err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+	response.Success(c, pagination)
+}
+
+// RunGroupProbe probes a group immediately and returns the result.
+func (s *Server) RunGroupProbe(c *gin.Context) {
+	group, ok := s.findAccessibleGroup(c)
+	if !ok {
+		return
+	}
+	if services.ParseProbeConfig(group.ProbeConfig) == nil {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, "The group has no probe configured"))
+		return
+	}
+
+	result, err := s.ProbeService.RunProbe(group.Name)
+	if err != nil {
+		if errors.Is(err, services.ErrProbeInProgress) {
+			response.Error(c, app_errors.NewAPIError(app_errors.ErrTaskInProgress, err.Error()))
+			return
+		}
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrInternalServer, err.Error()))
+		return
+	}
+	response.Success(c, result)
+}
+
+// PublicStatus serves the unauthenticated status of probed groups when it is enabled in the settings.
+func (s *Server) PublicStatus(c *gin.Context) {
+	if !s.SettingsManager.GetSettings().EnablePublicStatus {
+		response.Error(c, app_errors.ErrResourceNotFound)
+		return
+	}
+
+	status, err := s.ProbeService.GetPublicStatus()
+	if err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// findAccessibleGroup loads the group of the id path parameter and checks that the caller can access it.
+func (s *Server) findAccessibleGroup(c *gin.Context) (*models.Group, bool) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return nil, false
+	}
+
+	var group models.Group
+	if err := s.DB.First(&group, id).Error; err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return nil, false
+	}
+	if !auth.GetPrincipal(c).CanAccessGroup(group.ID) {
+		response.Error(c, app_errors.ErrForbidden)
+		return nil, false
+	}
+	return &group, true
+}
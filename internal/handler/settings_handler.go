@@ -1,9 +1,11 @@
 package handler
 
 import (
+	"gpt-load/internal/auth"
 	app_errors "gpt-load/internal/errors"
 	"gpt-load/internal/models"
 	"gpt-load/internal/response"
+	"gpt-load/internal/services"
 	"gpt-load/internal/utils"
 	"strings"
 	"time"
@@ -17,6 +19,16 @@ func (s *Server) GetSettings(c *gin.Context) {
 	currentSettings := s.SettingsManager.GetSettings()
 	settingsInfo := utils.GenerateSettingsMetadata(&currentSettings)
 
+	if !auth.GetPrincipal(c).Can(auth.PermissionRevealKeys) {
+		for i := range settingsInfo {
+			if settingsInfo[i].Key == "proxy_keys" {
+				if proxyKeys, ok := settingsInfo[i].Value.(string); ok {
+					settingsInfo[i].Value = services.MaskProxyKeys(proxyKeys)
+				}
+			}
+		}
+	}
+
 	// Group settings by category while preserving order
 	categorized := make(map[string][]models.SystemSettingInfo)
 	var categoryOrder []string
@@ -60,12 +72,21 @@ func (s *Server) UpdateSettings(c *gin.Context) {
 		}
 	}
 
+	before := s.settingsAuditSnapshot(settingsMap)
+
 	// 更新配置
 	if err := s.SettingsManager.UpdateSettings(settingsMap); err != nil {
 		response.Error(c, app_errors.NewAPIError(app_errors.ErrDatabase, err.Error()))
 		return
 	}
 
+	s.AuditService.Record(c, services.AuditEntry{
+		Action:     services.AuditSettingsUpdate,
+		TargetType: services.AuditTargetSettings,
+		Before:     before,
+		After:      maskSettingsSnapshot(settingsMap),
+	})
+
 	time.Sleep(100 * time.Millisecond) // 等待异步更新配置
 
 	response.Success(c, gin.H{
@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	app_errors "gpt-load/internal/errors"
+	"gpt-load/internal/response"
+	"gpt-load/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	ssoLoginPage       = "/login"
+	ssoStateCookieName = "gpt_load_oidc_state"
+)
+
+// SSOConfigResponse tells the login page whether single sign-on is available.
+type SSOConfigResponse struct {
+	Enabled     bool   `json:"enabled"`
+	DisplayName string `json:"display_name,omitempty"`
+}
+
+// GetSSOConfig returns the public single sign-on settings of the login page.
+func (s *Server) GetSSOConfig(c *gin.Context) {
+	if !s.SSOService.IsEnabled() {
+		response.Success(c, SSOConfigResponse{Enabled: false})
+		return
+	}
+	response.Success(c, SSOConfigResponse{Enabled: true, DisplayName: s.SSOService.DisplayName()})
+}
+
+// SSOLogin redirects the browser to the identity provider.
+func (s *Server) SSOLogin(c *gin.Context) {
+	if !s.SSOService.IsEnabled() {
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrResourceNotFound, services.ErrSSODisabled.Error()))
+		return
+	}
+
+	authURL, state, err := s.SSOService.BeginLogin(c.Request.Context(), s.SSOService.RedirectURL())
+	if err != nil {
+		logrus.WithError(err).Error("Failed to start single sign-on")
+		redirectToLogin(c, url.Values{"error": {"Failed to contact the identity provider"}})
+		return
+	}
+	// The callback is only accepted from the browser that started the login, against login CSRF
+	s.setSSOStateCookie(c, services.SSOStateBinding(state), int(services.SSOStateTTL.Seconds()))
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// SSOCallback completes single sign-on and hands the session to the login page in the URL fragment.
+func (s *Server) SSOCallback(c *gin.Context) {
+	clientIP := c.ClientIP()
+	if lockedFor := s.AuthLimiter.LockedFor(clientIP); lockedFor > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(lockedFor.Seconds())+1))
+		redirectToLogin(c, url.Values{"error": {"Too many failed attempts, please try again later"}})
+		return
+	}
+
+	binding, _ := c.Cookie(ssoStateCookieName)
+	s.setSSOStateCookie(c, "", -1)
+	if !services.CheckStateBinding(c.Query("state"), binding) {
+		logrus.Warn("Single sign-on callback does not match the login started by this browser")
+		s.AuthLimiter.RecordFailure(clientIP)
+		redirectToLogin(c, url.Values{"error": {"Login state does not match this browser, please try again"}})
+		return
+	}
+
+	if providerError := c.Query("error"); providerError != "" {
+		message := c.Query("error_description")
+		if message == "" {
+			message = providerError
+		}
+		redirectToLogin(c, url.Values{"error": {message}})
+		return
+	}
+
+	session, err := s.SSOService.CompleteLogin(c.Request.Context(), c.Query("code"), c.Query("state"))
+	if err != nil {
+		message := "Single sign-on failed"
+		switch {
+		case errors.Is(err, services.ErrSSODenied):
+			message = err.Error()
+		case errors.Is(err, services.ErrInvalidCredentials):
+			message = "Your account is disabled"
+		case errors.Is(err, services.ErrInvalidAdminUser):
+			message = err.Error()
+		}
+		logrus.WithError(err).Warn("Single sign-on failed")
+		s.AuthLimiter.RecordFailure(clientIP)
+		redirectToLogin(c, url.Values{"error": {message}})
+		return
+	}
+	s.AuthLimiter.Reset(clientIP)
+
+	redirectToLogin(c, url.Values{
+		"token":         {session.Token},
+		"refresh_token": {session.RefreshToken},
+		"expires_at":    {session.ExpiresAt.Format(time.RFC3339)},
+	})
+}
+
+// setSSOStateCookie sets or, with a negative maxAge, clears the cookie binding a login to the browser.
+// The cookie is scoped to the path of the configured callback URL.
+func (s *Server) setSSOStateCookie(c *gin.Context, value string, maxAge int) {
+	path := "/"
+	if redirectURL, err := url.Parse(s.SSOService.RedirectURL()); err == nil && redirectURL.Path != "" {
+		path = redirectURL.Path
+	}
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     ssoStateCookieName,
+		Value:    value,
+		Path:     path,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// redirectToLogin sends the browser back to the login page. Values go in the fragment so they never reach server logs.
+func redirectToLogin(c *gin.Context, values url.Values) {
+	c.Redirect(http.StatusFound, ssoLoginPage+"#"+values.Encode())
+}
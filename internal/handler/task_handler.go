@@ -1,18 +1,114 @@
 package handler
 
 import (
+	"errors"
+	"strconv"
+
+	"gpt-load/internal/auth"
 	app_errors "gpt-load/internal/errors"
+	"gpt-load/internal/models"
 	"gpt-load/internal/response"
+	"gpt-load/internal/services"
 
 	"github.com/gin-gonic/gin"
 )
 
-// GetTaskStatus handles requests for the status of the global long-running task.
+// GetTaskStatus returns the latest running task, or the latest finished task when none is running.
 func (s *Server) GetTaskStatus(c *gin.Context) {
-	taskStatus, err := s.TaskService.GetTaskStatus()
+	taskStatus, err := s.TaskService.GetTaskStatus(taskGroupIDs(c))
 	if err != nil {
 		response.Error(c, app_errors.NewAPIError(app_errors.ErrInternalServer, "Failed to get task status"))
 		return
 	}
 	response.Success(c, taskStatus)
 }
+
+// ListTasks lists the running and finished tasks, newest first, optionally filtered by group, type and status.
+func (s *Server) ListTasks(c *gin.Context) {
+	filter := services.TaskFilter{
+		GroupIDs: taskGroupIDs(c),
+		TaskType: c.Query("task_type"),
+		Status:   c.Query("status"),
+	}
+	if groupID, err := strconv.Atoi(c.Query("group_id")); err == nil && groupID > 0 {
+		filter.GroupID = uint(groupID)
+	}
+
+	var tasks []models.Task
+	pagination, err := response.Paginate(c, s.TaskService.ListTasks(filter), &tasks)
+	if err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+	pagination.Items = s.TaskService.NewTaskStatuses(tasks)
+	response.Success(c, pagination)
+}
+
+// GetTask returns a task with its progress, result and error.
+func (s *Server) GetTask(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	task, err := s.TaskService.GetTask(id)
+	if err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+	if !auth.GetPrincipal(c).CanAccessGroup(task.GroupID) {
+		response.Error(c, app_errors.ErrResourceNotFound)
+		return
+	}
+	response.Success(c, task)
+}
+
+// CancelTask requests the cancellation of a running task.
+// The task stops after the item it is processing and keeps the result of the processed items.
+func (s *Server) CancelTask(c *gin.Context) {
+	id, ok := parseIDParam(c, "id")
+	if !ok {
+		return
+	}
+
+	task, err := s.TaskService.GetTask(id)
+	if err != nil {
+		response.Error(c, app_errors.ParseDBError(err))
+		return
+	}
+	if !auth.GetPrincipal(c).CanAccessGroup(task.GroupID) {
+		response.Error(c, app_errors.ErrResourceNotFound)
+		return
+	}
+
+	task, err = s.TaskService.CancelTask(id)
+	if err != nil {
+		if errors.Is(err, services.ErrTaskNotRunning) {
+			response.Error(c, app_errors.NewAPIError(app_errors.ErrValidation, err.Error()))
+			return
+		}
+		response.Error(c, app_errors.NewAPIError(app_errors.ErrInternalServer, err.Error()))
+		return
+	}
+
+	s.AuditService.Record(c, services.AuditEntry{
+		Action:     services.AuditTaskCancel,
+		TargetType: services.AuditTargetGroup,
+		TargetID:   task.GroupID,
+		TargetName: task.GroupName,
+		Details:    map[string]any{"task_id": task.ID, "task_type": task.TaskType, "processed": task.Processed, "total": task.Total},
+	})
+	response.Success(c, task)
+}
+
+// taskGroupIDs returns the groups whose tasks the caller can see, nil for all groups.
+func taskGroupIDs(c *gin.Context) []uint {
+	principal := auth.GetPrincipal(c)
+	if !principal.IsGroupScoped() {
+		return nil
+	}
+	if principal.GroupIDs == nil {
+		return []uint{}
+	}
+	return principal.GroupIDs
+}
@@ -0,0 +1,42 @@
+package handler
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"gpt-load/internal/auth"
+	"gpt-load/internal/models"
+	"gpt-load/internal/services"
+)
+
+func TestListTasksScopedToMaintainerGroups(t *testing.T) {
+	s := newTestServer(t)
+	for groupID := uint(1); groupID <= 3; groupID++ {
+		task := models.Task{TaskType: services.TaskTypeKeyImport, Status: models.TaskStatusSucceeded, GroupID: groupID, StartedAt: time.Now()}
+		if err := s.DB.Create(&task).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		principal *auth.Principal
+		want      []uint
+	}{
+		{&auth.Principal{Role: models.RoleAdmin}, []uint{1, 2, 3}},
+		{&auth.Principal{Role: models.RoleViewer}, []uint{1, 2, 3}},
+		{&auth.Principal{Role: models.RoleMaintainer, GroupIDs: []uint{2}}, []uint{2}},
+		{&auth.Principal{Role: models.RoleMaintainer}, nil},
+	}
+	for _, tt := range tests {
+		_, data := serve(t, tt.principal, s.ListTasks, "/")
+		var got []uint
+		for _, task := range pageItems[services.TaskStatus](t, data) {
+			got = append(got, task.GroupID)
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s with groups %v sees the tasks of groups %v, want %v", tt.principal.Role, tt.principal.GroupIDs, got, tt.want)
+		}
+	}
+}
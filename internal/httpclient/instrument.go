@@ -0,0 +1,117 @@
+package httpclient
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+
+	"gpt-load/internal/metrics"
+	"gpt-load/internal/tracing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type dialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// instrumentedDial counts dials and tracks the open connections of the connection pools.
+func instrumentedDial(dial dialFunc) dialFunc {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			metrics.HTTPClientDials.WithLabelValues("error").Inc()
+			return nil, err
+		}
+		metrics.HTTPClientDials.WithLabelValues("success").Inc()
+		metrics.HTTPClientConnections.Inc()
+		return &trackedConn{Conn: conn}, nil
+	}
+}
+
+// trackedConn decrements the open connection gauge once when closed.
+type trackedConn struct {
+	net.Conn
+	closeOnce sync.Once
+}
+
+func (c *trackedConn) Close() error {
+	c.closeOnce.Do(metrics.HTTPClientConnections.Dec)
+	return c.Conn.Close()
+}
+
+// tracedTransport records a client span for upstream requests made within a trace and
+// propagates the trace context in the traceparent header. Requests outside a trace, such as
+// background key validation, are passed through. The query string is never recorded, as
+// some channels pass the API key in it.
+type tracedTransport struct {
+	next http.RoundTripper
+}
+
+func (t *tracedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !trace.SpanContextFromContext(req.Context()).IsValid() {
+		return t.next.RoundTrip(req)
+	}
+
+	ctx, span := tracing.Tracer().Start(req.Context(), "upstream "+req.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(req.Method),
+			semconv.ServerAddress(req.URL.Hostname()),
+			semconv.URLPath(req.URL.Path),
+			attribute.String("url.scheme", req.URL.Scheme),
+		),
+	)
+
+	req = req.Clone(ctx)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		span.End()
+		return nil, err
+	}
+
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+	if resp.StatusCode >= 400 {
+		span.SetStatus(codes.Error, fmt.Sprintf("upstream returned %d", resp.StatusCode))
+	}
+	resp.Body = &spanBody{ReadCloser: resp.Body, span: span}
+	return resp, nil
+}
+
+// spanBody ends the upstream span once the response body is fully read or closed,
+// so streamed responses are covered until their last chunk.
+type spanBody struct {
+	io.ReadCloser
+	span    trace.Span
+	endOnce sync.Once
+}
+
+func (b *spanBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil {
+		if err != io.EOF {
+			b.span.RecordError(err)
+		}
+		b.end()
+	}
+	return n, err
+}
+
+func (b *spanBody) Close() error {
+	b.end()
+	return b.ReadCloser.Close()
+}
+
+func (b *spanBody) end() {
+	b.endOnce.Do(func() { b.span.End() })
+}
@@ -8,6 +8,9 @@ import (
 	"sync"
 	"time"
 
+	"gpt-load/internal/metrics"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
 )
 
@@ -68,11 +71,12 @@ func (m *HTTPClientManager) GetClient(config *Config) *http.Client {
 	}
 
 	// Create a new transport and client with the specified configuration.
+	dialer := &net.Dialer{
+		Timeout:   config.ConnectTimeout,
+		KeepAlive: 30 * time.Second,
+	}
 	transport := &http.Transport{
-		DialContext: (&net.Dialer{
-			Timeout:   config.ConnectTimeout,
-			KeepAlive: 30 * time.Second,
-		}).DialContext,
+		DialContext:           instrumentedDial(dialer.DialContext),
 		ForceAttemptHTTP2:     config.ForceAttemptHTTP2,
 		MaxIdleConns:          config.MaxIdleConns,
 		MaxIdleConnsPerHost:   config.MaxIdleConnsPerHost,
@@ -99,7 +103,7 @@ func (m *HTTPClientManager) GetClient(config *Config) *http.Client {
 	}
 
 	newClient := &http.Client{
-		Transport: transport,
+		Transport: &tracedTransport{next: promhttp.InstrumentRoundTripperInFlight(metrics.HTTPClientInFlight, transport)},
 		Timeout:   config.RequestTimeout,
 	}
 
@@ -107,6 +111,13 @@ func (m *HTTPClientManager) GetClient(config *Config) *http.Client {
 	return newClient
 }
 
+// ClientCount returns the number of cached clients, each with its own connection pool.
+func (m *HTTPClientManager) ClientCount() int {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return len(m.clients)
+}
+
 // getFingerprint generates a unique string representation of the client configuration.
 func (c *Config) getFingerprint() string {
 	return fmt.Sprintf(
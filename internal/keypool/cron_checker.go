@@ -2,7 +2,9 @@ package keypool
 
 import (
 	"context"
+	"gpt-load/internal/alert"
 	"gpt-load/internal/config"
+	"gpt-load/internal/metrics"
 	"gpt-load/internal/models"
 	"sync"
 	"sync/atomic"
@@ -12,11 +14,13 @@ import (
 	"gorm.io/gorm"
 )
 
-// NewCronChecker is responsible for periodically validating invalid keys.
+// CronChecker is responsible for periodically validating invalid keys and, optionally, health checking active keys.
 type CronChecker struct {
 	DB              *gorm.DB
 	SettingsManager *config.SystemSettingsManager
 	Validator       *KeyValidator
+	KeyProvider     *KeyProvider
+	Alerts          *alert.Service
 	stopChan        chan struct{}
 	wg              sync.WaitGroup
 }
@@ -26,11 +30,15 @@ func NewCronChecker(
 	db *gorm.DB,
 	settingsManager *config.SystemSettingsManager,
 	validator *KeyValidator,
+	keyProvider *KeyProvider,
+	alerts *alert.Service,
 ) *CronChecker {
 	return &CronChecker{
 		DB:              db,
 		SettingsManager: settingsManager,
 		Validator:       validator,
+		KeyProvider:     keyProvider,
+		Alerts:          alerts,
 		stopChan:        make(chan struct{}),
 	}
 }
@@ -82,8 +90,21 @@ func (s *CronChecker) runLoop() {
 
 // submitValidationJobs finds groups whose keys need validation and validates them concurrently.
 func (s *CronChecker) submitValidationJobs() {
+	runStart := time.Now()
+	defer func() {
+		metrics.CronCheckerRuns.Inc()
+		metrics.CronCheckerRunDuration.Observe(time.Since(runStart).Seconds())
+	}()
+
+	if count, err := s.KeyProvider.DisableExpiredKeys(); err != nil {
+		logrus.Errorf("CronChecker: Failed to disable expired keys: %v", err)
+	} else if count > 0 {
+		logrus.Infof("CronChecker: Disabled %d expired keys.", count)
+	}
+
+	// 已停用的分组不接收流量，也不检查其密钥
 	var groups []models.Group
-	if err := s.DB.Find(&groups).Error; err != nil {
+	if err := s.DB.Where("enabled = ?", true).Order("id asc").Find(&groups).Error; err != nil {
 		logrus.Errorf("CronChecker: Failed to get groups: %v", err)
 		return
 	}
@@ -91,12 +112,30 @@ func (s *CronChecker) submitValidationJobs() {
 	validationStartTime := time.Now()
 	var wg sync.WaitGroup
 
+	// 引用同一密钥池的分组共享 Key，由其中 ID 最小的启用分组（主分组）按自己的配置和间隔检查，
+	// 其他分组不单独检查，只随主分组更新检查时间
+	poolGroups := make(map[models.KeyOwner][]*models.Group)
+	for i := range groups {
+		if owner := groups[i].KeyOwner(); owner.IsPool() {
+			poolGroups[owner] = append(poolGroups[owner], &groups[i])
+		}
+	}
+
 	for i := range groups {
 		group := &groups[i]
+		var followers []*models.Group
+		if owner := group.KeyOwner(); owner.IsPool() {
+			if poolGroups[owner][0] != group {
+				continue
+			}
+			followers = poolGroups[owner][1:]
+		}
+
 		group.EffectiveConfig = s.SettingsManager.GetEffectiveConfig(group.Config)
 		interval := time.Duration(group.EffectiveConfig.KeyValidationIntervalMinutes) * time.Minute
 
 		if group.LastValidatedAt == nil || validationStartTime.Sub(*group.LastValidatedAt) > interval {
+			s.markChecked(followers, "last_validated_at")
 			wg.Add(1)
 			g := group
 			go func() {
@@ -104,17 +143,40 @@ func (s *CronChecker) submitValidationJobs() {
 				s.validateGroupKeys(g)
 			}()
 		}
+
+		activeInterval := time.Duration(group.EffectiveConfig.ActiveKeyCheckIntervalMinutes) * time.Minute
+		if activeInterval > 0 && (group.LastActiveCheckAt == nil || validationStartTime.Sub(*group.LastActiveCheckAt) > activeInterval) {
+			s.markChecked(followers, "last_active_check_at")
+			wg.Add(1)
+			// Use a separate copy, the invalid key pass may run concurrently on the same group.
+			g := *group
+			go func() {
+				defer wg.Done()
+				s.checkActiveKeys(&g)
+			}()
+		}
 	}
 
 	wg.Wait()
 }
 
+// markChecked records a check of the key pool on the groups following the primary group of the pool.
+func (s *CronChecker) markChecked(groups []*models.Group, column string) {
+	for _, group := range groups {
+		if err := s.DB.Model(group).Update(column, time.Now()).Error; err != nil {
+			logrus.Errorf("CronChecker: Failed to update %s for group %s: %v", column, group.Name, err)
+		}
+	}
+}
+
 // validateGroupKeys validates all invalid keys for a single group concurrently.
 func (s *CronChecker) validateGroupKeys(group *models.Group) {
 	groupProcessStart := time.Now()
 
 	var invalidKeys []models.APIKey
-	err := s.DB.Where("group_id = ? AND status = ?", group.ID, models.KeyStatusInvalid).Find(&invalidKeys).Error
+	err := s.DB.Scopes(group.KeyOwner().Scope).Where("status = ?", models.KeyStatusInvalid).
+		Where("expires_at IS NULL OR expires_at > ?", time.Now()).
+		Find(&invalidKeys).Error
 	if err != nil {
 		logrus.Errorf("CronChecker: Failed to get invalid keys for group %s: %v", group.Name, err)
 		return
@@ -128,11 +190,70 @@ func (s *CronChecker) validateGroupKeys(group *models.Group) {
 		return
 	}
 
-	var becameValidCount int32
+	validCount := s.runValidation(group, invalidKeys, group.EffectiveConfig.KeyValidationConcurrency, func(key *models.APIKey, group *models.Group) (bool, error) {
+		return s.Validator.ValidateSingleKey(key, group, models.KeyEventSourceCron)
+	})
+
+	if err := s.DB.Model(group).Update("last_validated_at", time.Now()).Error; err != nil {
+		logrus.Errorf("CronChecker: Failed to update last_validated_at for group %s: %v", group.Name, err)
+	}
+
+	if validCount > 0 {
+		s.Alerts.KeysRestored(group, int(validCount), len(invalidKeys))
+	}
+
+	duration := time.Since(groupProcessStart)
+	logrus.Infof(
+		"CronChecker: Group '%s' validation finished. Total checked: %d, became valid: %d. Duration: %s.",
+		group.Name,
+		len(invalidKeys),
+		validCount,
+		duration.String(),
+	)
+}
+
+// checkActiveKeys validates all active keys for a single group, removing dead keys from the active pool.
+func (s *CronChecker) checkActiveKeys(group *models.Group) {
+	groupProcessStart := time.Now()
+
+	var activeKeys []models.APIKey
+	err := s.DB.Scopes(group.KeyOwner().Scope).Where("status = ?", models.KeyStatusActive).Find(&activeKeys).Error
+	if err != nil {
+		logrus.Errorf("CronChecker: Failed to get active keys for group %s: %v", group.Name, err)
+		return
+	}
+
+	validCount := s.runValidation(group, activeKeys, group.EffectiveConfig.ActiveKeyCheckConcurrency, s.Validator.ValidateActiveKey)
+
+	if err := s.DB.Model(group).Update("last_active_check_at", time.Now()).Error; err != nil {
+		logrus.Errorf("CronChecker: Failed to update last_active_check_at for group %s: %v", group.Name, err)
+	}
+
+	duration := time.Since(groupProcessStart)
+	logrus.Infof(
+		"CronChecker: Group '%s' active key check finished. Total checked: %d, failed: %d. Duration: %s.",
+		group.Name,
+		len(activeKeys),
+		int32(len(activeKeys))-validCount,
+		duration.String(),
+	)
+}
+
+// runValidation validates the given keys with a fixed number of workers and returns the number of valid keys.
+func (s *CronChecker) runValidation(
+	group *models.Group,
+	keys []models.APIKey,
+	concurrency int,
+	validate func(key *models.APIKey, group *models.Group) (bool, error),
+) int32 {
+	if len(keys) == 0 {
+		return 0
+	}
+
+	var validCount int32
 	var keyWg sync.WaitGroup
-	jobs := make(chan *models.APIKey, len(invalidKeys))
+	jobs := make(chan *models.APIKey, len(keys))
 
-	concurrency := group.EffectiveConfig.KeyValidationConcurrency
 	for range concurrency {
 		keyWg.Add(1)
 		go func() {
@@ -143,9 +264,9 @@ func (s *CronChecker) validateGroupKeys(group *models.Group) {
 					if !ok {
 						return
 					}
-					isValid, _ := s.Validator.ValidateSingleKey(key, group)
+					isValid, _ := validate(key, group)
 					if isValid {
-						atomic.AddInt32(&becameValidCount, 1)
+						atomic.AddInt32(&validCount, 1)
 					}
 				case <-s.stopChan:
 					return
@@ -155,9 +276,9 @@ func (s *CronChecker) validateGroupKeys(group *models.Group) {
 	}
 
 DistributeLoop:
-	for i := range invalidKeys {
+	for i := range keys {
 		select {
-		case jobs <- &invalidKeys[i]:
+		case jobs <- &keys[i]:
 		case <-s.stopChan:
 			break DistributeLoop
 		}
@@ -166,16 +287,5 @@ DistributeLoop:
 
 	keyWg.Wait()
 
-	if err := s.DB.Model(group).Update("last_validated_at", time.Now()).Error; err != nil {
-		logrus.Errorf("CronChecker: Failed to update last_validated_at for group %s: %v", group.Name, err)
-	}
-
-	duration := time.Since(groupProcessStart)
-	logrus.Infof(
-		"CronChecker: Group '%s' validation finished. Total checked: %d, became valid: %d. Duration: %s.",
-		group.Name,
-		len(invalidKeys),
-		becameValidCount,
-		duration.String(),
-	)
+	return validCount
 }
@@ -0,0 +1,183 @@
+package keypool
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"gpt-load/internal/config"
+	"gpt-load/internal/encryption"
+	"gpt-load/internal/models"
+	"gpt-load/internal/store"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+func newPoolProvider(t *testing.T) *KeyProvider {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewProvider(db, store.NewMemoryStore(), config.NewSystemSettingsManager(), encryption.NewService(testConfig{}), nil)
+	if err := db.AutoMigrate(&models.Group{}, &models.APIKey{}, &models.KeyEvent{}); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// addOwnedKeys creates active keys for the owner and adds them to its rotation.
+func addOwnedKeys(t *testing.T, p *KeyProvider, owner models.KeyOwner, hashes ...string) []uint {
+	t.Helper()
+	keys := make([]models.APIKey, 0, len(hashes))
+	for _, hash := range hashes {
+		key := models.APIKey{KeyValue: "sk-" + hash, KeyHash: hash, Status: models.KeyStatusActive, Weight: 1}
+		owner.Assign(&key)
+		keys = append(keys, key)
+	}
+	if err := p.AddKeys(owner, keys); err != nil {
+		t.Fatal(err)
+	}
+	var ids []uint
+	if err := p.db.Model(&models.APIKey{}).Scopes(owner.Scope).Order("id").Pluck("id", &ids).Error; err != nil {
+		t.Fatal(err)
+	}
+	return ids
+}
+
+func TestKeyOwnerScope(t *testing.T) {
+	p := newPoolProvider(t)
+	group := models.KeyOwner{GroupID: 1}
+	pool := models.PoolKeyOwner(1)
+	other := models.KeyOwner{GroupID: 2}
+	groupIDs := addOwnedKeys(t, p, group, "group")
+	poolIDs := addOwnedKeys(t, p, pool, "pool-a", "pool-b")
+	addOwnedKeys(t, p, other, "other")
+
+	for owner, want := range map[models.KeyOwner][]uint{group: groupIDs, pool: poolIDs} {
+		var got []uint
+		if err := p.db.Model(&models.APIKey{}).Scopes(owner.Scope).Order("id").Pluck("id", &got).Error; err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("%s scope = %v, want %v", owner, got, want)
+		}
+	}
+
+	if group.ActiveKeysKey() == pool.ActiveKeysKey() {
+		t.Errorf("group 1 and key pool 1 share the rotation %s", group.ActiveKeysKey())
+	}
+}
+
+func TestGroupKeyOwner(t *testing.T) {
+	poolID, noPool := uint(3), uint(0)
+	tests := []struct {
+		keyPoolID *uint
+		want      models.KeyOwner
+	}{
+		{nil, models.KeyOwner{GroupID: 7}},
+		{&noPool, models.KeyOwner{GroupID: 7}},
+		{&poolID, models.PoolKeyOwner(3)},
+	}
+	for _, tt := range tests {
+		group := models.Group{ID: 7, KeyPoolID: tt.keyPoolID}
+		if got := group.KeyOwner(); got != tt.want {
+			t.Errorf("KeyOwner() with key pool %v = %s, want %s", tt.keyPoolID, got, tt.want)
+		}
+	}
+}
+
+func TestSelectKeyFromPool(t *testing.T) {
+	p := newPoolProvider(t)
+	poolID := uint(1)
+	groups := []models.Group{{ID: 1, KeyPoolID: &poolID}, {ID: 2, KeyPoolID: &poolID}}
+	poolIDs := addOwnedKeys(t, p, groups[0].KeyOwner(), "pool-a", "pool-b")
+	// 分组自己遗留的 Key 不参与轮换
+	addOwnedKeys(t, p, models.KeyOwner{GroupID: 1}, "group")
+
+	// 引用同一密钥池的分组从同一个列表轮换
+	var selected []uint
+	for i := range 4 {
+		key, err := p.SelectKey(groups[i%2].KeyOwner())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Contains(poolIDs, key.ID) {
+			t.Fatalf("selected key %d, want a key of the pool %v", key.ID, poolIDs)
+		}
+		selected = append(selected, key.ID)
+	}
+	for i := 1; i < len(selected); i++ {
+		if selected[i] == selected[i-1] {
+			t.Errorf("selections %v, want the groups to share one rotation", selected)
+		}
+	}
+
+	if _, err := p.RemoveKeys(groups[0].KeyOwner(), []string{"sk-pool-a", "sk-pool-b"}); err != nil {
+		t.Fatal(err)
+	}
+	if key, err := p.SelectKey(groups[1].KeyOwner()); err == nil {
+		t.Errorf("selected key %d from an empty pool", key.ID)
+	}
+}
+
+func TestSubmitValidationJobsChecksPrimaryGroup(t *testing.T) {
+	p := newPoolProvider(t)
+	poolID := uint(1)
+	recently := time.Now().Add(-time.Minute)
+	groups := []models.Group{
+		{Name: "disabled", KeyPoolID: &poolID},
+		{Name: "primary", KeyPoolID: &poolID, LastValidatedAt: &recently},
+		{Name: "follower", KeyPoolID: &poolID},
+		{Name: "own-keys"},
+	}
+	for i := range groups {
+		groups[i].Upstreams = datatypes.JSON(`[]`)
+	}
+	if err := p.db.Create(&groups).Error; err != nil {
+		t.Fatal(err)
+	}
+	// enabled 列有默认值，创建后单独停用
+	if err := p.db.Model(&groups[0]).Update("enabled", false).Error; err != nil {
+		t.Fatal(err)
+	}
+	checker := NewCronChecker(p.db, p.settingsManager, nil, p, nil)
+
+	lastValidated := func(group *models.Group) *time.Time {
+		t.Helper()
+		var reloaded models.Group
+		if err := p.db.First(&reloaded, group.ID).Error; err != nil {
+			t.Fatal(err)
+		}
+		return reloaded.LastValidatedAt
+	}
+
+	// 主分组未到检查间隔时，其他分组即使从未检查过也不单独检查
+	checker.submitValidationJobs()
+	if got := lastValidated(&groups[1]); got == nil || !got.Equal(recently) {
+		t.Errorf("primary group validated at %v before its interval", got)
+	}
+	if got := lastValidated(&groups[2]); got != nil {
+		t.Errorf("follower group validated at %v, want it checked with the primary group only", got)
+	}
+	if lastValidated(&groups[3]) == nil {
+		t.Error("a group with its own keys should be validated")
+	}
+
+	if err := p.db.Model(&groups[1]).Update("last_validated_at", nil).Error; err != nil {
+		t.Fatal(err)
+	}
+	checker.submitValidationJobs()
+	if lastValidated(&groups[1]) == nil {
+		t.Error("the primary group should be validated once its interval passed")
+	}
+	if lastValidated(&groups[2]) == nil {
+		t.Error("the follower group should be marked as checked with the primary group")
+	}
+	if got := lastValidated(&groups[0]); got != nil {
+		t.Errorf("disabled group validated at %v", got)
+	}
+}
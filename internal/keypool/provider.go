@@ -3,40 +3,52 @@ package keypool
 import (
 	"errors"
 	"fmt"
+	"gpt-load/internal/alert"
 	"gpt-load/internal/config"
+	"gpt-load/internal/encryption"
 	app_errors "gpt-load/internal/errors"
+	"gpt-load/internal/metrics"
 	"gpt-load/internal/models"
 	"gpt-load/internal/store"
+	"maps"
 	"math/rand"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/sirupsen/logrus"
+	"gorm.io/datatypes"
 	"gorm.io/gorm"
 )
 
+// keysLoadedFlagKey marks that the keys have been loaded from the database into the store.
+// 有效密钥改为加权轮换后更换了标记，升级时重新加载
+const keysLoadedFlagKey = "initialization:db_keys_loaded:weighted"
+
 type KeyProvider struct {
-	db              *gorm.DB
-	store           store.Store
-	settingsManager *config.SystemSettingsManager
+	db                *gorm.DB
+	store             store.Store
+	settingsManager   *config.SystemSettingsManager
+	encryptionService *encryption.Service
+	alerts            *alert.Service
 }
 
 // NewProvider 创建一个新的 KeyProvider 实例。
-func NewProvider(db *gorm.DB, store store.Store, settingsManager *config.SystemSettingsManager) *KeyProvider {
+func NewProvider(db *gorm.DB, store store.Store, settingsManager *config.SystemSettingsManager, encryptionService *encryption.Service, alerts *alert.Service) *KeyProvider {
 	return &KeyProvider{
-		db:              db,
-		store:           store,
-		settingsManager: settingsManager,
+		db:                db,
+		store:             store,
+		settingsManager:   settingsManager,
+		encryptionService: encryptionService,
+		alerts:            alerts,
 	}
 }
 
-// SelectKey 为指定的分组原子性地选择并轮换一个可用的 APIKey。
-func (p *KeyProvider) SelectKey(groupID uint) (*models.APIKey, error) {
-	activeKeysListKey := fmt.Sprintf("group:%d:active_keys", groupID)
-
-	// 1. Atomically rotate the key ID from the list
-	keyIDStr, err := p.store.Rotate(activeKeysListKey)
+// SelectKey 从分组或密钥池的活跃列表中原子性地选择并轮换一个可用的 APIKey。
+// 引用同一密钥池的分组从同一个列表轮换，共享 Key 的状态和冷却。
+func (p *KeyProvider) SelectKey(owner models.KeyOwner) (*models.APIKey, error) {
+	// 1. Atomically select the key ID from the weighted rotation
+	keyIDStr, err := p.store.WeightedRotate(owner.ActiveKeysKey())
 	if err != nil {
 		if errors.Is(err, store.ErrNotFound) {
 			return nil, app_errors.ErrNoActiveKeys
@@ -57,39 +69,66 @@ func (p *KeyProvider) SelectKey(groupID uint) (*models.APIKey, error) {
 	}
 
 	// 3. Manually unmarshal the map into an APIKey struct
+	keyValue, err := p.encryptionService.Decrypt(keyDetails["key_string"])
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt key ID %d: %w", keyID, err)
+	}
 	failureCount, _ := strconv.ParseInt(keyDetails["failure_count"], 10, 64)
 	createdAt, _ := strconv.ParseInt(keyDetails["created_at"], 10, 64)
 
 	apiKey := &models.APIKey{
 		ID:           uint(keyID),
-		KeyValue:     keyDetails["key_string"],
+		KeyValue:     keyValue,
 		Status:       keyDetails["status"],
 		FailureCount: failureCount,
-		GroupID:      groupID,
+		GroupID:      owner.GroupID,
+		PoolID:       owner.PoolID,
+		HeaderRules:  datatypes.JSON(keyDetails["header_rules"]),
+		UpstreamURL:  keyDetails["upstream_url"],
+		ProxyURL:     keyDetails["proxy_url"],
 		CreatedAt:    time.Unix(createdAt, 0),
 	}
 
 	return apiKey, nil
 }
 
+// StatusUpdate describes the outcome of a single request or validation made with a key.
+type StatusUpdate struct {
+	IsSuccess    bool
+	StatusCode   int
+	ErrorMessage string
+	Source       string // One of the models.KeyEventSource* values
+	Definitive   bool   // The upstream rejected the key itself: 401/403, or a response rule classified it as invalid
+}
+
 // UpdateStatus 异步地提交一个 Key 状态更新任务。
-func (p *KeyProvider) UpdateStatus(apiKey *models.APIKey, group *models.Group, isSuccess bool, errorMessage string) {
+func (p *KeyProvider) UpdateStatus(apiKey *models.APIKey, group *models.Group, update StatusUpdate) {
+	p.updateStatus(apiKey, group, update, false)
+}
+
+// UpdateHealthCheckStatus 异步地提交一个主动巡检结果。上游明确拒绝 Key 时跳过失败计数阈值立即拉黑，
+// 超时、5xx 和网络错误等其他失败仍按阈值计数，避免上游短暂故障清空轮询池。
+func (p *KeyProvider) UpdateHealthCheckStatus(apiKey *models.APIKey, group *models.Group, update StatusUpdate) {
+	p.updateStatus(apiKey, group, update, true)
+}
+
+func (p *KeyProvider) updateStatus(apiKey *models.APIKey, group *models.Group, update StatusUpdate, blacklistOnFailure bool) {
 	go func() {
 		keyHashKey := fmt.Sprintf("key:%d", apiKey.ID)
-		activeKeysListKey := fmt.Sprintf("group:%d:active_keys", group.ID)
+		activeKeysKey := apiKey.KeyOwner().ActiveKeysKey()
 
-		if isSuccess {
-			if err := p.handleSuccess(apiKey.ID, keyHashKey, activeKeysListKey); err != nil {
+		if update.IsSuccess {
+			if err := p.handleSuccess(apiKey.ID, keyHashKey, activeKeysKey, update); err != nil {
 				logrus.WithFields(logrus.Fields{"keyID": apiKey.ID, "error": err}).Error("Failed to handle key success")
 			}
 		} else {
-			if app_errors.IsUnCounted(errorMessage) {
+			if app_errors.IsUnCounted(update.ErrorMessage) {
 				logrus.WithFields(logrus.Fields{
 					"keyID": apiKey.ID,
-					"error": errorMessage,
+					"error": update.ErrorMessage,
 				}).Debug("Uncounted error, skipping failure handling")
 			} else {
-				if err := p.handleFailure(apiKey, group, keyHashKey, activeKeysListKey); err != nil {
+				if err := p.handleFailure(apiKey, group, keyHashKey, activeKeysKey, update, blacklistOnFailure); err != nil {
 					logrus.WithFields(logrus.Fields{"keyID": apiKey.ID, "error": err}).Error("Failed to handle key failure")
 				}
 			}
@@ -124,7 +163,7 @@ func (p *KeyProvider) executeTransactionWithRetry(operation func(tx *gorm.DB) er
 	return err
 }
 
-func (p *KeyProvider) handleSuccess(keyID uint, keyHashKey, activeKeysListKey string) error {
+func (p *KeyProvider) handleSuccess(keyID uint, keyHashKey, activeKeysKey string, update StatusUpdate) error {
 	keyDetails, err := p.store.HGetAll(keyHashKey)
 	if err != nil {
 		return fmt.Errorf("failed to get key details from store: %w", err)
@@ -143,6 +182,11 @@ func (p *KeyProvider) handleSuccess(keyID uint, keyHashKey, activeKeysListKey st
 			return fmt.Errorf("failed to lock key %d for update: %w", keyID, err)
 		}
 
+		// Expired keys stay disabled even if they still work upstream.
+		if !isActive && key.IsExpired() {
+			return nil
+		}
+
 		updates := map[string]any{"failure_count": 0}
 		if !isActive {
 			updates["status"] = models.KeyStatusActive
@@ -152,17 +196,32 @@ func (p *KeyProvider) handleSuccess(keyID uint, keyHashKey, activeKeysListKey st
 			return fmt.Errorf("failed to update key in DB: %w", err)
 		}
 
+		// 失效的 Key 恢复可用；仍可用的 Key 清零失败计数，结束冷却
+		event := models.KeyEvent{
+			KeyID:      key.ID,
+			GroupID:    key.GroupID,
+			EventType:  models.KeyEventRecovered,
+			FromStatus: models.KeyStatusInvalid,
+			ToStatus:   models.KeyStatusActive,
+			Source:     update.Source,
+			StatusCode: update.StatusCode,
+		}
+		if isActive {
+			event.EventType = models.KeyEventCooledDown
+			event.FromStatus = models.KeyStatusActive
+		}
+		if err := tx.Create(&event).Error; err != nil {
+			return fmt.Errorf("failed to record key event: %w", err)
+		}
+
 		if err := p.store.HSet(keyHashKey, updates); err != nil {
 			return fmt.Errorf("failed to update key details in store: %w", err)
 		}
 
 		if !isActive {
 			logrus.WithField("keyID", keyID).Debug("Key has recovered and is being restored to active pool.")
-			if err := p.store.LRem(activeKeysListKey, 0, keyID); err != nil {
-				return fmt.Errorf("failed to LRem key before LPush on recovery: %w", err)
-			}
-			if err := p.store.LPush(activeKeysListKey, keyID); err != nil {
-				return fmt.Errorf("failed to LPush key back to active list: %w", err)
+			if err := p.store.WeightedAdd(activeKeysKey, rotationWeights(&key)); err != nil {
+				return fmt.Errorf("failed to add key back to active keys: %w", err)
 			}
 		}
 
@@ -170,7 +229,7 @@ func (p *KeyProvider) handleSuccess(keyID uint, keyHashKey, activeKeysListKey st
 	})
 }
 
-func (p *KeyProvider) handleFailure(apiKey *models.APIKey, group *models.Group, keyHashKey, activeKeysListKey string) error {
+func (p *KeyProvider) handleFailure(apiKey *models.APIKey, group *models.Group, keyHashKey, activeKeysKey string, update StatusUpdate, blacklistOnFailure bool) error {
 	keyDetails, err := p.store.HGetAll(keyHashKey)
 	if err != nil {
 		return fmt.Errorf("failed to get key details from store: %w", err)
@@ -185,7 +244,8 @@ func (p *KeyProvider) handleFailure(apiKey *models.APIKey, group *models.Group,
 	// 获取该分组的有效配置
 	blacklistThreshold := group.EffectiveConfig.BlacklistThreshold
 
-	return p.executeTransactionWithRetry(func(tx *gorm.DB) error {
+	blacklisted := false
+	err = p.executeTransactionWithRetry(func(tx *gorm.DB) error {
 		var key models.APIKey
 		if err := tx.Set("gorm:query_option", "FOR UPDATE").First(&key, apiKey.ID).Error; err != nil {
 			return fmt.Errorf("failed to lock key %d for update: %w", apiKey.ID, err)
@@ -193,8 +253,13 @@ func (p *KeyProvider) handleFailure(apiKey *models.APIKey, group *models.Group,
 
 		newFailureCount := failureCount + 1
 
-		updates := map[string]any{"failure_count": newFailureCount}
-		shouldBlacklist := blacklistThreshold > 0 && newFailureCount >= int64(blacklistThreshold)
+		updates := map[string]any{
+			"failure_count": newFailureCount,
+			"last_error":    update.ErrorMessage,
+			"last_error_at": time.Now(),
+		}
+		shouldBlacklist := blacklistThreshold > 0 &&
+			((blacklistOnFailure && update.Definitive) || newFailureCount >= int64(blacklistThreshold))
 		if shouldBlacklist {
 			updates["status"] = models.KeyStatusInvalid
 		}
@@ -203,27 +268,61 @@ func (p *KeyProvider) handleFailure(apiKey *models.APIKey, group *models.Group,
 			return fmt.Errorf("failed to update key stats in DB: %w", err)
 		}
 
+		if shouldBlacklist {
+			event := models.KeyEvent{
+				KeyID:        key.ID,
+				GroupID:      key.GroupID,
+				EventType:    models.KeyEventBlacklisted,
+				FromStatus:   models.KeyStatusActive,
+				ToStatus:     models.KeyStatusInvalid,
+				Source:       update.Source,
+				StatusCode:   update.StatusCode,
+				ErrorMessage: update.ErrorMessage,
+			}
+			if err := tx.Create(&event).Error; err != nil {
+				return fmt.Errorf("failed to record key event: %w", err)
+			}
+		}
+
 		if _, err := p.store.HIncrBy(keyHashKey, "failure_count", 1); err != nil {
 			return fmt.Errorf("failed to increment failure count in store: %w", err)
 		}
 
 		if shouldBlacklist {
 			logrus.WithFields(logrus.Fields{"keyID": apiKey.ID, "threshold": blacklistThreshold}).Warn("Key has reached blacklist threshold, disabling.")
-			if err := p.store.LRem(activeKeysListKey, 0, apiKey.ID); err != nil {
-				return fmt.Errorf("failed to LRem key from active list: %w", err)
+			if err := p.store.WeightedRemove(activeKeysKey, rotationMember(apiKey.ID)); err != nil {
+				return fmt.Errorf("failed to remove key from active keys: %w", err)
 			}
 			if err := p.store.HSet(keyHashKey, map[string]any{"status": models.KeyStatusInvalid}); err != nil {
 				return fmt.Errorf("failed to update key status to invalid in store: %w", err)
 			}
 		}
 
+		blacklisted = shouldBlacklist
 		return nil
 	})
+	if err == nil && blacklisted {
+		metrics.KeyBlacklistEvents.WithLabelValues(group.Name, update.Source).Inc()
+		p.alertBlacklisted(apiKey, group, update)
+	}
+	return err
+}
+
+// alertBlacklisted sends the blacklist alert and checks whether the group is running out of keys.
+func (p *KeyProvider) alertBlacklisted(apiKey *models.APIKey, group *models.Group, update StatusUpdate) {
+	p.alerts.KeyBlacklisted(group, apiKey, update.Source, update.StatusCode, update.ErrorMessage)
+
+	var activeKeys int64
+	if err := p.db.Model(&models.APIKey{}).Scopes(apiKey.KeyOwner().Scope).Where("status = ?", models.KeyStatusActive).Count(&activeKeys).Error; err != nil {
+		logrus.WithError(err).Warnf("Failed to count active keys of group %s for alerts", group.Name)
+		return
+	}
+	p.alerts.CheckActiveKeys(group, activeKeys)
 }
 
 // LoadKeysFromDB 从数据库加载所有分组和密钥，并填充到 Store 中。
 func (p *KeyProvider) LoadKeysFromDB() error {
-	initFlagKey := "initialization:db_keys_loaded"
+	initFlagKey := keysLoadedFlagKey
 
 	exists, err := p.store.Exists(initFlagKey)
 	if err != nil {
@@ -238,7 +337,7 @@ func (p *KeyProvider) LoadKeysFromDB() error {
 	logrus.Debug("First time startup, loading keys from DB...")
 
 	// 1. 分批从数据库加载并使用 Pipeline 写入 Redis
-	allActiveKeyIDs := make(map[uint][]any)
+	allActiveKeys := make(map[string]map[string]int) // 按有效密钥轮换的 store key 分组
 	batchSize := 1000
 	var batchKeys []*models.APIKey
 
@@ -252,7 +351,10 @@ func (p *KeyProvider) LoadKeysFromDB() error {
 
 		for _, key := range batchKeys {
 			keyHashKey := fmt.Sprintf("key:%d", key.ID)
-			keyDetails := p.apiKeyToMap(key)
+			keyDetails, err := p.apiKeyToMap(key)
+			if err != nil {
+				return err
+			}
 
 			if pipeline != nil {
 				pipeline.HSet(keyHashKey, keyDetails)
@@ -263,7 +365,11 @@ func (p *KeyProvider) LoadKeysFromDB() error {
 			}
 
 			if key.Status == models.KeyStatusActive {
-				allActiveKeyIDs[key.GroupID] = append(allActiveKeyIDs[key.GroupID], key.ID)
+				activeKeysKey := key.KeyOwner().ActiveKeysKey()
+				if allActiveKeys[activeKeysKey] == nil {
+					allActiveKeys[activeKeysKey] = make(map[string]int)
+				}
+				maps.Copy(allActiveKeys[activeKeysKey], rotationWeights(key))
 			}
 		}
 
@@ -279,15 +385,12 @@ func (p *KeyProvider) LoadKeysFromDB() error {
 		return fmt.Errorf("failed during batch processing of keys: %w", err)
 	}
 
-	// 2. 更新所有分组的 active_keys 列表
-	logrus.Info("Updating active key lists for all groups...")
-	for groupID, activeIDs := range allActiveKeyIDs {
-		if len(activeIDs) > 0 {
-			activeKeysListKey := fmt.Sprintf("group:%d:active_keys", groupID)
-			p.store.Delete(activeKeysListKey)
-			if err := p.store.LPush(activeKeysListKey, activeIDs...); err != nil {
-				logrus.WithFields(logrus.Fields{"groupID": groupID, "error": err}).Error("Failed to LPush active keys for group")
-			}
+	// 2. 更新所有分组和密钥池的有效密钥轮换
+	logrus.Info("Updating active keys for all groups and key pools...")
+	for activeKeysKey, weights := range allActiveKeys {
+		p.store.WeightedClear(activeKeysKey)
+		if err := p.store.WeightedAdd(activeKeysKey, weights); err != nil {
+			logrus.WithFields(logrus.Fields{"rotation": activeKeysKey, "error": err}).Error("Failed to add active keys")
 		}
 	}
 
@@ -298,75 +401,133 @@ func (p *KeyProvider) LoadKeysFromDB() error {
 	return nil
 }
 
-// AddKeys 批量添加新的 Key 到池和数据库中。
-func (p *KeyProvider) AddKeys(groupID uint, keys []models.APIKey) error {
-	if len(keys) == 0 {
-		return nil
+// ReloadKeysIntoStore 清除初始化标记并重新从数据库加载所有密钥到 store。
+func (p *KeyProvider) ReloadKeysIntoStore() error {
+	if err := p.store.Delete(keysLoadedFlagKey); err != nil {
+		return fmt.Errorf("failed to clear initialization flag: %w", err)
 	}
+	return p.LoadKeysFromDB()
+}
 
-	err := p.db.Transaction(func(tx *gorm.DB) error {
-		if err := tx.Create(&keys).Error; err != nil {
-			return err
+// RebuildStore 清空所有分组和密钥池的有效密钥列表后从数据库重新加载，用于修复 store 与数据库不一致的情况。
+func (p *KeyProvider) RebuildStore() error {
+	var groupIDs, poolIDs []uint
+	if err := p.db.Model(&models.Group{}).Pluck("id", &groupIDs).Error; err != nil {
+		return fmt.Errorf("failed to list groups: %w", err)
+	}
+	if err := p.db.Model(&models.KeyPool{}).Pluck("id", &poolIDs).Error; err != nil {
+		return fmt.Errorf("failed to list key pools: %w", err)
+	}
+	owners := make([]models.KeyOwner, 0, len(groupIDs)+len(poolIDs))
+	for _, groupID := range groupIDs {
+		owners = append(owners, models.KeyOwner{GroupID: groupID})
+	}
+	for _, poolID := range poolIDs {
+		owners = append(owners, models.PoolKeyOwner(poolID))
+	}
+	for _, owner := range owners {
+		if err := p.store.WeightedClear(owner.ActiveKeysKey()); err != nil {
+			return fmt.Errorf("failed to clear active keys of %s: %w", owner, err)
 		}
+	}
+	return p.ReloadKeysIntoStore()
+}
 
-		for _, key := range keys {
-			if err := p.addKeyToStore(&key); err != nil {
-				logrus.WithFields(logrus.Fields{"keyID": key.ID, "error": err}).Error("Failed to add key to store after DB creation, rolling back transaction")
-				return err
-			}
-		}
+// AddKeys 批量添加新的 Key 到分组或密钥池和数据库中。
+func (p *KeyProvider) AddKeys(owner models.KeyOwner, keys []models.APIKey) error {
+	if len(keys) == 0 {
 		return nil
+	}
+	changes := &StoreChanges{}
+	err := p.db.Transaction(func(tx *gorm.DB) error {
+		return p.AddKeysInTx(tx, owner, keys, changes)
 	})
+	if err != nil {
+		return err
+	}
+	return p.ApplyStoreChanges(changes)
+}
 
-	return err
+// AddKeysInTx 在调用方的事务中添加 Key，store 的更新记录在 changes 中，由调用方在事务提交后应用。
+func (p *KeyProvider) AddKeysInTx(tx *gorm.DB, owner models.KeyOwner, keys []models.APIKey, changes *StoreChanges) error {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	for i := range keys {
+		owner.Assign(&keys[i])
+		keys[i].KeyHash = p.encryptionService.Hash(keys[i].KeyValue)
+	}
+
+	if err := tx.Create(&keys).Error; err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		changes.addKey(key)
+	}
+	return nil
 }
 
 // RemoveKeys 批量从池和数据库中移除 Key。
-func (p *KeyProvider) RemoveKeys(groupID uint, keyValues []string) (int64, error) {
+func (p *KeyProvider) RemoveKeys(owner models.KeyOwner, keyValues []string) (int64, error) {
 	if len(keyValues) == 0 {
 		return 0, nil
 	}
 
-	var keysToDelete []models.APIKey
 	var deletedCount int64
-
+	changes := &StoreChanges{}
 	err := p.db.Transaction(func(tx *gorm.DB) error {
-		if err := tx.Where("group_id = ? AND key_value IN ?", groupID, keyValues).Find(&keysToDelete).Error; err != nil {
-			return err
-		}
+		var err error
+		deletedCount, err = p.RemoveKeysInTx(tx, owner, keyValues, changes)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return deletedCount, p.ApplyStoreChanges(changes)
+}
 
-		if len(keysToDelete) == 0 {
-			return nil
-		}
+// RemoveKeysInTx 在调用方的事务中移除 Key，store 的清理记录在 changes 中，由调用方在事务提交后应用。
+func (p *KeyProvider) RemoveKeysInTx(tx *gorm.DB, owner models.KeyOwner, keyValues []string, changes *StoreChanges) (int64, error) {
+	if len(keyValues) == 0 {
+		return 0, nil
+	}
 
-		keyIDsToDelete := pluckIDs(keysToDelete)
+	var keysToDelete []models.APIKey
+	if err := tx.Scopes(owner.Scope).Where("key_hash IN ?", p.hashKeys(keyValues)).Find(&keysToDelete).Error; err != nil {
+		return 0, err
+	}
 
-		result := tx.Where("id IN ?", keyIDsToDelete).Delete(&models.APIKey{})
-		if result.Error != nil {
-			return result.Error
-		}
-		deletedCount = result.RowsAffected
+	if len(keysToDelete) == 0 {
+		return 0, nil
+	}
 
-		for _, key := range keysToDelete {
-			if err := p.removeKeyFromStore(key.ID, key.GroupID); err != nil {
-				logrus.WithFields(logrus.Fields{"keyID": key.ID, "error": err}).Error("Failed to remove key from store after DB deletion, rolling back transaction")
-				return err
-			}
-		}
+	keyIDsToDelete := pluckIDs(keysToDelete)
 
-		return nil
-	})
+	result := tx.Where("id IN ?", keyIDsToDelete).Delete(&models.APIKey{})
+	if result.Error != nil {
+		return 0, result.Error
+	}
+
+	if err := tx.Where("key_id IN ?", keyIDsToDelete).Delete(&models.KeyEvent{}).Error; err != nil {
+		return 0, err
+	}
 
-	return deletedCount, err
+	for _, key := range keysToDelete {
+		changes.removeKey(key.ID, key.KeyOwner())
+	}
+
+	return result.RowsAffected, nil
 }
 
-// RestoreKeys 恢复组内所有无效的 Key。
-func (p *KeyProvider) RestoreKeys(groupID uint) (int64, error) {
+// RestoreKeys 恢复分组或密钥池内所有无效的 Key。
+func (p *KeyProvider) RestoreKeys(owner models.KeyOwner) (int64, error) {
 	var invalidKeys []models.APIKey
 	var restoredCount int64
 
 	err := p.db.Transaction(func(tx *gorm.DB) error {
-		if err := tx.Where("group_id = ? AND status = ?", groupID, models.KeyStatusInvalid).Find(&invalidKeys).Error; err != nil {
+		if err := tx.Scopes(owner.Scope).Where("status = ?", models.KeyStatusInvalid).Find(&invalidKeys).Error; err != nil {
 			return err
 		}
 
@@ -378,12 +539,16 @@ func (p *KeyProvider) RestoreKeys(groupID uint) (int64, error) {
 			"status":        models.KeyStatusActive,
 			"failure_count": 0,
 		}
-		result := tx.Model(&models.APIKey{}).Where("group_id = ? AND status = ?", groupID, models.KeyStatusInvalid).Updates(updates)
+		result := tx.Model(&models.APIKey{}).Scopes(owner.Scope).Where("status = ?", models.KeyStatusInvalid).Updates(updates)
 		if result.Error != nil {
 			return result.Error
 		}
 		restoredCount = result.RowsAffected
 
+		if err := tx.Create(newRestoreEvents(invalidKeys)).Error; err != nil {
+			return err
+		}
+
 		for _, key := range invalidKeys {
 			key.Status = models.KeyStatusActive
 			key.FailureCount = 0
@@ -399,7 +564,7 @@ func (p *KeyProvider) RestoreKeys(groupID uint) (int64, error) {
 }
 
 // RestoreMultipleKeys 恢复指定的 Key。
-func (p *KeyProvider) RestoreMultipleKeys(groupID uint, keyValues []string) (int64, error) {
+func (p *KeyProvider) RestoreMultipleKeys(owner models.KeyOwner, keyValues []string) (int64, error) {
 	if len(keyValues) == 0 {
 		return 0, nil
 	}
@@ -409,7 +574,7 @@ func (p *KeyProvider) RestoreMultipleKeys(groupID uint, keyValues []string) (int
 
 	err := p.db.Transaction(func(tx *gorm.DB) error {
 		// 1. 查找要恢复的密钥
-		if err := tx.Where("group_id = ? AND key_value IN ? AND status = ?", groupID, keyValues, models.KeyStatusInvalid).Find(&keysToRestore).Error; err != nil {
+		if err := tx.Scopes(owner.Scope).Where("key_hash IN ? AND status = ?", p.hashKeys(keyValues), models.KeyStatusInvalid).Find(&keysToRestore).Error; err != nil {
 			return err
 		}
 
@@ -430,6 +595,10 @@ func (p *KeyProvider) RestoreMultipleKeys(groupID uint, keyValues []string) (int
 		}
 		restoredCount = result.RowsAffected
 
+		if err := tx.Create(newRestoreEvents(keysToRestore)).Error; err != nil {
+			return err
+		}
+
 		// 3. 将密钥添加回 Redis
 		for _, key := range keysToRestore {
 			key.Status = models.KeyStatusActive
@@ -447,24 +616,24 @@ func (p *KeyProvider) RestoreMultipleKeys(groupID uint, keyValues []string) (int
 	return restoredCount, err
 }
 
-// RemoveInvalidKeys 移除组内所有无效的 Key。
-func (p *KeyProvider) RemoveInvalidKeys(groupID uint) (int64, error) {
-	return p.removeKeysByStatus(groupID, models.KeyStatusInvalid)
+// RemoveInvalidKeys 移除分组或密钥池内所有无效的 Key。
+func (p *KeyProvider) RemoveInvalidKeys(owner models.KeyOwner) (int64, error) {
+	return p.removeKeysByStatus(owner, models.KeyStatusInvalid)
 }
 
-// RemoveAllKeys 移除组内所有的 Key。
-func (p *KeyProvider) RemoveAllKeys(groupID uint) (int64, error) {
-	return p.removeKeysByStatus(groupID)
+// RemoveAllKeys 移除分组或密钥池内所有的 Key。
+func (p *KeyProvider) RemoveAllKeys(owner models.KeyOwner) (int64, error) {
+	return p.removeKeysByStatus(owner)
 }
 
 // removeKeysByStatus is a generic function to remove keys by status.
-// If no status is provided, it removes all keys in the group.
-func (p *KeyProvider) removeKeysByStatus(groupID uint, status ...string) (int64, error) {
+// If no status is provided, it removes all keys of the owner.
+func (p *KeyProvider) removeKeysByStatus(owner models.KeyOwner, status ...string) (int64, error) {
 	var keysToRemove []models.APIKey
 	var removedCount int64
 
 	err := p.db.Transaction(func(tx *gorm.DB) error {
-		query := tx.Where("group_id = ?", groupID)
+		query := tx.Scopes(owner.Scope)
 		if len(status) > 0 {
 			query = query.Where("status IN ?", status)
 		}
@@ -477,7 +646,7 @@ func (p *KeyProvider) removeKeysByStatus(groupID uint, status ...string) (int64,
 			return nil
 		}
 
-		deleteQuery := tx.Where("group_id = ?", groupID)
+		deleteQuery := tx.Scopes(owner.Scope)
 		if len(status) > 0 {
 			deleteQuery = deleteQuery.Where("status IN ?", status)
 		}
@@ -487,8 +656,12 @@ func (p *KeyProvider) removeKeysByStatus(groupID uint, status ...string) (int64,
 		}
 		removedCount = result.RowsAffected
 
+		if err := tx.Where("key_id IN ?", pluckIDs(keysToRemove)).Delete(&models.KeyEvent{}).Error; err != nil {
+			return err
+		}
+
 		for _, key := range keysToRemove {
-			if err := p.removeKeyFromStore(key.ID, key.GroupID); err != nil {
+			if err := p.removeKeyFromStore(key.ID, key.KeyOwner()); err != nil {
 				logrus.WithFields(logrus.Fields{"keyID": key.ID, "error": err}).Error("Failed to remove key from store after DB deletion, rolling back transaction")
 				return err
 			}
@@ -499,21 +672,114 @@ func (p *KeyProvider) removeKeysByStatus(groupID uint, status ...string) (int64,
 	return removedCount, err
 }
 
+// UpdateKeyMetadata 批量更新分组或密钥池内指定 Key 的元数据，权重变化会同步到活跃列表。
+func (p *KeyProvider) UpdateKeyMetadata(owner models.KeyOwner, keyValues []string, updates map[string]any) (int64, error) {
+	if len(keyValues) == 0 || len(updates) == 0 {
+		return 0, nil
+	}
+
+	var keysToUpdate []models.APIKey
+	var updatedCount int64
+
+	err := p.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Scopes(owner.Scope).Where("key_hash IN ?", p.hashKeys(keyValues)).Find(&keysToUpdate).Error; err != nil {
+			return err
+		}
+
+		if len(keysToUpdate) == 0 {
+			return nil
+		}
+
+		if err := tx.Model(&models.APIKey{}).Where("id IN ?", pluckIDs(keysToUpdate)).Updates(updates).Error; err != nil {
+			return err
+		}
+		// MySQL 的 RowsAffected 不计入值未变化的行，因此按更新前查到的 Key 计数
+		updatedCount = int64(len(keysToUpdate))
+
+		if !touchesStoreFields(updates) {
+			return nil
+		}
+
+		// Reload the keys so the store receives the updated weight, headers and bindings.
+		var updatedKeys []models.APIKey
+		if err := tx.Where("id IN ?", pluckIDs(keysToUpdate)).Find(&updatedKeys).Error; err != nil {
+			return err
+		}
+		for _, key := range updatedKeys {
+			if err := p.addKeyToStore(&key); err != nil {
+				logrus.WithFields(logrus.Fields{"keyID": key.ID, "error": err}).Error("Failed to update key in store, rolling back transaction")
+				return err
+			}
+		}
+		return nil
+	})
+
+	return updatedCount, err
+}
+
+// DisableExpiredKeys 将所有已过期的有效 Key 标记为无效并移出活跃列表。
+func (p *KeyProvider) DisableExpiredKeys() (int64, error) {
+	var expiredKeys []models.APIKey
+	var disabledCount int64
+
+	err := p.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Where("status = ? AND expires_at IS NOT NULL AND expires_at <= ?", models.KeyStatusActive, now).Find(&expiredKeys).Error; err != nil {
+			return err
+		}
+
+		if len(expiredKeys) == 0 {
+			return nil
+		}
+
+		if err := tx.Model(&models.APIKey{}).Where("id IN ?", pluckIDs(expiredKeys)).Update("status", models.KeyStatusInvalid).Error; err != nil {
+			return err
+		}
+		disabledCount = int64(len(expiredKeys))
+
+		events := make([]models.KeyEvent, len(expiredKeys))
+		for i, key := range expiredKeys {
+			events[i] = models.KeyEvent{
+				KeyID:      key.ID,
+				GroupID:    key.GroupID,
+				EventType:  models.KeyEventExpired,
+				FromStatus: models.KeyStatusActive,
+				ToStatus:   models.KeyStatusInvalid,
+				Source:     models.KeyEventSourceSystem,
+			}
+		}
+		if err := tx.Create(&events).Error; err != nil {
+			return err
+		}
+
+		for _, key := range expiredKeys {
+			if err := p.store.WeightedRemove(key.KeyOwner().ActiveKeysKey(), rotationMember(key.ID)); err != nil {
+				return fmt.Errorf("failed to remove expired key %d from active keys: %w", key.ID, err)
+			}
+			keyHashKey := fmt.Sprintf("key:%d", key.ID)
+			if err := p.store.HSet(keyHashKey, map[string]any{"status": models.KeyStatusInvalid}); err != nil {
+				return fmt.Errorf("failed to update expired key %d status in store: %w", key.ID, err)
+			}
+		}
+		return nil
+	})
+
+	return disabledCount, err
+}
+
 // RemoveKeysFromStore 直接从内存存储中移除指定的键，不涉及数据库操作
 // 这个方法适用于数据库已经删除但需要清理内存存储的场景
-func (p *KeyProvider) RemoveKeysFromStore(groupID uint, keyIDs []uint) error {
+func (p *KeyProvider) RemoveKeysFromStore(owner models.KeyOwner, keyIDs []uint) error {
 	if len(keyIDs) == 0 {
 		return nil
 	}
 
-	activeKeysListKey := fmt.Sprintf("group:%d:active_keys", groupID)
-
-	// 第一步：直接删除整个 active_keys 列表
-	if err := p.store.Delete(activeKeysListKey); err != nil {
+	// 第一步：直接删除整个有效密钥轮换
+	if err := p.store.WeightedClear(owner.ActiveKeysKey()); err != nil {
 		logrus.WithFields(logrus.Fields{
-			"groupID": groupID,
-			"error":   err,
-		}).Error("Failed to delete active keys list")
+			"owner": owner.String(),
+			"error": err,
+		}).Error("Failed to delete active keys")
 		return err
 	}
 
@@ -529,9 +795,9 @@ func (p *KeyProvider) RemoveKeysFromStore(groupID uint, keyIDs []uint) error {
 	}
 
 	logrus.WithFields(logrus.Fields{
-		"groupID":  groupID,
+		"owner":    owner.String(),
 		"keyCount": len(keyIDs),
-	}).Info("Successfully cleaned up group keys from store")
+	}).Info("Successfully cleaned up keys from store")
 
 	return nil
 }
@@ -540,29 +806,28 @@ func (p *KeyProvider) RemoveKeysFromStore(groupID uint, keyIDs []uint) error {
 func (p *KeyProvider) addKeyToStore(key *models.APIKey) error {
 	// 1. Store key details in HASH
 	keyHashKey := fmt.Sprintf("key:%d", key.ID)
-	keyDetails := p.apiKeyToMap(key)
+	keyDetails, err := p.apiKeyToMap(key)
+	if err != nil {
+		return err
+	}
 	if err := p.store.HSet(keyHashKey, keyDetails); err != nil {
 		return fmt.Errorf("failed to HSet key details for key %d: %w", key.ID, err)
 	}
 
-	// 2. If active, add to the active LIST
+	// 2. If active, add to the active keys, or update its weight
 	if key.Status == models.KeyStatusActive {
-		activeKeysListKey := fmt.Sprintf("group:%d:active_keys", key.GroupID)
-		if err := p.store.LRem(activeKeysListKey, 0, key.ID); err != nil {
-			return fmt.Errorf("failed to LRem key %d before LPush for group %d: %w", key.ID, key.GroupID, err)
-		}
-		if err := p.store.LPush(activeKeysListKey, key.ID); err != nil {
-			return fmt.Errorf("failed to LPush key %d to group %d: %w", key.ID, key.GroupID, err)
+		owner := key.KeyOwner()
+		if err := p.store.WeightedAdd(owner.ActiveKeysKey(), rotationWeights(key)); err != nil {
+			return fmt.Errorf("failed to add key %d to %s: %w", key.ID, owner, err)
 		}
 	}
 	return nil
 }
 
 // removeKeyFromStore is a helper to remove a single key from the cache.
-func (p *KeyProvider) removeKeyFromStore(keyID, groupID uint) error {
-	activeKeysListKey := fmt.Sprintf("group:%d:active_keys", groupID)
-	if err := p.store.LRem(activeKeysListKey, 0, keyID); err != nil {
-		logrus.WithFields(logrus.Fields{"keyID": keyID, "groupID": groupID, "error": err}).Error("Failed to LRem key from active list")
+func (p *KeyProvider) removeKeyFromStore(keyID uint, owner models.KeyOwner) error {
+	if err := p.store.WeightedRemove(owner.ActiveKeysKey(), rotationMember(keyID)); err != nil {
+		logrus.WithFields(logrus.Fields{"keyID": keyID, "owner": owner.String(), "error": err}).Error("Failed to remove key from active keys")
 	}
 
 	keyHashKey := fmt.Sprintf("key:%d", keyID)
@@ -573,15 +838,72 @@ func (p *KeyProvider) removeKeyFromStore(keyID, groupID uint) error {
 }
 
 // apiKeyToMap converts an APIKey model to a map for HSET.
-func (p *KeyProvider) apiKeyToMap(key *models.APIKey) map[string]any {
+// The key value is stored encrypted when encryption is enabled.
+func (p *KeyProvider) apiKeyToMap(key *models.APIKey) (map[string]any, error) {
+	keyString, err := p.encryptionService.Encrypt(key.KeyValue)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt key %d: %w", key.ID, err)
+	}
+
 	return map[string]any{
 		"id":            fmt.Sprint(key.ID),
-		"key_string":    key.KeyValue,
+		"key_string":    keyString,
 		"status":        key.Status,
 		"failure_count": key.FailureCount,
 		"group_id":      key.GroupID,
+		"pool_id":       key.PoolID,
+		"weight":        key.RotationWeight(),
+		"header_rules":  string(key.HeaderRules),
+		"upstream_url":  key.UpstreamURL,
+		"proxy_url":     key.ProxyURL,
 		"created_at":    key.CreatedAt.Unix(),
+	}, nil
+}
+
+// hashKeys returns the deduplication hashes of the given key values.
+func (p *KeyProvider) hashKeys(keyValues []string) []string {
+	hashes := make([]string, len(keyValues))
+	for i, keyValue := range keyValues {
+		hashes[i] = p.encryptionService.Hash(keyValue)
+	}
+	return hashes
+}
+
+// touchesStoreFields reports whether the updates change any field cached in the key's store hash.
+func touchesStoreFields(updates map[string]any) bool {
+	for _, field := range []string{"weight", "header_rules", "upstream_url", "proxy_url"} {
+		if _, ok := updates[field]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// rotationMember returns the member of a key in the active keys rotation of its group or key pool.
+func rotationMember(keyID uint) string {
+	return strconv.FormatUint(uint64(keyID), 10)
+}
+
+// rotationWeights returns the member and weight of a key for the active keys rotation,
+// which selects the key in proportion to its weight.
+func rotationWeights(key *models.APIKey) map[string]int {
+	return map[string]int{rotationMember(key.ID): key.RotationWeight()}
+}
+
+// newRestoreEvents builds the key events recorded when invalid keys are restored manually.
+func newRestoreEvents(keys []models.APIKey) []models.KeyEvent {
+	events := make([]models.KeyEvent, len(keys))
+	for i, key := range keys {
+		events[i] = models.KeyEvent{
+			KeyID:      key.ID,
+			GroupID:    key.GroupID,
+			EventType:  models.KeyEventRestored,
+			FromStatus: models.KeyStatusInvalid,
+			ToStatus:   models.KeyStatusActive,
+			Source:     models.KeyEventSourceManual,
+		}
 	}
+	return events
 }
 
 // pluckIDs extracts IDs from a slice of APIKey.
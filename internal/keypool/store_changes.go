@@ -0,0 +1,118 @@
+package keypool
+
+import (
+	"fmt"
+	"gpt-load/internal/models"
+	"slices"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// StoreChanges collects the store updates of the keys changed in a transaction.
+// They are applied with ApplyStoreChanges once the transaction commits, so that a rolled back
+// transaction leaves the store untouched. The zero value is ready to use.
+type StoreChanges struct {
+	changes []storeChange
+}
+
+// storeChange is a key written to the store, a key removed from it, or all keys of a deleted owner.
+type storeChange struct {
+	key    *models.APIKey
+	owner  models.KeyOwner
+	keyIDs []uint
+	clear  bool
+}
+
+// addKey records a key whose details and rotation membership are written to the store.
+func (c *StoreChanges) addKey(key models.APIKey) {
+	c.changes = append(c.changes, storeChange{key: &key, owner: key.KeyOwner()})
+}
+
+// removeKey records a key removed from the store of its owner.
+func (c *StoreChanges) removeKey(keyID uint, owner models.KeyOwner) {
+	c.changes = append(c.changes, storeChange{owner: owner, keyIDs: []uint{keyID}})
+}
+
+// RemoveOwnerKeys records that all keys of an owner are removed from the store, used when a group is deleted.
+func (c *StoreChanges) RemoveOwnerKeys(owner models.KeyOwner, keyIDs []uint) {
+	if len(keyIDs) == 0 {
+		return
+	}
+	c.changes = append(c.changes, storeChange{owner: owner, keyIDs: keyIDs, clear: true})
+}
+
+// owners returns the owners whose keys are changed, and the IDs of the removed keys.
+func (c *StoreChanges) owners() ([]models.KeyOwner, []uint) {
+	var owners []models.KeyOwner
+	var removedKeyIDs []uint
+	for _, change := range c.changes {
+		if !slices.Contains(owners, change.owner) {
+			owners = append(owners, change.owner)
+		}
+		if change.key == nil {
+			removedKeyIDs = append(removedKeyIDs, change.keyIDs...)
+		}
+	}
+	return owners, removedKeyIDs
+}
+
+// ApplyStoreChanges applies the store changes of a committed transaction in order.
+// When a change fails, the keys of the affected groups and key pools are reloaded from the database instead.
+func (p *KeyProvider) ApplyStoreChanges(changes *StoreChanges) error {
+	for _, change := range changes.changes {
+		if err := p.applyStoreChange(change); err != nil {
+			logrus.WithError(err).Error("Failed to apply key changes to the store, reloading the affected keys from the database")
+			owners, removedKeyIDs := changes.owners()
+			if err := p.reloadOwners(owners, removedKeyIDs); err != nil {
+				return fmt.Errorf("the keys were saved, but the store could not be updated: %w", err)
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+func (p *KeyProvider) applyStoreChange(change storeChange) error {
+	switch {
+	case change.key != nil:
+		return p.addKeyToStore(change.key)
+	case change.clear:
+		return p.RemoveKeysFromStore(change.owner, change.keyIDs)
+	default:
+		for _, keyID := range change.keyIDs {
+			if err := p.removeKeyFromStore(keyID, change.owner); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// reloadOwners deletes the removed keys from the store and reloads the keys of the owners from the database.
+func (p *KeyProvider) reloadOwners(owners []models.KeyOwner, removedKeyIDs []uint) error {
+	for _, keyID := range removedKeyIDs {
+		if err := p.store.Delete(fmt.Sprintf("key:%d", keyID)); err != nil {
+			return fmt.Errorf("failed to delete key %d from store: %w", keyID, err)
+		}
+	}
+
+	for _, owner := range owners {
+		if err := p.store.WeightedClear(owner.ActiveKeysKey()); err != nil {
+			return fmt.Errorf("failed to clear active keys of %s: %w", owner, err)
+		}
+		var keys []models.APIKey
+		err := p.db.Scopes(owner.Scope).FindInBatches(&keys, 1000, func(tx *gorm.DB, batch int) error {
+			for i := range keys {
+				if err := p.addKeyToStore(&keys[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error
+		if err != nil {
+			return fmt.Errorf("failed to reload the keys of %s: %w", owner, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,235 @@
+package keypool
+
+import (
+	"gpt-load/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// Key transfer modes
+const (
+	KeyTransferMove = "move"
+	KeyTransferCopy = "copy"
+)
+
+// Policies for keys that already exist in the target group of a transfer
+const (
+	// KeyConflictSkip leaves the key as it is in both groups.
+	KeyConflictSkip = "skip"
+	// KeyConflictKeepTarget keeps the key of the target group, a moved key is removed from the source group.
+	KeyConflictKeepTarget = "keep_target"
+	// KeyConflictOverwrite replaces the key of the target group with the status, counts and metadata of the source key.
+	KeyConflictOverwrite = "overwrite"
+)
+
+// KeyTransferResult holds the result of a key transfer between two groups.
+type KeyTransferResult struct {
+	TransferredCount int `json:"transferred_count"`
+	OverwrittenCount int `json:"overwritten_count"`
+	MergedCount      int `json:"merged_count"`
+	SkippedCount     int `json:"skipped_count"`
+}
+
+// Add adds the counts of another transfer, used to sum the results of several batches.
+func (r *KeyTransferResult) Add(other *KeyTransferResult) {
+	r.TransferredCount += other.TransferredCount
+	r.OverwrittenCount += other.OverwrittenCount
+	r.MergedCount += other.MergedCount
+	r.SkippedCount += other.SkippedCount
+}
+
+// TransferKeys 在一个事务中将源分组（或密钥池）的指定 Key 移动或复制到目标分组（或密钥池），事务提交后更新 store。
+// 移动保留 Key 的 ID 和状态历史，复制创建带有相同状态、计数和元数据的新 Key。
+func (p *KeyProvider) TransferKeys(source, target models.KeyOwner, keyIDs []uint, mode, onConflict string) (*KeyTransferResult, error) {
+	result := &KeyTransferResult{}
+	if len(keyIDs) == 0 {
+		return result, nil
+	}
+
+	changes := &StoreChanges{}
+	err := p.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		result, err = p.TransferKeysInTx(tx, source, target, keyIDs, mode, onConflict, changes)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.ApplyStoreChanges(changes); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// TransferKeysInTx 在调用方的事务中移动或复制 Key，store 的更新记录在 changes 中，由调用方在事务提交后应用。
+func (p *KeyProvider) TransferKeysInTx(tx *gorm.DB, source, target models.KeyOwner, keyIDs []uint, mode, onConflict string, changes *StoreChanges) (*KeyTransferResult, error) {
+	result := &KeyTransferResult{}
+	if len(keyIDs) == 0 {
+		return result, nil
+	}
+
+	var sourceKeys []models.APIKey
+	if err := tx.Scopes(source.Scope).Where("id IN ?", keyIDs).Find(&sourceKeys).Error; err != nil {
+		return nil, err
+	}
+	if len(sourceKeys) == 0 {
+		return result, nil
+	}
+
+	hashes := make([]string, len(sourceKeys))
+	for i, key := range sourceKeys {
+		hashes[i] = key.KeyHash
+	}
+	var targetKeys []models.APIKey
+	if err := tx.Scopes(target.Scope).Where("key_hash IN ?", hashes).Find(&targetKeys).Error; err != nil {
+		return nil, err
+	}
+	targetByHash := make(map[string]models.APIKey, len(targetKeys))
+	for _, key := range targetKeys {
+		targetByHash[key.KeyHash] = key
+	}
+
+	var transferKeys, removedSourceKeys, replacedTargetKeys []models.APIKey
+	var overwrittenKeys [][2]models.APIKey
+	for _, key := range sourceKeys {
+		targetKey, exists := targetByHash[key.KeyHash]
+		if !exists {
+			transferKeys = append(transferKeys, key)
+			result.TransferredCount++
+			continue
+		}
+
+		switch {
+		case onConflict == KeyConflictOverwrite && mode == KeyTransferMove:
+			// 删除目标分组中的 Key，再移动源 Key，以保留其历史
+			replacedTargetKeys = append(replacedTargetKeys, targetKey)
+			transferKeys = append(transferKeys, key)
+			result.OverwrittenCount++
+		case onConflict == KeyConflictOverwrite:
+			overwrittenKeys = append(overwrittenKeys, [2]models.APIKey{key, targetKey})
+			result.OverwrittenCount++
+		case onConflict == KeyConflictKeepTarget && mode == KeyTransferMove:
+			removedSourceKeys = append(removedSourceKeys, key)
+			result.MergedCount++
+		default:
+			result.SkippedCount++
+		}
+	}
+
+	if err := p.deleteKeysInTx(tx, append(replacedTargetKeys, removedSourceKeys...), changes); err != nil {
+		return nil, err
+	}
+
+	for _, pair := range overwrittenKeys {
+		if err := p.overwriteKeyInTx(tx, &pair[0], &pair[1], changes); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(transferKeys) > 0 {
+		var err error
+		if mode == KeyTransferMove {
+			err = p.moveKeysInTx(tx, transferKeys, target, changes)
+		} else {
+			err = p.copyKeysInTx(tx, transferKeys, target, changes)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// moveKeysInTx moves the keys and their status history to the target owner, keeping their IDs.
+func (p *KeyProvider) moveKeysInTx(tx *gorm.DB, keys []models.APIKey, target models.KeyOwner, changes *StoreChanges) error {
+	ids := pluckIDs(keys)
+	if err := tx.Model(&models.APIKey{}).Where("id IN ?", ids).Updates(map[string]any{"group_id": target.GroupID, "pool_id": target.PoolID}).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&models.KeyEvent{}).Where("key_id IN ?", ids).Update("group_id", target.GroupID).Error; err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		changes.removeKey(key.ID, key.KeyOwner())
+		target.Assign(&key)
+		changes.addKey(key)
+	}
+	return nil
+}
+
+// copyKeysInTx creates copies of the keys for the target owner with the same status, counts and metadata.
+func (p *KeyProvider) copyKeysInTx(tx *gorm.DB, keys []models.APIKey, target models.KeyOwner, changes *StoreChanges) error {
+	copies := make([]models.APIKey, len(keys))
+	for i, key := range keys {
+		copies[i] = key
+		copies[i].ID = 0
+		target.Assign(&copies[i])
+	}
+	if err := tx.Create(&copies).Error; err != nil {
+		return err
+	}
+
+	for _, key := range copies {
+		changes.addKey(key)
+	}
+	return nil
+}
+
+// overwriteKeyInTx replaces the status, counts and metadata of the target key with those of the source key.
+func (p *KeyProvider) overwriteKeyInTx(tx *gorm.DB, source, target *models.APIKey, changes *StoreChanges) error {
+	updated := *source
+	updated.ID = target.ID
+	target.KeyOwner().Assign(&updated)
+	updated.CreatedAt = target.CreatedAt
+
+	if err := tx.Model(&models.APIKey{}).Where("id = ?", target.ID).Updates(keyStateUpdates(&updated)).Error; err != nil {
+		return err
+	}
+
+	// 状态可能由有效变为无效，先移出轮换再按新状态写入
+	changes.removeKey(target.ID, target.KeyOwner())
+	changes.addKey(updated)
+	return nil
+}
+
+// deleteKeysInTx deletes the keys with their status history from the database, and records their removal from the store.
+func (p *KeyProvider) deleteKeysInTx(tx *gorm.DB, keys []models.APIKey, changes *StoreChanges) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	ids := pluckIDs(keys)
+	if err := tx.Where("id IN ?", ids).Delete(&models.APIKey{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("key_id IN ?", ids).Delete(&models.KeyEvent{}).Error; err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		changes.removeKey(key.ID, key.KeyOwner())
+	}
+	return nil
+}
+
+// keyStateUpdates returns the status, counts and metadata of a key as column updates.
+func keyStateUpdates(key *models.APIKey) map[string]any {
+	return map[string]any{
+		"status":            key.Status,
+		"request_count":     key.RequestCount,
+		"failure_count":     key.FailureCount,
+		"last_used_at":      key.LastUsedAt,
+		"last_validated_at": key.LastValidatedAt,
+		"last_error":        key.LastError,
+		"last_error_at":     key.LastErrorAt,
+		"labels":            key.Labels,
+		"note":              key.Note,
+		"owner":             key.Owner,
+		"expires_at":        key.ExpiresAt,
+		"weight":            key.Weight,
+		"header_rules":      key.HeaderRules,
+		"upstream_url":      key.UpstreamURL,
+		"proxy_url":         key.ProxyURL,
+	}
+}
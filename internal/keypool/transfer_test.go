@@ -0,0 +1,267 @@
+package keypool
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"gpt-load/internal/encryption"
+	"gpt-load/internal/models"
+	"gpt-load/internal/store"
+	"gpt-load/internal/types"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// testConfig is a config manager without a master key, so keys are stored in plaintext.
+type testConfig struct {
+	types.ConfigManager
+}
+
+func (testConfig) GetEncryptionConfig() types.EncryptionConfig {
+	return types.EncryptionConfig{}
+}
+
+var (
+	transferSource = models.KeyOwner{GroupID: 1}
+	transferTarget = models.KeyOwner{GroupID: 2}
+)
+
+// newTransferProvider returns a provider whose source group has the keys "unique" and "shared",
+// and whose target group already has "shared" with another state.
+func newTransferProvider(t *testing.T) (*KeyProvider, map[string]uint) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewProvider(db, store.NewMemoryStore(), nil, encryption.NewService(testConfig{}), nil)
+	if err := db.AutoMigrate(&models.APIKey{}, &models.KeyEvent{}); err != nil {
+		t.Fatal(err)
+	}
+
+	keys := []models.APIKey{
+		{KeyValue: "sk-unique", KeyHash: "unique", Status: models.KeyStatusActive, Weight: 1, Note: "source"},
+		{KeyValue: "sk-shared", KeyHash: "shared", Status: models.KeyStatusActive, Weight: 3, Note: "source"},
+		{KeyValue: "sk-shared", KeyHash: "shared", Status: models.KeyStatusInvalid, Weight: 1, FailureCount: 5, Note: "target"},
+	}
+	transferSource.Assign(&keys[0])
+	transferSource.Assign(&keys[1])
+	transferTarget.Assign(&keys[2])
+	if err := db.Create(&keys).Error; err != nil {
+		t.Fatal(err)
+	}
+	for i := range keys {
+		if err := p.addKeyToStore(&keys[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	events := []models.KeyEvent{
+		{KeyID: keys[1].ID, GroupID: transferSource.GroupID, EventType: "created", Source: "test"},
+		{KeyID: keys[2].ID, GroupID: transferTarget.GroupID, EventType: "created", Source: "test"},
+	}
+	if err := db.Create(&events).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	return p, map[string]uint{"unique": keys[0].ID, "shared": keys[1].ID, "target": keys[2].ID}
+}
+
+// ownedKeys returns the keys of the owner by key hash.
+func ownedKeys(t *testing.T, p *KeyProvider, owner models.KeyOwner) map[string]models.APIKey {
+	t.Helper()
+	var keys []models.APIKey
+	if err := p.db.Scopes(owner.Scope).Find(&keys).Error; err != nil {
+		t.Fatal(err)
+	}
+	byHash := make(map[string]models.APIKey, len(keys))
+	for _, key := range keys {
+		byHash[key.KeyHash] = key
+	}
+	return byHash
+}
+
+// flakyStore fails the first writes of key details.
+type flakyStore struct {
+	store.Store
+	failures int
+}
+
+func (s *flakyStore) HSet(key string, values map[string]any) error {
+	if s.failures > 0 {
+		s.failures--
+		return errors.New("store unavailable")
+	}
+	return s.Store.HSet(key, values)
+}
+
+// activeKeyIDs returns the IDs of the keys selected from the rotation of the owner.
+func activeKeyIDs(t *testing.T, p *KeyProvider, owner models.KeyOwner) []uint {
+	t.Helper()
+	var ids []uint
+	for range 10 {
+		key, err := p.SelectKey(owner)
+		if err != nil {
+			break
+		}
+		if !slices.Contains(ids, key.ID) {
+			ids = append(ids, key.ID)
+		}
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func TestTransferKeysConflictPolicies(t *testing.T) {
+	tests := []struct {
+		mode, onConflict string
+		want             KeyTransferResult
+		// wantSource and wantTarget are the notes of the keys left in each group, by key hash.
+		wantSource, wantTarget map[string]string
+		// wantSharedID names the key of newTransferProvider whose ID the shared key of the target group keeps.
+		wantSharedID string
+	}{
+		{
+			mode: KeyTransferMove, onConflict: KeyConflictSkip,
+			want:       KeyTransferResult{TransferredCount: 1, SkippedCount: 1},
+			wantSource: map[string]string{"shared": "source"},
+			wantTarget: map[string]string{"unique": "source", "shared": "target"}, wantSharedID: "target",
+		},
+		{
+			mode: KeyTransferMove, onConflict: KeyConflictKeepTarget,
+			want:       KeyTransferResult{TransferredCount: 1, MergedCount: 1},
+			wantSource: map[string]string{},
+			wantTarget: map[string]string{"unique": "source", "shared": "target"}, wantSharedID: "target",
+		},
+		{
+			mode: KeyTransferMove, onConflict: KeyConflictOverwrite,
+			want:       KeyTransferResult{TransferredCount: 1, OverwrittenCount: 1},
+			wantSource: map[string]string{},
+			wantTarget: map[string]string{"unique": "source", "shared": "source"}, wantSharedID: "shared",
+		},
+		{
+			mode: KeyTransferCopy, onConflict: KeyConflictSkip,
+			want:       KeyTransferResult{TransferredCount: 1, SkippedCount: 1},
+			wantSource: map[string]string{"unique": "source", "shared": "source"},
+			wantTarget: map[string]string{"unique": "source", "shared": "target"}, wantSharedID: "target",
+		},
+		{
+			// 复制时源 Key 保留，keep_target 等同于 skip
+			mode: KeyTransferCopy, onConflict: KeyConflictKeepTarget,
+			want:       KeyTransferResult{TransferredCount: 1, SkippedCount: 1},
+			wantSource: map[string]string{"unique": "source", "shared": "source"},
+			wantTarget: map[string]string{"unique": "source", "shared": "target"}, wantSharedID: "target",
+		},
+		{
+			mode: KeyTransferCopy, onConflict: KeyConflictOverwrite,
+			want:       KeyTransferResult{TransferredCount: 1, OverwrittenCount: 1},
+			wantSource: map[string]string{"unique": "source", "shared": "source"},
+			wantTarget: map[string]string{"unique": "source", "shared": "source"}, wantSharedID: "target",
+		},
+	}
+
+	for _, tt := range tests {
+		name := tt.mode + "/" + tt.onConflict
+		t.Run(name, func(t *testing.T) {
+			p, ids := newTransferProvider(t)
+			result, err := p.TransferKeys(transferSource, transferTarget, []uint{ids["unique"], ids["shared"]}, tt.mode, tt.onConflict)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *result != tt.want {
+				t.Errorf("result = %+v, want %+v", *result, tt.want)
+			}
+
+			for owner, want := range map[models.KeyOwner]map[string]string{transferSource: tt.wantSource, transferTarget: tt.wantTarget} {
+				got := ownedKeys(t, p, owner)
+				if len(got) != len(want) {
+					t.Errorf("%s has %d keys, want %d", owner, len(got), len(want))
+				}
+				for hash, note := range want {
+					if got[hash].Note != note {
+						t.Errorf("%s key %s has note %q, want %q", owner, hash, got[hash].Note, note)
+					}
+				}
+			}
+
+			shared := ownedKeys(t, p, transferTarget)["shared"]
+			if shared.ID != ids[tt.wantSharedID] {
+				t.Errorf("shared target key ID = %d, want the ID of the %s key %d", shared.ID, tt.wantSharedID, ids[tt.wantSharedID])
+			}
+			if tt.wantTarget["shared"] == "source" && (shared.Status != models.KeyStatusActive || shared.Weight != 3 || shared.FailureCount != 0) {
+				t.Errorf("overwritten key = %+v, want the state of the source key", shared)
+			}
+
+			// store 与数据库保持一致
+			details, err := p.store.HGetAll(fmt.Sprintf("key:%d", shared.ID))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if details["group_id"] != fmt.Sprint(transferTarget.GroupID) || details["status"] != shared.Status {
+				t.Errorf("store details of key %d = %v, want them to match the database", shared.ID, details)
+			}
+			var events int64
+			p.db.Model(&models.KeyEvent{}).Where("key_id = ? AND group_id = ?", shared.ID, transferTarget.GroupID).Count(&events)
+			if events != 1 {
+				t.Errorf("shared target key has %d events in the target group, want 1", events)
+			}
+		})
+	}
+}
+
+func TestTransferKeysWithoutKeys(t *testing.T) {
+	p, _ := newTransferProvider(t)
+	result, err := p.TransferKeys(transferSource, transferTarget, nil, KeyTransferMove, KeyConflictOverwrite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *result != (KeyTransferResult{}) {
+		t.Errorf("result = %+v, want no transferred keys", *result)
+	}
+}
+
+func TestTransferKeysInTxRollbackLeavesStore(t *testing.T) {
+	p, ids := newTransferProvider(t)
+	changes := &StoreChanges{}
+	err := p.db.Transaction(func(tx *gorm.DB) error {
+		if _, err := p.TransferKeysInTx(tx, transferSource, transferTarget, []uint{ids["unique"], ids["shared"]}, KeyTransferMove, KeyConflictOverwrite, changes); err != nil {
+			return err
+		}
+		return errors.New("a later step failed")
+	})
+	if err == nil {
+		t.Fatal("expected the transaction to fail")
+	}
+
+	if got := activeKeyIDs(t, p, transferSource); !slices.Equal(got, []uint{ids["unique"], ids["shared"]}) {
+		t.Errorf("source rotation = %v, want the keys left in the source group", got)
+	}
+	if got := activeKeyIDs(t, p, transferTarget); len(got) != 0 {
+		t.Errorf("target rotation = %v, want no keys moved into the target group", got)
+	}
+	if details, _ := p.store.HGetAll(fmt.Sprintf("key:%d", ids["target"])); details["status"] != models.KeyStatusInvalid {
+		t.Errorf("the replaced target key should stay in the store, got %v", details)
+	}
+}
+
+func TestTransferKeysReloadsStoreWhenApplyFails(t *testing.T) {
+	p, ids := newTransferProvider(t)
+	p.store = &flakyStore{Store: p.store, failures: 1}
+
+	if _, err := p.TransferKeys(transferSource, transferTarget, []uint{ids["unique"], ids["shared"]}, KeyTransferMove, KeyConflictOverwrite); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := activeKeyIDs(t, p, transferSource); len(got) != 0 {
+		t.Errorf("source rotation = %v, want it empty after the move", got)
+	}
+	if got := activeKeyIDs(t, p, transferTarget); !slices.Equal(got, []uint{ids["unique"], ids["shared"]}) {
+		t.Errorf("target rotation = %v, want the moved keys", got)
+	}
+	if exists, _ := p.store.Exists(fmt.Sprintf("key:%d", ids["target"])); exists {
+		t.Error("the replaced target key should be removed from the store")
+	}
+}
@@ -2,10 +2,13 @@ package keypool
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"gpt-load/internal/channel"
 	"gpt-load/internal/config"
+	app_errors "gpt-load/internal/errors"
 	"gpt-load/internal/models"
+	"net/http"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -47,7 +50,41 @@ func NewKeyValidator(params KeyValidatorParams) *KeyValidator {
 }
 
 // ValidateSingleKey performs a validation check on a single API key.
-func (s *KeyValidator) ValidateSingleKey(key *models.APIKey, group *models.Group) (bool, error) {
+// The source identifies what triggered the validation and is recorded with any resulting key event.
+func (s *KeyValidator) ValidateSingleKey(key *models.APIKey, group *models.Group, source string) (bool, error) {
+	return s.validateKey(key, group, source, s.keypoolProvider.UpdateStatus)
+}
+
+// ValidateActiveKey performs a scheduled health check on an active API key.
+// A check the upstream rejects with 401/403 or an invalid response rule removes the key from the active pool immediately,
+// other failures count towards the blacklist threshold.
+func (s *KeyValidator) ValidateActiveKey(key *models.APIKey, group *models.Group) (bool, error) {
+	return s.validateKey(key, group, models.KeyEventSourceCron, s.keypoolProvider.UpdateHealthCheckStatus)
+}
+
+// CheckKey runs the channel validation for a key that is not in the pool yet.
+// Unlike ValidateSingleKey, it does not update the status of the key.
+func (s *KeyValidator) CheckKey(ctx context.Context, key *models.APIKey, group *models.Group) (bool, error) {
+	if group.EffectiveConfig.AppUrl == "" {
+		group.EffectiveConfig = s.SettingsManager.GetEffectiveConfig(group.Config)
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(group.EffectiveConfig.KeyValidationTimeoutSeconds)*time.Second)
+	defer cancel()
+
+	ch, err := s.channelFactory.GetChannel(group)
+	if err != nil {
+		return false, fmt.Errorf("failed to get channel for group %s: %w", group.Name, err)
+	}
+	return ch.ValidateKey(ctx, key, group)
+}
+
+// validateKey runs the channel validation for a key and reports the result through updateStatus.
+func (s *KeyValidator) validateKey(
+	key *models.APIKey,
+	group *models.Group,
+	source string,
+	updateStatus func(apiKey *models.APIKey, group *models.Group, update StatusUpdate),
+) (bool, error) {
 	if group.EffectiveConfig.AppUrl == "" {
 		group.EffectiveConfig = s.SettingsManager.GetEffectiveConfig(group.Config)
 	}
@@ -61,11 +98,20 @@ func (s *KeyValidator) ValidateSingleKey(key *models.APIKey, group *models.Group
 
 	isValid, validationErr := ch.ValidateKey(ctx, key, group)
 
-	var errorMsg string
+	update := StatusUpdate{IsSuccess: isValid, Source: source}
 	if !isValid && validationErr != nil {
-		errorMsg = validationErr.Error()
+		update.ErrorMessage = validationErr.Error()
+		var upstreamErr *app_errors.UpstreamError
+		if errors.As(validationErr, &upstreamErr) {
+			update.StatusCode = upstreamErr.StatusCode
+			update.Definitive = isDefinitiveRejection(upstreamErr)
+		}
+	}
+	updateStatus(key, group, update)
+
+	if err := s.DB.Model(&models.APIKey{}).Where("id = ?", key.ID).UpdateColumn("last_validated_at", time.Now()).Error; err != nil {
+		logrus.WithFields(logrus.Fields{"key_id": key.ID, "error": err}).Warn("Failed to update key last_validated_at")
 	}
-	s.keypoolProvider.UpdateStatus(key, group, isValid, errorMsg)
 
 	if !isValid {
 		logrus.WithFields(logrus.Fields{
@@ -90,7 +136,7 @@ func (s *KeyValidator) TestMultipleKeys(group *models.Group, keyValues []string)
 
 	// Find which of the provided keys actually exist in the database for this group
 	var existingKeys []models.APIKey
-	if err := s.DB.Where("group_id = ? AND key_value IN ?", group.ID, keyValues).Find(&existingKeys).Error; err != nil {
+	if err := s.DB.Scopes(group.KeyOwner().Scope).Where("key_hash IN ?", s.keypoolProvider.hashKeys(keyValues)).Find(&existingKeys).Error; err != nil {
 		return nil, fmt.Errorf("failed to query keys from DB: %w", err)
 	}
 	existingKeyMap := make(map[string]models.APIKey)
@@ -109,7 +155,7 @@ func (s *KeyValidator) TestMultipleKeys(group *models.Group, keyValues []string)
 			continue
 		}
 
-		isValid, validationErr := s.ValidateSingleKey(&apiKey, group)
+		isValid, validationErr := s.ValidateSingleKey(&apiKey, group, models.KeyEventSourceManual)
 
 		results[i] = KeyTestResult{
 			KeyValue: kv,
@@ -123,3 +169,9 @@ func (s *KeyValidator) TestMultipleKeys(group *models.Group, keyValues []string)
 
 	return results, nil
 }
+
+// isDefinitiveRejection reports whether a validation failure means the key itself is invalid,
+// rather than the upstream being unavailable.
+func isDefinitiveRejection(err *app_errors.UpstreamError) bool {
+	return err.RuleInvalid || err.StatusCode == http.StatusUnauthorized || err.StatusCode == http.StatusForbidden
+}
@@ -0,0 +1,26 @@
+package keypool
+
+import (
+	"testing"
+
+	app_errors "gpt-load/internal/errors"
+)
+
+func TestIsDefinitiveRejection(t *testing.T) {
+	tests := []struct {
+		err  app_errors.UpstreamError
+		want bool
+	}{
+		{app_errors.UpstreamError{StatusCode: 401}, true},
+		{app_errors.UpstreamError{StatusCode: 403}, true},
+		{app_errors.UpstreamError{StatusCode: 400, RuleInvalid: true}, true},
+		{app_errors.UpstreamError{StatusCode: 500}, false},
+		{app_errors.UpstreamError{StatusCode: 503}, false},
+		{app_errors.UpstreamError{StatusCode: 400}, false},
+	}
+	for _, tt := range tests {
+		if got := isDefinitiveRejection(&tt.err); got != tt.want {
+			t.Errorf("isDefinitiveRejection(%+v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
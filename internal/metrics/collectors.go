@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+// KeyCount is the number of keys of a group with a status.
+type KeyCount struct {
+	Group  string
+	Status string
+	Count  int64
+}
+
+// keyCountCollector reports the keys per group and status, counted when scraped.
+type keyCountCollector struct {
+	desc  *prometheus.Desc
+	count func() ([]KeyCount, error)
+}
+
+// RegisterKeyCounts registers a gauge of the keys per group and status, computed by count on each scrape.
+func RegisterKeyCounts(count func() ([]KeyCount, error)) {
+	Registry.MustRegister(&keyCountCollector{
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "keys"),
+			"Keys by group and status.",
+			[]string{"group", "status"}, nil,
+		),
+		count: count,
+	})
+}
+
+// Describe implements prometheus.Collector.
+func (c *keyCountCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+// Collect implements prometheus.Collector.
+func (c *keyCountCollector) Collect(ch chan<- prometheus.Metric) {
+	counts, err := c.count()
+	if err != nil {
+		logrus.WithError(err).Warn("Failed to count keys for metrics")
+		return
+	}
+	for _, kc := range counts {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(kc.Count), kc.Group, kc.Status)
+	}
+}
+
+// RegisterGaugeFunc registers a gauge whose value is read on each scrape.
+func RegisterGaugeFunc(name, help string, value func() float64) {
+	Registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      name,
+		Help:      help,
+	}, value))
+}
@@ -0,0 +1,135 @@
+// Package metrics defines the Prometheus metrics exposed on /metrics.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "gptload"
+
+// Registry holds all gpt-load metrics, together with the Go runtime and process collectors.
+var Registry = prometheus.NewRegistry()
+
+var (
+	// ProxyRequests counts proxied requests by their final outcome.
+	ProxyRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "proxy_requests_total",
+		Help:      "Proxied requests by group, model, final status code and stream flag.",
+	}, []string{"group", "model", "status", "stream"})
+
+	// ProxyRequestDuration observes the total duration of proxied requests, including retries.
+	ProxyRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "proxy_request_duration_seconds",
+		Help:      "Total duration of proxied requests including retries.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+	}, []string{"group", "model", "stream"})
+
+	// UpstreamLatency observes the time until the upstream returned response headers, per attempt.
+	UpstreamLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "upstream_latency_seconds",
+		Help:      "Time until the upstream returned response headers, per attempt.",
+		Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"group", "stream"})
+
+	// UpstreamTimeToFirstByte observes the time until the first byte of a successful upstream response body.
+	UpstreamTimeToFirstByte = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "upstream_time_to_first_byte_seconds",
+		Help:      "Time from sending the upstream request until the first byte of the response body.",
+		Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"group", "stream"})
+
+	// ProxyRetries counts attempts that were retried with another key.
+	ProxyRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "proxy_retries_total",
+		Help:      "Upstream attempts that failed and were retried with another key.",
+	}, []string{"group"})
+
+	// KeySelections counts key selections by result: success, no_keys or error.
+	KeySelections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "key_selections_total",
+		Help:      "Key selections by group and result.",
+	}, []string{"group", "result"})
+
+	// KeyBlacklistEvents counts keys moved to the invalid state after failures.
+	KeyBlacklistEvents = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "key_blacklist_events_total",
+		Help:      "Keys blacklisted after reaching the failure threshold, by group and source.",
+	}, []string{"group", "source"})
+
+	// CronCheckerRuns counts runs of the background key validation.
+	CronCheckerRuns = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cron_checker_runs_total",
+		Help:      "Runs of the background key validation.",
+	})
+
+	// CronCheckerRunDuration observes the duration of background key validation runs.
+	CronCheckerRunDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "cron_checker_run_duration_seconds",
+		Help:      "Duration of background key validation runs.",
+		Buckets:   []float64{1, 5, 15, 30, 60, 120, 300, 600},
+	})
+
+	// HTTPClientConnections tracks the open upstream connections of the shared HTTP clients.
+	HTTPClientConnections = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "http_client_open_connections",
+		Help:      "Open upstream connections of the shared HTTP clients.",
+	})
+
+	// HTTPClientDials counts new upstream connections, a high rate means idle connections are not reused.
+	HTTPClientDials = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_client_dials_total",
+		Help:      "New upstream connections by result.",
+	}, []string{"result"})
+
+	// HTTPClientInFlight tracks upstream requests in flight.
+	HTTPClientInFlight = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "http_client_in_flight_requests",
+		Help:      "Upstream requests in flight.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		ProxyRequests,
+		ProxyRequestDuration,
+		UpstreamLatency,
+		UpstreamTimeToFirstByte,
+		ProxyRetries,
+		KeySelections,
+		KeyBlacklistEvents,
+		CronCheckerRuns,
+		CronCheckerRunDuration,
+		HTTPClientConnections,
+		HTTPClientDials,
+		HTTPClientInFlight,
+	)
+}
+
+// Handler returns the HTTP handler serving the metrics in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// StreamLabel formats the stream flag of a request as a label value.
+func StreamLabel(isStream bool) string {
+	return strconv.FormatBool(isStream)
+}
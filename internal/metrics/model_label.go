@@ -0,0 +1,49 @@
+package metrics
+
+import "sync"
+
+const (
+	// maxModelsPerGroup bounds the distinct model label values of a group, the model comes from the client request.
+	maxModelsPerGroup = 20
+	// OtherModel is the model label of requests for models beyond the per-group limit.
+	OtherModel = "other"
+	// maxModelLabelLength bounds the length of a model label value.
+	maxModelLabelLength = 128
+)
+
+var (
+	modelsMu    sync.Mutex
+	groupModels = make(map[string]map[string]struct{})
+)
+
+// ModelLabel maps the requested model to a bounded label value. The configured models of the group are
+// always kept; other models are kept until the group has seen maxModelsPerGroup of them, then reported as OtherModel.
+func ModelLabel(group, model string, configured ...string) string {
+	if model == "" {
+		return ""
+	}
+	if len(model) > maxModelLabelLength {
+		return OtherModel
+	}
+	for _, m := range configured {
+		if m == model {
+			return model
+		}
+	}
+
+	modelsMu.Lock()
+	defer modelsMu.Unlock()
+	known, ok := groupModels[group]
+	if !ok {
+		known = make(map[string]struct{})
+		groupModels[group] = known
+	}
+	if _, ok := known[model]; ok {
+		return model
+	}
+	if len(known) >= maxModelsPerGroup {
+		return OtherModel
+	}
+	known[model] = struct{}{}
+	return model
+}
@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestModelLabel(t *testing.T) {
+	group := "model-label-test"
+	for i := range maxModelsPerGroup {
+		model := fmt.Sprintf("model-%d", i)
+		if got := ModelLabel(group, model, "gpt-4o-mini"); got != model {
+			t.Fatalf("ModelLabel(%q) = %q, want the model within the limit", model, got)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		model string
+		want  string
+	}{
+		{"empty", "", ""},
+		{"known", "model-0", "model-0"},
+		{"configured", "gpt-4o-mini", "gpt-4o-mini"},
+		{"beyond limit", "model-new", OtherModel},
+		{"too long", strings.Repeat("m", maxModelLabelLength+1), OtherModel},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ModelLabel(group, tt.model, "gpt-4o-mini"); got != tt.want {
+				t.Errorf("ModelLabel(%q) = %q, want %q", tt.model, got, tt.want)
+			}
+		})
+	}
+
+	if got := ModelLabel("another-group", "model-new"); got != "model-new" {
+		t.Errorf("the limit should apply per group, got %q", got)
+	}
+}
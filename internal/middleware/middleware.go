@@ -3,14 +3,19 @@ package middleware
 
 import (
 	"crypto/subtle"
+	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
+	"gpt-load/internal/auth"
 	app_errors "gpt-load/internal/errors"
+	"gpt-load/internal/models"
 	"gpt-load/internal/response"
 	"gpt-load/internal/services"
 	"gpt-load/internal/types"
+	"gpt-load/internal/utils"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
@@ -48,6 +53,11 @@ func Logger(config types.LogConfig) gin.HandlerFunc {
 			}
 		}
 
+		requestInfo := ""
+		if requestID := utils.GetRequestID(c); requestID != "" {
+			requestInfo = fmt.Sprintf(" - Request[%s]", requestID)
+		}
+
 		// Get retry information (if exists)
 		retryInfo := ""
 		if retryCount, exists := c.Get("retryCount"); exists {
@@ -65,15 +75,26 @@ func Logger(config types.LogConfig) gin.HandlerFunc {
 
 		// Choose log level based on status code
 		if statusCode >= 500 {
-			logrus.Errorf("%s %s - %d - %v%s%s", method, fullPath, statusCode, latency, keyInfo, retryInfo)
+			logrus.Errorf("%s %s - %d - %v%s%s%s", method, fullPath, statusCode, latency, requestInfo, keyInfo, retryInfo)
 		} else if statusCode >= 400 {
-			logrus.Warnf("%s %s - %d - %v%s%s", method, fullPath, statusCode, latency, keyInfo, retryInfo)
+			logrus.Warnf("%s %s - %d - %v%s%s%s", method, fullPath, statusCode, latency, requestInfo, keyInfo, retryInfo)
 		} else {
-			logrus.Infof("%s %s - %d - %v%s%s", method, fullPath, statusCode, latency, keyInfo, retryInfo)
+			logrus.Infof("%s %s - %d - %v%s%s%s", method, fullPath, statusCode, latency, requestInfo, keyInfo, retryInfo)
 		}
 	}
 }
 
+// RequestID assigns each request a new correlation ID and returns it in the response header.
+// A valid X-Request-ID sent by the client is kept separately as the client request ID.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := utils.NewRequestID()
+		utils.SetRequestID(c, requestID, utils.ClientRequestID(c.GetHeader(utils.RequestIDHeader)))
+		c.Header(utils.RequestIDHeader, requestID)
+		c.Next()
+	}
+}
+
 // CORS creates a CORS middleware
 func CORS(config types.CORSConfig) gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -101,6 +122,8 @@ func CORS(config types.CORSConfig) gin.HandlerFunc {
 		c.Header("Access-Control-Allow-Methods", strings.Join(config.AllowedMethods, ", "))
 		c.Header("Access-Control-Allow-Headers", strings.Join(config.AllowedHeaders, ", "))
 
+		c.Header("Access-Control-Expose-Headers", utils.RequestIDHeader)
+
 		if config.AllowCredentials {
 			c.Header("Access-Control-Allow-Credentials", "true")
 		}
@@ -115,8 +138,14 @@ func CORS(config types.CORSConfig) gin.HandlerFunc {
 	}
 }
 
-// Auth creates an authentication middleware
-func Auth(authConfig types.AuthConfig) gin.HandlerFunc {
+// Auth creates an authentication middleware.
+// It accepts a session token, an API token of an admin user, or the global AUTH_KEY.
+func Auth(
+	authConfig types.AuthConfig,
+	userService *services.AdminUserService,
+	sessionService *services.SessionService,
+	limiter *services.AuthLimiter,
+) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		path := c.Request.URL.Path
 
@@ -125,23 +154,78 @@ func Auth(authConfig types.AuthConfig) gin.HandlerFunc {
 			return
 		}
 
+		if rejectLockedOut(c, limiter) {
+			return
+		}
+
 		key := extractAuthKey(c)
 
-		isValid := key != "" && subtle.ConstantTimeCompare([]byte(key), []byte(authConfig.Key)) == 1
+		var principal *auth.Principal
+		var err error
+		switch {
+		case key == "":
+			err = services.ErrInvalidCredentials
+		case services.IsSessionToken(key):
+			principal, err = sessionService.Authenticate(key)
+		case services.IsAdminToken(key):
+			principal, err = userService.AuthenticateToken(key)
+		case subtle.ConstantTimeCompare([]byte(key), []byte(authConfig.Key)) == 1:
+			principal = auth.RootPrincipal()
+		default:
+			err = services.ErrInvalidCredentials
+		}
 
-		if !isValid {
+		if err != nil {
+			switch {
+			case errors.Is(err, services.ErrSessionExpired):
+			case errors.Is(err, services.ErrInvalidCredentials):
+				if key != "" {
+					limiter.RecordFailure(c.ClientIP())
+				}
+			default:
+				logrus.WithError(err).Error("Failed to authenticate admin request")
+			}
 			response.Error(c, app_errors.ErrUnauthorized)
 			c.Abort()
 			return
 		}
 
+		auth.SetPrincipal(c, principal)
+		c.Next()
+	}
+}
+
+// rejectLockedOut aborts the request if the client IP is locked out after repeated authentication failures.
+func rejectLockedOut(c *gin.Context, limiter *services.AuthLimiter) bool {
+	lockedFor := limiter.LockedFor(c.ClientIP())
+	if lockedFor <= 0 {
+		return false
+	}
+	c.Header("Retry-After", strconv.Itoa(int(lockedFor.Seconds())+1))
+	response.Error(c, app_errors.ErrTooManyRequests)
+	c.Abort()
+	return true
+}
+
+// RequirePermission rejects requests whose principal lacks the permission
+func RequirePermission(permission auth.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !auth.GetPrincipal(c).Can(permission) {
+			response.Error(c, app_errors.ErrForbidden)
+			c.Abort()
+			return
+		}
 		c.Next()
 	}
 }
 
 // ProxyAuth
-func ProxyAuth(gm *services.GroupManager) gin.HandlerFunc {
+func ProxyAuth(gm *services.GroupManager, limiter *services.AuthLimiter) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if rejectLockedOut(c, limiter) {
+			return
+		}
+
 		// Check key
 		key := extractAuthKey(c)
 		if key == "" {
@@ -162,15 +246,65 @@ func ProxyAuth(gm *services.GroupManager) gin.HandlerFunc {
 		_, existsInGroup := group.ProxyKeysMap[key]
 
 		if existsInEffective || existsInGroup {
+			if rejectUnavailableGroup(c, group) {
+				return
+			}
 			c.Next()
 			return
 		}
 
+		limiter.RecordFailure(c.ClientIP())
 		response.Error(c, app_errors.ErrUnauthorized)
 		c.Abort()
 	}
 }
 
+// rejectUnavailableGroup rejects requests to a disabled group or a group under maintenance,
+// before any key of the group is selected.
+func rejectUnavailableGroup(c *gin.Context, group *models.Group) bool {
+	if !group.Enabled {
+		response.Error(c, app_errors.ErrGroupDisabled)
+		c.Abort()
+		return true
+	}
+
+	maintenance := group.Maintenance
+	if maintenance == nil {
+		return false
+	}
+	apiErr := app_errors.NewAPIError(app_errors.ErrGroupMaintenance, app_errors.ErrGroupMaintenance.Message)
+	if maintenance.StatusCode != 0 {
+		apiErr.HTTPStatus = maintenance.StatusCode
+	}
+	if maintenance.Message != "" {
+		apiErr.Message = maintenance.Message
+	}
+	if maintenance.RetryAfterSeconds > 0 {
+		c.Header("Retry-After", strconv.Itoa(maintenance.RetryAfterSeconds))
+	}
+	response.Error(c, apiErr)
+	c.Abort()
+	return true
+}
+
+// MetricsAuth protects the metrics endpoint with its own bearer token. An empty token leaves it open.
+func MetricsAuth(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token == "" {
+			c.Next()
+			return
+		}
+
+		key := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(key), []byte(token)) != 1 {
+			response.Error(c, app_errors.ErrUnauthorized)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
 // Recovery creates a recovery middleware with custom error handling
 func Recovery() gin.HandlerFunc {
 	return gin.CustomRecovery(func(c *gin.Context, recovered any) {
@@ -221,7 +355,7 @@ func ErrorHandler() gin.HandlerFunc {
 
 // isMonitoringEndpoint checks if the path is a monitoring endpoint
 func isMonitoringEndpoint(path string) bool {
-	monitoringPaths := []string{"/health"}
+	monitoringPaths := []string{"/health", "/metrics", "/status.json"}
 	for _, monitoringPath := range monitoringPaths {
 		if path == monitoringPath {
 			return true
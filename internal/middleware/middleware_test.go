@@ -0,0 +1,190 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"gpt-load/internal/auth"
+	"gpt-load/internal/config"
+	"gpt-load/internal/encryption"
+	"gpt-load/internal/models"
+	"gpt-load/internal/response"
+	"gpt-load/internal/services"
+	"gpt-load/internal/store"
+	"gpt-load/internal/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glebarez/sqlite"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// withPrincipal authenticates every request as the principal.
+func withPrincipal(p *auth.Principal) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if p != nil {
+			auth.SetPrincipal(c, p)
+		}
+		c.Next()
+	}
+}
+
+func TestRequirePermission(t *testing.T) {
+	tests := []struct {
+		principal  *auth.Principal
+		permission auth.Permission
+		want       int
+	}{
+		{nil, auth.PermissionRead, http.StatusForbidden},
+		{&auth.Principal{Role: models.RoleViewer}, auth.PermissionRead, http.StatusOK},
+		{&auth.Principal{Role: models.RoleViewer}, auth.PermissionRevealKeys, http.StatusForbidden},
+		{&auth.Principal{Role: models.RoleMaintainer}, auth.PermissionWriteKeys, http.StatusOK},
+		{&auth.Principal{Role: models.RoleMaintainer}, auth.PermissionManageGroups, http.StatusForbidden},
+		{&auth.Principal{Role: models.RoleOperator}, auth.PermissionManageGroups, http.StatusOK},
+		{&auth.Principal{Role: models.RoleOperator}, auth.PermissionManageSettings, http.StatusForbidden},
+		{&auth.Principal{Role: models.RoleAdmin}, auth.PermissionManageUsers, http.StatusOK},
+		{auth.RootPrincipal(), auth.PermissionReadAudit, http.StatusOK},
+	}
+	for _, tt := range tests {
+		role := "anonymous"
+		if tt.principal != nil {
+			role = tt.principal.Role
+		}
+		handled := false
+		router := gin.New()
+		router.GET("/", withPrincipal(tt.principal), RequirePermission(tt.permission), func(c *gin.Context) {
+			handled = true
+			c.Status(http.StatusOK)
+		})
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		if w.Code != tt.want {
+			t.Errorf("%s with %s: status = %d, want %d", role, tt.permission, w.Code, tt.want)
+		}
+		if handled != (tt.want == http.StatusOK) {
+			t.Errorf("%s with %s: handler called = %v", role, tt.permission, handled)
+		}
+	}
+}
+
+// testConfig is a config manager with the auth lockout turned off and without a master key.
+type testConfig struct {
+	types.ConfigManager
+}
+
+func (testConfig) GetEncryptionConfig() types.EncryptionConfig {
+	return types.EncryptionConfig{}
+}
+
+func (testConfig) GetAuthConfig() types.AuthConfig {
+	return types.AuthConfig{}
+}
+
+// newProxyRouter serves the proxy routes of the groups behind ProxyAuth. The proxy handler is
+// replaced by one that records the groups it was reached for, where the real one selects a key.
+func newProxyRouter(t *testing.T, groups ...models.Group) (*gin.Engine, map[string]bool) {
+	t.Helper()
+	// 加密服务注册 encrypted 序列化器，需在建表前创建
+	encryption.NewService(testConfig{})
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&models.Group{}); err != nil {
+		t.Fatal(err)
+	}
+	for _, group := range groups {
+		group.Upstreams = datatypes.JSON(`[]`)
+		group.ProxyKeys = "sk-proxy"
+		enabled := group.Enabled
+		if err := db.Create(&group).Error; err != nil {
+			t.Fatal(err)
+		}
+		// enabled 列默认为 true，创建时的 false 会被忽略
+		if !enabled {
+			if err := db.Model(&group).Update("enabled", false).Error; err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	memoryStore := store.NewMemoryStore()
+	gm := services.NewGroupManager(db, memoryStore, config.NewSystemSettingsManager())
+	if err := gm.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { gm.Stop(context.Background()) })
+
+	reached := make(map[string]bool)
+	router := gin.New()
+	router.Any("/proxy/:group_name/*path", ProxyAuth(gm, services.NewAuthLimiter(memoryStore, testConfig{})), func(c *gin.Context) {
+		reached[c.Param("group_name")] = true
+		c.Status(http.StatusOK)
+	})
+	return router, reached
+}
+
+func TestProxyAuthRejectsUnavailableGroups(t *testing.T) {
+	router, reached := newProxyRouter(t,
+		models.Group{Name: "open", Enabled: true},
+		models.Group{Name: "disabled", Enabled: false},
+		models.Group{Name: "maintenance", Enabled: true, MaintenanceConfig: datatypes.JSON(`{"enabled":true,"status_code":429,"message":"Back at noon","retry_after_seconds":120}`)},
+		models.Group{Name: "maintenance-default", Enabled: true, MaintenanceConfig: datatypes.JSON(`{"enabled":true}`)},
+		models.Group{Name: "maintenance-off", Enabled: true, MaintenanceConfig: datatypes.JSON(`{"enabled":false,"status_code":429}`)},
+	)
+
+	tests := []struct {
+		group       string
+		proxyKey    string
+		wantStatus  int
+		wantCode    string
+		wantMessage string
+		wantRetry   string
+	}{
+		{"open", "sk-proxy", http.StatusOK, "", "", ""},
+		{"maintenance-off", "sk-proxy", http.StatusOK, "", "", ""},
+		{"disabled", "sk-proxy", http.StatusForbidden, "GROUP_DISABLED", "This group is disabled", ""},
+		{"maintenance", "sk-proxy", http.StatusTooManyRequests, "GROUP_MAINTENANCE", "Back at noon", "120"},
+		{"maintenance-default", "sk-proxy", http.StatusServiceUnavailable, "GROUP_MAINTENANCE", "This group is under maintenance, please try again later", ""},
+		// 代理密钥错误时先拒绝认证，不暴露分组的状态
+		{"disabled", "sk-wrong", http.StatusUnauthorized, "UNAUTHORIZED", "", ""},
+		{"maintenance", "sk-wrong", http.StatusUnauthorized, "UNAUTHORIZED", "", ""},
+	}
+	for _, tt := range tests {
+		clear(reached)
+		req := httptest.NewRequest(http.MethodPost, "/proxy/"+tt.group+"/v1/chat/completions", nil)
+		req.Header.Set("Authorization", "Bearer "+tt.proxyKey)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != tt.wantStatus {
+			t.Errorf("%s with %s: status = %d, want %d", tt.group, tt.proxyKey, w.Code, tt.wantStatus)
+			continue
+		}
+		if reached[tt.group] != (tt.wantStatus == http.StatusOK) {
+			t.Errorf("%s with %s: proxy handler reached = %v, no key may be selected for a rejected request", tt.group, tt.proxyKey, reached[tt.group])
+		}
+		if got := w.Header().Get("Retry-After"); got != tt.wantRetry {
+			t.Errorf("%s: Retry-After = %q, want %q", tt.group, got, tt.wantRetry)
+		}
+		if tt.wantCode == "" {
+			continue
+		}
+		var body response.ErrorResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		if body.Code != tt.wantCode || (tt.wantMessage != "" && body.Message != tt.wantMessage) {
+			t.Errorf("%s with %s: body = %+v, want %s %q", tt.group, tt.proxyKey, body, tt.wantCode, tt.wantMessage)
+		}
+	}
+}
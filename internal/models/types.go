@@ -1,10 +1,12 @@
 package models
 
 import (
+	"fmt"
 	"gpt-load/internal/types"
 	"time"
 
 	"gorm.io/datatypes"
+	"gorm.io/gorm"
 )
 
 // Key状态
@@ -13,6 +15,13 @@ const (
 	KeyStatusInvalid = "invalid"
 )
 
+// SchemaMigration 对应 schema_migrations 表，记录已执行的数据库迁移版本
+type SchemaMigration struct {
+	Version   uint      `gorm:"primaryKey;autoIncrement:false" json:"version"`
+	Name      string    `gorm:"type:varchar(255);not null" json:"name"`
+	AppliedAt time.Time `gorm:"not null" json:"applied_at"`
+}
+
 // SystemSetting 对应 system_settings 表
 type SystemSetting struct {
 	ID           uint      `gorm:"primaryKey;autoIncrement" json:"id"`
@@ -25,19 +34,25 @@ type SystemSetting struct {
 
 // GroupConfig 存储特定于分组的配置
 type GroupConfig struct {
-	RequestTimeout               *int    `json:"request_timeout,omitempty"`
-	IdleConnTimeout              *int    `json:"idle_conn_timeout,omitempty"`
-	ConnectTimeout               *int    `json:"connect_timeout,omitempty"`
-	MaxIdleConns                 *int    `json:"max_idle_conns,omitempty"`
-	MaxIdleConnsPerHost          *int    `json:"max_idle_conns_per_host,omitempty"`
-	ResponseHeaderTimeout        *int    `json:"response_header_timeout,omitempty"`
-	ProxyURL                     *string `json:"proxy_url,omitempty"`
-	MaxRetries                   *int    `json:"max_retries,omitempty"`
-	BlacklistThreshold           *int    `json:"blacklist_threshold,omitempty"`
-	KeyValidationIntervalMinutes *int    `json:"key_validation_interval_minutes,omitempty"`
-	KeyValidationConcurrency     *int    `json:"key_validation_concurrency,omitempty"`
-	KeyValidationTimeoutSeconds  *int    `json:"key_validation_timeout_seconds,omitempty"`
-	EnableRequestBodyLogging     *bool   `json:"enable_request_body_logging,omitempty"`
+	RequestTimeout                *int    `json:"request_timeout,omitempty"`
+	IdleConnTimeout               *int    `json:"idle_conn_timeout,omitempty"`
+	ConnectTimeout                *int    `json:"connect_timeout,omitempty"`
+	MaxIdleConns                  *int    `json:"max_idle_conns,omitempty"`
+	MaxIdleConnsPerHost           *int    `json:"max_idle_conns_per_host,omitempty"`
+	ResponseHeaderTimeout         *int    `json:"response_header_timeout,omitempty"`
+	ProxyURL                      *string `json:"proxy_url,omitempty"`
+	MaxRetries                    *int    `json:"max_retries,omitempty"`
+	BlacklistThreshold            *int    `json:"blacklist_threshold,omitempty"`
+	KeyValidationIntervalMinutes  *int    `json:"key_validation_interval_minutes,omitempty"`
+	KeyValidationConcurrency      *int    `json:"key_validation_concurrency,omitempty"`
+	KeyValidationTimeoutSeconds   *int    `json:"key_validation_timeout_seconds,omitempty"`
+	ActiveKeyCheckIntervalMinutes *int    `json:"active_key_check_interval_minutes,omitempty"`
+	ActiveKeyCheckConcurrency     *int    `json:"active_key_check_concurrency,omitempty"`
+	EnableRequestBodyLogging      *bool   `json:"enable_request_body_logging,omitempty"`
+	AlertMinActiveKeys            *int    `json:"alert_min_active_keys,omitempty"`
+	AlertErrorRateThreshold       *int    `json:"alert_error_rate_threshold,omitempty"`
+	AlertErrorRateWindowMinutes   *int    `json:"alert_error_rate_window_minutes,omitempty"`
+	AlertErrorRateMinRequests     *int    `json:"alert_error_rate_min_requests,omitempty"`
 }
 
 // HeaderRule defines a single rule for header manipulation.
@@ -47,6 +62,57 @@ type HeaderRule struct {
 	Action string `json:"action"` // "set" or "remove"
 }
 
+// 密钥验证方式
+const (
+	ValidationMethodCompletion  = "completion"
+	ValidationMethodListModels  = "list_models"
+	ValidationMethodCountTokens = "count_tokens"
+	ValidationMethodCustom      = "custom"
+)
+
+// 验证响应判定结果
+const (
+	ValidationResultValid       = "valid"
+	ValidationResultInvalid     = "invalid"
+	ValidationResultRateLimited = "rate_limited"
+)
+
+// ValidationResponseRule maps an upstream validation response to a result.
+// A rule matches when the status code is in Statuses (or Statuses is empty)
+// and the response body contains BodyContains (or BodyContains is empty).
+type ValidationResponseRule struct {
+	Statuses     []int  `json:"statuses,omitempty"`
+	BodyContains string `json:"body_contains,omitempty"`
+	Result       string `json:"result"` // "valid", "invalid" or "rate_limited"
+}
+
+// ValidationConfig defines how keys of a group are validated.
+type ValidationConfig struct {
+	Method        string                   `json:"method"`                // "completion", "list_models", "count_tokens" or "custom"
+	HTTPMethod    string                   `json:"http_method,omitempty"` // Only used by the custom method
+	Body          string                   `json:"body,omitempty"`        // Only used by the custom method
+	ResponseRules []ValidationResponseRule `json:"response_rules,omitempty"`
+}
+
+// ProbeConfig defines the synthetic request that probes a group through its proxy endpoint.
+type ProbeConfig struct {
+	Enabled          bool   `json:"enabled"`
+	IntervalSeconds  int    `json:"interval_seconds"`
+	TimeoutSeconds   int    `json:"timeout_seconds"`
+	Method           string `json:"method"`
+	Path             string `json:"path"` // Relative to /proxy/{group}, e.g. /v1/chat/completions
+	Body             string `json:"body,omitempty"`
+	ExpectedStatuses []int  `json:"expected_statuses,omitempty"` // Any 2xx status when empty
+}
+
+// MaintenanceConfig defines the response of a group under maintenance.
+type MaintenanceConfig struct {
+	Enabled           bool   `json:"enabled"`
+	StatusCode        int    `json:"status_code"`                   // 503 when not set
+	Message           string `json:"message,omitempty"`             // Default message when empty
+	RetryAfterSeconds int    `json:"retry_after_seconds,omitempty"` // Sent as the Retry-After header when set
+}
+
 // Group 对应 groups 表
 type Group struct {
 	ID                 uint                 `gorm:"primaryKey;autoIncrement" json:"id"`
@@ -58,33 +124,401 @@ type Group struct {
 	Description        string               `gorm:"type:varchar(512)" json:"description"`
 	Upstreams          datatypes.JSON       `gorm:"type:json;not null" json:"upstreams"`
 	ValidationEndpoint string               `gorm:"type:varchar(255)" json:"validation_endpoint"`
+	ValidationConfig   datatypes.JSON       `gorm:"type:json" json:"validation_config"`
+	ProbeConfig        datatypes.JSON       `gorm:"type:json" json:"probe_config"`
 	ChannelType        string               `gorm:"type:varchar(50);not null" json:"channel_type"`
 	Sort               int                  `gorm:"default:0" json:"sort"`
 	TestModel          string               `gorm:"type:varchar(255);not null" json:"test_model"`
 	ParamOverrides     datatypes.JSONMap    `gorm:"type:json" json:"param_overrides"`
 	Config             datatypes.JSONMap    `gorm:"type:json" json:"config"`
 	HeaderRules        datatypes.JSON       `gorm:"type:json" json:"header_rules"`
+	Enabled            bool                 `gorm:"not null;default:true" json:"enabled"`
+	MaintenanceConfig  datatypes.JSON       `gorm:"type:json" json:"maintenance_config"`
+	KeyPoolID          *uint                `gorm:"index" json:"key_pool_id"` // Keys come from the shared pool instead of the group when set
 	APIKeys            []APIKey             `gorm:"foreignKey:GroupID" json:"api_keys"`
 	LastValidatedAt    *time.Time           `json:"last_validated_at"`
+	LastActiveCheckAt  *time.Time           `json:"last_active_check_at"`
 	CreatedAt          time.Time            `json:"created_at"`
 	UpdatedAt          time.Time            `json:"updated_at"`
 
 	// For cache
 	ProxyKeysMap   map[string]struct{} `gorm:"-" json:"-"`
 	HeaderRuleList []HeaderRule        `gorm:"-" json:"-"`
+	Maintenance    *MaintenanceConfig  `gorm:"-" json:"-"` // Only set while maintenance mode is on
+}
+
+// 分组配置版本的变更来源
+const (
+	GroupVersionBaseline    = "baseline" // 启用配置历史前已有的配置
+	GroupVersionCreate      = "create"
+	GroupVersionUpdate      = "update"
+	GroupVersionCopy        = "copy"
+	GroupVersionConfigApply = "config.apply"
+	GroupVersionRollback    = "rollback"
+)
+
+// GroupVersion 对应 group_versions 表，记录分组每次配置变更后的快照
+type GroupVersion struct {
+	ID           uint           `gorm:"primaryKey;autoIncrement" json:"id"`
+	GroupID      uint           `gorm:"not null;uniqueIndex:idx_group_version" json:"group_id"`
+	Version      int            `gorm:"not null;uniqueIndex:idx_group_version" json:"version"`
+	Action       string         `gorm:"type:varchar(32);not null" json:"action"`
+	ActorID      uint           `json:"actor_id"`
+	Actor        string         `gorm:"type:varchar(255);not null" json:"actor"`
+	RestoredFrom int            `json:"restored_from,omitempty"` // 回滚时恢复的版本号
+	Snapshot     datatypes.JSON `gorm:"type:json;not null" json:"-"`
+	CreatedAt    time.Time      `json:"created_at"`
+}
+
+// GroupSnapshot 是分组配置的快照，不包含 ID、Key 和运行状态
+type GroupSnapshot struct {
+	Name               string            `json:"name"`
+	DisplayName        string            `json:"display_name"`
+	Description        string            `json:"description"`
+	Upstreams          datatypes.JSON    `json:"upstreams"`
+	ChannelType        string            `json:"channel_type"`
+	Sort               int               `json:"sort"`
+	TestModel          string            `json:"test_model"`
+	ValidationEndpoint string            `json:"validation_endpoint"`
+	ValidationConfig   datatypes.JSON    `json:"validation_config"`
+	ProbeConfig        datatypes.JSON    `json:"probe_config"`
+	ParamOverrides     datatypes.JSONMap `json:"param_overrides"`
+	Config             datatypes.JSONMap `json:"config"`
+	HeaderRules        datatypes.JSON    `json:"header_rules"`
+	ProxyKeys          string            `json:"proxy_keys"`
+}
+
+// NewGroupSnapshot returns the configuration of a group.
+func NewGroupSnapshot(group *Group) GroupSnapshot {
+	return GroupSnapshot{
+		Name:               group.Name,
+		DisplayName:        group.DisplayName,
+		Description:        group.Description,
+		Upstreams:          snapshotJSON(group.Upstreams),
+		ChannelType:        group.ChannelType,
+		Sort:               group.Sort,
+		TestModel:          group.TestModel,
+		ValidationEndpoint: group.ValidationEndpoint,
+		ValidationConfig:   snapshotJSON(group.ValidationConfig),
+		ProbeConfig:        snapshotJSON(group.ProbeConfig),
+		ParamOverrides:     group.ParamOverrides,
+		Config:             group.Config,
+		HeaderRules:        snapshotJSON(group.HeaderRules),
+		ProxyKeys:          group.ProxyKeys,
+	}
+}
+
+// ApplyTo replaces the configuration of a group with the snapshot.
+func (s GroupSnapshot) ApplyTo(group *Group) {
+	group.Name = s.Name
+	group.DisplayName = s.DisplayName
+	group.Description = s.Description
+	group.Upstreams = snapshotJSON(s.Upstreams)
+	group.ChannelType = s.ChannelType
+	group.Sort = s.Sort
+	group.TestModel = s.TestModel
+	group.ValidationEndpoint = s.ValidationEndpoint
+	group.ValidationConfig = snapshotJSON(s.ValidationConfig)
+	group.ProbeConfig = snapshotJSON(s.ProbeConfig)
+	group.ParamOverrides = s.ParamOverrides
+	group.Config = s.Config
+	group.HeaderRules = snapshotJSON(s.HeaderRules)
+	group.ProxyKeys = s.ProxyKeys
+}
+
+// snapshotJSON treats empty and null JSON values as absent.
+func snapshotJSON(value datatypes.JSON) datatypes.JSON {
+	if len(value) == 0 || string(value) == "null" {
+		return nil
+	}
+	return value
 }
 
 // APIKey 对应 api_keys 表
 type APIKey struct {
+	ID              uint           `gorm:"primaryKey;autoIncrement" json:"id"`
+	KeyValue        string         `gorm:"type:text;not null;serializer:encrypted" json:"key_value"`
+	KeyHash         string         `gorm:"type:varchar(64);not null;uniqueIndex:idx_owner_key_hash,priority:3" json:"-"`
+	GroupID         uint           `gorm:"not null;uniqueIndex:idx_owner_key_hash,priority:1" json:"group_id"` // 0 for the keys of a key pool
+	PoolID          uint           `gorm:"not null;default:0;uniqueIndex:idx_owner_key_hash,priority:2" json:"pool_id"`
+	Status          string         `gorm:"type:varchar(50);not null;default:'active'" json:"status"`
+	RequestCount    int64          `gorm:"not null;default:0" json:"request_count"`
+	FailureCount    int64          `gorm:"not null;default:0" json:"failure_count"`
+	LastUsedAt      *time.Time     `json:"last_used_at"`
+	LastValidatedAt *time.Time     `json:"last_validated_at"`
+	LastError       string         `gorm:"type:text" json:"last_error"`
+	LastErrorAt     *time.Time     `json:"last_error_at"`
+	Labels          string         `gorm:"type:varchar(512)" json:"labels"` // Comma-separated
+	Note            string         `gorm:"type:text" json:"note"`
+	Owner           string         `gorm:"type:varchar(255);index" json:"owner"`
+	ExpiresAt       *time.Time     `gorm:"index" json:"expires_at"`
+	Weight          int            `gorm:"not null;default:1" json:"weight"`
+	HeaderRules     datatypes.JSON `gorm:"type:json" json:"header_rules"`         // Applied after the group's header rules
+	UpstreamURL     string         `gorm:"type:varchar(500)" json:"upstream_url"` // Overrides the group's upstreams
+	ProxyURL        string         `gorm:"type:varchar(500)" json:"proxy_url"`    // Overrides the group's proxy_url
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+}
+
+// KeyPool 对应 key_pools 表，多个分组可以引用同一个密钥池，共享其中 Key 的状态、冷却和计数
+type KeyPool struct {
+	ID          uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name        string    `gorm:"type:varchar(255);not null;unique" json:"name"`
+	Description string    `gorm:"type:varchar(512)" json:"description"`
+	ChannelType string    `gorm:"type:varchar(50);not null" json:"channel_type"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// KeyOwner identifies the owner of a set of keys, either a group or a key pool.
+// Pool keys are stored with group_id 0 and the pool's ID in pool_id.
+type KeyOwner struct {
+	GroupID uint
+	PoolID  uint
+}
+
+// KeyOwner returns the owner of the keys the group uses: its key pool when it references one, otherwise the group itself.
+func (g *Group) KeyOwner() KeyOwner {
+	if g.KeyPoolID != nil && *g.KeyPoolID != 0 {
+		return KeyOwner{PoolID: *g.KeyPoolID}
+	}
+	return KeyOwner{GroupID: g.ID}
+}
+
+// PoolKeyOwner returns the owner of the keys of a key pool.
+func PoolKeyOwner(poolID uint) KeyOwner {
+	return KeyOwner{PoolID: poolID}
+}
+
+// KeyOwner returns the group or key pool the key belongs to.
+func (k *APIKey) KeyOwner() KeyOwner {
+	return KeyOwner{GroupID: k.GroupID, PoolID: k.PoolID}
+}
+
+// IsPool reports whether the keys belong to a key pool.
+func (o KeyOwner) IsPool() bool {
+	return o.PoolID != 0
+}
+
+// Scope restricts a query on api_keys to the keys of the owner.
+func (o KeyOwner) Scope(db *gorm.DB) *gorm.DB {
+	return db.Where("group_id = ? AND pool_id = ?", o.GroupID, o.PoolID)
+}
+
+// Assign makes the owner the owner of the key.
+func (o KeyOwner) Assign(key *APIKey) {
+	key.GroupID = o.GroupID
+	key.PoolID = o.PoolID
+}
+
+// ActiveKeysKey returns the store key of the weighted rotation the active keys of the owner are selected from.
+func (o KeyOwner) ActiveKeysKey() string {
+	if o.IsPool() {
+		return fmt.Sprintf("pool:%d:weighted_keys", o.PoolID)
+	}
+	return fmt.Sprintf("group:%d:weighted_keys", o.GroupID)
+}
+
+// String returns the owner for logs and error messages.
+func (o KeyOwner) String() string {
+	if o.IsPool() {
+		return fmt.Sprintf("key pool %d", o.PoolID)
+	}
+	return fmt.Sprintf("group %d", o.GroupID)
+}
+
+// Key 权重范围
+const (
+	MinKeyWeight = 1
+	MaxKeyWeight = 100
+)
+
+// IsExpired reports whether the key has passed its expiry date.
+func (k *APIKey) IsExpired() bool {
+	return k.ExpiresAt != nil && !k.ExpiresAt.After(time.Now())
+}
+
+// RotationWeight returns the weight of the key in the rotation of its group or key pool.
+func (k *APIKey) RotationWeight() int {
+	return min(max(k.Weight, MinKeyWeight), MaxKeyWeight)
+}
+
+// Key 事件类型
+const (
+	KeyEventBlacklisted = "blacklisted" // active -> invalid
+	KeyEventRecovered   = "recovered"   // invalid -> active, after a successful request or validation
+	KeyEventRestored    = "restored"    // invalid -> active, restored by an administrator
+	KeyEventExpired     = "expired"     // active -> invalid, after the key's expires_at
+	KeyEventCooledDown  = "cooled_down" // active key whose failure streak ended with a success before reaching the blacklist threshold
+)
+
+// Key 事件来源
+const (
+	KeyEventSourceTraffic = "traffic"
+	KeyEventSourceCron    = "cron"
+	KeyEventSourceManual  = "manual"
+	KeyEventSourceSystem  = "system"
+)
+
+// KeyEvent 对应 key_events 表，记录 Key 的状态变更历史
+type KeyEvent struct {
+	ID           uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	KeyID        uint      `gorm:"not null;index" json:"key_id"`
+	GroupID      uint      `gorm:"not null;index" json:"group_id"`
+	EventType    string    `gorm:"type:varchar(50);not null" json:"event_type"`
+	FromStatus   string    `gorm:"type:varchar(50)" json:"from_status"`
+	ToStatus     string    `gorm:"type:varchar(50)" json:"to_status"`
+	Source       string    `gorm:"type:varchar(50);not null" json:"source"`
+	StatusCode   int       `json:"status_code"`
+	ErrorMessage string    `gorm:"type:text" json:"error_message"`
+	CreatedAt    time.Time `gorm:"index" json:"created_at"`
+}
+
+// DataKey 对应 data_keys 表，存储由主密钥加密的数据密钥
+type DataKey struct {
+	ID          uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	WrappedKey  string    `gorm:"type:text;not null" json:"-"`
+	MasterKeyID string    `gorm:"type:varchar(16);not null" json:"master_key_id"` // Fingerprint of the wrapping master key
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// 管理员角色
+const (
+	RoleAdmin      = "admin"
+	RoleOperator   = "operator"
+	RoleViewer     = "viewer"
+	RoleMaintainer = "maintainer" // Only manages the groups assigned to it
+)
+
+// AdminUser 对应 admin_users 表
+type AdminUser struct {
+	ID           uint             `gorm:"primaryKey;autoIncrement" json:"id"`
+	Username     string           `gorm:"type:varchar(255);not null;unique" json:"username"`
+	PasswordHash string           `gorm:"type:varchar(255);not null" json:"-"`
+	Role         string           `gorm:"type:varchar(50);not null" json:"role"`
+	Enabled      bool             `gorm:"not null" json:"enabled"`
+	OIDCSubject  *string          `gorm:"column:oidc_subject;type:varchar(255);uniqueIndex" json:"oidc_subject,omitempty"` // 通过 SSO 登录的用户在身份提供方的 sub
+	LastLoginAt  *time.Time       `json:"last_login_at"`
+	Groups       []AdminUserGroup `gorm:"foreignKey:UserID" json:"-"`
+	CreatedAt    time.Time        `json:"created_at"`
+	UpdatedAt    time.Time        `json:"updated_at"`
+}
+
+// AdminUserGroup 对应 admin_user_groups 表，记录维护者可管理的分组
+type AdminUserGroup struct {
+	UserID  uint `gorm:"primaryKey" json:"user_id"`
+	GroupID uint `gorm:"primaryKey;index" json:"group_id"`
+}
+
+// AdminToken 对应 admin_tokens 表，管理员用于访问管理 API 的令牌
+type AdminToken struct {
+	ID          uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID      uint       `gorm:"not null;index" json:"user_id"`
+	Name        string     `gorm:"type:varchar(255);not null" json:"name"`
+	TokenHash   string     `gorm:"type:varchar(64);not null;unique" json:"-"`
+	TokenPrefix string     `gorm:"type:varchar(16);not null" json:"token_prefix"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// AuditLog 对应 audit_logs 表，记录管理 API 的每次变更操作
+type AuditLog struct {
+	ID         uint           `gorm:"primaryKey;autoIncrement" json:"id"`
+	CreatedAt  time.Time      `gorm:"not null;index" json:"created_at"`
+	ActorID    uint           `gorm:"index" json:"actor_id"` // 使用 AUTH_KEY 操作时为 0
+	Actor      string         `gorm:"type:varchar(255);not null;index" json:"actor"`
+	ActorRole  string         `gorm:"type:varchar(50)" json:"actor_role"`
+	SourceIP   string         `gorm:"type:varchar(64);index" json:"source_ip"`
+	Action     string         `gorm:"type:varchar(64);not null;index" json:"action"`
+	TargetType string         `gorm:"type:varchar(32);not null;index:idx_audit_target" json:"target_type"`
+	TargetID   uint           `gorm:"index:idx_audit_target" json:"target_id"`
+	TargetName string         `gorm:"type:varchar(255)" json:"target_name"`
+	Changes    datatypes.JSON `gorm:"type:json" json:"changes"` // 字段级差异 {"field": {"before": ..., "after": ...}}
+	Details    datatypes.JSON `gorm:"type:json" json:"details"`
+}
+
+// 告警通道类型
+const (
+	AlertChannelWebhook  = "webhook"
+	AlertChannelSlack    = "slack"
+	AlertChannelFeishu   = "feishu"
+	AlertChannelDingTalk = "dingtalk"
+	AlertChannelTelegram = "telegram"
+)
+
+// AlertChannel 对应 alert_channels 表，告警通知的投递目标
+type AlertChannel struct {
+	ID         uint           `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name       string         `gorm:"type:varchar(100);not null" json:"name"`
+	Type       string         `gorm:"type:varchar(20);not null" json:"type"`
+	URL        string         `gorm:"type:text;not null;serializer:encrypted" json:"url"`
+	Secret     string         `gorm:"type:text;serializer:encrypted" json:"-"` // webhook 的 HMAC 密钥或飞书、钉钉的加签密钥
+	ChatID     string         `gorm:"type:varchar(100)" json:"chat_id"`        // 仅 Telegram
+	EventTypes datatypes.JSON `gorm:"type:json" json:"event_types"`            // 为空时接收全部事件
+	GroupIDs   datatypes.JSON `gorm:"type:json" json:"group_ids"`              // 为空时接收全部分组
+	Enabled    bool           `gorm:"not null;default:true" json:"enabled"`
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+}
+
+// AlertSilence 对应 alert_silences 表，时间窗口内匹配的告警不会发送
+type AlertSilence struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	GroupID   uint      `gorm:"index" json:"group_id"`              // 0 表示全部分组
+	EventType string    `gorm:"type:varchar(64)" json:"event_type"` // 为空表示全部事件
+	StartsAt  time.Time `gorm:"not null;index" json:"starts_at"`
+	EndsAt    time.Time `gorm:"not null;index" json:"ends_at"`
+	Reason    string    `gorm:"type:varchar(500)" json:"reason"`
+	CreatedBy string    `gorm:"type:varchar(255)" json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ProbeResult 对应 probe_results 表，记录每次合成探测的结果
+type ProbeResult struct {
+	ID           uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	GroupID      uint      `gorm:"not null;index:idx_probe_group_checked" json:"group_id"`
+	CheckedAt    time.Time `gorm:"not null;index:idx_probe_group_checked;index" json:"checked_at"`
+	Success      bool      `gorm:"not null" json:"success"`
+	StatusCode   int       `json:"status_code"`
+	LatencyMs    int64     `gorm:"not null" json:"latency_ms"`
+	RequestID    string    `gorm:"type:varchar(64)" json:"request_id"` // 对应请求日志的 request_id
+	ErrorMessage string    `gorm:"type:text" json:"error_message"`
+}
+
+// ProbeIncident 对应 probe_incidents 表，分组连续探测失败期间为一次故障
+type ProbeIncident struct {
 	ID           uint       `gorm:"primaryKey;autoIncrement" json:"id"`
-	KeyValue     string     `gorm:"type:varchar(700);not null;uniqueIndex:idx_group_key" json:"key_value"`
-	GroupID      uint       `gorm:"not null;uniqueIndex:idx_group_key" json:"group_id"`
-	Status       string     `gorm:"type:varchar(50);not null;default:'active'" json:"status"`
-	RequestCount int64      `gorm:"not null;default:0" json:"request_count"`
-	FailureCount int64      `gorm:"not null;default:0" json:"failure_count"`
-	LastUsedAt   *time.Time `json:"last_used_at"`
-	CreatedAt    time.Time  `json:"created_at"`
-	UpdatedAt    time.Time  `json:"updated_at"`
+	GroupID      uint       `gorm:"not null;index" json:"group_id"`
+	StartedAt    time.Time  `gorm:"not null;index" json:"started_at"`
+	ResolvedAt   *time.Time `gorm:"index" json:"resolved_at"`
+	FailureCount int        `gorm:"not null" json:"failure_count"`
+	StatusCode   int        `json:"status_code"`                    // 最近一次失败的状态码
+	ErrorMessage string     `gorm:"type:text" json:"error_message"` // 最近一次失败的错误信息
+}
+
+// 后台任务状态
+const (
+	TaskStatusRunning   = "running"
+	TaskStatusSucceeded = "succeeded"
+	TaskStatusFailed    = "failed"
+	TaskStatusCancelled = "cancelled"
+)
+
+// Task 对应 tasks 表，记录密钥导入、删除和验证等后台任务的进度与结果
+type Task struct {
+	ID         uint           `gorm:"primaryKey;autoIncrement" json:"id"`
+	TaskType   string         `gorm:"type:varchar(50);not null" json:"task_type"`
+	Status     string         `gorm:"type:varchar(20);not null;index" json:"status"`
+	GroupID    uint           `gorm:"not null;index" json:"group_id"`
+	GroupName  string         `gorm:"type:varchar(255)" json:"group_name"`
+	Processed  int            `gorm:"not null;default:0" json:"processed"`
+	Total      int            `gorm:"not null;default:0" json:"total"`
+	Result     datatypes.JSON `gorm:"type:json" json:"result"`
+	Error      string         `gorm:"type:text" json:"error"`
+	StartedAt  time.Time      `gorm:"not null;index" json:"started_at"`
+	FinishedAt *time.Time     `gorm:"index" json:"finished_at"`
 }
 
 // RequestType 请求类型常量
@@ -95,23 +529,27 @@ const (
 
 // RequestLog 对应 request_logs 表
 type RequestLog struct {
-	ID           string    `gorm:"type:varchar(36);primaryKey" json:"id"`
-	Timestamp    time.Time `gorm:"not null;index" json:"timestamp"`
-	GroupID      uint      `gorm:"not null;index" json:"group_id"`
-	GroupName    string    `gorm:"type:varchar(255);index" json:"group_name"`
-	KeyValue     string    `gorm:"type:varchar(700)" json:"key_value"`
-	Model        string    `gorm:"type:varchar(255);index" json:"model"`
-	IsSuccess    bool      `gorm:"not null" json:"is_success"`
-	SourceIP     string    `gorm:"type:varchar(64)" json:"source_ip"`
-	StatusCode   int       `gorm:"not null" json:"status_code"`
-	RequestPath  string    `gorm:"type:varchar(500)" json:"request_path"`
-	Duration     int64     `gorm:"not null" json:"duration_ms"`
-	ErrorMessage string    `gorm:"type:text" json:"error_message"`
-	UserAgent    string    `gorm:"type:varchar(512)" json:"user_agent"`
-	RequestType  string    `gorm:"type:varchar(20);not null;default:'final';index" json:"request_type"`
-	UpstreamAddr string    `gorm:"type:varchar(500)" json:"upstream_addr"`
-	IsStream     bool      `gorm:"not null" json:"is_stream"`
-	RequestBody  string    `gorm:"type:text" json:"request_body"`
+	ID              string    `gorm:"type:varchar(36);primaryKey" json:"id"`
+	RequestID       string    `gorm:"type:varchar(64);index" json:"request_id"`
+	ClientRequestID string    `gorm:"type:varchar(64);index" json:"client_request_id"` // 客户端 X-Request-ID 请求头
+	Attempt         int       `gorm:"not null;default:1" json:"attempt"`
+	Timestamp       time.Time `gorm:"not null;index" json:"timestamp"`
+	GroupID         uint      `gorm:"not null;index" json:"group_id"`
+	GroupName       string    `gorm:"type:varchar(255);index" json:"group_name"`
+	KeyValue        string    `gorm:"type:text;serializer:encrypted" json:"key_value"`
+	KeyHash         string    `gorm:"type:varchar(64);index" json:"-"`
+	Model           string    `gorm:"type:varchar(255);index" json:"model"`
+	IsSuccess       bool      `gorm:"not null" json:"is_success"`
+	SourceIP        string    `gorm:"type:varchar(64)" json:"source_ip"`
+	StatusCode      int       `gorm:"not null" json:"status_code"`
+	RequestPath     string    `gorm:"type:varchar(500)" json:"request_path"`
+	Duration        int64     `gorm:"not null" json:"duration_ms"`
+	ErrorMessage    string    `gorm:"type:text" json:"error_message"`
+	UserAgent       string    `gorm:"type:varchar(512)" json:"user_agent"`
+	RequestType     string    `gorm:"type:varchar(20);not null;default:'final';index" json:"request_type"`
+	UpstreamAddr    string    `gorm:"type:varchar(500)" json:"upstream_addr"`
+	IsStream        bool      `gorm:"not null" json:"is_stream"`
+	RequestBody     string    `gorm:"type:text" json:"request_body"`
 }
 
 // StatCard 用于仪表盘的单个统计卡片数据
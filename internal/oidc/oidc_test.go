@@ -0,0 +1,339 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testClientID     = "gpt-load"
+	testClientSecret = "secret"
+	testKeyID        = "test-key"
+	testRedirectURI  = "https://gpt-load.example.com/api/auth/oidc/callback"
+)
+
+// mockProvider is an OpenID Connect provider serving discovery, JWKS and a token endpoint.
+type mockProvider struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	// claims returns the claims of the next ID token, idToken overrides the token entirely when set.
+	claims  func() map[string]any
+	idToken string
+
+	lastForm url.Values
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := &mockProvider{t: t, key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc(discoveryPath, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{
+			"issuer":                 m.server.URL,
+			"authorization_endpoint": m.server.URL + "/authorize",
+			"token_endpoint":         m.server.URL + "/token",
+			"jwks_uri":               m.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{"keys": []map[string]any{{
+			"kty": "RSA",
+			"kid": testKeyID,
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		m.lastForm = r.PostForm
+		if id, secret, ok := r.BasicAuth(); !ok || id != testClientID || secret != testClientSecret {
+			http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+			return
+		}
+		if r.PostForm.Get("code") != "good-code" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		idToken := m.idToken
+		if idToken == "" {
+			idToken = m.sign("RS256", testKeyID, m.claims())
+		}
+		writeJSON(w, map[string]any{"access_token": "access", "token_type": "Bearer", "id_token": idToken})
+	})
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+
+	m.claims = func() map[string]any { return m.validClaims("nonce-1") }
+	return m
+}
+
+func (m *mockProvider) provider() *Provider {
+	return NewProvider(Config{
+		Issuer:       m.server.URL,
+		ClientID:     testClientID,
+		ClientSecret: testClientSecret,
+		Scopes:       []string{"openid", "profile"},
+	})
+}
+
+func (m *mockProvider) validClaims(nonce string) map[string]any {
+	return map[string]any{
+		"iss":   m.server.URL,
+		"aud":   testClientID,
+		"sub":   "user-1",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"nonce": nonce,
+	}
+}
+
+// sign creates a JWT signed with the provider key.
+func (m *mockProvider) sign(alg, kid string, claims map[string]any) string {
+	m.t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(input))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, m.key, crypto.SHA256, digest[:])
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func writeJSON(w http.ResponseWriter, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(value)
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	m := newMockProvider(t)
+
+	authURL, err := m.provider().AuthCodeURL(context.Background(), testRedirectURI, "state-1", "nonce-1", "challenge")
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(authURL, m.server.URL+"/authorize?") {
+		t.Errorf("unexpected authorization endpoint: %s", authURL)
+	}
+	query := parsed.Query()
+	expected := map[string]string{
+		"response_type":         "code",
+		"client_id":             testClientID,
+		"redirect_uri":          testRedirectURI,
+		"scope":                 "openid profile",
+		"state":                 "state-1",
+		"nonce":                 "nonce-1",
+		"code_challenge":        "challenge",
+		"code_challenge_method": "S256",
+	}
+	for name, value := range expected {
+		if got := query.Get(name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+}
+
+func TestDiscoveryRejectsIssuerMismatch(t *testing.T) {
+	m := newMockProvider(t)
+	provider := NewProvider(Config{Issuer: m.server.URL + "/other", ClientID: testClientID})
+
+	if _, err := provider.AuthCodeURL(context.Background(), testRedirectURI, "s", "n", "c"); err == nil {
+		t.Fatal("expected an error for a discovery document of another issuer")
+	}
+}
+
+func TestExchangeAndVerify(t *testing.T) {
+	m := newMockProvider(t)
+	provider := m.provider()
+	ctx := context.Background()
+
+	token, err := provider.Exchange(ctx, "good-code", "verifier", testRedirectURI)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if got := m.lastForm.Get("code_verifier"); got != "verifier" {
+		t.Errorf("code_verifier = %q, want %q", got, "verifier")
+	}
+	if got := m.lastForm.Get("redirect_uri"); got != testRedirectURI {
+		t.Errorf("redirect_uri = %q, want %q", got, testRedirectURI)
+	}
+
+	claims, err := provider.VerifyIDToken(ctx, token.IDToken, "nonce-1")
+	if err != nil {
+		t.Fatalf("VerifyIDToken: %v", err)
+	}
+	if claims["sub"] != "user-1" {
+		t.Errorf("sub = %v, want user-1", claims["sub"])
+	}
+}
+
+func TestExchangeRejectsInvalidCode(t *testing.T) {
+	m := newMockProvider(t)
+
+	if _, err := m.provider().Exchange(context.Background(), "bad-code", "verifier", testRedirectURI); err == nil {
+		t.Fatal("expected an error for an invalid code")
+	}
+}
+
+func TestVerifyIDTokenRejections(t *testing.T) {
+	m := newMockProvider(t)
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token func() string
+	}{
+		{"nonce", func() string { return m.sign("RS256", testKeyID, m.validClaims("other-nonce")) }},
+		{"issuer", func() string {
+			claims := m.validClaims("nonce-1")
+			claims["iss"] = "https://evil.example.com"
+			return m.sign("RS256", testKeyID, claims)
+		}},
+		{"audience", func() string {
+			claims := m.validClaims("nonce-1")
+			claims["aud"] = []any{"another-client"}
+			return m.sign("RS256", testKeyID, claims)
+		}},
+		{"authorized party", func() string {
+			claims := m.validClaims("nonce-1")
+			claims["aud"] = []any{testClientID, "another-client"}
+			claims["azp"] = "another-client"
+			return m.sign("RS256", testKeyID, claims)
+		}},
+		{"expired", func() string {
+			claims := m.validClaims("nonce-1")
+			claims["exp"] = time.Now().Add(-time.Hour).Unix()
+			return m.sign("RS256", testKeyID, claims)
+		}},
+		{"missing expiry", func() string {
+			claims := m.validClaims("nonce-1")
+			delete(claims, "exp")
+			return m.sign("RS256", testKeyID, claims)
+		}},
+		{"missing subject", func() string {
+			claims := m.validClaims("nonce-1")
+			delete(claims, "sub")
+			return m.sign("RS256", testKeyID, claims)
+		}},
+		{"unknown key", func() string { return m.sign("RS256", "unknown", m.validClaims("nonce-1")) }},
+		{"symmetric algorithm", func() string { return m.sign("HS256", testKeyID, m.validClaims("nonce-1")) }},
+		{"none algorithm", func() string {
+			token := m.sign("none", testKeyID, m.validClaims("nonce-1"))
+			return token[:strings.LastIndex(token, ".")+1]
+		}},
+		{"tampered payload", func() string {
+			token := m.sign("RS256", testKeyID, m.validClaims("nonce-1"))
+			parts := strings.Split(token, ".")
+			claims := m.validClaims("nonce-1")
+			claims["sub"] = "admin"
+			payload, _ := json.Marshal(claims)
+			return parts[0] + "." + base64.RawURLEncoding.EncodeToString(payload) + "." + parts[2]
+		}},
+		{"signed by another key", func() string {
+			signer := &mockProvider{t: t, key: otherKey}
+			return signer.sign("RS256", testKeyID, m.validClaims("nonce-1"))
+		}},
+		{"malformed", func() string { return "not-a-jwt" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := m.provider().VerifyIDToken(context.Background(), tt.token(), "nonce-1"); err == nil {
+				t.Fatal("expected the id token to be rejected")
+			}
+		})
+	}
+}
+
+func TestVerifyJWS(t *testing.T) {
+	input := []byte("header.payload")
+	digest := sha256.Sum256(input)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rsaSignature, err := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	pssSignature, err := rsa.SignPSS(rand.Reader, rsaKey, crypto.SHA256, digest[:], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, s, err := ecdsa.Sign(rand.Reader, ecKey, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecSignature := make([]byte, 64)
+	r.FillBytes(ecSignature[:32])
+	s.FillBytes(ecSignature[32:])
+
+	valid := []struct {
+		alg       string
+		key       crypto.PublicKey
+		signature []byte
+	}{
+		{"RS256", &rsaKey.PublicKey, rsaSignature},
+		{"PS256", &rsaKey.PublicKey, pssSignature},
+		{"ES256", &ecKey.PublicKey, ecSignature},
+	}
+	for _, tt := range valid {
+		if err := verifyJWS(tt.alg, tt.key, input, tt.signature); err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.alg, err)
+		}
+		tampered := append([]byte(nil), tt.signature...)
+		tampered[len(tampered)-1] ^= 0xff
+		if err := verifyJWS(tt.alg, tt.key, input, tampered); err == nil {
+			t.Errorf("%s: expected a tampered signature to be rejected", tt.alg)
+		}
+	}
+
+	if err := verifyJWS("ES256", &rsaKey.PublicKey, input, ecSignature); err == nil {
+		t.Error("expected a key of the wrong type to be rejected")
+	}
+	if err := verifyJWS("HS256", &rsaKey.PublicKey, input, rsaSignature); err == nil {
+		t.Error("expected a symmetric algorithm to be rejected")
+	}
+	if err := verifyJWS("ES256", &ecKey.PublicKey, input, ecSignature[:63]); err == nil {
+		t.Error("expected a signature of the wrong length to be rejected")
+	}
+}
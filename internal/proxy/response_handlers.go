@@ -46,3 +46,22 @@ func (ps *ProxyServer) handleNormalResponse(c *gin.Context, resp *http.Response)
 		logUpstreamError("copying response body", err)
 	}
 }
+
+// firstByteReader calls onFirstByte when the first bytes of the upstream body are read.
+type firstByteReader struct {
+	io.ReadCloser
+	onFirstByte func()
+}
+
+func newFirstByteReader(body io.ReadCloser, onFirstByte func()) io.ReadCloser {
+	return &firstByteReader{ReadCloser: body, onFirstByte: onFirstByte}
+}
+
+func (r *firstByteReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 && r.onFirstByte != nil {
+		r.onFirstByte()
+		r.onFirstByte = nil
+	}
+	return n, err
+}
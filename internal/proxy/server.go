@@ -9,19 +9,29 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"time"
 
+	"gpt-load/internal/alert"
 	"gpt-load/internal/channel"
 	"gpt-load/internal/config"
 	app_errors "gpt-load/internal/errors"
 	"gpt-load/internal/keypool"
+	"gpt-load/internal/metrics"
 	"gpt-load/internal/models"
 	"gpt-load/internal/response"
 	"gpt-load/internal/services"
+	"gpt-load/internal/tracing"
 	"gpt-load/internal/utils"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // ProxyServer represents the proxy server
@@ -31,6 +41,7 @@ type ProxyServer struct {
 	settingsManager   *config.SystemSettingsManager
 	channelFactory    *channel.Factory
 	requestLogService *services.RequestLogService
+	alerts            *alert.Service
 }
 
 // NewProxyServer creates a new proxy server
@@ -40,6 +51,7 @@ func NewProxyServer(
 	settingsManager *config.SystemSettingsManager,
 	channelFactory *channel.Factory,
 	requestLogService *services.RequestLogService,
+	alerts *alert.Service,
 ) (*ProxyServer, error) {
 	return &ProxyServer{
 		keyProvider:       keyProvider,
@@ -47,6 +59,7 @@ func NewProxyServer(
 		settingsManager:   settingsManager,
 		channelFactory:    channelFactory,
 		requestLogService: requestLogService,
+		alerts:            alerts,
 	}, nil
 }
 
@@ -55,6 +68,27 @@ func (ps *ProxyServer) HandleProxy(c *gin.Context) {
 	startTime := time.Now()
 	groupName := c.Param("group_name")
 
+	// 延续客户端传入的 traceparent
+	ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+	ctx, span := tracing.Tracer().Start(ctx, "proxy "+groupName,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("gptload.group", groupName),
+			attribute.String("gptload.request_id", utils.GetRequestID(c)),
+			semconv.HTTPRequestMethodKey.String(c.Request.Method),
+			semconv.URLPath(c.Request.URL.Path),
+		),
+	)
+	defer func() {
+		statusCode := c.Writer.Status()
+		span.SetAttributes(semconv.HTTPResponseStatusCode(statusCode))
+		if statusCode >= 500 {
+			span.SetStatus(codes.Error, http.StatusText(statusCode))
+		}
+		span.End()
+	}()
+	c.Request = c.Request.WithContext(ctx)
+
 	group, err := ps.groupManager.GetGroupByName(groupName)
 	if err != nil {
 		response.Error(c, app_errors.ParseDBError(err))
@@ -82,6 +116,10 @@ func (ps *ProxyServer) HandleProxy(c *gin.Context) {
 	}
 
 	isStream := channelHandler.IsStreamRequest(c, bodyBytes)
+	span.SetAttributes(
+		attribute.Bool("gptload.stream", isStream),
+		attribute.String("gptload.model", channelHandler.ExtractModel(c, bodyBytes)),
+	)
 
 	ps.executeRequestWithRetry(c, channelHandler, group, finalBodyBytes, isStream, startTime, 0)
 }
@@ -98,15 +136,39 @@ func (ps *ProxyServer) executeRequestWithRetry(
 ) {
 	cfg := group.EffectiveConfig
 
-	apiKey, err := ps.keyProvider.SelectKey(group.ID)
+	attemptCtx, attemptSpan := tracing.Tracer().Start(c.Request.Context(), "proxy.attempt",
+		trace.WithAttributes(attribute.Int("gptload.attempt", retryCount+1)),
+	)
+	defer attemptSpan.End()
+
+	_, selectSpan := tracing.Tracer().Start(attemptCtx, "keypool.select_key")
+	apiKey, err := ps.keyProvider.SelectKey(group.KeyOwner())
+	if err != nil {
+		selectSpan.RecordError(err)
+		selectSpan.SetStatus(codes.Error, err.Error())
+	} else {
+		selectSpan.SetAttributes(attribute.Int64("gptload.key.id", int64(apiKey.ID)))
+	}
+	selectSpan.End()
+
 	if err != nil {
+		if errors.Is(err, app_errors.ErrNoActiveKeys) {
+			metrics.KeySelections.WithLabelValues(group.Name, "no_keys").Inc()
+			ps.alerts.CheckActiveKeys(group, 0)
+		} else {
+			metrics.KeySelections.WithLabelValues(group.Name, "error").Inc()
+		}
 		logrus.Errorf("Failed to select a key for group %s on attempt %d: %v", group.Name, retryCount+1, err)
+		attemptSpan.SetStatus(codes.Error, err.Error())
 		response.Error(c, app_errors.NewAPIError(app_errors.ErrNoKeysAvailable, err.Error()))
-		ps.logRequest(c, group, nil, startTime, http.StatusServiceUnavailable, err, isStream, "", channelHandler, bodyBytes, models.RequestTypeFinal)
+		ps.logRequest(attemptCtx, c, group, nil, startTime, http.StatusServiceUnavailable, err, isStream, "", channelHandler, bodyBytes, models.RequestTypeFinal, retryCount+1)
 		return
 	}
 
-	upstreamURL, err := channelHandler.BuildUpstreamURL(c.Request.URL, group)
+	metrics.KeySelections.WithLabelValues(group.Name, "success").Inc()
+	attemptSpan.SetAttributes(attribute.Int64("gptload.key.id", int64(apiKey.ID)))
+
+	upstreamURL, err := channelHandler.BuildUpstreamURL(c.Request.URL, group, apiKey)
 	if err != nil {
 		response.Error(c, app_errors.NewAPIError(app_errors.ErrInternalServer, fmt.Sprintf("Failed to build upstream URL: %v", err)))
 		return
@@ -115,10 +177,10 @@ func (ps *ProxyServer) executeRequestWithRetry(
 	var ctx context.Context
 	var cancel context.CancelFunc
 	if isStream {
-		ctx, cancel = context.WithCancel(c.Request.Context())
+		ctx, cancel = context.WithCancel(attemptCtx)
 	} else {
 		timeout := time.Duration(cfg.RequestTimeout) * time.Second
-		ctx, cancel = context.WithTimeout(c.Request.Context(), timeout)
+		ctx, cancel = context.WithTimeout(attemptCtx, timeout)
 	}
 	defer cancel()
 
@@ -137,24 +199,27 @@ func (ps *ProxyServer) executeRequestWithRetry(
 	req.Header.Del("X-Api-Key")
 	req.Header.Del("X-Goog-Api-Key")
 
-	// Apply custom header rules
+	// Apply custom header rules, the key's own rules after the group's
+	headerCtx := utils.NewHeaderVariableContextFromGin(c, group, apiKey)
 	if len(group.HeaderRuleList) > 0 {
-		headerCtx := utils.NewHeaderVariableContextFromGin(c, group, apiKey)
 		utils.ApplyHeaderRules(req, group.HeaderRuleList, headerCtx)
 	}
+	utils.ApplyKeyHeaderRules(req, apiKey, headerCtx)
 
 	channelHandler.ModifyRequest(req, apiKey, group)
 
 	var client *http.Client
 	if isStream {
-		client = channelHandler.GetStreamClient()
+		client = channelHandler.GetStreamClient(apiKey)
 		req.Header.Set("X-Accel-Buffering", "no")
 	} else {
-		client = channelHandler.GetHTTPClient()
+		client = channelHandler.GetHTTPClient(apiKey)
 	}
 
+	attemptStart := time.Now()
 	resp, err := client.Do(req)
 	if resp != nil {
+		metrics.UpstreamLatency.WithLabelValues(group.Name, metrics.StreamLabel(isStream)).Observe(time.Since(attemptStart).Seconds())
 		defer resp.Body.Close()
 	}
 
@@ -162,7 +227,7 @@ func (ps *ProxyServer) executeRequestWithRetry(
 	if err != nil || (resp != nil && resp.StatusCode >= 400 && resp.StatusCode != http.StatusNotFound) {
 		if err != nil && app_errors.IsIgnorableError(err) {
 			logrus.Debugf("Client-side ignorable error for key %s, aborting retries: %v", utils.MaskAPIKey(apiKey.KeyValue), err)
-			ps.logRequest(c, group, apiKey, startTime, 499, err, isStream, upstreamURL, channelHandler, bodyBytes, models.RequestTypeFinal)
+			ps.logRequest(attemptCtx, c, group, apiKey, startTime, 499, err, isStream, upstreamURL, channelHandler, bodyBytes, models.RequestTypeFinal, retryCount+1)
 			return
 		}
 
@@ -190,8 +255,15 @@ func (ps *ProxyServer) executeRequestWithRetry(
 			logrus.Debugf("Request failed with status %d (attempt %d/%d) for key %s. Parsed Error: %s", statusCode, retryCount+1, cfg.MaxRetries, utils.MaskAPIKey(apiKey.KeyValue), parsedError)
 		}
 
+		attemptSpan.SetAttributes(semconv.HTTPResponseStatusCode(statusCode))
+		attemptSpan.SetStatus(codes.Error, parsedError)
+
 		// 使用解析后的错误信息更新密钥状态
-		ps.keyProvider.UpdateStatus(apiKey, group, false, parsedError)
+		ps.keyProvider.UpdateStatus(apiKey, group, keypool.StatusUpdate{
+			StatusCode:   statusCode,
+			ErrorMessage: parsedError,
+			Source:       models.KeyEventSourceTraffic,
+		})
 
 		// 判断是否为最后一次尝试
 		isLastAttempt := retryCount >= cfg.MaxRetries
@@ -200,7 +272,7 @@ func (ps *ProxyServer) executeRequestWithRetry(
 			requestType = models.RequestTypeFinal
 		}
 
-		ps.logRequest(c, group, apiKey, startTime, statusCode, errors.New(parsedError), isStream, upstreamURL, channelHandler, bodyBytes, requestType)
+		ps.logRequest(attemptCtx, c, group, apiKey, startTime, statusCode, errors.New(parsedError), isStream, upstreamURL, channelHandler, bodyBytes, requestType, retryCount+1)
 
 		// 如果是最后一次尝试，直接返回错误，不再递归
 		if isLastAttempt {
@@ -213,6 +285,8 @@ func (ps *ProxyServer) executeRequestWithRetry(
 			return
 		}
 
+		metrics.ProxyRetries.WithLabelValues(group.Name).Inc()
+		attemptSpan.End()
 		ps.executeRequestWithRetry(c, channelHandler, group, bodyBytes, isStream, startTime, retryCount+1)
 		return
 	}
@@ -225,7 +299,14 @@ func (ps *ProxyServer) executeRequestWithRetry(
 			c.Header(key, value)
 		}
 	}
+	// 上游可能返回自己的 X-Request-ID，以本服务的请求 ID 为准
+	c.Header(utils.RequestIDHeader, utils.GetRequestID(c))
 	c.Status(resp.StatusCode)
+	attemptSpan.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+
+	resp.Body = newFirstByteReader(resp.Body, func() {
+		metrics.UpstreamTimeToFirstByte.WithLabelValues(group.Name, metrics.StreamLabel(isStream)).Observe(time.Since(attemptStart).Seconds())
+	})
 
 	if isStream {
 		ps.handleStreamingResponse(c, resp)
@@ -233,11 +314,12 @@ func (ps *ProxyServer) executeRequestWithRetry(
 		ps.handleNormalResponse(c, resp)
 	}
 
-	ps.logRequest(c, group, apiKey, startTime, resp.StatusCode, nil, isStream, upstreamURL, channelHandler, bodyBytes, models.RequestTypeFinal)
+	ps.logRequest(attemptCtx, c, group, apiKey, startTime, resp.StatusCode, nil, isStream, upstreamURL, channelHandler, bodyBytes, models.RequestTypeFinal, retryCount+1)
 }
 
 // logRequest is a helper function to create and record a request log.
 func (ps *ProxyServer) logRequest(
+	ctx context.Context,
 	c *gin.Context,
 	group *models.Group,
 	apiKey *models.APIKey,
@@ -249,11 +331,32 @@ func (ps *ProxyServer) logRequest(
 	channelHandler channel.ChannelProxy,
 	bodyBytes []byte,
 	requestType string,
+	attempt int,
 ) {
+	model := ""
+	if channelHandler != nil && bodyBytes != nil {
+		model = channelHandler.ExtractModel(c, bodyBytes)
+	}
+
+	if requestType == models.RequestTypeFinal {
+		stream := metrics.StreamLabel(isStream)
+		modelLabel := metrics.ModelLabel(group.Name, model, group.TestModel)
+		metrics.ProxyRequests.WithLabelValues(group.Name, modelLabel, strconv.Itoa(statusCode), stream).Inc()
+		metrics.ProxyRequestDuration.WithLabelValues(group.Name, modelLabel, stream).Observe(time.Since(startTime).Seconds())
+
+		// 客户端主动取消的请求不计入错误率
+		if statusCode != 499 {
+			ps.alerts.ObserveRequest(group, finalError != nil || statusCode >= 400)
+		}
+	}
+
 	if ps.requestLogService == nil {
 		return
 	}
 
+	_, span := tracing.Tracer().Start(ctx, "proxy.log_request", trace.WithAttributes(attribute.String("gptload.request_type", requestType)))
+	defer span.End()
+
 	var requestBodyToLog, userAgent string
 
 	if group.EffectiveConfig.EnableRequestBodyLogging {
@@ -264,22 +367,22 @@ func (ps *ProxyServer) logRequest(
 	duration := time.Since(startTime).Milliseconds()
 
 	logEntry := &models.RequestLog{
-		GroupID:      group.ID,
-		GroupName:    group.Name,
-		IsSuccess:    finalError == nil && statusCode < 400,
-		SourceIP:     c.ClientIP(),
-		StatusCode:   statusCode,
-		RequestPath:  utils.TruncateString(c.Request.URL.String(), 500),
-		Duration:     duration,
-		UserAgent:    userAgent,
-		RequestType:  requestType,
-		IsStream:     isStream,
-		UpstreamAddr: utils.TruncateString(upstreamAddr, 500),
-		RequestBody:  requestBodyToLog,
-	}
-
-	if channelHandler != nil && bodyBytes != nil {
-		logEntry.Model = channelHandler.ExtractModel(c, bodyBytes)
+		RequestID:       utils.GetRequestID(c),
+		ClientRequestID: utils.GetClientRequestID(c),
+		Attempt:         attempt,
+		GroupID:         group.ID,
+		GroupName:       group.Name,
+		IsSuccess:       finalError == nil && statusCode < 400,
+		SourceIP:        c.ClientIP(),
+		StatusCode:      statusCode,
+		RequestPath:     utils.TruncateString(c.Request.URL.String(), 500),
+		Duration:        duration,
+		UserAgent:       userAgent,
+		RequestType:     requestType,
+		IsStream:        isStream,
+		UpstreamAddr:    utils.TruncateString(upstreamAddr, 500),
+		RequestBody:     requestBodyToLog,
+		Model:           model,
 	}
 
 	if apiKey != nil {
@@ -291,6 +394,8 @@ func (ps *ProxyServer) logRequest(
 	}
 
 	if err := ps.requestLogService.Record(logEntry); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 		logrus.Errorf("Failed to record request log: %v", err)
 	}
 }
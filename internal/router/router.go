@@ -2,6 +2,7 @@ package router
 
 import (
 	"embed"
+	"gpt-load/internal/auth"
 	"gpt-load/internal/handler"
 	"gpt-load/internal/middleware"
 	"gpt-load/internal/proxy"
@@ -16,6 +17,7 @@ import (
 	"github.com/gin-contrib/static"
 
 	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
 )
 
 type embedFileSystem struct {
@@ -42,15 +44,25 @@ func NewRouter(
 	proxyServer *proxy.ProxyServer,
 	configManager types.ConfigManager,
 	groupManager *services.GroupManager,
+	adminUserService *services.AdminUserService,
+	sessionService *services.SessionService,
+	authLimiter *services.AuthLimiter,
+	metricsService *services.MetricsService,
 	buildFS embed.FS,
 	indexPage []byte,
 ) *gin.Engine {
 	gin.SetMode(gin.ReleaseMode)
 
 	router := gin.New()
+	// 客户端 IP 用于认证失败锁定和审计，只信任配置的反向代理传递的 X-Forwarded-For
+	if err := router.SetTrustedProxies(configManager.GetEffectiveServerConfig().TrustedProxies); err != nil {
+		logrus.WithError(err).Error("Invalid trusted proxies, client IPs are taken from the connection")
+		_ = router.SetTrustedProxies(nil)
+	}
 
 	// 注册全局中间件
 	router.Use(middleware.Recovery())
+	router.Use(middleware.RequestID())
 	router.Use(middleware.ErrorHandler())
 	router.Use(middleware.Logger(configManager.GetLogConfig()))
 	router.Use(middleware.CORS(configManager.GetCORSConfig()))
@@ -62,17 +74,27 @@ func NewRouter(
 	})
 
 	// 注册路由
-	registerSystemRoutes(router, serverHandler)
-	registerAPIRoutes(router, serverHandler, configManager)
-	registerProxyRoutes(router, proxyServer, groupManager)
+	registerSystemRoutes(router, serverHandler, configManager, metricsService)
+	registerAPIRoutes(router, serverHandler, configManager, adminUserService, sessionService, authLimiter)
+	registerProxyRoutes(router, proxyServer, groupManager, authLimiter)
 	registerFrontendRoutes(router, buildFS, indexPage)
 
 	return router
 }
 
 // registerSystemRoutes 注册系统级路由
-func registerSystemRoutes(router *gin.Engine, serverHandler *handler.Server) {
+func registerSystemRoutes(
+	router *gin.Engine,
+	serverHandler *handler.Server,
+	configManager types.ConfigManager,
+	metricsService *services.MetricsService,
+) {
 	router.GET("/health", serverHandler.Health)
+	router.GET("/status.json", serverHandler.PublicStatus)
+
+	if metricsConfig := configManager.GetMetricsConfig(); metricsConfig.Enabled {
+		router.GET("/metrics", middleware.MetricsAuth(metricsConfig.Token), gin.WrapH(metricsService.Handler()))
+	}
 }
 
 // registerAPIRoutes 注册API路由
@@ -80,6 +102,9 @@ func registerAPIRoutes(
 	router *gin.Engine,
 	serverHandler *handler.Server,
 	configManager types.ConfigManager,
+	adminUserService *services.AdminUserService,
+	sessionService *services.SessionService,
+	authLimiter *services.AuthLimiter,
 ) {
 	api := router.Group("/api")
 	authConfig := configManager.GetAuthConfig()
@@ -89,53 +114,109 @@ func registerAPIRoutes(
 
 	// 认证
 	protectedAPI := api.Group("")
-	protectedAPI.Use(middleware.Auth(authConfig))
+	protectedAPI.Use(middleware.Auth(authConfig, adminUserService, sessionService, authLimiter))
 	registerProtectedAPIRoutes(protectedAPI, serverHandler)
 }
 
 // registerPublicAPIRoutes 公开API路由
 func registerPublicAPIRoutes(api *gin.RouterGroup, serverHandler *handler.Server) {
 	api.POST("/auth/login", serverHandler.Login)
+	api.POST("/auth/refresh", serverHandler.RefreshSession)
+	api.GET("/auth/oidc/config", serverHandler.GetSSOConfig)
+	api.GET("/auth/oidc/login", serverHandler.SSOLogin)
+	api.GET("/auth/oidc/callback", serverHandler.SSOCallback)
 }
 
-// registerProtectedAPIRoutes 认证API路由
+// registerProtectedAPIRoutes 认证API路由，按角色权限控制访问
 func registerProtectedAPIRoutes(api *gin.RouterGroup, serverHandler *handler.Server) {
-	api.GET("/channel-types", serverHandler.CommonHandler.GetChannelTypes)
+	read := middleware.RequirePermission(auth.PermissionRead)
+	revealKeys := middleware.RequirePermission(auth.PermissionRevealKeys)
+	writeKeys := middleware.RequirePermission(auth.PermissionWriteKeys)
+	updateGroups := middleware.RequirePermission(auth.PermissionUpdateGroups)
+	manageGroups := middleware.RequirePermission(auth.PermissionManageGroups)
+	manageSettings := middleware.RequirePermission(auth.PermissionManageSettings)
+	manageUsers := middleware.RequirePermission(auth.PermissionManageUsers)
+	readAudit := middleware.RequirePermission(auth.PermissionReadAudit)
+
+	// 当前用户
+	account := api.Group("/auth")
+	{
+		account.POST("/logout", serverHandler.Logout)
+		account.GET("/me", serverHandler.GetCurrentUser)
+		account.GET("/tokens", serverHandler.ListOwnTokens)
+		account.POST("/tokens", serverHandler.CreateOwnToken)
+		account.DELETE("/tokens/:id", serverHandler.DeleteOwnToken)
+	}
+
+	api.GET("/channel-types", read, serverHandler.CommonHandler.GetChannelTypes)
 
 	groups := api.Group("/groups")
 	{
-		groups.POST("", serverHandler.CreateGroup)
-		groups.GET("", serverHandler.ListGroups)
-		groups.GET("/list", serverHandler.List)
-		groups.GET("/config-options", serverHandler.GetGroupConfigOptions)
-		groups.PUT("/:id", serverHandler.UpdateGroup)
-		groups.DELETE("/:id", serverHandler.DeleteGroup)
-		groups.GET("/:id/stats", serverHandler.GetGroupStats)
-		groups.POST("/:id/copy", serverHandler.CopyGroup)
+		groups.POST("", manageGroups, serverHandler.CreateGroup)
+		groups.GET("", read, serverHandler.ListGroups)
+		groups.GET("/list", read, serverHandler.List)
+		groups.GET("/config-options", read, serverHandler.GetGroupConfigOptions)
+		groups.PUT("/:id", updateGroups, serverHandler.UpdateGroup)
+		groups.DELETE("/:id", manageGroups, serverHandler.DeleteGroup)
+		groups.GET("/:id/stats", read, serverHandler.GetGroupStats)
+		groups.POST("/:id/copy", manageGroups, serverHandler.CopyGroup)
+		groups.GET("/:id/probe-results", read, serverHandler.GetGroupProbeResults)
+		groups.POST("/:id/probe", updateGroups, serverHandler.RunGroupProbe)
+		groups.PUT("/:id/availability", updateGroups, serverHandler.UpdateGroupAvailability)
+		groups.GET("/:id/versions", read, serverHandler.ListGroupVersions)
+		groups.GET("/:id/versions/diff", read, serverHandler.DiffGroupVersions)
+		groups.GET("/:id/versions/:version", read, serverHandler.GetGroupVersion)
+		groups.POST("/:id/versions/:version/rollback", updateGroups, serverHandler.RollbackGroupVersion)
+	}
+
+	// 多个分组共享的密钥池
+	keyPools := api.Group("/key-pools")
+	{
+		keyPools.GET("", read, serverHandler.ListKeyPools)
+		keyPools.POST("", manageGroups, serverHandler.CreateKeyPool)
+		keyPools.PUT("/:id", manageGroups, serverHandler.UpdateKeyPool)
+		keyPools.DELETE("/:id", manageGroups, serverHandler.DeleteKeyPool)
+	}
+
+	// 可用性探测
+	probes := api.Group("/probes", read)
+	{
+		probes.GET("", serverHandler.GetProbeUptime)
+		probes.GET("/incidents", serverHandler.GetProbeIncidents)
 	}
 
 	// Key Management Routes
 	keys := api.Group("/keys")
 	{
-		keys.GET("", serverHandler.ListKeysInGroup)
-		keys.GET("/export", serverHandler.ExportKeys)
-		keys.POST("/add-multiple", serverHandler.AddMultipleKeys)
-		keys.POST("/add-async", serverHandler.AddMultipleKeysAsync)
-		keys.POST("/delete-multiple", serverHandler.DeleteMultipleKeys)
-		keys.POST("/delete-async", serverHandler.DeleteMultipleKeysAsync)
-		keys.POST("/restore-multiple", serverHandler.RestoreMultipleKeys)
-		keys.POST("/restore-all-invalid", serverHandler.RestoreAllInvalidKeys)
-		keys.POST("/clear-all-invalid", serverHandler.ClearAllInvalidKeys)
-		keys.POST("/clear-all", serverHandler.ClearAllKeys)
-		keys.POST("/validate-group", serverHandler.ValidateGroupKeys)
-		keys.POST("/test-multiple", serverHandler.TestMultipleKeys)
+		keys.GET("", read, serverHandler.ListKeysInGroup)
+		keys.GET("/export", revealKeys, serverHandler.ExportKeys)
+		keys.POST("/add-multiple", writeKeys, serverHandler.AddMultipleKeys)
+		keys.POST("/add-async", writeKeys, serverHandler.AddMultipleKeysAsync)
+		keys.POST("/import", writeKeys, serverHandler.ImportKeysFromFile)
+		keys.POST("/delete-multiple", writeKeys, serverHandler.DeleteMultipleKeys)
+		keys.POST("/delete-async", writeKeys, serverHandler.DeleteMultipleKeysAsync)
+		keys.POST("/restore-multiple", writeKeys, serverHandler.RestoreMultipleKeys)
+		keys.POST("/restore-all-invalid", writeKeys, serverHandler.RestoreAllInvalidKeys)
+		keys.POST("/clear-all-invalid", writeKeys, serverHandler.ClearAllInvalidKeys)
+		keys.POST("/clear-all", writeKeys, serverHandler.ClearAllKeys)
+		keys.POST("/validate-group", writeKeys, serverHandler.ValidateGroupKeys)
+		keys.POST("/test-multiple", writeKeys, serverHandler.TestMultipleKeys)
+		keys.POST("/update-metadata", writeKeys, serverHandler.UpdateKeysMetadata)
+		keys.POST("/transfer", writeKeys, serverHandler.TransferKeys)
+		keys.GET("/:id/events", read, serverHandler.ListKeyEvents)
 	}
 
 	// Tasks
-	api.GET("/tasks/status", serverHandler.GetTaskStatus)
+	tasks := api.Group("/tasks")
+	{
+		tasks.GET("", read, serverHandler.ListTasks)
+		tasks.GET("/status", read, serverHandler.GetTaskStatus)
+		tasks.GET("/:id", read, serverHandler.GetTask)
+		tasks.POST("/:id/cancel", writeKeys, serverHandler.CancelTask)
+	}
 
 	// 仪表板和日志
-	dashboard := api.Group("/dashboard")
+	dashboard := api.Group("/dashboard", read)
 	{
 		dashboard.GET("/stats", serverHandler.Stats)
 		dashboard.GET("/chart", serverHandler.Chart)
@@ -144,15 +225,58 @@ func registerProtectedAPIRoutes(api *gin.RouterGroup, serverHandler *handler.Ser
 	// 日志
 	logs := api.Group("/logs")
 	{
-		logs.GET("", serverHandler.GetLogs)
-		logs.GET("/export", serverHandler.ExportLogs)
+		logs.GET("", read, serverHandler.GetLogs)
+		logs.GET("/export", revealKeys, serverHandler.ExportLogs)
+		logs.GET("/requests/:request_id", read, serverHandler.GetRequestTimeline)
 	}
 
+	// 审计日志
+	api.GET("/audit-logs", readAudit, serverHandler.GetAuditLogs)
+
 	// 设置
 	settings := api.Group("/settings")
 	{
-		settings.GET("", serverHandler.GetSettings)
-		settings.PUT("", serverHandler.UpdateSettings)
+		settings.GET("", read, serverHandler.GetSettings)
+		settings.PUT("", manageSettings, serverHandler.UpdateSettings)
+	}
+
+	// 配置导入导出
+	configDocs := api.Group("/config", manageSettings, manageGroups)
+	{
+		configDocs.GET("/export", serverHandler.ExportConfigDocument)
+		configDocs.POST("/apply", serverHandler.ApplyConfigDocument)
+	}
+
+	// 备份与恢复，备份包含明文 Key 和管理员账号
+	backup := api.Group("/backup", manageSettings, manageUsers, revealKeys)
+	{
+		backup.GET("/export", serverHandler.ExportBackup)
+		backup.POST("/restore", serverHandler.RestoreBackup)
+	}
+
+	// 告警
+	alerts := api.Group("/alerts", manageSettings)
+	{
+		alerts.GET("/channels", serverHandler.ListAlertChannels)
+		alerts.POST("/channels", serverHandler.CreateAlertChannel)
+		alerts.PUT("/channels/:id", serverHandler.UpdateAlertChannel)
+		alerts.DELETE("/channels/:id", serverHandler.DeleteAlertChannel)
+		alerts.POST("/channels/:id/test", serverHandler.TestAlertChannel)
+		alerts.GET("/silences", serverHandler.ListAlertSilences)
+		alerts.POST("/silences", serverHandler.CreateAlertSilence)
+		alerts.DELETE("/silences/:id", serverHandler.DeleteAlertSilence)
+	}
+
+	// 管理员账号
+	users := api.Group("/users", manageUsers)
+	{
+		users.GET("", serverHandler.ListAdminUsers)
+		users.POST("", serverHandler.CreateAdminUser)
+		users.PUT("/:id", serverHandler.UpdateAdminUser)
+		users.DELETE("/:id", serverHandler.DeleteAdminUser)
+		users.GET("/:id/tokens", serverHandler.ListAdminUserTokens)
+		users.POST("/:id/tokens", serverHandler.CreateAdminUserToken)
+		users.DELETE("/:id/tokens/:token_id", serverHandler.DeleteAdminUserToken)
 	}
 }
 
@@ -161,10 +285,11 @@ func registerProxyRoutes(
 	router *gin.Engine,
 	proxyServer *proxy.ProxyServer,
 	groupManager *services.GroupManager,
+	authLimiter *services.AuthLimiter,
 ) {
 	proxyGroup := router.Group("/proxy")
 
-	proxyGroup.Use(middleware.ProxyAuth(groupManager))
+	proxyGroup.Use(middleware.ProxyAuth(groupManager, authLimiter))
 
 	proxyGroup.Any("/:group_name/*path", proxyServer.HandleProxy)
 }
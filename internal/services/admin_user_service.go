@@ -0,0 +1,434 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"gpt-load/internal/auth"
+	"gpt-load/internal/models"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const (
+	adminTokenPrefix       = "glt_"
+	minPasswordLength      = 8
+	tokenLastUsedThrottle  = time.Minute
+	maxAdminUsernameLength = 64
+)
+
+var (
+	// ErrInvalidAdminUser is returned when an admin user payload fails validation.
+	ErrInvalidAdminUser = errors.New("invalid admin user")
+	// ErrInvalidCredentials is returned when a login or token cannot be authenticated.
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// dummyPasswordHash is compared against when a login names an unknown user.
+var dummyPasswordHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("gpt-load-dummy-password"), bcrypt.DefaultCost)
+	return hash
+})
+
+// AdminUserInput holds the fields to create or update an admin user. Nil fields are left unchanged on update.
+type AdminUserInput struct {
+	Username *string `json:"username"`
+	Password *string `json:"password"`
+	Role     *string `json:"role"`
+	Enabled  *bool   `json:"enabled"`
+	GroupIDs *[]uint `json:"group_ids"`
+}
+
+// AdminUserInfo is an admin user with the groups assigned to it.
+type AdminUserInfo struct {
+	models.AdminUser
+	GroupIDs []uint `json:"group_ids"`
+}
+
+// CreatedAdminToken is a newly created token. The plaintext token is only returned once.
+type CreatedAdminToken struct {
+	models.AdminToken
+	Token string `json:"token"`
+}
+
+// AdminUserService manages admin users and their API tokens.
+type AdminUserService struct {
+	DB *gorm.DB
+}
+
+// NewAdminUserService creates a new AdminUserService.
+func NewAdminUserService(db *gorm.DB) *AdminUserService {
+	return &AdminUserService{DB: db}
+}
+
+// ListUsers returns all admin users.
+func (s *AdminUserService) ListUsers() ([]AdminUserInfo, error) {
+	var users []models.AdminUser
+	if err := s.DB.Preload("Groups").Order("id asc").Find(&users).Error; err != nil {
+		return nil, err
+	}
+
+	result := make([]AdminUserInfo, 0, len(users))
+	for _, user := range users {
+		result = append(result, newAdminUserInfo(user))
+	}
+	return result, nil
+}
+
+// CreateUser creates a new admin user.
+func (s *AdminUserService) CreateUser(input AdminUserInput) (*AdminUserInfo, error) {
+	if input.Username == nil || input.Password == nil || input.Role == nil {
+		return nil, fmt.Errorf("%w: username, password and role are required", ErrInvalidAdminUser)
+	}
+
+	user := models.AdminUser{Enabled: true}
+	if input.Enabled != nil {
+		user.Enabled = *input.Enabled
+	}
+	if err := applyAdminUserInput(&user, input); err != nil {
+		return nil, err
+	}
+
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		return replaceUserGroups(tx, &user, input.GroupIDs)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetUser(user.ID)
+}
+
+// GetUser returns an admin user by ID.
+func (s *AdminUserService) GetUser(id uint) (*AdminUserInfo, error) {
+	var user models.AdminUser
+	if err := s.DB.Preload("Groups").First(&user, id).Error; err != nil {
+		return nil, err
+	}
+	info := newAdminUserInfo(user)
+	return &info, nil
+}
+
+// UpdateUser updates an admin user. Disabling a user or changing its password revokes its tokens.
+func (s *AdminUserService) UpdateUser(id uint, input AdminUserInput) (*AdminUserInfo, error) {
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		var user models.AdminUser
+		if err := tx.First(&user, id).Error; err != nil {
+			return err
+		}
+
+		if err := applyAdminUserInput(&user, input); err != nil {
+			return err
+		}
+		revokeTokens := input.Password != nil
+		if input.Enabled != nil {
+			user.Enabled = *input.Enabled
+			revokeTokens = revokeTokens || !user.Enabled
+		}
+
+		if err := tx.Save(&user).Error; err != nil {
+			return err
+		}
+		if input.GroupIDs != nil || input.Role != nil {
+			if err := replaceUserGroups(tx, &user, input.GroupIDs); err != nil {
+				return err
+			}
+		}
+		if revokeTokens {
+			return tx.Where("user_id = ?", user.ID).Delete(&models.AdminToken{}).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetUser(id)
+}
+
+// DeleteUser deletes an admin user with its tokens and group assignments.
+func (s *AdminUserService) DeleteUser(id uint) error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Delete(&models.AdminUser{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if err := tx.Where("user_id = ?", id).Delete(&models.AdminToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", id).Delete(&models.AdminUserGroup{}).Error
+	})
+}
+
+// Login checks a username and password and returns the user.
+func (s *AdminUserService) Login(username, password string) (*AdminUserInfo, error) {
+	var user models.AdminUser
+	if err := s.DB.Where("username = ?", strings.TrimSpace(username)).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// Compare against a dummy hash to keep the response time independent of the username.
+			_ = bcrypt.CompareHashAndPassword(dummyPasswordHash(), []byte(password))
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+	if !user.Enabled || bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	now := time.Now()
+	if err := s.DB.Model(&user).UpdateColumn("last_login_at", now).Error; err != nil {
+		logrus.WithError(err).Warnf("Failed to update last login time for admin user %s", user.Username)
+	}
+
+	return s.GetUser(user.ID)
+}
+
+// ExternalUser is a user authenticated by the identity provider.
+type ExternalUser struct {
+	Subject  string
+	Username string
+	Role     string
+	GroupIDs []uint
+}
+
+// LoginExternalUser provisions or updates the account of a single sign-on user and returns it.
+// Role and group assignments follow the identity provider on every login, while a locally disabled account stays disabled.
+func (s *AdminUserService) LoginExternalUser(external ExternalUser) (*AdminUserInfo, error) {
+	var userID uint
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		var user models.AdminUser
+		err := tx.Where("oidc_subject = ?", external.Subject).First(&user).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		isNew := errors.Is(err, gorm.ErrRecordNotFound)
+		if !isNew && !user.Enabled {
+			return ErrInvalidCredentials
+		}
+
+		var conflicts int64
+		if err := tx.Model(&models.AdminUser{}).
+			Where("username = ? AND (oidc_subject IS NULL OR oidc_subject <> ?)", external.Username, external.Subject).
+			Count(&conflicts).Error; err != nil {
+			return err
+		}
+		if conflicts > 0 {
+			return fmt.Errorf("%w: username '%s' is already used by another account", ErrInvalidAdminUser, external.Username)
+		}
+
+		now := time.Now()
+		user.Username = external.Username
+		user.Role = external.Role
+		user.LastLoginAt = &now
+		if isNew {
+			subject := external.Subject
+			user.OIDCSubject = &subject
+			user.Enabled = true
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+		} else if err := tx.Save(&user).Error; err != nil {
+			return err
+		}
+
+		userID = user.ID
+		return replaceUserGroups(tx, &user, &external.GroupIDs)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetUser(userID)
+}
+
+// CreateToken issues a new API token for a user.
+func (s *AdminUserService) CreateToken(userID uint, name string, expiresAt *time.Time) (*CreatedAdminToken, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("%w: token name is required", ErrInvalidAdminUser)
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return nil, fmt.Errorf("%w: token expiry must be in the future", ErrInvalidAdminUser)
+	}
+
+	randomBytes := make([]byte, 32)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return nil, fmt.Errorf("failed to generate token: %w", err)
+	}
+	plaintext := adminTokenPrefix + base64.RawURLEncoding.EncodeToString(randomBytes)
+
+	token := models.AdminToken{
+		UserID:      userID,
+		Name:        name,
+		TokenHash:   hashAdminToken(plaintext),
+		TokenPrefix: plaintext[:len(adminTokenPrefix)+6],
+		ExpiresAt:   expiresAt,
+	}
+	if err := s.DB.Create(&token).Error; err != nil {
+		return nil, err
+	}
+	return &CreatedAdminToken{AdminToken: token, Token: plaintext}, nil
+}
+
+// ListTokens returns the tokens of a user.
+func (s *AdminUserService) ListTokens(userID uint) ([]models.AdminToken, error) {
+	var tokens []models.AdminToken
+	err := s.DB.Where("user_id = ?", userID).Order("id desc").Find(&tokens).Error
+	return tokens, err
+}
+
+// DeleteToken revokes a token of a user.
+func (s *AdminUserService) DeleteToken(userID, tokenID uint) error {
+	result := s.DB.Where("id = ? AND user_id = ?", tokenID, userID).Delete(&models.AdminToken{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// IsAdminToken reports whether a credential looks like an admin token.
+func IsAdminToken(credential string) bool {
+	return strings.HasPrefix(credential, adminTokenPrefix)
+}
+
+// AuthenticateToken resolves an API token into the principal of its user.
+func (s *AdminUserService) AuthenticateToken(plaintext string) (*auth.Principal, error) {
+	var token models.AdminToken
+	if err := s.DB.Where("token_hash = ?", hashAdminToken(plaintext)).First(&token).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+	if token.ExpiresAt != nil && !token.ExpiresAt.After(time.Now()) {
+		return nil, ErrInvalidCredentials
+	}
+
+	principal, err := s.PrincipalForUser(token.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) > tokenLastUsedThrottle {
+		if err := s.DB.Model(&token).UpdateColumn("last_used_at", now).Error; err != nil {
+			logrus.WithError(err).Warn("Failed to update admin token last used time")
+		}
+	}
+	return principal, nil
+}
+
+// PrincipalForUser returns the principal of an enabled user.
+func (s *AdminUserService) PrincipalForUser(userID uint) (*auth.Principal, error) {
+	var user models.AdminUser
+	if err := s.DB.Preload("Groups").First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+	if !user.Enabled {
+		return nil, ErrInvalidCredentials
+	}
+
+	info := newAdminUserInfo(user)
+	return &auth.Principal{
+		UserID:   user.ID,
+		Username: user.Username,
+		Role:     user.Role,
+		GroupIDs: info.GroupIDs,
+	}, nil
+}
+
+// RemoveGroupAssignments removes a deleted group from all maintainers.
+func (s *AdminUserService) RemoveGroupAssignments(tx *gorm.DB, groupID uint) error {
+	return tx.Where("group_id = ?", groupID).Delete(&models.AdminUserGroup{}).Error
+}
+
+// applyAdminUserInput validates the input and applies it to the user.
+func applyAdminUserInput(user *models.AdminUser, input AdminUserInput) error {
+	if input.Username != nil {
+		username := strings.TrimSpace(*input.Username)
+		if username == "" || len(username) > maxAdminUsernameLength {
+			return fmt.Errorf("%w: username must be 1-%d characters", ErrInvalidAdminUser, maxAdminUsernameLength)
+		}
+		user.Username = username
+	}
+	if input.Password != nil {
+		if len(*input.Password) < minPasswordLength {
+			return fmt.Errorf("%w: password must be at least %d characters", ErrInvalidAdminUser, minPasswordLength)
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(*input.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return fmt.Errorf("failed to hash password: %w", err)
+		}
+		user.PasswordHash = string(hash)
+	}
+	if input.Role != nil {
+		if !auth.IsValidRole(*input.Role) {
+			return fmt.Errorf("%w: unknown role '%s'", ErrInvalidAdminUser, *input.Role)
+		}
+		user.Role = *input.Role
+	}
+	if user.Role != models.RoleMaintainer && input.GroupIDs != nil && len(*input.GroupIDs) > 0 {
+		return fmt.Errorf("%w: only maintainers can be assigned to groups", ErrInvalidAdminUser)
+	}
+	return nil
+}
+
+// replaceUserGroups replaces the groups assigned to a maintainer. Other roles have no group assignments.
+func replaceUserGroups(tx *gorm.DB, user *models.AdminUser, groupIDs *[]uint) error {
+	if user.Role == models.RoleMaintainer && groupIDs == nil {
+		return nil
+	}
+	if err := tx.Where("user_id = ?", user.ID).Delete(&models.AdminUserGroup{}).Error; err != nil {
+		return err
+	}
+	if user.Role != models.RoleMaintainer || len(*groupIDs) == 0 {
+		return nil
+	}
+
+	var count int64
+	if err := tx.Model(&models.Group{}).Where("id IN ?", *groupIDs).Count(&count).Error; err != nil {
+		return err
+	}
+	if int(count) != len(*groupIDs) {
+		return fmt.Errorf("%w: one or more groups do not exist", ErrInvalidAdminUser)
+	}
+
+	assignments := make([]models.AdminUserGroup, 0, len(*groupIDs))
+	for _, groupID := range *groupIDs {
+		assignments = append(assignments, models.AdminUserGroup{UserID: user.ID, GroupID: groupID})
+	}
+	return tx.Create(&assignments).Error
+}
+
+// newAdminUserInfo flattens the group assignments of a user.
+func newAdminUserInfo(user models.AdminUser) AdminUserInfo {
+	groupIDs := make([]uint, 0, len(user.Groups))
+	for _, g := range user.Groups {
+		groupIDs = append(groupIDs, g.GroupID)
+	}
+	return AdminUserInfo{AdminUser: user, GroupIDs: groupIDs}
+}
+
+// hashAdminToken returns the hash under which a token is stored.
+func hashAdminToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,299 @@
+package services
+
+import (
+	"encoding/json"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gpt-load/internal/auth"
+	"gpt-load/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// Audited actions
+const (
+	AuditGroupCreate        = "group.create"
+	AuditGroupUpdate        = "group.update"
+	AuditGroupDelete        = "group.delete"
+	AuditGroupCopy          = "group.copy"
+	AuditGroupRollback      = "group.rollback"
+	AuditGroupAvailability  = "group.availability"
+	AuditKeysAdd            = "keys.add"
+	AuditKeysDelete         = "keys.delete"
+	AuditKeysRestore        = "keys.restore"
+	AuditKeysRestoreAll     = "keys.restore_all"
+	AuditKeysClearInvalid   = "keys.clear_invalid"
+	AuditKeysClearAll       = "keys.clear_all"
+	AuditKeysUpdate         = "keys.update_metadata"
+	AuditKeysMove           = "keys.move"
+	AuditKeysCopy           = "keys.copy"
+	AuditKeyPoolCreate      = "key_pool.create"
+	AuditKeyPoolUpdate      = "key_pool.update"
+	AuditKeyPoolDelete      = "key_pool.delete"
+	AuditSettingsUpdate     = "settings.update"
+	AuditTaskImportKeys     = "task.import_keys"
+	AuditTaskDeleteKeys     = "task.delete_keys"
+	AuditTaskValidateKeys   = "task.validate_keys"
+	AuditTaskCancel         = "task.cancel"
+	AuditUserCreate         = "user.create"
+	AuditUserUpdate         = "user.update"
+	AuditUserDelete         = "user.delete"
+	AuditTokenCreate        = "token.create"
+	AuditTokenDelete        = "token.delete"
+	AuditAlertChannelCreate = "alert_channel.create"
+	AuditAlertChannelUpdate = "alert_channel.update"
+	AuditAlertChannelDelete = "alert_channel.delete"
+	AuditAlertSilenceCreate = "alert_silence.create"
+	AuditAlertSilenceDelete = "alert_silence.delete"
+	AuditConfigApply        = "config.apply"
+	AuditBackupExport       = "backup.export"
+	AuditBackupRestore      = "backup.restore"
+)
+
+// Audit target types
+const (
+	AuditTargetGroup        = "group"
+	AuditTargetKeyPool      = "key_pool"
+	AuditTargetSettings     = "settings"
+	AuditTargetUser         = "user"
+	AuditTargetToken        = "token"
+	AuditTargetAlertChannel = "alert_channel"
+	AuditTargetAlertSilence = "alert_silence"
+	AuditTargetConfig       = "config"
+	AuditTargetBackup       = "backup"
+)
+
+// AuditChange is the value of a field before and after a change.
+type AuditChange struct {
+	Before any `json:"before"`
+	After  any `json:"after"`
+}
+
+// AuditEntry describes a change to record in the audit log.
+// Before and After are snapshots of the target, compared field by field.
+type AuditEntry struct {
+	Action     string
+	TargetType string
+	TargetID   uint
+	TargetName string
+	Before     any
+	After      any
+	Details    map[string]any
+}
+
+// AuditService records and queries the audit log of administrative changes.
+type AuditService struct {
+	DB *gorm.DB
+}
+
+// NewAuditService creates a new AuditService.
+func NewAuditService(db *gorm.DB) *AuditService {
+	return &AuditService{DB: db}
+}
+
+// Record writes an audit entry for a change made by the caller of the request.
+// Failures are logged and never fail the audited operation.
+func (s *AuditService) Record(c *gin.Context, entry AuditEntry) {
+	principal := auth.GetPrincipal(c)
+	s.record(models.AuditLog{
+		ActorID:   principal.UserID,
+		Actor:     principal.Username,
+		ActorRole: principal.Role,
+		SourceIP:  c.ClientIP(),
+	}, entry)
+}
+
+// RecordSystem writes an audit entry for a change made outside of an HTTP request, such as a CLI command.
+func (s *AuditService) RecordSystem(actor string, entry AuditEntry) {
+	s.record(models.AuditLog{Actor: actor}, entry)
+}
+
+func (s *AuditService) record(log models.AuditLog, entry AuditEntry) {
+	log.Action = entry.Action
+	log.TargetType = entry.TargetType
+	log.TargetID = entry.TargetID
+	log.TargetName = entry.TargetName
+
+	changes, err := DiffSnapshots(entry.Before, entry.After)
+	if err != nil {
+		logrus.WithError(err).Errorf("Failed to compute audit changes for %s", entry.Action)
+	}
+	if len(changes) > 0 {
+		log.Changes, _ = json.Marshal(changes)
+	}
+	if len(entry.Details) > 0 {
+		log.Details, _ = json.Marshal(entry.Details)
+	}
+
+	if err := s.DB.Create(&log).Error; err != nil {
+		logrus.WithError(err).Errorf("Failed to record audit log for %s", entry.Action)
+	}
+}
+
+// GetAuditLogsQuery returns a query for the audit log with the filters of the request applied.
+func (s *AuditService) GetAuditLogsQuery(c *gin.Context) *gorm.DB {
+	db := s.DB.Model(&models.AuditLog{})
+	if actor := c.Query("actor"); actor != "" {
+		db = db.Where("actor = ?", actor)
+	}
+	if actorID := c.Query("actor_id"); actorID != "" {
+		if id, err := strconv.Atoi(actorID); err == nil {
+			db = db.Where("actor_id = ?", id)
+		}
+	}
+	if action := c.Query("action"); action != "" {
+		db = db.Where("action LIKE ?", action+"%")
+	}
+	if targetType := c.Query("target_type"); targetType != "" {
+		db = db.Where("target_type = ?", targetType)
+	}
+	if targetID := c.Query("target_id"); targetID != "" {
+		if id, err := strconv.Atoi(targetID); err == nil {
+			db = db.Where("target_id = ?", id)
+		}
+	}
+	if targetName := c.Query("target_name"); targetName != "" {
+		db = db.Where("target_name LIKE ?", "%"+targetName+"%")
+	}
+	if sourceIP := c.Query("source_ip"); sourceIP != "" {
+		db = db.Where("source_ip = ?", sourceIP)
+	}
+	if startTimeStr := c.Query("start_time"); startTimeStr != "" {
+		if startTime, err := time.Parse(time.RFC3339, startTimeStr); err == nil {
+			db = db.Where("created_at >= ?", startTime)
+		}
+	}
+	if endTimeStr := c.Query("end_time"); endTimeStr != "" {
+		if endTime, err := time.Parse(time.RFC3339, endTimeStr); err == nil {
+			db = db.Where("created_at <= ?", endTime)
+		}
+	}
+	return db
+}
+
+// GroupAuditSnapshot returns the audited fields of a group. Proxy keys are masked.
+func GroupAuditSnapshot(group *models.Group) map[string]any {
+	var headerRules []models.HeaderRule
+	if len(group.HeaderRules) > 0 {
+		if err := json.Unmarshal(group.HeaderRules, &headerRules); err != nil {
+			logrus.WithError(err).Error("Failed to unmarshal header rules")
+			headerRules = make([]models.HeaderRule, 0)
+		}
+	}
+
+	var validationConfig *models.ValidationConfig
+	if len(group.ValidationConfig) > 0 {
+		if err := json.Unmarshal(group.ValidationConfig, &validationConfig); err != nil {
+			logrus.WithError(err).Error("Failed to unmarshal validation config")
+			validationConfig = nil
+		}
+	}
+
+	return map[string]any{
+		"name":                group.Name,
+		"display_name":        group.DisplayName,
+		"description":         group.Description,
+		"upstreams":           group.Upstreams,
+		"channel_type":        group.ChannelType,
+		"sort":                group.Sort,
+		"test_model":          group.TestModel,
+		"validation_endpoint": group.ValidationEndpoint,
+		"validation_config":   validationConfig,
+		"probe_config":        ParseProbeConfig(group.ProbeConfig),
+		"param_overrides":     group.ParamOverrides,
+		"config":              group.Config,
+		"header_rules":        headerRules,
+		"proxy_keys":          MaskProxyKeys(group.ProxyKeys),
+		"key_pool_id":         group.KeyPoolID,
+	}
+}
+
+// GroupAvailabilitySnapshot returns the availability of a group for the audit log.
+func GroupAvailabilitySnapshot(group *models.Group) map[string]any {
+	return map[string]any{
+		"enabled":            group.Enabled,
+		"maintenance_config": ParseMaintenanceConfig(group.MaintenanceConfig),
+	}
+}
+
+// MaskProxyKeys masks each key of a comma separated proxy key list.
+func MaskProxyKeys(proxyKeys string) string {
+	if proxyKeys == "" {
+		return ""
+	}
+	keys := strings.Split(proxyKeys, ",")
+	for i, key := range keys {
+		keys[i] = auth.MaskKey(strings.TrimSpace(key))
+	}
+	return strings.Join(keys, ",")
+}
+
+// KeyMetadataAuditDetails returns a bulk metadata update for the audit log. The password in the proxy URL
+// and the values of header rules are masked, they usually carry credentials.
+func KeyMetadataAuditDetails(update KeyMetadataUpdate) KeyMetadataUpdate {
+	if update.ProxyURL != nil {
+		proxyURL := *update.ProxyURL
+		if parsed, err := url.Parse(proxyURL); err == nil {
+			proxyURL = parsed.Redacted()
+		} else {
+			proxyURL = auth.MaskKey(proxyURL)
+		}
+		update.ProxyURL = &proxyURL
+	}
+	if update.HeaderRules != nil {
+		rules := make([]models.HeaderRule, len(*update.HeaderRules))
+		for i, rule := range *update.HeaderRules {
+			rule.Value = auth.MaskKey(rule.Value)
+			rules[i] = rule
+		}
+		update.HeaderRules = &rules
+	}
+	return update
+}
+
+// DiffSnapshots compares the JSON fields of two snapshots. A nil snapshot has no fields,
+// so creations and deletions list every field.
+func DiffSnapshots(before, after any) (map[string]AuditChange, error) {
+	beforeFields, err := snapshotFields(before)
+	if err != nil {
+		return nil, err
+	}
+	afterFields, err := snapshotFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make(map[string]AuditChange)
+	for name, value := range beforeFields {
+		if afterValue, ok := afterFields[name]; !ok || !reflect.DeepEqual(value, afterValue) {
+			changes[name] = AuditChange{Before: value, After: afterFields[name]}
+		}
+	}
+	for name, value := range afterFields {
+		if _, ok := beforeFields[name]; !ok {
+			changes[name] = AuditChange{After: value}
+		}
+	}
+	return changes, nil
+}
+
+func snapshotFields(snapshot any) (map[string]any, error) {
+	if snapshot == nil || reflect.ValueOf(snapshot).Kind() == reflect.Ptr && reflect.ValueOf(snapshot).IsNil() {
+		return nil, nil
+	}
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
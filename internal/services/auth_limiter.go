@@ -0,0 +1,150 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"gpt-load/internal/store"
+	"gpt-load/internal/types"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	authFailurePrefix = "auth_failures:"
+	maxLockout        = time.Hour
+	// maxRecordRetries bounds the attempts to save a failure while other requests update the same record.
+	maxRecordRetries = 100
+)
+
+// authFailureRecord tracks the failed authentication attempts of a client IP.
+type authFailureRecord struct {
+	Count       int   `json:"count"`
+	LockedUntil int64 `json:"locked_until"`
+}
+
+// AuthLimiter locks out client IPs after repeated authentication failures.
+// Records live in the store so that lockouts are shared across cluster nodes.
+type AuthLimiter struct {
+	store      store.Store
+	authConfig types.AuthConfig
+}
+
+// NewAuthLimiter creates a new AuthLimiter.
+func NewAuthLimiter(store store.Store, configManager types.ConfigManager) *AuthLimiter {
+	return &AuthLimiter{
+		store:      store,
+		authConfig: configManager.GetAuthConfig(),
+	}
+}
+
+// LockedFor returns how long the IP is still locked out, or zero if it is not.
+func (l *AuthLimiter) LockedFor(ip string) time.Duration {
+	if l.authConfig.MaxFailedAttempts == 0 {
+		return 0
+	}
+
+	record, err := l.getRecord(ip)
+	if err != nil || record == nil {
+		return 0
+	}
+
+	remaining := time.Until(time.Unix(record.LockedUntil, 0))
+	if remaining <= 0 {
+		return 0
+	}
+	return remaining
+}
+
+// RecordFailure counts a failed attempt. Once the threshold is reached every further failure
+// doubles the lockout, up to one hour.
+func (l *AuthLimiter) RecordFailure(ip string) {
+	if l.authConfig.MaxFailedAttempts == 0 {
+		return
+	}
+
+	// 并发的失败请求通过比较并设置逐个计数，避免同时读到相同的次数而漏计
+	key := authFailurePrefix + ip
+	for range maxRecordRetries {
+		current, err := l.store.Get(key)
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			logrus.WithError(err).Warn("Failed to read auth failure record")
+			return
+		}
+
+		record := &authFailureRecord{}
+		if current != nil {
+			if err := json.Unmarshal(current, record); err != nil {
+				logrus.WithError(err).Warn("Failed to parse auth failure record")
+				return
+			}
+		}
+		data, ttl, err := l.nextRecord(ip, record)
+		if err != nil {
+			return
+		}
+
+		var saved bool
+		if current == nil {
+			saved, err = l.store.SetNX(key, data, ttl)
+		} else {
+			saved, err = l.store.CompareAndSet(key, current, data, ttl)
+		}
+		if err != nil {
+			logrus.WithError(err).Warn("Failed to save auth failure record")
+			return
+		}
+		if saved {
+			return
+		}
+	}
+	logrus.Warnf("Failed to record an authentication failure of client %s after %d concurrent updates", ip, maxRecordRetries)
+}
+
+// nextRecord counts one more failure in the record and returns it with the TTL to store it with.
+func (l *AuthLimiter) nextRecord(ip string, record *authFailureRecord) ([]byte, time.Duration, error) {
+	record.Count++
+
+	window := time.Duration(l.authConfig.FailureWindowMinutes) * time.Minute
+	ttl := window
+	if excess := record.Count - l.authConfig.MaxFailedAttempts; excess >= 0 {
+		lockout := time.Duration(l.authConfig.LockoutBaseSeconds) * time.Second
+		for i := 0; i < excess && lockout < maxLockout; i++ {
+			lockout *= 2
+		}
+		lockout = min(lockout, maxLockout)
+		record.LockedUntil = time.Now().Add(lockout).Unix()
+		ttl = max(ttl, lockout)
+		logrus.Warnf("Client %s locked out for %v after %d failed authentication attempts", ip, lockout, record.Count)
+	}
+
+	data, err := json.Marshal(record)
+	return data, ttl, err
+}
+
+// Reset clears the failures of an IP after a successful login.
+func (l *AuthLimiter) Reset(ip string) {
+	if l.authConfig.MaxFailedAttempts == 0 {
+		return
+	}
+	if err := l.store.Delete(authFailurePrefix + ip); err != nil {
+		logrus.WithError(err).Warn("Failed to reset auth failure record")
+	}
+}
+
+func (l *AuthLimiter) getRecord(ip string) (*authFailureRecord, error) {
+	data, err := l.store.Get(authFailurePrefix + ip)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var record authFailureRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
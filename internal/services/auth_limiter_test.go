@@ -0,0 +1,93 @@
+package services
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"gpt-load/internal/store"
+	"gpt-load/internal/types"
+)
+
+// slowReadStore delays the result of reads so that concurrent requests read the record before any of them saves it.
+type slowReadStore struct {
+	store.Store
+}
+
+func (s slowReadStore) Get(key string) ([]byte, error) {
+	value, err := s.Store.Get(key)
+	time.Sleep(time.Millisecond)
+	return value, err
+}
+
+func newTestAuthLimiter() *AuthLimiter {
+	return &AuthLimiter{
+		store: store.NewMemoryStore(),
+		authConfig: types.AuthConfig{
+			MaxFailedAttempts:    5,
+			LockoutBaseSeconds:   60,
+			FailureWindowMinutes: 15,
+		},
+	}
+}
+
+func TestAuthLimiterLocksOutAfterMaxFailures(t *testing.T) {
+	l := newTestAuthLimiter()
+	for range 4 {
+		l.RecordFailure("10.0.0.1")
+	}
+	if locked := l.LockedFor("10.0.0.1"); locked != 0 {
+		t.Fatalf("locked for %v before reaching the threshold", locked)
+	}
+
+	l.RecordFailure("10.0.0.1")
+	if l.LockedFor("10.0.0.1") == 0 {
+		t.Fatal("the IP should be locked out at the threshold")
+	}
+	if l.LockedFor("10.0.0.2") != 0 {
+		t.Error("other IPs should not be locked out")
+	}
+
+	l.Reset("10.0.0.1")
+	if l.LockedFor("10.0.0.1") != 0 {
+		t.Error("a reset should lift the lockout")
+	}
+}
+
+func TestAuthLimiterCountsConcurrentFailures(t *testing.T) {
+	l := newTestAuthLimiter()
+	l.store = slowReadStore{l.store}
+	const attempts = 50
+
+	var wg sync.WaitGroup
+	for range attempts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l.RecordFailure("10.0.0.1")
+		}()
+	}
+	wg.Wait()
+
+	record, err := l.getRecord("10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record == nil || record.Count != attempts {
+		t.Fatalf("record = %+v, want %d failures", record, attempts)
+	}
+	if l.LockedFor("10.0.0.1") == 0 {
+		t.Error("parallel failures should lock out the IP")
+	}
+}
+
+func TestAuthLimiterDisabled(t *testing.T) {
+	l := newTestAuthLimiter()
+	l.authConfig.MaxFailedAttempts = 0
+	for range 10 {
+		l.RecordFailure("10.0.0.1")
+	}
+	if l.LockedFor("10.0.0.1") != 0 {
+		t.Error("no IP should be locked out when the limiter is disabled")
+	}
+}
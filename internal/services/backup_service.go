@@ -0,0 +1,578 @@
+package services
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"time"
+
+	"gpt-load/internal/encryption"
+	"gpt-load/internal/models"
+	"gpt-load/internal/version"
+
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// Backup 文件格式
+const (
+	BackupFormat    = "gpt-load-backup"
+	BackupVersion   = 1
+	backupBatchSize = 500
+)
+
+// Backup 记录类型，文件的每一行是一条记录
+const (
+	backupRecordHeader = "header"
+	backupRecordRow    = "row"
+	backupRecordFooter = "footer"
+)
+
+// Consistency check statuses
+const (
+	BackupCheckOK      = "ok"
+	BackupCheckWarning = "warning"
+	BackupCheckFailed  = "failed"
+)
+
+// ErrBackupTargetNotEmpty is returned when restoring into a database that already has data without force.
+var ErrBackupTargetNotEmpty = errors.New("target database is not empty")
+
+// backupTable is a table included in backups.
+type backupTable struct {
+	model any  // Pointer to the model
+	logs  bool // Only included with IncludeLogs
+}
+
+// backupTables lists the tables of a backup in restore order, referenced tables first.
+// The data keys are not included: values are written in plaintext and re-encrypted by the target.
+var backupTables = []backupTable{
+	{model: &models.SystemSetting{}},
+	{model: &models.KeyPool{}},
+	{model: &models.Group{}},
+	{model: &models.GroupVersion{}},
+	{model: &models.APIKey{}},
+	{model: &models.GroupHourlyStat{}},
+	{model: &models.AdminUser{}},
+	{model: &models.AdminUserGroup{}},
+	{model: &models.AdminToken{}},
+	{model: &models.AlertChannel{}},
+	{model: &models.AlertSilence{}},
+	{model: &models.ProbeIncident{}, logs: true},
+	{model: &models.ProbeResult{}, logs: true},
+	{model: &models.KeyEvent{}, logs: true},
+	{model: &models.RequestLog{}, logs: true},
+	{model: &models.AuditLog{}, logs: true},
+	{model: &models.Task{}, logs: true},
+}
+
+// BackupOptions controls what an export includes.
+type BackupOptions struct {
+	IncludeLogs bool
+}
+
+// BackupHeader is the first record of a backup.
+type BackupHeader struct {
+	Format      string    `json:"format"`
+	Version     int       `json:"version"`
+	AppVersion  string    `json:"app_version"`
+	Source      string    `json:"source"` // Dialect of the exported database
+	CreatedAt   time.Time `json:"created_at"`
+	IncludeLogs bool      `json:"include_logs"`
+	Tables      []string  `json:"tables"`
+}
+
+// backupRecord is one line of a backup: the header, a table row, or the footer with the row counts.
+type backupRecord struct {
+	Type   string           `json:"type"`
+	Header *BackupHeader    `json:"header,omitempty"`
+	Table  string           `json:"table,omitempty"`
+	Row    json.RawMessage  `json:"row,omitempty"`
+	Counts map[string]int64 `json:"counts,omitempty"`
+}
+
+// BackupCheck is the result of a consistency check after a restore.
+type BackupCheck struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// BackupSummary describes an exported backup.
+type BackupSummary struct {
+	Header BackupHeader     `json:"header"`
+	Counts map[string]int64 `json:"counts"`
+}
+
+// RestoreOptions controls how a backup is restored.
+type RestoreOptions struct {
+	Force bool // Replace the data of a non-empty database
+}
+
+// RestoreResult describes a restored backup and the consistency checks run on the target.
+type RestoreResult struct {
+	BackupSummary
+	Checks []BackupCheck `json:"checks"`
+}
+
+// Passed reports whether no consistency check failed. Warnings do not fail a restore.
+func (r *RestoreResult) Passed() bool {
+	for _, check := range r.Checks {
+		if check.Status == BackupCheckFailed {
+			return false
+		}
+	}
+	return true
+}
+
+// BackupService exports and restores the database in a portable format that works between the supported databases.
+//
+// A backup is newline-delimited JSON, optionally gzip compressed: a header, one record per row keyed by
+// column name, and a footer with the row count of every table so truncated files are detected.
+// Encrypted columns are written in plaintext, so backups must be stored as securely as the keys themselves.
+type BackupService struct {
+	DB                *gorm.DB
+	EncryptionService *encryption.Service
+}
+
+// NewBackupService creates a new BackupService.
+func NewBackupService(db *gorm.DB, encryptionService *encryption.Service) *BackupService {
+	return &BackupService{
+		DB:                db,
+		EncryptionService: encryptionService,
+	}
+}
+
+// Export streams a backup of the database to w.
+func (s *BackupService) Export(w io.Writer, opts BackupOptions) (*BackupSummary, error) {
+	tables, err := s.parseTables(opts.IncludeLogs)
+	if err != nil {
+		return nil, err
+	}
+
+	header := BackupHeader{
+		Format:      BackupFormat,
+		Version:     BackupVersion,
+		AppVersion:  version.Version,
+		Source:      s.DB.Dialector.Name(),
+		CreatedAt:   time.Now(),
+		IncludeLogs: opts.IncludeLogs,
+	}
+	counts := make(map[string]int64, len(tables))
+	for _, table := range tables {
+		header.Tables = append(header.Tables, table.Table)
+		counts[table.Table] = 0
+	}
+
+	buf := bufio.NewWriter(w)
+	encoder := json.NewEncoder(buf)
+	if err := encoder.Encode(backupRecord{Type: backupRecordHeader, Header: &header}); err != nil {
+		return nil, err
+	}
+
+	err = s.snapshot(func(tx *gorm.DB) error {
+		for _, table := range tables {
+			err := s.exportTable(tx, table, func(row map[string]any) error {
+				data, err := json.Marshal(row)
+				if err != nil {
+					return fmt.Errorf("failed to encode row of %s: %w", table.Table, err)
+				}
+				counts[table.Table]++
+				return encoder.Encode(backupRecord{Type: backupRecordRow, Table: table.Table, Row: data})
+			})
+			if err != nil {
+				return fmt.Errorf("failed to export %s: %w", table.Table, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := encoder.Encode(backupRecord{Type: backupRecordFooter, Counts: counts}); err != nil {
+		return nil, err
+	}
+	if err := buf.Flush(); err != nil {
+		return nil, err
+	}
+	return &BackupSummary{Header: header, Counts: counts}, nil
+}
+
+// Restore reads a backup, plain or gzip compressed, and replaces the tables it contains.
+// The rows keep their IDs. Everything is written in a single transaction, and the row counts
+// and references are checked against the backup afterwards.
+func (s *BackupService) Restore(r io.Reader, opts RestoreOptions) (*RestoreResult, error) {
+	reader, err := openBackupReader(r)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(reader)
+
+	var record backupRecord
+	if err := decoder.Decode(&record); err != nil {
+		return nil, fmt.Errorf("failed to read backup header: %w", err)
+	}
+	header := record.Header
+	if record.Type != backupRecordHeader || header == nil || header.Format != BackupFormat {
+		return nil, fmt.Errorf("not a %s file", BackupFormat)
+	}
+	if header.Version > BackupVersion {
+		return nil, fmt.Errorf("backup version %d is newer than the supported version %d", header.Version, BackupVersion)
+	}
+
+	tables := make(map[string]*schema.Schema, len(header.Tables))
+	var ordered []*schema.Schema
+	all, err := s.parseTables(true)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range header.Tables {
+		for _, table := range all {
+			if table.Table == name {
+				tables[name] = table
+				ordered = append(ordered, table)
+			}
+		}
+		if tables[name] == nil {
+			return nil, fmt.Errorf("backup contains unsupported table '%s'", name)
+		}
+	}
+
+	if !opts.Force {
+		if err := s.ensureEmpty(ordered); err != nil {
+			return nil, err
+		}
+	}
+
+	counts := make(map[string]int64, len(ordered))
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		// 先删除子表，再删除被引用的表
+		for i := len(ordered) - 1; i >= 0; i-- {
+			if err := tx.Where("1 = 1").Delete(reflect.New(ordered[i].ModelType).Interface()).Error; err != nil {
+				return fmt.Errorf("failed to clear %s: %w", ordered[i].Table, err)
+			}
+		}
+
+		var current *schema.Schema
+		var batch reflect.Value // Pointer to a slice of the current model
+		flush := func() error {
+			if current == nil || batch.Elem().Len() == 0 {
+				return nil
+			}
+			// Select("*") 写入零值字段，避免被列的默认值覆盖
+			zeros := zeroDefaultRows(tx.Statement.Context, current, batch.Elem())
+			if err := tx.Select("*").Omit(clause.Associations).Create(batch.Interface()).Error; err != nil {
+				return fmt.Errorf("failed to restore %s: %w", current.Table, err)
+			}
+			for field, ids := range zeros {
+				err := tx.Table(current.Table).Where("? IN ?", clause.Column{Name: current.PrioritizedPrimaryField.DBName}, ids).
+					UpdateColumn(field.DBName, reflect.Zero(field.FieldType).Interface()).Error
+				if err != nil {
+					return fmt.Errorf("failed to restore %s: %w", current.Table, err)
+				}
+			}
+			counts[current.Table] += int64(batch.Elem().Len())
+			batch.Elem().SetLen(0)
+			return nil
+		}
+
+		for {
+			var record backupRecord
+			if err := decoder.Decode(&record); err != nil {
+				if errors.Is(err, io.EOF) {
+					return errors.New("backup is truncated, the footer is missing")
+				}
+				return fmt.Errorf("failed to read backup: %w", err)
+			}
+
+			switch record.Type {
+			case backupRecordRow:
+				table := tables[record.Table]
+				if table == nil {
+					return fmt.Errorf("row of table '%s' is not listed in the backup header", record.Table)
+				}
+				if table != current {
+					if err := flush(); err != nil {
+						return err
+					}
+					current = table
+					batch = reflect.New(reflect.SliceOf(table.ModelType))
+				}
+				row, err := s.decodeRow(table, record.Row)
+				if err != nil {
+					return fmt.Errorf("invalid row of %s: %w", table.Table, err)
+				}
+				batch.Elem().Set(reflect.Append(batch.Elem(), row))
+				if batch.Elem().Len() >= backupBatchSize {
+					if err := flush(); err != nil {
+						return err
+					}
+				}
+			case backupRecordFooter:
+				if err := flush(); err != nil {
+					return err
+				}
+				for _, table := range ordered {
+					if counts[table.Table] != record.Counts[table.Table] {
+						return fmt.Errorf("backup is incomplete: %s has %d rows, the footer expects %d",
+							table.Table, counts[table.Table], record.Counts[table.Table])
+					}
+				}
+				return nil
+			default:
+				return fmt.Errorf("unexpected backup record '%s'", record.Type)
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.resetSequences(ordered); err != nil {
+		return nil, err
+	}
+
+	return &RestoreResult{
+		BackupSummary: BackupSummary{Header: *header, Counts: counts},
+		Checks:        s.verify(ordered, counts),
+	}, nil
+}
+
+// parseTables returns the schemas of the tables to back up.
+func (s *BackupService) parseTables(includeLogs bool) ([]*schema.Schema, error) {
+	var tables []*schema.Schema
+	for _, table := range backupTables {
+		if table.logs && !includeLogs {
+			continue
+		}
+		stmt := &gorm.Statement{DB: s.DB}
+		if err := stmt.Parse(table.model); err != nil {
+			return nil, fmt.Errorf("failed to parse model schema: %w", err)
+		}
+		tables = append(tables, stmt.Schema)
+	}
+	return tables, nil
+}
+
+// snapshot runs the export in a read-only repeatable read transaction so all tables are read at the same point.
+// SQLite exports run outside of a transaction to avoid blocking writers for the whole export.
+func (s *BackupService) snapshot(fn func(tx *gorm.DB) error) error {
+	if s.DB.Dialector.Name() == "sqlite" {
+		return fn(s.DB)
+	}
+	return s.DB.Transaction(fn, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+}
+
+// exportTable calls fn with every row of the table as a map of column name to value.
+func (s *BackupService) exportTable(tx *gorm.DB, table *schema.Schema, fn func(row map[string]any) error) error {
+	each := func(rows reflect.Value) error {
+		for i := 0; i < rows.Len(); i++ {
+			if err := fn(encodeRow(table, rows.Index(i))); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	rows := reflect.New(reflect.SliceOf(table.ModelType))
+	query := tx.Model(reflect.New(table.ModelType).Interface())
+	if table.PrioritizedPrimaryField == nil {
+		// 复合主键的表（分组授权）数据量很小，一次读出
+		if err := query.Find(rows.Interface()).Error; err != nil {
+			return err
+		}
+		return each(rows.Elem())
+	}
+	return query.FindInBatches(rows.Interface(), backupBatchSize, func(_ *gorm.DB, _ int) error {
+		return each(rows.Elem())
+	}).Error
+}
+
+// encodeRow returns the column values of a row, including the fields hidden from the API.
+func encodeRow(table *schema.Schema, row reflect.Value) map[string]any {
+	values := make(map[string]any, len(table.DBNames))
+	for _, name := range table.DBNames {
+		value := row.FieldByIndex(table.FieldsByDBName[name].StructField.Index).Interface()
+		if raw, ok := value.(datatypes.JSON); ok && len(raw) == 0 {
+			value = nil
+		}
+		values[name] = value
+	}
+	return values
+}
+
+// decodeRow builds a model from the column values of a backup row.
+// Unknown columns are ignored and missing ones keep their zero value.
+func (s *BackupService) decodeRow(table *schema.Schema, data json.RawMessage) (reflect.Value, error) {
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(data, &values); err != nil {
+		return reflect.Value{}, err
+	}
+
+	row := reflect.New(table.ModelType)
+	for name, raw := range values {
+		field, ok := table.FieldsByDBName[name]
+		if !ok || string(raw) == "null" {
+			continue
+		}
+		target := row.Elem().FieldByIndex(field.StructField.Index).Addr().Interface()
+		if err := json.Unmarshal(raw, target); err != nil {
+			return reflect.Value{}, fmt.Errorf("column %s: %w", name, err)
+		}
+	}
+
+	// 目标库的加密密钥可能不同，重新计算 Key 的哈希
+	switch model := row.Interface().(type) {
+	case *models.APIKey:
+		model.KeyHash = s.EncryptionService.Hash(model.KeyValue)
+	case *models.RequestLog:
+		if model.KeyValue != "" {
+			model.KeyHash = s.EncryptionService.Hash(model.KeyValue)
+		}
+	}
+	return row.Elem(), nil
+}
+
+// zeroDefaultRows returns the primary keys of the rows with a zero value in a column whose default is not zero.
+// gorm inserts the default in place of a zero value even for selected columns, so a disabled group
+// would be restored as enabled.
+func zeroDefaultRows(ctx context.Context, table *schema.Schema, rows reflect.Value) map[*schema.Field][]any {
+	pk := table.PrioritizedPrimaryField
+	if pk == nil {
+		return nil
+	}
+	result := make(map[*schema.Field][]any)
+	for _, field := range table.Fields {
+		if field.DBName == "" || field.DefaultValueInterface == nil || reflect.ValueOf(field.DefaultValueInterface).IsZero() {
+			continue
+		}
+		for i := 0; i < rows.Len(); i++ {
+			if _, zero := field.ValueOf(ctx, rows.Index(i)); zero {
+				id, _ := pk.ValueOf(ctx, rows.Index(i))
+				result[field] = append(result[field], id)
+			}
+		}
+	}
+	return result
+}
+
+// ensureEmpty returns ErrBackupTargetNotEmpty if any of the tables has rows.
+// System settings are ignored because every started instance writes the defaults.
+func (s *BackupService) ensureEmpty(tables []*schema.Schema) error {
+	for _, table := range tables {
+		if table.Table == "system_settings" {
+			continue
+		}
+		var count int64
+		if err := s.DB.Table(table.Table).Count(&count).Error; err != nil {
+			return fmt.Errorf("failed to count %s: %w", table.Table, err)
+		}
+		if count > 0 {
+			return fmt.Errorf("%w: %s has %d rows", ErrBackupTargetNotEmpty, table.Table, count)
+		}
+	}
+	return nil
+}
+
+// resetSequences moves the PostgreSQL ID sequences past the restored IDs.
+// MySQL and SQLite advance their auto increment counters on insert.
+func (s *BackupService) resetSequences(tables []*schema.Schema) error {
+	if s.DB.Dialector.Name() != "postgres" {
+		return nil
+	}
+	for _, table := range tables {
+		field := table.PrioritizedPrimaryField
+		if field == nil || !field.AutoIncrement {
+			continue
+		}
+		err := s.DB.Exec("SELECT setval(pg_get_serial_sequence(?, ?), COALESCE((SELECT MAX(?) FROM ?), 0) + 1, false)",
+			table.Table, field.DBName, clause.Column{Name: field.DBName}, clause.Table{Name: table.Table}).Error
+		if err != nil {
+			return fmt.Errorf("failed to reset the ID sequence of %s: %w", table.Table, err)
+		}
+	}
+	return nil
+}
+
+// verify compares the restored tables with the row counts of the backup and looks for dangling references.
+// Dangling references are warnings: the source database may already contain them, such as the hourly
+// stats of deleted groups.
+func (s *BackupService) verify(tables []*schema.Schema, counts map[string]int64) []BackupCheck {
+	var checks []BackupCheck
+	restored := make(map[string]bool, len(tables))
+	for _, table := range tables {
+		restored[table.Table] = true
+
+		var count int64
+		check := BackupCheck{Name: "rows:" + table.Table, Status: BackupCheckOK}
+		if err := s.DB.Table(table.Table).Count(&count).Error; err != nil {
+			check.Status = BackupCheckFailed
+			check.Detail = err.Error()
+		} else if count != counts[table.Table] {
+			check.Status = BackupCheckFailed
+			check.Detail = fmt.Sprintf("expected %d rows, found %d", counts[table.Table], count)
+		}
+		checks = append(checks, check)
+	}
+
+	// optional 表示 0 为没有引用，例如密钥池中 Key 的 group_id
+	references := []struct {
+		table, column, parent string
+		optional              bool
+	}{
+		{"groups", "key_pool_id", "key_pools", true},
+		{"api_keys", "group_id", "groups", true},
+		{"api_keys", "pool_id", "key_pools", true},
+		{"group_hourly_stats", "group_id", "groups", false},
+		{"admin_user_groups", "user_id", "admin_users", false},
+		{"admin_user_groups", "group_id", "groups", false},
+		{"admin_tokens", "user_id", "admin_users", false},
+	}
+	for _, ref := range references {
+		if !restored[ref.table] || !restored[ref.parent] {
+			continue
+		}
+
+		var count int64
+		check := BackupCheck{Name: fmt.Sprintf("references:%s.%s", ref.table, ref.column), Status: BackupCheckOK}
+		query := s.DB.Table(ref.table).Where("? NOT IN (?)", clause.Column{Name: ref.column}, s.DB.Table(ref.parent).Select("id"))
+		if ref.optional {
+			query = query.Where("? <> 0", clause.Column{Name: ref.column})
+		}
+		err := query.Count(&count).Error
+		if err != nil {
+			check.Status = BackupCheckFailed
+			check.Detail = err.Error()
+		} else if count > 0 {
+			check.Status = BackupCheckWarning
+			check.Detail = fmt.Sprintf("%d rows reference a missing row of %s", count, ref.parent)
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+// openBackupReader detects gzip compressed backups.
+func openBackupReader(r io.Reader) (io.Reader, error) {
+	buf := bufio.NewReader(r)
+	magic, err := buf.Peek(2)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("backup is empty")
+		}
+		return nil, err
+	}
+	if magic[0] == 0x1f && magic[1] == 0x8b {
+		return gzip.NewReader(buf)
+	}
+	return buf, nil
+}
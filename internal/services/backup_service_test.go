@@ -0,0 +1,215 @@
+package services
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"gpt-load/internal/encryption"
+	"gpt-load/internal/models"
+
+	"gorm.io/datatypes"
+)
+
+// newTestBackupService returns a backup service on an empty sqlite database with all backed up tables.
+func newTestBackupService(t *testing.T) *BackupService {
+	t.Helper()
+	// 加密服务注册 encrypted 序列化器，需在建表前创建
+	encryptionService := encryption.NewService(testConfig{})
+	tables := make([]any, 0, len(backupTables))
+	for _, table := range backupTables {
+		tables = append(tables, table.model)
+	}
+	return NewBackupService(newTestDB(t, tables...), encryptionService)
+}
+
+// seedBackupSource creates a key pool, a group using it, a disabled group with its own key,
+// a maintainer assigned to the disabled group and a request log.
+func seedBackupSource(t *testing.T, s *BackupService) {
+	t.Helper()
+	pool := models.KeyPool{Name: "shared", ChannelType: "openai"}
+	if err := s.DB.Create(&pool).Error; err != nil {
+		t.Fatal(err)
+	}
+	groups := []models.Group{
+		{Name: "pooled", ChannelType: "openai", Upstreams: datatypes.JSON(`[]`), KeyPoolID: &pool.ID},
+		{Name: "own", ChannelType: "openai", Upstreams: datatypes.JSON(`[{"url":"https://api.openai.com","weight":1}]`)},
+	}
+	if err := s.DB.Create(&groups).Error; err != nil {
+		t.Fatal(err)
+	}
+	// enabled 列默认为 true，需在创建后关闭
+	if err := s.DB.Model(&groups[1]).Update("enabled", false).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	keys := []models.APIKey{
+		{KeyValue: "sk-pool", KeyHash: s.EncryptionService.Hash("sk-pool"), PoolID: pool.ID, Status: models.KeyStatusActive},
+		{KeyValue: "sk-own", KeyHash: s.EncryptionService.Hash("sk-own"), GroupID: groups[1].ID, Status: models.KeyStatusInvalid},
+	}
+	if err := s.DB.Create(&keys).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	user := models.AdminUser{Username: "maintainer", PasswordHash: "hash", Role: models.RoleMaintainer, Enabled: true}
+	if err := s.DB.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DB.Create(&models.AdminUserGroup{UserID: user.ID, GroupID: groups[1].ID}).Error; err != nil {
+		t.Fatal(err)
+	}
+	log := models.RequestLog{ID: "log-1", RequestID: "request-1", Timestamp: time.Now(), GroupID: groups[1].ID, KeyValue: "sk-own"}
+	if err := s.DB.Create(&log).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// exportBackup exports the database and returns the lines of the backup.
+func exportBackup(t *testing.T, s *BackupService, opts BackupOptions) []string {
+	t.Helper()
+	var buf bytes.Buffer
+	if _, err := s.Export(&buf, opts); err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+}
+
+func joinBackup(lines []string) *strings.Reader {
+	return strings.NewReader(strings.Join(lines, "\n") + "\n")
+}
+
+func TestBackupRoundTrip(t *testing.T) {
+	source := newTestBackupService(t)
+	seedBackupSource(t, source)
+	lines := exportBackup(t, source, BackupOptions{IncludeLogs: true})
+
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	if _, err := zw.Write([]byte(strings.Join(lines, "\n") + "\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, backup := range map[string]func() *bytes.Reader{
+		"plain": func() *bytes.Reader { return bytes.NewReader([]byte(strings.Join(lines, "\n") + "\n")) },
+		"gzip":  func() *bytes.Reader { return bytes.NewReader(compressed.Bytes()) },
+	} {
+		target := newTestBackupService(t)
+		result, err := target.Restore(backup(), RestoreOptions{})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !result.Passed() {
+			t.Errorf("%s: checks = %+v, want all passed", name, result.Checks)
+		}
+		for _, check := range result.Checks {
+			if check.Status != BackupCheckOK {
+				t.Errorf("%s: check %s = %s %s", name, check.Name, check.Status, check.Detail)
+			}
+		}
+		if result.Counts["groups"] != 2 || result.Counts["api_keys"] != 2 || result.Counts["request_logs"] != 1 {
+			t.Errorf("%s: counts = %v", name, result.Counts)
+		}
+
+		var groups []models.Group
+		if err := target.DB.Order("id").Find(&groups).Error; err != nil {
+			t.Fatal(err)
+		}
+		if len(groups) != 2 || groups[0].KeyPoolID == nil || groups[1].Enabled || string(groups[1].Upstreams) == "[]" {
+			t.Errorf("%s: restored groups = %+v, want the pool reference and the disabled group kept", name, groups)
+		}
+		var key models.APIKey
+		if err := target.DB.Where("group_id = ?", groups[1].ID).First(&key).Error; err != nil {
+			t.Fatal(err)
+		}
+		if key.KeyValue != "sk-own" || key.KeyHash != target.EncryptionService.Hash("sk-own") || key.Status != models.KeyStatusInvalid {
+			t.Errorf("%s: restored key = %+v", name, key)
+		}
+		var assigned int64
+		target.DB.Model(&models.AdminUserGroup{}).Where("group_id = ?", groups[1].ID).Count(&assigned)
+		if assigned != 1 {
+			t.Errorf("%s: %d group assignments restored, want 1", name, assigned)
+		}
+
+		// 恢复的行保留 ID，新建的行排在其后
+		group := models.Group{Name: "new", Upstreams: datatypes.JSON(`[]`)}
+		if err := target.DB.Create(&group).Error; err != nil {
+			t.Fatal(err)
+		}
+		if group.ID <= groups[1].ID {
+			t.Errorf("%s: new group ID = %d, want after the restored %d", name, group.ID, groups[1].ID)
+		}
+	}
+}
+
+func TestBackupRestoreRefusesNonEmptyTarget(t *testing.T) {
+	source := newTestBackupService(t)
+	seedBackupSource(t, source)
+	lines := exportBackup(t, source, BackupOptions{})
+
+	target := newTestBackupService(t)
+	if _, err := target.Restore(joinBackup(lines), RestoreOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := target.Restore(joinBackup(lines), RestoreOptions{}); !errors.Is(err, ErrBackupTargetNotEmpty) {
+		t.Fatalf("err = %v, want ErrBackupTargetNotEmpty", err)
+	}
+
+	// 强制恢复替换已有数据
+	result, err := target.Restore(joinBackup(lines), RestoreOptions{Force: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Passed() {
+		t.Errorf("checks = %+v, want all passed", result.Checks)
+	}
+	var count int64
+	target.DB.Model(&models.Group{}).Count(&count)
+	if count != 2 {
+		t.Errorf("%d groups after a forced restore, want 2", count)
+	}
+}
+
+func TestBackupRestoreRejectsIncompleteBackups(t *testing.T) {
+	source := newTestBackupService(t)
+	seedBackupSource(t, source)
+	lines := exportBackup(t, source, BackupOptions{})
+
+	var footer backupRecord
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &footer); err != nil || footer.Type != backupRecordFooter {
+		t.Fatalf("last line = %s, want the footer", lines[len(lines)-1])
+	}
+	footer.Counts["groups"]++
+	mismatched, err := json.Marshal(footer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		lines []string
+		want  string
+	}{
+		{"count mismatch", append(lines[:len(lines)-1:len(lines)-1], string(mismatched)), "groups has 2 rows, the footer expects 3"},
+		{"truncated", lines[:len(lines)-1], "the footer is missing"},
+	}
+	for _, tt := range tests {
+		target := newTestBackupService(t)
+		_, err := target.Restore(joinBackup(tt.lines), RestoreOptions{})
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.want)
+		}
+		// 恢复在同一事务中执行，失败时不留下部分数据
+		var count int64
+		target.DB.Model(&models.Group{}).Count(&count)
+		if count != 0 {
+			t.Errorf("%s: %d groups left after the failed restore, want none", tt.name, count)
+		}
+	}
+}
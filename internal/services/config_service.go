@@ -0,0 +1,773 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"strings"
+
+	"gpt-load/internal/config"
+	"gpt-load/internal/keypool"
+	"gpt-load/internal/models"
+	"gpt-load/internal/utils"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// ConfigDocumentVersion is the version of the config document format.
+const ConfigDocumentVersion = 1
+
+// Config change actions and kinds
+const (
+	ConfigActionCreate = "create"
+	ConfigActionUpdate = "update"
+	ConfigActionDelete = "delete"
+
+	ConfigKindSettings = "settings"
+	ConfigKindGroup    = "group"
+)
+
+// ConfigDocument is the declarative configuration of the system settings and groups.
+type ConfigDocument struct {
+	Version  int            `json:"version"`
+	Settings map[string]any `json:"settings,omitempty"`
+	Groups   []GroupSpec    `json:"groups"`
+}
+
+// GroupSpec is the declarative configuration of a group.
+// An omitted proxy_keys, enabled or maintenance_config keeps the value of an existing group, and keys
+// are only synchronized when the document is applied with keys included. Groups referencing a key pool
+// by its name in key_pool use the keys of the pool, so their keys are neither exported nor synchronized.
+type GroupSpec struct {
+	Name               string                    `json:"name"`
+	DisplayName        string                    `json:"display_name,omitempty"`
+	Description        string                    `json:"description,omitempty"`
+	ChannelType        string                    `json:"channel_type"`
+	Sort               int                       `json:"sort"`
+	TestModel          string                    `json:"test_model"`
+	Upstreams          []UpstreamDefinition      `json:"upstreams"`
+	ValidationEndpoint string                    `json:"validation_endpoint,omitempty"`
+	ValidationConfig   *models.ValidationConfig  `json:"validation_config,omitempty"`
+	ProbeConfig        *models.ProbeConfig       `json:"probe_config,omitempty"`
+	ParamOverrides     map[string]any            `json:"param_overrides,omitempty"`
+	Config             map[string]any            `json:"config,omitempty"`
+	HeaderRules        []models.HeaderRule       `json:"header_rules,omitempty"`
+	KeyPool            string                    `json:"key_pool,omitempty"`
+	Enabled            *bool                     `json:"enabled,omitempty"`
+	MaintenanceConfig  *models.MaintenanceConfig `json:"maintenance_config,omitempty"`
+	ProxyKeys          *string                   `json:"proxy_keys,omitempty"`
+	Keys               []string                  `json:"keys,omitempty"`
+}
+
+// ConfigApplyOptions controls how a config document is applied.
+type ConfigApplyOptions struct {
+	DryRun      bool
+	IncludeKeys bool // Synchronize the keys of the groups that list them
+	Prune       bool // Delete the groups, and keys, that are missing from the document
+	Actor       GroupVersionActor
+}
+
+// ConfigChange is a change that applying a config document makes.
+// Proxy keys are masked in the changed fields.
+type ConfigChange struct {
+	Action      string                 `json:"action"`
+	Kind        string                 `json:"kind"`
+	Name        string                 `json:"name"`
+	Fields      map[string]AuditChange `json:"fields,omitempty"`
+	KeysAdded   int                    `json:"keys_added,omitempty"`
+	KeysDeleted int                    `json:"keys_deleted,omitempty"`
+}
+
+// ConfigPlan is the list of changes that applying a config document makes.
+type ConfigPlan struct {
+	DryRun      bool           `json:"dry_run"`
+	IncludeKeys bool           `json:"include_keys"`
+	Prune       bool           `json:"prune"`
+	Changes     []ConfigChange `json:"changes"`
+
+	settings map[string]any
+	groups   []plannedGroup
+	deletes  []models.Group
+}
+
+// plannedGroup is the desired state of a group in a config plan.
+type plannedGroup struct {
+	group       models.Group
+	previous    *models.Group // Nil for created groups
+	create      bool
+	changed     bool
+	addKeys     []string
+	deleteKeys  []string
+	changeIndex int
+}
+
+// AuditEntry returns the audit entry of an applied plan.
+func (p *ConfigPlan) AuditEntry() AuditEntry {
+	return AuditEntry{
+		Action:     AuditConfigApply,
+		TargetType: AuditTargetConfig,
+		Details: map[string]any{
+			"include_keys": p.IncludeKeys,
+			"prune":        p.Prune,
+			"changes":      p.Changes,
+		},
+	}
+}
+
+// ErrInvalidConfigDocument is returned when a config document cannot be parsed or fails validation.
+var ErrInvalidConfigDocument = errors.New("invalid config document")
+
+// ConfigService exports the settings and groups as a config document, and plans and applies config documents.
+type ConfigService struct {
+	DB                  *gorm.DB
+	SettingsManager     *config.SystemSettingsManager
+	KeyService          *KeyService
+	GroupService        *GroupService
+	GroupVersionService *GroupVersionService
+	GroupManager        *GroupManager
+}
+
+// NewConfigService creates a new ConfigService.
+func NewConfigService(
+	db *gorm.DB,
+	settingsManager *config.SystemSettingsManager,
+	keyService *KeyService,
+	groupService *GroupService,
+	groupVersionService *GroupVersionService,
+	groupManager *GroupManager,
+) *ConfigService {
+	return &ConfigService{
+		DB:                  db,
+		SettingsManager:     settingsManager,
+		KeyService:          keyService,
+		GroupService:        groupService,
+		GroupVersionService: groupVersionService,
+		GroupManager:        groupManager,
+	}
+}
+
+// ParseConfigDocument parses a YAML or JSON config document.
+func ParseConfigDocument(data []byte) (*ConfigDocument, error) {
+	jsonData, err := utils.YAMLToJSON(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc ConfigDocument
+	decoder := json.NewDecoder(bytes.NewReader(jsonData))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidConfigDocument, err)
+	}
+	if doc.Version != ConfigDocumentVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d, expected %d", ErrInvalidConfigDocument, doc.Version, ConfigDocumentVersion)
+	}
+	return &doc, nil
+}
+
+// MarshalConfigDocument encodes a config document as "yaml" or "json".
+func MarshalConfigDocument(doc *ConfigDocument, format string) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case "json":
+		return buf.Bytes(), nil
+	case "yaml":
+		return utils.JSONToYAML(buf.Bytes())
+	default:
+		return nil, fmt.Errorf("unsupported format '%s', must be yaml or json", format)
+	}
+}
+
+// Export builds the config document of the current settings and groups.
+// Proxy keys and API keys are only exported when includeKeys is set.
+func (s *ConfigService) Export(includeKeys bool) (*ConfigDocument, error) {
+	settings, err := s.currentSettingsMap()
+	if err != nil {
+		return nil, err
+	}
+	if !includeKeys {
+		delete(settings, "proxy_keys")
+	}
+
+	var groups []models.Group
+	if err := s.DB.Order("sort asc, name asc").Find(&groups).Error; err != nil {
+		return nil, err
+	}
+
+	pools, err := s.loadKeyPools()
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &ConfigDocument{
+		Version:  ConfigDocumentVersion,
+		Settings: settings,
+		Groups:   make([]GroupSpec, 0, len(groups)),
+	}
+	for i := range groups {
+		spec, err := s.groupSpec(&groups[i], pools, includeKeys)
+		if err != nil {
+			return nil, err
+		}
+		doc.Groups = append(doc.Groups, *spec)
+	}
+	return doc, nil
+}
+
+// groupSpec returns the config document entry of a group.
+func (s *ConfigService) groupSpec(group *models.Group, pools *keyPoolIndex, includeKeys bool) (*GroupSpec, error) {
+	var upstreams []UpstreamDefinition
+	if err := json.Unmarshal(group.Upstreams, &upstreams); err != nil {
+		return nil, fmt.Errorf("invalid upstreams of group %s: %w", group.Name, err)
+	}
+
+	spec := &GroupSpec{
+		Name:               group.Name,
+		DisplayName:        group.DisplayName,
+		Description:        group.Description,
+		ChannelType:        group.ChannelType,
+		Sort:               group.Sort,
+		TestModel:          group.TestModel,
+		Upstreams:          upstreams,
+		ValidationEndpoint: group.ValidationEndpoint,
+		ValidationConfig:   parseValidationConfig(group.ValidationConfig),
+		ProbeConfig:        ParseProbeConfig(group.ProbeConfig),
+		ParamOverrides:     group.ParamOverrides,
+		Config:             group.Config,
+		HeaderRules:        parseHeaderRules(group.HeaderRules),
+		KeyPool:            pools.name(group.KeyPoolID),
+		Enabled:            &group.Enabled,
+		MaintenanceConfig:  ParseMaintenanceConfig(group.MaintenanceConfig),
+	}
+	if !includeKeys {
+		return spec, nil
+	}
+
+	proxyKeys := group.ProxyKeys
+	spec.ProxyKeys = &proxyKeys
+	if group.KeyOwner().IsPool() {
+		return spec, nil
+	}
+	var keys []models.APIKey
+	if err := s.DB.Select("id", "key_value").Scopes(group.KeyOwner().Scope).Order("id asc").Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		spec.Keys = append(spec.Keys, key.KeyValue)
+	}
+	return spec, nil
+}
+
+// currentSettingsMap returns the current system settings keyed by their JSON names.
+func (s *ConfigService) currentSettingsMap() (map[string]any, error) {
+	data, err := json.Marshal(s.SettingsManager.GetSettings())
+	if err != nil {
+		return nil, err
+	}
+	var settings map[string]any
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// Plan computes the changes that applying the config document makes, without applying them.
+func (s *ConfigService) Plan(doc *ConfigDocument, opts ConfigApplyOptions) (*ConfigPlan, error) {
+	plan := &ConfigPlan{
+		DryRun:      opts.DryRun,
+		IncludeKeys: opts.IncludeKeys,
+		Prune:       opts.Prune,
+		Changes:     []ConfigChange{},
+	}
+
+	if err := s.planSettings(plan, doc.Settings); err != nil {
+		return nil, err
+	}
+
+	pools, err := s.loadKeyPools()
+	if err != nil {
+		return nil, err
+	}
+
+	var existingGroups []models.Group
+	if err := s.DB.Order("sort asc, name asc").Find(&existingGroups).Error; err != nil {
+		return nil, err
+	}
+	existingByName := make(map[string]*models.Group, len(existingGroups))
+	for i := range existingGroups {
+		existingByName[existingGroups[i].Name] = &existingGroups[i]
+	}
+
+	seen := make(map[string]bool, len(doc.Groups))
+	for i := range doc.Groups {
+		spec := &doc.Groups[i]
+		name := strings.TrimSpace(spec.Name)
+		if seen[name] {
+			return nil, fmt.Errorf("%w: duplicate group '%s'", ErrInvalidConfigDocument, name)
+		}
+		seen[name] = true
+
+		if err := s.planGroup(plan, spec, existingByName[name], pools, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.Prune {
+		for _, group := range existingGroups {
+			if seen[group.Name] {
+				continue
+			}
+			var keyCount int64
+			if err := s.DB.Model(&models.APIKey{}).Scopes(models.KeyOwner{GroupID: group.ID}.Scope).Count(&keyCount).Error; err != nil {
+				return nil, err
+			}
+			plan.deletes = append(plan.deletes, group)
+			plan.Changes = append(plan.Changes, ConfigChange{
+				Action:      ConfigActionDelete,
+				Kind:        ConfigKindGroup,
+				Name:        group.Name,
+				KeysDeleted: int(keyCount),
+			})
+		}
+	}
+
+	return plan, nil
+}
+
+// planSettings adds the settings of the document that differ from the current ones to the plan.
+// Settings missing from the document are left unchanged.
+func (s *ConfigService) planSettings(plan *ConfigPlan, desired map[string]any) error {
+	if len(desired) == 0 {
+		return nil
+	}
+
+	if proxyKeys, ok := desired["proxy_keys"].(string); ok {
+		desired["proxy_keys"] = strings.Join(utils.SplitAndTrim(proxyKeys, ","), ",")
+	}
+	if err := s.SettingsManager.ValidateSettings(desired); err != nil {
+		return fmt.Errorf("%w: invalid settings: %v", ErrInvalidConfigDocument, err)
+	}
+
+	current, err := s.currentSettingsMap()
+	if err != nil {
+		return err
+	}
+
+	changed := make(map[string]any)
+	fields := make(map[string]AuditChange)
+	for key, value := range desired {
+		if reflect.DeepEqual(current[key], value) {
+			continue
+		}
+		changed[key] = value
+		change := AuditChange{Before: current[key], After: value}
+		if key == "proxy_keys" {
+			change = AuditChange{Before: MaskProxyKeys(fmt.Sprint(current[key])), After: MaskProxyKeys(fmt.Sprint(value))}
+		}
+		fields[key] = change
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+
+	plan.settings = changed
+	plan.Changes = append(plan.Changes, ConfigChange{
+		Action: ConfigActionUpdate,
+		Kind:   ConfigKindSettings,
+		Name:   "settings",
+		Fields: fields,
+	})
+	return nil
+}
+
+// planGroup adds the changes of a group of the document to the plan.
+func (s *ConfigService) planGroup(plan *ConfigPlan, spec *GroupSpec, existing *models.Group, pools *keyPoolIndex, opts ConfigApplyOptions) error {
+	pg := plannedGroup{create: existing == nil, previous: existing}
+	if existing != nil {
+		pg.group = *existing
+	} else {
+		pg.group.Enabled = true
+	}
+	if err := s.applyGroupSpec(&pg.group, spec, pools); err != nil {
+		return fmt.Errorf("%w: group '%s': %v", ErrInvalidConfigDocument, spec.Name, err)
+	}
+
+	change := ConfigChange{Action: ConfigActionCreate, Kind: ConfigKindGroup, Name: pg.group.Name}
+	if existing != nil {
+		change.Action = ConfigActionUpdate
+		fields, err := GroupChanges(existing, &pg.group)
+		if err != nil {
+			return err
+		}
+		// 启用状态和维护模式不属于配置版本，单独比较
+		availability, err := DiffSnapshots(GroupAvailabilitySnapshot(existing), GroupAvailabilitySnapshot(&pg.group))
+		if err != nil {
+			return err
+		}
+		maps.Copy(fields, availability)
+		// 文档按名称引用密钥池
+		if _, ok := fields["key_pool_id"]; ok {
+			delete(fields, "key_pool_id")
+			fields["key_pool"] = AuditChange{Before: pools.name(existing.KeyPoolID), After: pools.name(pg.group.KeyPoolID)}
+		}
+		change.Fields = fields
+		pg.changed = len(fields) > 0
+	}
+
+	// 引用密钥池的分组使用池中的 Key，不同步 keys
+	if opts.IncludeKeys && spec.Keys != nil && !pg.group.KeyOwner().IsPool() {
+		if err := s.planGroupKeys(&pg, existing, spec.Keys, opts.Prune); err != nil {
+			return err
+		}
+		change.KeysAdded = len(pg.addKeys)
+		change.KeysDeleted = len(pg.deleteKeys)
+	}
+
+	if !pg.create && !pg.changed && len(pg.addKeys) == 0 && len(pg.deleteKeys) == 0 {
+		return nil
+	}
+	pg.changeIndex = len(plan.Changes)
+	plan.Changes = append(plan.Changes, change)
+	plan.groups = append(plan.groups, pg)
+	return nil
+}
+
+// planGroupKeys compares the keys of the document with the keys of the group by their hashes.
+func (s *ConfigService) planGroupKeys(pg *plannedGroup, existing *models.Group, keys []string, prune bool) error {
+	desired := s.KeyService.ParseKeysFromText(strings.Join(keys, "\n"))
+	desiredHashes := make(map[string]bool, len(desired))
+	for _, key := range desired {
+		desiredHashes[s.KeyService.EncryptionService.Hash(key)] = true
+	}
+
+	existingHashes := make(map[string]bool)
+	if existing != nil {
+		var existingKeys []models.APIKey
+		if err := s.DB.Select("id", "key_value", "key_hash").Scopes(existing.KeyOwner().Scope).
+			Find(&existingKeys).Error; err != nil {
+			return err
+		}
+		for _, key := range existingKeys {
+			existingHashes[key.KeyHash] = true
+			if prune && !desiredHashes[key.KeyHash] {
+				pg.deleteKeys = append(pg.deleteKeys, key.KeyValue)
+			}
+		}
+	}
+
+	added := make(map[string]bool, len(desired))
+	for _, key := range desired {
+		hash := s.KeyService.EncryptionService.Hash(key)
+		if existingHashes[hash] || added[hash] {
+			continue
+		}
+		added[hash] = true
+		pg.addKeys = append(pg.addKeys, key)
+	}
+	return nil
+}
+
+// GroupChanges returns the fields of a group that differ between two states.
+// Null and empty values are treated as equal, and proxy keys are compared unmasked.
+func GroupChanges(before, after *models.Group) (map[string]AuditChange, error) {
+	changes, err := DiffSnapshots(GroupAuditSnapshot(before), GroupAuditSnapshot(after))
+	if err != nil {
+		return nil, err
+	}
+	for name, change := range changes {
+		if isEmptyConfigValue(change.Before) && isEmptyConfigValue(change.After) {
+			delete(changes, name)
+		}
+	}
+
+	delete(changes, "proxy_keys")
+	if before.ProxyKeys != after.ProxyKeys {
+		changes["proxy_keys"] = AuditChange{
+			Before: MaskProxyKeys(before.ProxyKeys),
+			After:  MaskProxyKeys(after.ProxyKeys),
+		}
+	}
+	return changes, nil
+}
+
+// isEmptyConfigValue reports whether a JSON snapshot value is null or empty.
+func isEmptyConfigValue(value any) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case []any:
+		return len(v) == 0
+	case map[string]any:
+		return len(v) == 0
+	}
+	return false
+}
+
+// applyGroupSpec validates a group spec and applies it to the group.
+func (s *ConfigService) applyGroupSpec(group *models.Group, spec *GroupSpec, pools *keyPoolIndex) error {
+	name := strings.TrimSpace(spec.Name)
+	if !IsValidGroupName(name) {
+		return fmt.Errorf("invalid group name, only lowercase letters, digits, hyphens and underscores are allowed, 3-30 characters")
+	}
+
+	channelType := strings.TrimSpace(spec.ChannelType)
+	if !IsValidChannelType(channelType) {
+		return fmt.Errorf("invalid channel type '%s'", channelType)
+	}
+
+	testModel := strings.TrimSpace(spec.TestModel)
+	if testModel == "" {
+		return fmt.Errorf("test model is required")
+	}
+
+	upstreamsJSON, err := json.Marshal(spec.Upstreams)
+	if err != nil {
+		return err
+	}
+	upstreams, err := ValidateAndCleanUpstreams(upstreamsJSON)
+	if err != nil {
+		return err
+	}
+
+	groupConfig, err := ValidateAndCleanGroupConfig(s.SettingsManager, spec.Config)
+	if err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+
+	validationEndpoint := strings.TrimSpace(spec.ValidationEndpoint)
+	if !IsValidValidationEndpoint(validationEndpoint) {
+		return fmt.Errorf("invalid validation endpoint, it must be a path starting with /")
+	}
+
+	validationConfig, err := ValidateAndCleanValidationConfig(spec.ValidationConfig, channelType, validationEndpoint)
+	if err != nil {
+		return fmt.Errorf("invalid validation config: %w", err)
+	}
+
+	probeConfig, err := ValidateAndCleanProbeConfig(spec.ProbeConfig)
+	if err != nil {
+		return fmt.Errorf("invalid probe config: %w", err)
+	}
+
+	headerRules, err := NormalizeHeaderRules(spec.HeaderRules)
+	if err != nil {
+		return err
+	}
+
+	var keyPoolID *uint
+	if poolName := strings.TrimSpace(spec.KeyPool); poolName != "" {
+		pool, ok := pools.byName[poolName]
+		if !ok {
+			return fmt.Errorf("key pool '%s' not found", poolName)
+		}
+		if pool.ChannelType != channelType {
+			return fmt.Errorf("key pool '%s' holds %s keys, but the group uses the %s channel", pool.Name, pool.ChannelType, channelType)
+		}
+		id := pool.ID
+		keyPoolID = &id
+	}
+
+	var maintenanceConfig datatypes.JSON
+	if spec.MaintenanceConfig != nil {
+		maintenanceConfig, err = ValidateAndCleanMaintenanceConfig(spec.MaintenanceConfig)
+		if err != nil {
+			return fmt.Errorf("invalid maintenance config: %w", err)
+		}
+	}
+
+	group.Name = name
+	group.DisplayName = strings.TrimSpace(spec.DisplayName)
+	group.Description = strings.TrimSpace(spec.Description)
+	group.ChannelType = channelType
+	group.Sort = spec.Sort
+	group.TestModel = testModel
+	group.Upstreams = upstreams
+	group.ValidationEndpoint = validationEndpoint
+	group.ValidationConfig = validationConfig
+	group.ProbeConfig = probeConfig
+	group.ParamOverrides = datatypes.JSONMap(spec.ParamOverrides)
+	group.Config = groupConfig
+	group.HeaderRules = headerRules
+	group.KeyPoolID = keyPoolID
+	if spec.Enabled != nil {
+		group.Enabled = *spec.Enabled
+	}
+	if spec.MaintenanceConfig != nil {
+		group.MaintenanceConfig = maintenanceConfig
+	}
+	if spec.ProxyKeys != nil {
+		group.ProxyKeys = strings.TrimSpace(*spec.ProxyKeys)
+	}
+	return nil
+}
+
+// Apply applies a config document and returns the applied changes.
+// The whole plan is validated first, then the settings, groups, pruned groups and keys are
+// written in one transaction, so that a failing change leaves the configuration unchanged.
+// The keys are updated in the store once the transaction commits.
+func (s *ConfigService) Apply(doc *ConfigDocument, opts ConfigApplyOptions) (*ConfigPlan, error) {
+	plan, err := s.Plan(doc, opts)
+	if err != nil || opts.DryRun || len(plan.Changes) == 0 {
+		return plan, err
+	}
+
+	// store 的更新在事务提交后再应用，事务回滚时 store 保持不变
+	changes := &keypool.StoreChanges{}
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		if len(plan.settings) > 0 {
+			if err := s.SettingsManager.UpdateSettingsInTx(tx, plan.settings); err != nil {
+				return err
+			}
+		}
+
+		for i := range plan.groups {
+			pg := &plan.groups[i]
+			switch {
+			case pg.create:
+				// enabled 列有默认值，创建时会忽略 false，创建后单独更新
+				enabled := pg.group.Enabled
+				if err := tx.Create(&pg.group).Error; err != nil {
+					return err
+				}
+				if !enabled {
+					if err := tx.Model(&pg.group).Update("enabled", false).Error; err != nil {
+						return err
+					}
+				}
+			case pg.changed:
+				if err := tx.Save(&pg.group).Error; err != nil {
+					return err
+				}
+			default:
+				continue
+			}
+			if _, err := s.GroupVersionService.Record(tx, &pg.group, GroupVersionEntry{
+				Action:   models.GroupVersionConfigApply,
+				Actor:    opts.Actor,
+				Previous: pg.previous,
+			}); err != nil {
+				return err
+			}
+			// 加入密钥池的分组，自己的 Key 并入池中
+			if _, err := s.GroupService.MoveKeysToPoolInTx(tx, &pg.group, changes); err != nil {
+				return fmt.Errorf("failed to move the keys of group '%s' into the key pool: %w", pg.group.Name, err)
+			}
+		}
+
+		for _, group := range plan.deletes {
+			if _, _, err := s.GroupService.DeleteInTx(tx, group.ID, changes); err != nil {
+				return fmt.Errorf("failed to delete group '%s': %w", group.Name, err)
+			}
+		}
+
+		for i := range plan.groups {
+			pg := &plan.groups[i]
+			change := &plan.Changes[pg.changeIndex]
+			if len(pg.addKeys) > 0 {
+				addedCount, err := s.KeyService.AddKeysInTx(tx, pg.group.KeyOwner(), pg.addKeys, changes)
+				if err != nil {
+					return fmt.Errorf("failed to add keys to group '%s': %w", pg.group.Name, err)
+				}
+				change.KeysAdded = addedCount
+			}
+			if len(pg.deleteKeys) > 0 {
+				deletedCount, err := s.KeyService.DeleteKeysInTx(tx, pg.group.KeyOwner(), pg.deleteKeys, changes)
+				if err != nil {
+					return fmt.Errorf("failed to delete keys from group '%s': %w", pg.group.Name, err)
+				}
+				change.KeysDeleted = int(deletedCount)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.KeyService.KeyProvider.ApplyStoreChanges(changes); err != nil {
+		logrus.WithError(err).Error("failed to update the store after applying the config")
+	}
+	if len(plan.settings) > 0 {
+		if err := s.SettingsManager.Reload(); err != nil {
+			logrus.WithError(err).Error("failed to reload system settings")
+		}
+	}
+	if err := s.GroupManager.Invalidate(); err != nil {
+		logrus.WithError(err).Error("failed to invalidate group cache")
+	}
+	return plan, nil
+}
+
+// keyPoolIndex looks up the key pools referenced by the groups of a config document.
+type keyPoolIndex struct {
+	byName map[string]*models.KeyPool
+	byID   map[uint]*models.KeyPool
+}
+
+// loadKeyPools loads all key pools.
+func (s *ConfigService) loadKeyPools() (*keyPoolIndex, error) {
+	var pools []models.KeyPool
+	if err := s.DB.Find(&pools).Error; err != nil {
+		return nil, err
+	}
+	index := &keyPoolIndex{
+		byName: make(map[string]*models.KeyPool, len(pools)),
+		byID:   make(map[uint]*models.KeyPool, len(pools)),
+	}
+	for i := range pools {
+		index.byName[pools[i].Name] = &pools[i]
+		index.byID[pools[i].ID] = &pools[i]
+	}
+	return index, nil
+}
+
+// name returns the name of a referenced key pool, empty when the group does not reference one.
+func (i *keyPoolIndex) name(id *uint) string {
+	if id == nil {
+		return ""
+	}
+	if pool, ok := i.byID[*id]; ok {
+		return pool.Name
+	}
+	return ""
+}
+
+// parseValidationConfig parses the validation config of a group, nil when it is not set.
+func parseValidationConfig(raw datatypes.JSON) *models.ValidationConfig {
+	if len(raw) == 0 {
+		return nil
+	}
+	var cfg models.ValidationConfig
+	if err := json.Unmarshal(raw, &cfg); err != nil {
+		logrus.WithError(err).Error("Failed to unmarshal validation config")
+		return nil
+	}
+	return &cfg
+}
+
+// parseHeaderRules parses the header rules of a group.
+func parseHeaderRules(raw datatypes.JSON) []models.HeaderRule {
+	var rules []models.HeaderRule
+	if len(raw) == 0 {
+		return rules
+	}
+	if err := json.Unmarshal(raw, &rules); err != nil {
+		logrus.WithError(err).Error("Failed to unmarshal header rules")
+		return make([]models.HeaderRule, 0)
+	}
+	return rules
+}
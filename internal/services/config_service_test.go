@@ -0,0 +1,156 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"gpt-load/internal/config"
+	"gpt-load/internal/models"
+
+	"gorm.io/datatypes"
+)
+
+func TestParseConfigDocument(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr bool
+	}{
+		{"yaml", "version: 1\ngroups:\n  - name: openai\n    channel_type: openai\n", false},
+		{"json", `{"version": 1, "groups": []}`, false},
+		{"unsupported version", "version: 2\ngroups: []\n", true},
+		{"unknown field", "version: 1\ngroups: []\nextra: true\n", true},
+		{"unknown group field", "version: 1\ngroups:\n  - name: openai\n    weight: 1\n", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseConfigDocument([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidConfigDocument) {
+				t.Errorf("err = %v, want ErrInvalidConfigDocument", err)
+			}
+		})
+	}
+}
+
+func TestMarshalConfigDocumentRoundTrip(t *testing.T) {
+	proxyKeys := "sk-proxy"
+	enabled := false
+	doc := &ConfigDocument{
+		Version: ConfigDocumentVersion,
+		Groups: []GroupSpec{{
+			Name:        "openai",
+			ChannelType: "openai",
+			Upstreams:   []UpstreamDefinition{{URL: "https://api.openai.com", Weight: 1}},
+			Enabled:     &enabled,
+			ProxyKeys:   &proxyKeys,
+			Keys:        []string{"sk-1", "sk-2"},
+		}},
+	}
+
+	for _, format := range []string{"yaml", "json"} {
+		data, err := MarshalConfigDocument(doc, format)
+		if err != nil {
+			t.Fatalf("%s: marshal: %v", format, err)
+		}
+		parsed, err := ParseConfigDocument(data)
+		if err != nil {
+			t.Fatalf("%s: parse: %v", format, err)
+		}
+		group := parsed.Groups[0]
+		if group.Name != "openai" || group.Enabled == nil || *group.Enabled || *group.ProxyKeys != proxyKeys || len(group.Keys) != 2 {
+			t.Errorf("%s: round trip changed the group: %+v", format, group)
+		}
+	}
+
+	if _, err := MarshalConfigDocument(doc, "toml"); err == nil {
+		t.Error("expected an unsupported format to be rejected")
+	}
+}
+
+func TestGroupChanges(t *testing.T) {
+	before := &models.Group{
+		Name:        "openai",
+		ChannelType: "openai",
+		TestModel:   "gpt-4o-mini",
+		Upstreams:   datatypes.JSON(`[{"url":"https://api.openai.com","weight":1}]`),
+		HeaderRules: datatypes.JSON(`[]`),
+		ProxyKeys:   "sk-proxy-one",
+	}
+
+	after := *before
+	after.HeaderRules = nil
+	after.ParamOverrides = datatypes.JSONMap{}
+	changes, err := GroupChanges(before, &after)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("empty and null values should be equal, got changes %v", changes)
+	}
+
+	after.TestModel = "gpt-4o"
+	after.ProxyKeys = "sk-proxy-two"
+	changes, err = GroupChanges(before, &after)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 2 {
+		t.Fatalf("changes = %v, want test_model and proxy_keys", changes)
+	}
+	if changes["test_model"].Before != "gpt-4o-mini" || changes["test_model"].After != "gpt-4o" {
+		t.Errorf("test_model change = %+v", changes["test_model"])
+	}
+	proxyKeys := changes["proxy_keys"]
+	if proxyKeys.Before == before.ProxyKeys || proxyKeys.After == after.ProxyKeys {
+		t.Errorf("proxy keys should be masked, got %+v", proxyKeys)
+	}
+}
+
+func newTestConfigService(t *testing.T) *ConfigService {
+	t.Helper()
+	keyService := newTestKeyService(t)
+	db := keyService.DB
+	groupService := NewGroupService(db, keyService, NewAdminUserService(db))
+	return NewConfigService(db, config.NewSystemSettingsManager(), keyService, groupService, NewGroupVersionService(db), nil)
+}
+
+func TestApplyFailureLeavesStoreUnchanged(t *testing.T) {
+	s := newTestConfigService(t)
+	groups := map[string]*models.Group{
+		"alpha": createTestGroup(t, s.KeyService, "alpha", "sk-alpha-1"),
+		"beta":  createTestGroup(t, s.KeyService, "beta", "sk-beta-1"),
+		"gamma": createTestGroup(t, s.KeyService, "gamma", "sk-gamma-1"),
+	}
+	// 最后一个 Key 写入失败，此前的分组删除和 Key 增删随事务回滚
+	if err := s.DB.Exec("CREATE TRIGGER reject_key BEFORE INSERT ON api_keys WHEN NEW.key_value = 'sk-rejected' " +
+		"BEGIN SELECT RAISE(ABORT, 'key rejected'); END").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	spec := func(name string, keys ...string) GroupSpec {
+		return GroupSpec{
+			Name:        name,
+			ChannelType: "openai",
+			TestModel:   "gpt-4o-mini",
+			Upstreams:   []UpstreamDefinition{{URL: "https://api.openai.com", Weight: 1}},
+			Keys:        keys,
+		}
+	}
+	doc := &ConfigDocument{
+		Version: ConfigDocumentVersion,
+		Groups:  []GroupSpec{spec("alpha", "sk-alpha-2"), spec("beta", "sk-beta-1", "sk-rejected")},
+	}
+	if _, err := s.Apply(doc, ConfigApplyOptions{IncludeKeys: true, Prune: true}); err == nil {
+		t.Fatal("expected the apply to fail")
+	}
+
+	for name, want := range map[string]string{"alpha": "sk-alpha-1", "beta": "sk-beta-1", "gamma": "sk-gamma-1"} {
+		got := selectableKeys(s.KeyService, groups[name].KeyOwner())
+		if len(got) != 1 || !got[want] {
+			t.Errorf("%s rotation = %v, want only %s", name, got, want)
+		}
+	}
+}
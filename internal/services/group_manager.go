@@ -61,6 +61,10 @@ func (gm *GroupManager) Initialize() error {
 				g.HeaderRuleList = []models.HeaderRule{}
 			}
 
+			if cfg := ParseMaintenanceConfig(g.MaintenanceConfig); cfg != nil && cfg.Enabled {
+				g.Maintenance = cfg
+			}
+
 			groupMap[g.Name] = &g
 			logrus.WithFields(logrus.Fields{
 				"group_name":         g.Name,
@@ -100,6 +104,19 @@ func (gm *GroupManager) GetGroupByName(name string) (*models.Group, error) {
 	return group, nil
 }
 
+// ParseMaintenanceConfig parses the maintenance config of a group, returning nil when it is not set or invalid.
+func ParseMaintenanceConfig(raw []byte) *models.MaintenanceConfig {
+	if len(raw) == 0 {
+		return nil
+	}
+	var cfg *models.MaintenanceConfig
+	if err := json.Unmarshal(raw, &cfg); err != nil {
+		logrus.WithError(err).Warn("Failed to unmarshal maintenance config")
+		return nil
+	}
+	return cfg
+}
+
 // Invalidate triggers a cache reload across all instances.
 func (gm *GroupManager) Invalidate() error {
 	if gm.syncer == nil {
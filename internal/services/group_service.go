@@ -0,0 +1,126 @@
+package services
+
+import (
+	"gpt-load/internal/keypool"
+	"gpt-load/internal/models"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// GroupService handles the group operations shared by the handlers and commands.
+type GroupService struct {
+	DB               *gorm.DB
+	KeyService       *KeyService
+	AdminUserService *AdminUserService
+}
+
+// NewGroupService creates a new GroupService.
+func NewGroupService(db *gorm.DB, keyService *KeyService, adminUserService *AdminUserService) *GroupService {
+	return &GroupService{
+		DB:               db,
+		KeyService:       keyService,
+		AdminUserService: adminUserService,
+	}
+}
+
+// Delete deletes a group with its keys and related records, and removes the keys from the store.
+// It returns the deleted group and the number of deleted keys.
+func (s *GroupService) Delete(id uint) (*models.Group, int, error) {
+	var group *models.Group
+	var deletedKeys int
+	changes := &keypool.StoreChanges{}
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		group, deletedKeys, err = s.DeleteInTx(tx, id, changes)
+		return err
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := s.KeyService.KeyProvider.ApplyStoreChanges(changes); err != nil {
+		logrus.WithError(err).Errorf("Failed to remove the keys of deleted group %d from the store", id)
+	}
+	return group, deletedKeys, nil
+}
+
+// DeleteInTx deletes a group within the transaction of the caller. The removal of its keys from the store
+// is recorded in changes, which the caller applies once the transaction commits.
+func (s *GroupService) DeleteInTx(tx *gorm.DB, id uint, changes *keypool.StoreChanges) (*models.Group, int, error) {
+	// First check if the group exists
+	var group models.Group
+	if err := tx.First(&group, id).Error; err != nil {
+		return nil, 0, err
+	}
+
+	// Get all API keys for this group to clean up from memory store.
+	// The keys of a key pool the group references are kept for the other groups.
+	owner := models.KeyOwner{GroupID: id}
+	var keyIDs []uint
+	if err := tx.Model(&models.APIKey{}).Scopes(owner.Scope).Pluck("id", &keyIDs).Error; err != nil {
+		return nil, 0, err
+	}
+
+	// Delete associated API keys first due to foreign key constraint
+	if err := tx.Scopes(owner.Scope).Delete(&models.APIKey{}).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if err := tx.Where("group_id = ?", id).Delete(&models.KeyEvent{}).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if err := tx.Where("group_id = ?", id).Delete(&models.ProbeResult{}).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if err := tx.Where("group_id = ?", id).Delete(&models.ProbeIncident{}).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if err := tx.Where("group_id = ?", id).Delete(&models.GroupVersion{}).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if err := s.AdminUserService.RemoveGroupAssignments(tx, id); err != nil {
+		return nil, 0, err
+	}
+
+	// Then delete the group
+	if err := tx.Delete(&models.Group{}, id).Error; err != nil {
+		return nil, 0, err
+	}
+
+	changes.RemoveOwnerKeys(owner, keyIDs)
+
+	return &group, len(keyIDs), nil
+}
+
+// MoveKeysToPoolInTx moves the group's own keys into the key pool it references, within the transaction
+// of the caller. Keys already in the pool keep the pool's status and counts, the group's copies are removed.
+// The store updates are recorded in changes, which the caller applies once the transaction commits.
+// It returns nil when the group has no own keys or does not reference a key pool.
+func (s *GroupService) MoveKeysToPoolInTx(tx *gorm.DB, group *models.Group, changes *keypool.StoreChanges) (*KeyTransferResult, error) {
+	if !group.KeyOwner().IsPool() {
+		return nil, nil
+	}
+	owner := models.KeyOwner{GroupID: group.ID}
+	var keyIDs []uint
+	if err := tx.Model(&models.APIKey{}).Scopes(owner.Scope).Order("id").Pluck("id", &keyIDs).Error; err != nil {
+		return nil, err
+	}
+	if len(keyIDs) == 0 {
+		return nil, nil
+	}
+
+	result := &KeyTransferResult{}
+	for i := 0; i < len(keyIDs); i += chunkSize {
+		end := min(i+chunkSize, len(keyIDs))
+		batchResult, err := s.KeyService.KeyProvider.TransferKeysInTx(tx, owner, group.KeyOwner(), keyIDs[i:end], keypool.KeyTransferMove, keypool.KeyConflictKeepTarget, changes)
+		if err != nil {
+			return nil, err
+		}
+		result.Add(batchResult)
+	}
+	return result, nil
+}
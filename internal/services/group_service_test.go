@@ -0,0 +1,131 @@
+package services
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"gpt-load/internal/encryption"
+	"gpt-load/internal/keypool"
+	"gpt-load/internal/models"
+	"gpt-load/internal/store"
+	"gpt-load/internal/types"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/datatypes"
+	"gorm.io/gorm"
+)
+
+// testConfig is a config manager without a master key, so keys are stored in plaintext.
+type testConfig struct {
+	types.ConfigManager
+}
+
+func (testConfig) GetEncryptionConfig() types.EncryptionConfig {
+	return types.EncryptionConfig{}
+}
+
+// newTestDB returns an empty sqlite database with the tables of the given models.
+func newTestDB(t *testing.T, tables ...any) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(tables...); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// newTestKeyService returns a key service on an empty sqlite database with the group and key tables.
+func newTestKeyService(t *testing.T) *KeyService {
+	t.Helper()
+	// 加密服务注册 encrypted 序列化器，需在建表前创建
+	encryptionService := encryption.NewService(testConfig{})
+	db := newTestDB(t,
+		&models.KeyPool{}, &models.Group{}, &models.GroupVersion{}, &models.APIKey{}, &models.KeyEvent{},
+		&models.AdminUserGroup{}, &models.ProbeResult{}, &models.ProbeIncident{},
+	)
+	provider := keypool.NewProvider(db, store.NewMemoryStore(), nil, encryptionService, nil)
+	return NewKeyService(db, provider, nil, encryptionService)
+}
+
+// createTestGroup creates a group with the given active keys.
+func createTestGroup(t *testing.T, keyService *KeyService, name string, keys ...string) *models.Group {
+	t.Helper()
+	group := &models.Group{Name: name, ChannelType: "openai", Upstreams: datatypes.JSON(`[]`)}
+	if err := keyService.DB.Create(group).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) > 0 {
+		apiKeys := make([]models.APIKey, 0, len(keys))
+		for _, key := range keys {
+			apiKeys = append(apiKeys, models.APIKey{KeyValue: key, KeyHash: keyService.EncryptionService.Hash(key), Status: models.KeyStatusActive, Weight: 1})
+		}
+		if err := keyService.KeyProvider.AddKeys(group.KeyOwner(), apiKeys); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return group
+}
+
+// selectableKeys returns the values of the keys selected from the rotation of the owner.
+func selectableKeys(keyService *KeyService, owner models.KeyOwner) map[string]bool {
+	values := make(map[string]bool)
+	for range 10 {
+		key, err := keyService.KeyProvider.SelectKey(owner)
+		if err != nil {
+			break
+		}
+		values[key.KeyValue] = true
+	}
+	return values
+}
+
+func TestMoveKeysToPoolInTxRollbackLeavesStore(t *testing.T) {
+	keyService := newTestKeyService(t)
+	groupService := NewGroupService(keyService.DB, keyService, NewAdminUserService(keyService.DB))
+	group := createTestGroup(t, keyService, "openai", "sk-own")
+	poolID := uint(1)
+	group.KeyPoolID = &poolID
+
+	changes := &keypool.StoreChanges{}
+	err := keyService.DB.Transaction(func(tx *gorm.DB) error {
+		moved, err := groupService.MoveKeysToPoolInTx(tx, group, changes)
+		if err != nil {
+			return err
+		}
+		if moved == nil || moved.TransferredCount != 1 {
+			t.Errorf("moved = %+v, want the key of the group", moved)
+		}
+		return errors.New("a later step failed")
+	})
+	if err == nil {
+		t.Fatal("expected the transaction to fail")
+	}
+	if got := selectableKeys(keyService, models.KeyOwner{GroupID: group.ID}); !got["sk-own"] {
+		t.Errorf("group rotation = %v, want the key kept in the group", got)
+	}
+	if got := selectableKeys(keyService, group.KeyOwner()); len(got) != 0 {
+		t.Errorf("pool rotation = %v, want it empty after the rollback", got)
+	}
+
+	// 提交后再应用，Key 进入密钥池的轮换
+	changes = &keypool.StoreChanges{}
+	if err := keyService.DB.Transaction(func(tx *gorm.DB) error {
+		_, err := groupService.MoveKeysToPoolInTx(tx, group, changes)
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := keyService.KeyProvider.ApplyStoreChanges(changes); err != nil {
+		t.Fatal(err)
+	}
+	if got := selectableKeys(keyService, group.KeyOwner()); !got["sk-own"] {
+		t.Errorf("pool rotation = %v, want the moved key", got)
+	}
+	if got := selectableKeys(keyService, models.KeyOwner{GroupID: group.ID}); len(got) != 0 {
+		t.Errorf("group rotation = %v, want it empty after the move", got)
+	}
+}
@@ -0,0 +1,349 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"gpt-load/internal/channel"
+	"gpt-load/internal/config"
+	"gpt-load/internal/models"
+
+	"gorm.io/datatypes"
+)
+
+// MaxMaintenanceRetryAfter limits the Retry-After of a group under maintenance to a week.
+const MaxMaintenanceRetryAfter = 7 * 24 * 3600
+
+// IsValidChannelType checks if the channel type is valid by checking against the registered channels.
+func IsValidChannelType(channelType string) bool {
+	channels := channel.GetChannels()
+	for _, t := range channels {
+		if t == channelType {
+			return true
+		}
+	}
+	return false
+}
+
+// UpstreamDefinition defines the structure for an upstream in the request.
+type UpstreamDefinition struct {
+	URL    string `json:"url"`
+	Weight int    `json:"weight"`
+}
+
+// ValidateAndCleanUpstreams validates and cleans the upstreams JSON.
+func ValidateAndCleanUpstreams(upstreams json.RawMessage) (datatypes.JSON, error) {
+	if len(upstreams) == 0 {
+		return nil, fmt.Errorf("upstreams field is required")
+	}
+
+	var defs []UpstreamDefinition
+	if err := json.Unmarshal(upstreams, &defs); err != nil {
+		return nil, fmt.Errorf("invalid format for upstreams: %w", err)
+	}
+
+	if len(defs) == 0 {
+		return nil, fmt.Errorf("at least one upstream is required")
+	}
+
+	for i := range defs {
+		defs[i].URL = strings.TrimSpace(defs[i].URL)
+		if defs[i].URL == "" {
+			return nil, fmt.Errorf("upstream URL cannot be empty")
+		}
+		// Basic URL format validation
+		if !strings.HasPrefix(defs[i].URL, "http://") && !strings.HasPrefix(defs[i].URL, "https://") {
+			return nil, fmt.Errorf("invalid URL format for upstream: %s", defs[i].URL)
+		}
+		if defs[i].Weight <= 0 {
+			return nil, fmt.Errorf("upstream weight must be a positive integer")
+		}
+	}
+
+	cleanedUpstreams, err := json.Marshal(defs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal cleaned upstreams: %w", err)
+	}
+
+	return cleanedUpstreams, nil
+}
+
+// IsValidGroupName checks if the group name is valid.
+func IsValidGroupName(name string) bool {
+	if name == "" {
+		return false
+	}
+	// 允许使用小写字母、数字、下划线和中划线，长度在 3 到 30 个字符之间
+	match, _ := regexp.MatchString("^[a-z0-9_-]{3,30}$", name)
+	return match
+}
+
+// IsValidValidationEndpoint checks if the validation endpoint is a valid path.
+func IsValidValidationEndpoint(endpoint string) bool {
+	if endpoint == "" {
+		return true
+	}
+	if !strings.HasPrefix(endpoint, "/") {
+		return false
+	}
+	if strings.Contains(endpoint, "://") {
+		return false
+	}
+	return true
+}
+
+// ValidateAndCleanValidationConfig validates the validation config for the channel type and returns its JSON form.
+func ValidateAndCleanValidationConfig(cfg *models.ValidationConfig, channelType, validationEndpoint string) (datatypes.JSON, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+
+	cleaned := models.ValidationConfig{
+		Method:     strings.ToLower(strings.TrimSpace(cfg.Method)),
+		HTTPMethod: strings.ToUpper(strings.TrimSpace(cfg.HTTPMethod)),
+		Body:       strings.TrimSpace(cfg.Body),
+	}
+	if cleaned.Method == "" {
+		cleaned.Method = models.ValidationMethodCompletion
+	}
+
+	switch cleaned.Method {
+	case models.ValidationMethodCompletion, models.ValidationMethodListModels, models.ValidationMethodCountTokens:
+		cleaned.HTTPMethod = ""
+		cleaned.Body = ""
+	case models.ValidationMethodCustom:
+		if validationEndpoint == "" {
+			return nil, fmt.Errorf("custom validation requires a validation endpoint")
+		}
+		switch cleaned.HTTPMethod {
+		case "":
+			cleaned.HTTPMethod = http.MethodPost
+		case http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodHead:
+		default:
+			return nil, fmt.Errorf("unsupported validation HTTP method: %s", cleaned.HTTPMethod)
+		}
+		if cleaned.Body != "" && !json.Valid([]byte(cleaned.Body)) {
+			return nil, fmt.Errorf("validation body must be valid JSON")
+		}
+	default:
+		return nil, fmt.Errorf("invalid validation method: %s", cfg.Method)
+	}
+	if !channel.SupportsValidationMethod(channelType, cleaned.Method) {
+		return nil, fmt.Errorf("validation method '%s' is not supported by the %s channel", cleaned.Method, channelType)
+	}
+
+	for _, rule := range cfg.ResponseRules {
+		switch rule.Result {
+		case models.ValidationResultValid, models.ValidationResultInvalid, models.ValidationResultRateLimited:
+		default:
+			return nil, fmt.Errorf("invalid validation rule result: %s", rule.Result)
+		}
+		for _, status := range rule.Statuses {
+			if status < 100 || status > 599 {
+				return nil, fmt.Errorf("invalid status code in validation rule: %d", status)
+			}
+		}
+		cleaned.ResponseRules = append(cleaned.ResponseRules, rule)
+	}
+
+	cleanedBytes, err := json.Marshal(cleaned)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal validation config: %w", err)
+	}
+	return cleanedBytes, nil
+}
+
+// CheckStoredValidationConfig checks that a stored validation config still works after the channel type
+// or validation endpoint of the group changed.
+func CheckStoredValidationConfig(raw datatypes.JSON, channelType, validationEndpoint string) error {
+	var cfg models.ValidationConfig
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &cfg); err != nil {
+			return fmt.Errorf("failed to parse validation config: %w", err)
+		}
+	}
+	if !channel.SupportsValidationMethod(channelType, cfg.Method) {
+		return fmt.Errorf("validation method '%s' is not supported by the %s channel", cfg.Method, channelType)
+	}
+	if cfg.Method == models.ValidationMethodCustom && validationEndpoint == "" {
+		return fmt.Errorf("custom validation requires a validation endpoint")
+	}
+	return nil
+}
+
+// ValidateAndCleanProbeConfig validates the probe config and returns its JSON form.
+func ValidateAndCleanProbeConfig(cfg *models.ProbeConfig) (datatypes.JSON, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+
+	cleaned := models.ProbeConfig{
+		Enabled:          cfg.Enabled,
+		IntervalSeconds:  cfg.IntervalSeconds,
+		TimeoutSeconds:   cfg.TimeoutSeconds,
+		Method:           strings.ToUpper(strings.TrimSpace(cfg.Method)),
+		Path:             strings.TrimSpace(cfg.Path),
+		Body:             strings.TrimSpace(cfg.Body),
+		ExpectedStatuses: cfg.ExpectedStatuses,
+	}
+	if cleaned.IntervalSeconds == 0 {
+		cleaned.IntervalSeconds = 60
+	}
+	if cleaned.TimeoutSeconds == 0 {
+		cleaned.TimeoutSeconds = 30
+	}
+	if cleaned.Method == "" {
+		cleaned.Method = http.MethodPost
+	}
+
+	if cleaned.IntervalSeconds < 10 || cleaned.IntervalSeconds > 86400 {
+		return nil, fmt.Errorf("probe interval must be between 10 and 86400 seconds")
+	}
+	if cleaned.TimeoutSeconds < 1 || cleaned.TimeoutSeconds > cleaned.IntervalSeconds {
+		return nil, fmt.Errorf("probe timeout must be between 1 second and the probe interval")
+	}
+	switch cleaned.Method {
+	case http.MethodGet, http.MethodPost:
+	default:
+		return nil, fmt.Errorf("unsupported probe HTTP method: %s", cleaned.Method)
+	}
+	if cleaned.Enabled && cleaned.Path == "" {
+		return nil, fmt.Errorf("probe path is required")
+	}
+	if !IsValidValidationEndpoint(cleaned.Path) {
+		return nil, fmt.Errorf("probe path must start with / and cannot be a full URL")
+	}
+	if cleaned.Body != "" && !json.Valid([]byte(cleaned.Body)) {
+		return nil, fmt.Errorf("probe body must be valid JSON")
+	}
+	for _, status := range cleaned.ExpectedStatuses {
+		if status < 100 || status > 599 {
+			return nil, fmt.Errorf("invalid expected status code: %d", status)
+		}
+	}
+
+	cleanedBytes, err := json.Marshal(cleaned)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal probe config: %w", err)
+	}
+	return cleanedBytes, nil
+}
+
+// NormalizeHeaderRules canonicalizes the header names of the rules, dropping empty ones, and returns their JSON form.
+func NormalizeHeaderRules(rules []models.HeaderRule) (datatypes.JSON, error) {
+	normalizedHeaderRules := make([]models.HeaderRule, 0, len(rules))
+	seenKeys := make(map[string]bool)
+
+	for _, rule := range rules {
+		key := strings.TrimSpace(rule.Key)
+		if key == "" {
+			continue
+		}
+
+		// Normalize to canonical form
+		canonicalKey := http.CanonicalHeaderKey(key)
+
+		// Check for duplicate keys
+		if seenKeys[canonicalKey] {
+			return nil, fmt.Errorf("Duplicate header key: %s", canonicalKey)
+		}
+		seenKeys[canonicalKey] = true
+
+		normalizedHeaderRules = append(normalizedHeaderRules, models.HeaderRule{
+			Key:    canonicalKey,
+			Value:  rule.Value,
+			Action: rule.Action,
+		})
+	}
+
+	headerRulesBytes, err := json.Marshal(normalizedHeaderRules)
+	if err != nil {
+		return nil, fmt.Errorf("failed to process header rules: %w", err)
+	}
+	return headerRulesBytes, nil
+}
+
+// ValidateAndCleanGroupConfig validates the group config against the GroupConfig struct and system-defined rules.
+func ValidateAndCleanGroupConfig(settingsManager *config.SystemSettingsManager, configMap map[string]any) (map[string]any, error) {
+	if configMap == nil {
+		return nil, nil
+	}
+
+	// 1. Check for unknown fields by comparing against the GroupConfig struct definition.
+	var tempGroupConfig models.GroupConfig
+	groupConfigType := reflect.TypeOf(tempGroupConfig)
+	validFields := make(map[string]bool)
+	for i := 0; i < groupConfigType.NumField(); i++ {
+		jsonTag := groupConfigType.Field(i).Tag.Get("json")
+		fieldName := strings.Split(jsonTag, ",")[0]
+		if fieldName != "" && fieldName != "-" {
+			validFields[fieldName] = true
+		}
+	}
+
+	for key := range configMap {
+		if !validFields[key] {
+			return nil, fmt.Errorf("unknown config field: '%s'", key)
+		}
+	}
+
+	// 2. Validate the values of the provided fields using the central system settings validator.
+	if err := settingsManager.ValidateGroupConfigOverrides(configMap); err != nil {
+		return nil, err
+	}
+
+	// 3. Unmarshal and marshal back to clean the map and ensure correct types.
+	configBytes, err := json.Marshal(configMap)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal config map: %w", err)
+	}
+
+	var validatedConfig models.GroupConfig
+	if err := json.Unmarshal(configBytes, &validatedConfig); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal into validated config: %w", err)
+	}
+
+	validatedBytes, err := json.Marshal(validatedConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal validated config: %w", err)
+	}
+	var finalMap map[string]any
+	if err := json.Unmarshal(validatedBytes, &finalMap); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal into final map: %w", err)
+	}
+
+	return finalMap, nil
+}
+
+// ValidateAndCleanMaintenanceConfig validates the maintenance config and returns its JSON form.
+func ValidateAndCleanMaintenanceConfig(cfg *models.MaintenanceConfig) (datatypes.JSON, error) {
+	cleaned := models.MaintenanceConfig{
+		Enabled:           cfg.Enabled,
+		StatusCode:        cfg.StatusCode,
+		Message:           strings.TrimSpace(cfg.Message),
+		RetryAfterSeconds: cfg.RetryAfterSeconds,
+	}
+	if cleaned.StatusCode == 0 {
+		cleaned.StatusCode = http.StatusServiceUnavailable
+	}
+
+	if cleaned.StatusCode < 400 || cleaned.StatusCode > 599 {
+		return nil, fmt.Errorf("maintenance status code must be between 400 and 599")
+	}
+	if len(cleaned.Message) > 512 {
+		return nil, fmt.Errorf("maintenance message must be at most 512 characters")
+	}
+	if cleaned.RetryAfterSeconds < 0 || cleaned.RetryAfterSeconds > MaxMaintenanceRetryAfter {
+		return nil, fmt.Errorf("retry after must be between 0 and %d seconds", MaxMaintenanceRetryAfter)
+	}
+
+	cleanedBytes, err := json.Marshal(cleaned)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal maintenance config: %w", err)
+	}
+	return cleanedBytes, nil
+}
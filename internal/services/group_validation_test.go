@@ -0,0 +1,55 @@
+package services
+
+import (
+	"testing"
+
+	"gpt-load/internal/models"
+
+	"gorm.io/datatypes"
+)
+
+func TestValidateAndCleanValidationConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		cfg         *models.ValidationConfig
+		channelType string
+		endpoint    string
+		wantErr     bool
+	}{
+		{"default method", &models.ValidationConfig{}, "openai", "", false},
+		{"count tokens on anthropic", &models.ValidationConfig{Method: models.ValidationMethodCountTokens}, "anthropic", "", false},
+		{"count tokens on openai", &models.ValidationConfig{Method: models.ValidationMethodCountTokens}, "openai", "", true},
+		{"custom with endpoint", &models.ValidationConfig{Method: models.ValidationMethodCustom}, "openai", "/v1/check", false},
+		{"custom without endpoint", &models.ValidationConfig{Method: models.ValidationMethodCustom}, "openai", "", true},
+		{"unknown method", &models.ValidationConfig{Method: "ping"}, "openai", "", true},
+		{"invalid rule result", &models.ValidationConfig{
+			ResponseRules: []models.ValidationResponseRule{{Result: "maybe"}},
+		}, "openai", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ValidateAndCleanValidationConfig(tt.cfg, tt.channelType, tt.endpoint)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckStoredValidationConfig(t *testing.T) {
+	countTokens := datatypes.JSON(`{"method":"count_tokens"}`)
+	custom := datatypes.JSON(`{"method":"custom"}`)
+
+	if err := CheckStoredValidationConfig(nil, "openai", ""); err != nil {
+		t.Errorf("default config: unexpected error %v", err)
+	}
+	if err := CheckStoredValidationConfig(countTokens, "anthropic", ""); err != nil {
+		t.Errorf("count_tokens on anthropic: unexpected error %v", err)
+	}
+	if err := CheckStoredValidationConfig(countTokens, "openai", ""); err == nil {
+		t.Error("expected count_tokens to be rejected after switching to the openai channel")
+	}
+	if err := CheckStoredValidationConfig(custom, "openai", ""); err == nil {
+		t.Error("expected custom validation to be rejected after clearing the validation endpoint")
+	}
+}
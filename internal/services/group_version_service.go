@@ -0,0 +1,143 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"gpt-load/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// GroupVersionActor identifies who changed a group. The ID is 0 for AUTH_KEY and CLI changes.
+type GroupVersionActor struct {
+	ID   uint
+	Name string
+}
+
+// GroupVersionEntry describes a group change to record as a new version.
+type GroupVersionEntry struct {
+	Action       string
+	Actor        GroupVersionActor
+	Previous     *models.Group // State before the change, recorded first for groups without history
+	RestoredFrom int
+}
+
+// GroupVersionService records the configuration history of groups.
+type GroupVersionService struct {
+	DB *gorm.DB
+}
+
+// NewGroupVersionService creates a new GroupVersionService.
+func NewGroupVersionService(db *gorm.DB) *GroupVersionService {
+	return &GroupVersionService{DB: db}
+}
+
+// Record stores the configuration of the group as its next version, within the transaction of the change.
+// Nothing is recorded when the configuration equals the latest version.
+func (s *GroupVersionService) Record(tx *gorm.DB, group *models.Group, entry GroupVersionEntry) (*models.GroupVersion, error) {
+	latest, err := s.latest(tx, group.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 启用配置历史前创建的分组，先记录变更前的配置作为基线
+	if latest == nil && entry.Previous != nil {
+		latest, err = s.create(tx, entry.Previous, 1, GroupVersionEntry{
+			Action: models.GroupVersionBaseline,
+			Actor:  GroupVersionActor{Name: "system"},
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	next := 1
+	if latest != nil {
+		same, err := snapshotEquals(latest.Snapshot, models.NewGroupSnapshot(group))
+		if err != nil {
+			return nil, err
+		}
+		if same {
+			return nil, nil
+		}
+		next = latest.Version + 1
+	}
+	return s.create(tx, group, next, entry)
+}
+
+// List returns the versions of a group, newest first.
+func (s *GroupVersionService) List(groupID uint) ([]models.GroupVersion, error) {
+	var versions []models.GroupVersion
+	err := s.DB.Where("group_id = ?", groupID).Order("version desc").Find(&versions).Error
+	return versions, err
+}
+
+// Get returns a version of a group.
+func (s *GroupVersionService) Get(groupID uint, version int) (*models.GroupVersion, error) {
+	var groupVersion models.GroupVersion
+	if err := s.DB.Where("group_id = ? AND version = ?", groupID, version).First(&groupVersion).Error; err != nil {
+		return nil, err
+	}
+	return &groupVersion, nil
+}
+
+// Snapshot decodes the configuration stored in a version.
+func (s *GroupVersionService) Snapshot(version *models.GroupVersion) (models.GroupSnapshot, error) {
+	var snapshot models.GroupSnapshot
+	if err := json.Unmarshal(version.Snapshot, &snapshot); err != nil {
+		return snapshot, fmt.Errorf("invalid snapshot of version %d: %w", version.Version, err)
+	}
+	return snapshot, nil
+}
+
+func (s *GroupVersionService) latest(tx *gorm.DB, groupID uint) (*models.GroupVersion, error) {
+	var version models.GroupVersion
+	err := tx.Where("group_id = ?", groupID).Order("version desc").First(&version).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
+func (s *GroupVersionService) create(tx *gorm.DB, group *models.Group, version int, entry GroupVersionEntry) (*models.GroupVersion, error) {
+	snapshot, err := json.Marshal(models.NewGroupSnapshot(group))
+	if err != nil {
+		return nil, err
+	}
+	groupVersion := models.GroupVersion{
+		GroupID:      group.ID,
+		Version:      version,
+		Action:       entry.Action,
+		ActorID:      entry.Actor.ID,
+		Actor:        entry.Actor.Name,
+		RestoredFrom: entry.RestoredFrom,
+		Snapshot:     snapshot,
+	}
+	if err := tx.Create(&groupVersion).Error; err != nil {
+		return nil, fmt.Errorf("failed to record group version: %w", err)
+	}
+	return &groupVersion, nil
+}
+
+// snapshotEquals compares a stored snapshot with a configuration as JSON values,
+// since databases may reformat stored JSON.
+func snapshotEquals(stored []byte, snapshot models.GroupSnapshot) (bool, error) {
+	current, err := json.Marshal(snapshot)
+	if err != nil {
+		return false, err
+	}
+	var a, b any
+	if err := json.Unmarshal(stored, &a); err != nil {
+		return false, nil
+	}
+	if err := json.Unmarshal(current, &b); err != nil {
+		return false, err
+	}
+	return reflect.DeepEqual(a, b), nil
+}
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"fmt"
 	"gpt-load/internal/models"
 	"time"
@@ -40,57 +41,55 @@ func (s *KeyDeleteService) StartDeleteTask(group *models.Group, keysText string)
 		return nil, fmt.Errorf("no valid keys found in the input text")
 	}
 
-	initialStatus, err := s.TaskService.StartTask(TaskTypeKeyDelete, group.Name, len(keys), deleteTimeout)
+	run, initialStatus, err := s.TaskService.StartTask(TaskTypeKeyDelete, group, len(keys), deleteTimeout)
 	if err != nil {
 		return nil, err
 	}
 
-	go s.runDelete(group, keys)
+	go s.runDelete(run, group, keys)
 
 	return initialStatus, nil
 }
 
-func (s *KeyDeleteService) runDelete(group *models.Group, keys []string) {
+func (s *KeyDeleteService) runDelete(run *TaskRun, group *models.Group, keys []string) {
 	progressCallback := func(processed int) {
-		if err := s.TaskService.UpdateProgress(processed); err != nil {
+		if err := run.UpdateProgress(processed); err != nil {
 			logrus.Warnf("Failed to update task progress for group %d: %v", group.ID, err)
 		}
 	}
 
-	deletedCount, ignoredCount, err := s.processAndDeleteKeys(group.ID, keys, progressCallback)
-	if err != nil {
-		if endErr := s.TaskService.EndTask(nil, err); endErr != nil {
-			logrus.Errorf("Failed to end task with error for group %d: %v (original error: %v)", group.ID, endErr, err)
-		}
-		return
-	}
-
+	deletedCount, ignoredCount, err := s.processAndDeleteKeys(run.Context(), group.KeyOwner(), keys, progressCallback)
 	result := KeyDeleteResult{
 		DeletedCount: deletedCount,
 		IgnoredCount: ignoredCount,
 	}
 
-	if endErr := s.TaskService.EndTask(result, nil); endErr != nil {
-		logrus.Errorf("Failed to end task with success result for group %d: %v", group.ID, endErr)
+	if endErr := run.End(result, err); endErr != nil {
+		logrus.Errorf("Failed to end task %d for group %d: %v (task error: %v)", run.ID, group.ID, endErr, err)
 	}
 }
 
 // processAndDeleteKeys is the core function for deleting keys with progress tracking.
+// It stops between chunks when the context is done.
 func (s *KeyDeleteService) processAndDeleteKeys(
-	groupID uint,
+	ctx context.Context,
+	owner models.KeyOwner,
 	keys []string,
 	progressCallback func(processed int),
 ) (deletedCount int, ignoredCount int, err error) {
 	var totalDeletedCount int64
 
 	for i := 0; i < len(keys); i += deleteChunkSize {
+		if err := ctx.Err(); err != nil {
+			return int(totalDeletedCount), len(keys) - int(totalDeletedCount), err
+		}
 		end := i + deleteChunkSize
 		if end > len(keys) {
 			end = len(keys)
 		}
 		chunk := keys[i:end]
 
-		deletedChunkCount, err := s.KeyService.KeyProvider.RemoveKeys(groupID, chunk)
+		deletedChunkCount, err := s.KeyService.KeyProvider.RemoveKeys(owner, chunk)
 		if err != nil {
 			return int(totalDeletedCount), len(keys) - int(totalDeletedCount), err
 		}
@@ -0,0 +1,463 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gpt-load/internal/channel"
+	"gpt-load/internal/models"
+)
+
+// Key file formats
+const (
+	KeyFileFormatTXT   = "txt"
+	KeyFileFormatCSV   = "csv"
+	KeyFileFormatJSON  = "json"
+	KeyFileFormatJSONL = "jsonl"
+)
+
+const (
+	// maxKeyFileEntries limits the number of keys imported from a single file.
+	maxKeyFileEntries = 500000
+	// maxKeyFileLineSize limits the length of a line of TXT and JSONL files.
+	maxKeyFileLineSize = 1024 * 1024
+	// keyFileSniffSize is the number of bytes inspected to detect the format of a file without extension.
+	keyFileSniffSize = 4096
+)
+
+var (
+	ErrUnknownKeyFileFormat = errors.New("unknown key file format, expected txt, csv, json or jsonl")
+	ErrTooManyKeyFileKeys   = fmt.Errorf("the file has more than %d keys", maxKeyFileEntries)
+
+	keyFileDelimiters = regexp.MustCompile(`[\s,;|]+`)
+	csvLabelSeparator = strings.NewReplacer(";", ",", "|", ",")
+)
+
+// KeyFileEntry is a key read from an uploaded file, with its optional metadata.
+type KeyFileEntry struct {
+	Line int
+	Key  models.APIKey
+}
+
+// KeyImportRejection is a line of an uploaded file that was not imported.
+// Line is the line number for TXT, CSV and JSONL files, and the item number for JSON arrays.
+type KeyImportRejection struct {
+	Line   int    `json:"line"`
+	Key    string `json:"key,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// KeyFileParseResult holds the keys read from an uploaded file and the lines that were rejected.
+type KeyFileParseResult struct {
+	Format   string
+	Entries  []KeyFileEntry
+	Rejected []KeyImportRejection
+}
+
+// keyFileRecord is a key of a JSON or JSONL file.
+type keyFileRecord struct {
+	Key       string          `json:"key"`
+	KeyValue  string          `json:"key_value"`
+	APIKey    string          `json:"api_key"`
+	Labels    json.RawMessage `json:"labels"`
+	Weight    json.RawMessage `json:"weight"`
+	ExpiresAt string          `json:"expires_at"`
+	Note      string          `json:"note"`
+	Owner     string          `json:"owner"`
+}
+
+// keyFileParser reads the keys of a file and checks them against the channel of the target group.
+type keyFileParser struct {
+	keyService  *KeyService
+	channelType string
+	checkFormat bool
+	now         time.Time
+	result      *KeyFileParseResult
+}
+
+// ParseKeyFile reads the keys of an uploaded file in a streaming way.
+// The format is taken from the format argument, then from the file extension, then from the content.
+// When checkFormat is set, keys that look like keys of another provider than the group's channel are rejected.
+func (s *KeyService) ParseKeyFile(r io.Reader, filename, format, channelType string, checkFormat bool) (*KeyFileParseResult, error) {
+	reader := bufio.NewReaderSize(r, keyFileSniffSize)
+
+	format = strings.ToLower(strings.TrimSpace(format))
+	if format == "" {
+		format = detectKeyFileFormat(reader, filename)
+	}
+
+	p := &keyFileParser{
+		keyService:  s,
+		channelType: channelType,
+		checkFormat: checkFormat,
+		now:         time.Now(),
+		result:      &KeyFileParseResult{Format: format},
+	}
+
+	var err error
+	switch format {
+	case KeyFileFormatTXT:
+		err = p.parseTXT(reader)
+	case KeyFileFormatCSV:
+		err = p.parseCSV(reader)
+	case KeyFileFormatJSON:
+		err = p.parseJSON(reader)
+	case KeyFileFormatJSONL:
+		err = p.parseJSONL(reader)
+	default:
+		return nil, ErrUnknownKeyFileFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+	return p.result, nil
+}
+
+// detectKeyFileFormat guesses the format of a file from its extension, or from its first bytes.
+func detectKeyFileFormat(reader *bufio.Reader, filename string) string {
+	switch ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(filename), ".")); ext {
+	case KeyFileFormatTXT, KeyFileFormatCSV, KeyFileFormatJSON, KeyFileFormatJSONL:
+		return ext
+	case "ndjson":
+		return KeyFileFormatJSONL
+	}
+
+	head, _ := reader.Peek(keyFileSniffSize)
+	head = bytes.TrimSpace(bytes.TrimPrefix(head, []byte("\xef\xbb\xbf")))
+	switch {
+	case len(head) == 0:
+		return KeyFileFormatTXT
+	case head[0] == '[':
+		return KeyFileFormatJSON
+	case head[0] == '{' || head[0] == '"':
+		return KeyFileFormatJSONL
+	}
+
+	firstLine, _, _ := bytes.Cut(head, []byte("\n"))
+	if bytes.Contains(firstLine, []byte(",")) && !bytes.ContainsAny(firstLine, " \t;|") {
+		return KeyFileFormatCSV
+	}
+	return KeyFileFormatTXT
+}
+
+// parseTXT reads keys separated by whitespace, commas, semicolons or pipes. Lines starting with # are comments.
+func (p *keyFileParser) parseTXT(reader io.Reader) error {
+	scanner := newKeyFileScanner(reader)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(strings.TrimPrefix(scanner.Text(), "\ufeff"))
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		for _, key := range keyFileDelimiters.Split(text, -1) {
+			if key == "" {
+				continue
+			}
+			if err := p.add(line, models.APIKey{KeyValue: key}); err != nil {
+				return err
+			}
+		}
+	}
+	return keyFileScanError(scanner.Err(), line)
+}
+
+// parseCSV reads rows of key, labels, weight and expires_at. Only the key column is required, lines starting with # are comments.
+// A header row may name the columns, including note and owner, in any order.
+func (p *keyFileParser) parseCSV(reader io.Reader) error {
+	csvReader := csv.NewReader(reader)
+	csvReader.FieldsPerRecord = -1
+	csvReader.TrimLeadingSpace = true
+	csvReader.ReuseRecord = true
+	csvReader.Comment = '#'
+
+	columns := map[string]int{"key": 0, "labels": 1, "weight": 2, "expires_at": 3}
+	first := true
+	for {
+		record, err := csvReader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				p.reject(parseErr.StartLine, "", "malformed CSV row: "+parseErr.Err.Error())
+				continue
+			}
+			return fmt.Errorf("failed to read the file: %w", err)
+		}
+		line, _ := csvReader.FieldPos(0)
+
+		if first {
+			first = false
+			record[0] = strings.TrimPrefix(record[0], "\ufeff")
+			if header := parseKeyFileCSVHeader(record); header != nil {
+				columns = header
+				continue
+			}
+		}
+
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+		key := models.APIKey{
+			KeyValue: field("key"),
+			Labels:   NormalizeLabels(csvLabelSeparator.Replace(field("labels"))),
+			Note:     field("note"),
+			Owner:    field("owner"),
+		}
+		if err := p.applyWeight(&key, field("weight")); err != nil {
+			p.reject(line, key.KeyValue, err.Error())
+			continue
+		}
+		if err := p.applyExpiresAt(&key, field("expires_at")); err != nil {
+			p.reject(line, key.KeyValue, err.Error())
+			continue
+		}
+		if err := p.add(line, key); err != nil {
+			return err
+		}
+	}
+}
+
+// parseKeyFileCSVHeader returns the column of each field when the row is a header row, nil otherwise.
+func parseKeyFileCSVHeader(record []string) map[string]int {
+	columns := make(map[string]int)
+	for i, name := range record {
+		name = strings.ToLower(strings.TrimSpace(name))
+		switch name {
+		case "key", "key_value", "api_key", "apikey":
+			columns["key"] = i
+		case "labels", "label":
+			columns["labels"] = i
+		case "weight", "expires_at", "note", "owner":
+			columns[name] = i
+		}
+	}
+	if _, ok := columns["key"]; !ok {
+		return nil
+	}
+	return columns
+}
+
+// parseJSON reads a JSON array whose items are keys or key objects.
+// A file that is not an array is read as a sequence of JSON values, like a JSONL file.
+func (p *keyFileParser) parseJSON(reader *bufio.Reader) error {
+	decoder := json.NewDecoder(reader)
+	token, err := decoder.Token()
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("malformed JSON file: %w", err)
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return fmt.Errorf("malformed JSON file: expected an array of keys")
+	}
+
+	for item := 1; decoder.More(); item++ {
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			return fmt.Errorf("malformed JSON file at item %d: %w", item, err)
+		}
+		if err := p.addJSONValue(item, raw); err != nil {
+			return err
+		}
+	}
+	if _, err := decoder.Token(); err != nil {
+		return fmt.Errorf("malformed JSON file: %w", err)
+	}
+	return nil
+}
+
+// parseJSONL reads one key or key object per line.
+func (p *keyFileParser) parseJSONL(reader io.Reader) error {
+	scanner := newKeyFileScanner(reader)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := bytes.TrimSpace(bytes.TrimPrefix(scanner.Bytes(), []byte("\xef\xbb\xbf")))
+		if len(text) == 0 {
+			continue
+		}
+		if err := p.addJSONValue(line, text); err != nil {
+			return err
+		}
+	}
+	return keyFileScanError(scanner.Err(), line)
+}
+
+// addJSONValue adds a key given as a JSON string or as an object with the key and its metadata.
+func (p *keyFileParser) addJSONValue(line int, raw json.RawMessage) error {
+	var keyValue string
+	if json.Unmarshal(raw, &keyValue) == nil {
+		return p.add(line, models.APIKey{KeyValue: strings.TrimSpace(keyValue)})
+	}
+
+	var record keyFileRecord
+	if err := json.Unmarshal(raw, &record); err != nil {
+		p.reject(line, "", "malformed JSON value: "+err.Error())
+		return nil
+	}
+
+	key := models.APIKey{
+		KeyValue: strings.TrimSpace(firstNonEmpty(record.Key, record.KeyValue, record.APIKey)),
+		Note:     strings.TrimSpace(record.Note),
+		Owner:    strings.TrimSpace(record.Owner),
+	}
+	labels, err := parseKeyFileLabels(record.Labels)
+	if err != nil {
+		p.reject(line, key.KeyValue, err.Error())
+		return nil
+	}
+	key.Labels = labels
+
+	weight := strings.Trim(strings.TrimSpace(string(record.Weight)), `"`)
+	if weight == "null" {
+		weight = ""
+	}
+	if err := p.applyWeight(&key, weight); err != nil {
+		p.reject(line, key.KeyValue, err.Error())
+		return nil
+	}
+	if err := p.applyExpiresAt(&key, record.ExpiresAt); err != nil {
+		p.reject(line, key.KeyValue, err.Error())
+		return nil
+	}
+	return p.add(line, key)
+}
+
+// parseKeyFileLabels accepts labels as an array of strings or as a comma-separated string.
+func parseKeyFileLabels(raw json.RawMessage) (string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return "", nil
+	}
+	var labels string
+	if json.Unmarshal(raw, &labels) == nil {
+		return NormalizeLabels(labels), nil
+	}
+	var labelList []string
+	if err := json.Unmarshal(raw, &labelList); err != nil {
+		return "", fmt.Errorf("labels must be a string or an array of strings")
+	}
+	return NormalizeLabels(strings.Join(labelList, ",")), nil
+}
+
+// applyWeight sets the weight of the key, keeping the default weight when the value is empty.
+func (p *keyFileParser) applyWeight(key *models.APIKey, value string) error {
+	if value == "" {
+		return nil
+	}
+	weight, err := strconv.Atoi(value)
+	if err != nil || weight < models.MinKeyWeight || weight > models.MaxKeyWeight {
+		return fmt.Errorf("weight must be an integer between %d and %d", models.MinKeyWeight, models.MaxKeyWeight)
+	}
+	key.Weight = weight
+	return nil
+}
+
+// applyExpiresAt sets the expiry of the key from an RFC 3339 time, a date or a Unix timestamp.
+func (p *keyFileParser) applyExpiresAt(key *models.APIKey, value string) error {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil
+	}
+
+	var expiresAt time.Time
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		expiresAt = t
+	} else if t, err := time.ParseInLocation(time.DateTime, value, time.Local); err == nil {
+		expiresAt = t
+	} else if t, err := time.ParseInLocation(time.DateOnly, value, time.Local); err == nil {
+		expiresAt = t
+	} else if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		expiresAt = time.Unix(seconds, 0)
+	} else {
+		return fmt.Errorf("invalid expires_at %q, expected an RFC 3339 time, a date or a Unix timestamp", value)
+	}
+
+	if !expiresAt.After(p.now) {
+		return fmt.Errorf("the key already expired at %s", expiresAt.Format(time.RFC3339))
+	}
+	key.ExpiresAt = &expiresAt
+	return nil
+}
+
+// add checks a key and adds it to the entries, or records why it was rejected.
+func (p *keyFileParser) add(line int, key models.APIKey) error {
+	switch {
+	case key.KeyValue == "":
+		p.reject(line, "", "missing key")
+		return nil
+	case !p.keyService.isValidKeyFormat(key.KeyValue):
+		p.reject(line, key.KeyValue, "invalid key format")
+		return nil
+	}
+	if p.checkFormat {
+		if err := channel.CheckKeyFormat(p.channelType, key.KeyValue); err != nil {
+			p.reject(line, key.KeyValue, err.Error())
+			return nil
+		}
+	}
+
+	if len(p.result.Entries) >= maxKeyFileEntries {
+		return ErrTooManyKeyFileKeys
+	}
+	if key.Weight == 0 {
+		key.Weight = models.MinKeyWeight
+	}
+	key.Status = models.KeyStatusActive
+	p.result.Entries = append(p.result.Entries, KeyFileEntry{Line: line, Key: key})
+	return nil
+}
+
+// reject records a line that is not imported, with the key masked.
+func (p *keyFileParser) reject(line int, key, reason string) {
+	p.result.Rejected = append(p.result.Rejected, KeyImportRejection{Line: line, Key: maskImportKey(key), Reason: reason})
+}
+
+// maskImportKey masks a key for the import report, keeping its first and last characters.
+func maskImportKey(key string) string {
+	if len(key) <= 8 {
+		return strings.Repeat("*", len(key))
+	}
+	return key[:4] + "..." + key[len(key)-4:]
+}
+
+func newKeyFileScanner(reader io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), maxKeyFileLineSize)
+	return scanner
+}
+
+func keyFileScanError(err error, line int) error {
+	if errors.Is(err, bufio.ErrTooLong) {
+		return fmt.Errorf("line %d is longer than %d bytes", line+1, maxKeyFileLineSize)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read the file: %w", err)
+	}
+	return nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
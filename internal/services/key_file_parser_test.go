@@ -0,0 +1,226 @@
+package services
+
+import (
+	"bufio"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"gpt-load/internal/models"
+)
+
+func parseKeyFile(t *testing.T, content, filename, format string) *KeyFileParseResult {
+	t.Helper()
+	result, err := (&KeyService{}).ParseKeyFile(strings.NewReader(content), filename, format, "openai", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func entryKeys(result *KeyFileParseResult) []string {
+	keys := make([]string, 0, len(result.Entries))
+	for _, entry := range result.Entries {
+		keys = append(keys, entry.Key.KeyValue)
+	}
+	return keys
+}
+
+func TestDetectKeyFileFormat(t *testing.T) {
+	tests := []struct {
+		filename string
+		content  string
+		want     string
+	}{
+		{"keys.csv", "key-1", KeyFileFormatCSV},
+		{"keys.JSON", "key-1", KeyFileFormatJSON},
+		{"keys.ndjson", "key-1", KeyFileFormatJSONL},
+		{"keys", "", KeyFileFormatTXT},
+		{"keys", "\xef\xbb\xbf [\"key-1\"]", KeyFileFormatJSON},
+		{"keys", "{\"key\":\"key-1\"}\n", KeyFileFormatJSONL},
+		{"keys", "key,labels,weight\nkey-1,a,2\n", KeyFileFormatCSV},
+		{"keys", "key-1, key-2\n", KeyFileFormatTXT},
+		{"keys", "key-1\nkey-2\n", KeyFileFormatTXT},
+	}
+	for _, tt := range tests {
+		reader := bufio.NewReaderSize(strings.NewReader(tt.content), keyFileSniffSize)
+		if got := detectKeyFileFormat(reader, tt.filename); got != tt.want {
+			t.Errorf("detectKeyFileFormat(%q, %q) = %q, want %q", tt.filename, tt.content, got, tt.want)
+		}
+	}
+}
+
+func TestParseKeyFileUnknownFormat(t *testing.T) {
+	_, err := (&KeyService{}).ParseKeyFile(strings.NewReader("key-1"), "keys.txt", "xml", "openai", false)
+	if !errors.Is(err, ErrUnknownKeyFileFormat) {
+		t.Errorf("err = %v, want ErrUnknownKeyFileFormat", err)
+	}
+}
+
+func TestParseKeyFileTXT(t *testing.T) {
+	result := parseKeyFile(t, "# comment\nkey-0001 key-0002,key-0003\n\n key-0004;key-0005|key-0006\nkey 0007\n", "keys.txt", "")
+
+	want := []string{"key-0001", "key-0002", "key-0003", "key-0004", "key-0005", "key-0006", "0007"}
+	if got := entryKeys(result); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("keys = %v, want %v", got, want)
+	}
+	if len(result.Rejected) != 1 || result.Rejected[0].Line != 5 || result.Rejected[0].Reason != "invalid key format" {
+		t.Errorf("rejected = %+v, want the too short key of line 5", result.Rejected)
+	}
+	for _, entry := range result.Entries {
+		if entry.Key.Weight != models.MinKeyWeight || entry.Key.Status != models.KeyStatusActive {
+			t.Errorf("entry %+v should be active with the default weight", entry.Key)
+		}
+	}
+}
+
+func TestParseKeyFileCSV(t *testing.T) {
+	future := time.Now().Add(24 * time.Hour).UTC().Format(time.RFC3339)
+	content := strings.Join([]string{
+		"key-0001,prod;team-a,5," + future,
+		"key-0002",
+		"# comment",
+		"key-0003,,abc",
+		"key-0004,,200",
+		"key-0005,,,2000-01-01",
+		"key-0006,,,tomorrow",
+		`"key-0007,broken`,
+	}, "\n")
+	result := parseKeyFile(t, content, "keys.csv", "")
+
+	if got := entryKeys(result); strings.Join(got, " ") != "key-0001 key-0002" {
+		t.Fatalf("keys = %v, want key-0001 and key-0002", got)
+	}
+	first := result.Entries[0].Key
+	if first.Labels != "prod,team-a" || first.Weight != 5 || first.ExpiresAt == nil || first.ExpiresAt.UTC().Format(time.RFC3339) != future {
+		t.Errorf("first key = %+v, want its labels, weight and expiry", first)
+	}
+
+	wantLines := []int{4, 5, 6, 7, 8}
+	if len(result.Rejected) != len(wantLines) {
+		t.Fatalf("rejected = %+v, want lines %v", result.Rejected, wantLines)
+	}
+	for i, rejection := range result.Rejected {
+		if rejection.Line != wantLines[i] {
+			t.Errorf("rejection %d is at line %d, want %d", i, rejection.Line, wantLines[i])
+		}
+	}
+	if !strings.Contains(result.Rejected[2].Reason, "already expired") {
+		t.Errorf("reason = %q, want the key reported as expired", result.Rejected[2].Reason)
+	}
+}
+
+func TestParseKeyFileCSVHeader(t *testing.T) {
+	content := "\ufeffNote,API_Key,Owner,Weight\nbackup key,key-0001,alice,3\n"
+	result := parseKeyFile(t, content, "keys.csv", "")
+
+	if len(result.Entries) != 1 || len(result.Rejected) != 0 {
+		t.Fatalf("entries = %+v, rejected = %+v, want one key", result.Entries, result.Rejected)
+	}
+	key := result.Entries[0].Key
+	if key.KeyValue != "key-0001" || key.Note != "backup key" || key.Owner != "alice" || key.Weight != 3 {
+		t.Errorf("key = %+v, want the columns named by the header", key)
+	}
+	if result.Entries[0].Line != 2 {
+		t.Errorf("line = %d, want 2", result.Entries[0].Line)
+	}
+}
+
+func TestParseKeyFileJSON(t *testing.T) {
+	content := `[
+		"key-0001",
+		{"api_key": "key-0002", "labels": ["prod", "team-a", "prod"], "weight": "7", "note": "main"},
+		{"key_value": "key-0003", "labels": "a, b", "weight": null},
+		{"key": "key-0004", "labels": 1},
+		{"key": "key-0005", "weight": 0},
+		{"note": "no key"},
+		42
+	]`
+	result := parseKeyFile(t, content, "", "")
+
+	if result.Format != KeyFileFormatJSON {
+		t.Errorf("format = %q, want json", result.Format)
+	}
+	if got := entryKeys(result); strings.Join(got, " ") != "key-0001 key-0002 key-0003" {
+		t.Fatalf("keys = %v, want key-0001 to key-0003", got)
+	}
+	second := result.Entries[1].Key
+	if second.Labels != "prod,team-a" || second.Weight != 7 || second.Note != "main" {
+		t.Errorf("second key = %+v, want its labels, weight and note", second)
+	}
+	if third := result.Entries[2].Key; third.Labels != "a,b" || third.Weight != models.MinKeyWeight {
+		t.Errorf("third key = %+v, want labels a,b and the default weight", third)
+	}
+
+	wantReasons := []string{"labels must be", "weight must be", "missing key", "malformed JSON value"}
+	if len(result.Rejected) != len(wantReasons) {
+		t.Fatalf("rejected = %+v, want %d rejections", result.Rejected, len(wantReasons))
+	}
+	for i, rejection := range result.Rejected {
+		if rejection.Line != i+4 || !strings.HasPrefix(rejection.Reason, wantReasons[i]) {
+			t.Errorf("rejection %d = %+v, want item %d rejected with %q", i, rejection, i+4, wantReasons[i])
+		}
+	}
+}
+
+func TestParseKeyFileMalformedJSON(t *testing.T) {
+	for _, content := range []string{`{"key": "key-0001"}`, `["key-0001"`, `["key-0001" "key-0002"]`} {
+		if _, err := (&KeyService{}).ParseKeyFile(strings.NewReader(content), "keys.json", "", "openai", false); err == nil {
+			t.Errorf("%s: expected an error", content)
+		}
+	}
+}
+
+func TestParseKeyFileJSONL(t *testing.T) {
+	content := "\"key-0001\"\n\n{\"key\": \"key-0002\", \"owner\": \"bob\"}\nnot json\n"
+	result := parseKeyFile(t, content, "keys.jsonl", "")
+
+	if got := entryKeys(result); strings.Join(got, " ") != "key-0001 key-0002" {
+		t.Fatalf("keys = %v, want key-0001 and key-0002", got)
+	}
+	if result.Entries[1].Line != 3 || result.Entries[1].Key.Owner != "bob" {
+		t.Errorf("second entry = %+v, want line 3 owned by bob", result.Entries[1])
+	}
+	if len(result.Rejected) != 1 || result.Rejected[0].Line != 4 {
+		t.Errorf("rejected = %+v, want line 4", result.Rejected)
+	}
+}
+
+func TestParseKeyFileCheckFormat(t *testing.T) {
+	anthropicKey := "sk-ant-" + strings.Repeat("a", 24)
+	content := "sk-" + strings.Repeat("b", 24) + "\n" + anthropicKey + "\ncustom-key-0001\n"
+
+	result, err := (&KeyService{}).ParseKeyFile(strings.NewReader(content), "keys.txt", "", "openai", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Entries) != 2 {
+		t.Errorf("entries = %v, want the OpenAI key and the key in an unknown format", entryKeys(result))
+	}
+	if len(result.Rejected) != 1 || result.Rejected[0].Line != 2 || result.Rejected[0].Key == anthropicKey {
+		t.Errorf("rejected = %+v, want the masked Anthropic key of line 2", result.Rejected)
+	}
+
+	result, err = (&KeyService{}).ParseKeyFile(strings.NewReader(content), "keys.txt", "", "openai", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Entries) != 3 {
+		t.Errorf("entries = %v, want all keys when the format check is off", entryKeys(result))
+	}
+}
+
+func TestMaskImportKey(t *testing.T) {
+	tests := map[string]string{
+		"":                 "",
+		"short":            "*****",
+		"12345678":         "********",
+		"sk-abcdefghijkl9": "sk-a...jkl9",
+	}
+	for key, want := range tests {
+		if got := maskImportKey(key); got != want {
+			t.Errorf("maskImportKey(%q) = %q, want %q", key, got, want)
+		}
+	}
+}
@@ -1,8 +1,12 @@
 package services
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"gpt-load/internal/models"
+	"slices"
+	"sync"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -11,14 +15,44 @@ import (
 const (
 	importChunkSize = 1000
 	importTimeout   = 30 * time.Minute
+	// maxImportRejections limits the number of rejected lines kept in the result of a file import.
+	maxImportRejections = 1000
 )
 
+// errImportSkipped marks a key whose validation was skipped because the task stopped.
+var errImportSkipped = errors.New("skipped")
+
 // KeyImportResult holds the result of an import task.
 type KeyImportResult struct {
 	AddedCount   int `json:"added_count"`
 	IgnoredCount int `json:"ignored_count"`
 }
 
+// KeyFileImportOptions controls the import of the keys of an uploaded file.
+type KeyFileImportOptions struct {
+	// Validate checks each key against the upstream before adding it, keys that fail are rejected.
+	Validate bool
+}
+
+// KeyFileImportResult holds the result of a file import task.
+// Rejected lists at most maxImportRejections lines, RejectedCount counts all of them.
+type KeyFileImportResult struct {
+	Format            string               `json:"format"`
+	AddedCount        int                  `json:"added_count"`
+	RejectedCount     int                  `json:"rejected_count"`
+	Rejected          []KeyImportRejection `json:"rejected"`
+	RejectedTruncated bool                 `json:"rejected_truncated,omitempty"`
+}
+
+func (r *KeyFileImportResult) reject(rejection KeyImportRejection) {
+	r.RejectedCount++
+	if len(r.Rejected) < maxImportRejections {
+		r.Rejected = append(r.Rejected, rejection)
+	} else {
+		r.RejectedTruncated = true
+	}
+}
+
 // KeyImportService handles the asynchronous import of a large number of keys.
 type KeyImportService struct {
 	TaskService *TaskService
@@ -40,37 +74,166 @@ func (s *KeyImportService) StartImportTask(group *models.Group, keysText string)
 		return nil, fmt.Errorf("no valid keys found in the input text")
 	}
 
-	initialStatus, err := s.TaskService.StartTask(TaskTypeKeyImport, group.Name, len(keys), importTimeout)
+	run, initialStatus, err := s.TaskService.StartTask(TaskTypeKeyImport, group, len(keys), importTimeout)
 	if err != nil {
 		return nil, err
 	}
 
-	go s.runImport(group, keys)
+	go s.runImport(run, group, keys)
 
 	return initialStatus, nil
 }
 
-func (s *KeyImportService) runImport(group *models.Group, keys []string) {
+func (s *KeyImportService) runImport(run *TaskRun, group *models.Group, keys []string) {
 	progressCallback := func(processed int) {
-		if err := s.TaskService.UpdateProgress(processed); err != nil {
+		if err := run.UpdateProgress(processed); err != nil {
 			logrus.Warnf("Failed to update task progress for group %d: %v", group.ID, err)
 		}
 	}
 
-	addedCount, ignoredCount, err := s.KeyService.processAndCreateKeys(group.ID, keys, progressCallback)
+	addedCount, ignoredCount, err := s.KeyService.processAndCreateKeys(run.Context(), group.KeyOwner(), keys, progressCallback)
+	result := KeyImportResult{
+		AddedCount:   addedCount,
+		IgnoredCount: ignoredCount,
+	}
+
+	if endErr := run.End(result, err); endErr != nil {
+		logrus.Errorf("Failed to end task %d for group %d: %v (task error: %v)", run.ID, group.ID, endErr, err)
+	}
+}
+
+// StartFileImportTask initiates an asynchronous import of the keys read from an uploaded file.
+// The lines rejected while parsing the file are reported in the result of the task.
+func (s *KeyImportService) StartFileImportTask(group *models.Group, parsed *KeyFileParseResult, opts KeyFileImportOptions) (*TaskStatus, error) {
+	run, initialStatus, err := s.TaskService.StartTask(TaskTypeKeyImport, group, len(parsed.Entries), importTimeout)
 	if err != nil {
-		if endErr := s.TaskService.EndTask(nil, err); endErr != nil {
-			logrus.Errorf("Failed to end task with error for group %d: %v (original error: %v)", group.ID, endErr, err)
+		return nil, err
+	}
+
+	go s.runFileImport(run, group, parsed, opts)
+
+	return initialStatus, nil
+}
+
+func (s *KeyImportService) runFileImport(run *TaskRun, group *models.Group, parsed *KeyFileParseResult, opts KeyFileImportOptions) {
+	result := &KeyFileImportResult{Format: parsed.Format, Rejected: []KeyImportRejection{}}
+	for _, rejection := range parsed.Rejected {
+		result.reject(rejection)
+	}
+
+	err := s.importEntries(run, group, parsed.Entries, opts, result)
+	slices.SortStableFunc(result.Rejected, func(a, b KeyImportRejection) int { return a.Line - b.Line })
+	if err != nil && run.Context().Err() == nil {
+		logrus.WithFields(logrus.Fields{"group": group.Name, "error": err}).Error("Key file import failed")
+	}
+	if endErr := run.End(result, err); endErr != nil {
+		logrus.Errorf("Failed to end task %d for group %d: %v (task error: %v)", run.ID, group.ID, endErr, err)
+	}
+}
+
+// importEntries adds the keys of a file in chunks, rejecting duplicates and, when requested, the keys that fail validation.
+// It stops between chunks when the task is cancelled, keeping the keys added so far.
+func (s *KeyImportService) importEntries(run *TaskRun, group *models.Group, entries []KeyFileEntry, opts KeyFileImportOptions, result *KeyFileImportResult) error {
+	var existingHashes []string
+	if err := s.KeyService.DB.Model(&models.APIKey{}).Scopes(group.KeyOwner().Scope).Pluck("key_hash", &existingHashes).Error; err != nil {
+		return err
+	}
+	existing := make(map[string]bool, len(existingHashes))
+	for _, hash := range existingHashes {
+		existing[hash] = true
+	}
+
+	// 先剔除文件内重复和分组中已存在的 Key
+	processed := 0
+	seen := make(map[string]int, len(entries))
+	candidates := make([]KeyFileEntry, 0, len(entries))
+	for _, entry := range entries {
+		if line, ok := seen[entry.Key.KeyValue]; ok {
+			result.reject(KeyImportRejection{Line: entry.Line, Key: maskImportKey(entry.Key.KeyValue), Reason: fmt.Sprintf("duplicate of line %d", line)})
+			processed++
+			continue
+		}
+		seen[entry.Key.KeyValue] = entry.Line
+		if existing[s.KeyService.EncryptionService.Hash(entry.Key.KeyValue)] {
+			result.reject(KeyImportRejection{Line: entry.Line, Key: maskImportKey(entry.Key.KeyValue), Reason: "the key already exists in the group"})
+			processed++
+			continue
 		}
-		return
+		candidates = append(candidates, entry)
 	}
 
-	result := KeyImportResult{
-		AddedCount:   addedCount,
-		IgnoredCount: ignoredCount,
+	ctx := run.Context()
+	for i := 0; i < len(candidates); i += importChunkSize {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		chunk := candidates[i:min(i+importChunkSize, len(candidates))]
+
+		var validationErrs []error
+		if opts.Validate {
+			validationErrs = s.validateEntries(ctx, group, chunk)
+		}
+
+		keys := make([]models.APIKey, 0, len(chunk))
+		for j, entry := range chunk {
+			if validationErrs != nil && validationErrs[j] != nil {
+				if errors.Is(validationErrs[j], errImportSkipped) {
+					continue
+				}
+				result.reject(KeyImportRejection{Line: entry.Line, Key: maskImportKey(entry.Key.KeyValue), Reason: "validation failed: " + validationErrs[j].Error()})
+				processed++
+				continue
+			}
+			keys = append(keys, entry.Key)
+		}
+
+		if err := s.KeyService.KeyProvider.AddKeys(group.KeyOwner(), keys); err != nil {
+			return err
+		}
+		result.AddedCount += len(keys)
+		processed += len(keys)
+
+		if err := run.UpdateProgress(processed); err != nil {
+			logrus.Warnf("Failed to update task progress for group %d: %v", group.ID, err)
+		}
+	}
+
+	return ctx.Err()
+}
+
+// validateEntries validates the keys with the concurrency of the group and returns the error of each key, nil when valid.
+// When the context is done, the remaining keys are skipped with errImportSkipped.
+func (s *KeyImportService) validateEntries(ctx context.Context, group *models.Group, entries []KeyFileEntry) []error {
+	errs := make([]error, len(entries))
+	jobs := make(chan int, len(entries))
+	for i := range entries {
+		jobs <- i
 	}
+	close(jobs)
 
-	if endErr := s.TaskService.EndTask(result, nil); endErr != nil {
-		logrus.Errorf("Failed to end task with success result for group %d: %v", group.ID, endErr)
+	var wg sync.WaitGroup
+	for range max(group.EffectiveConfig.KeyValidationConcurrency, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if ctx.Err() != nil {
+					errs[i] = errImportSkipped
+					continue
+				}
+				isValid, err := s.KeyService.KeyValidator.CheckKey(ctx, &entries[i].Key, group)
+				switch {
+				case ctx.Err() != nil:
+					errs[i] = errImportSkipped
+				case !isValid && err == nil:
+					errs[i] = errors.New("the key was rejected by the upstream")
+				case !isValid:
+					errs[i] = err
+				}
+			}
+		}()
 	}
+	wg.Wait()
+
+	return errs
 }
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"fmt"
 	"gpt-load/internal/config"
 	"gpt-load/internal/keypool"
@@ -42,33 +43,52 @@ func NewKeyManualValidationService(db *gorm.DB, validator *keypool.KeyValidator,
 
 // StartValidationTask starts a new manual validation task for a given group.
 func (s *KeyManualValidationService) StartValidationTask(group *models.Group, status string) (*TaskStatus, error) {
-	var keys []models.APIKey
-	query := s.DB.Where("group_id = ?", group.ID)
-	if status != "" {
-		query = query.Where("status = ?", status)
-	}
-	if err := query.Find(&keys).Error; err != nil {
-		return nil, fmt.Errorf("failed to get keys for group %s with status '%s': %w", group.Name, status, err)
-	}
-
-	if len(keys) == 0 {
-		return nil, fmt.Errorf("no keys to validate in group %s", group.Name)
+	keys, err := s.findKeys(group, status)
+	if err != nil {
+		return nil, err
 	}
 
 	timeout := 30 * time.Minute
 
-	taskStatus, err := s.TaskService.StartTask(TaskTypeKeyValidation, group.Name, len(keys), timeout)
+	run, taskStatus, err := s.TaskService.StartTask(TaskTypeKeyValidation, group, len(keys), timeout)
 	if err != nil {
 		return nil, err
 	}
 
 	// Run the validation in a separate goroutine
-	go s.runValidation(group, keys, status)
+	go s.runValidation(run, group, keys, status)
 
 	return taskStatus, nil
 }
 
-func (s *KeyManualValidationService) runValidation(group *models.Group, keys []models.APIKey, status string) {
+// ValidateKeys validates the keys of a group with the given status (all keys when empty) and waits for the result.
+// progress, when set, is called at most once per second with the number of validated keys.
+func (s *KeyManualValidationService) ValidateKeys(group *models.Group, status string, progress func(processed int)) (*ManualValidationResult, error) {
+	keys, err := s.findKeys(group, status)
+	if err != nil {
+		return nil, err
+	}
+	result := s.validate(context.Background(), group, keys, progress)
+	return &result, nil
+}
+
+func (s *KeyManualValidationService) findKeys(group *models.Group, status string) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	query := s.DB.Scopes(group.KeyOwner().Scope)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err := query.Find(&keys).Error; err != nil {
+		return nil, fmt.Errorf("failed to get keys for group %s with status '%s': %w", group.Name, status, err)
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no keys to validate in group %s", group.Name)
+	}
+	return keys, nil
+}
+
+func (s *KeyManualValidationService) runValidation(run *TaskRun, group *models.Group, keys []models.APIKey, status string) {
 	logFields := logrus.Fields{
 		"group":  group.Name,
 		"status": status,
@@ -78,6 +98,22 @@ func (s *KeyManualValidationService) runValidation(group *models.Group, keys []m
 	}
 	logrus.WithFields(logFields).Info("Starting manual validation")
 
+	result := s.validate(run.Context(), group, keys, func(processed int) {
+		if err := run.UpdateProgress(processed); err != nil {
+			logrus.Warnf("Failed to update task progress: %v", err)
+		}
+	})
+
+	// End the task and store the final result
+	if err := run.End(result, nil); err != nil {
+		logrus.Errorf("Failed to end task for group %s: %v", group.Name, err)
+	}
+	logrus.Infof("Manual validation finished for group %s: %+v", group.Name, result)
+}
+
+// validate runs the validation of the keys with the concurrency of the group.
+// When the context is done, the remaining keys are skipped and the result covers the validated keys.
+func (s *KeyManualValidationService) validate(ctx context.Context, group *models.Group, keys []models.APIKey, progress func(processed int)) ManualValidationResult {
 	jobs := make(chan models.APIKey, len(keys))
 	results := make(chan bool, len(keys))
 
@@ -86,7 +122,7 @@ func (s *KeyManualValidationService) runValidation(group *models.Group, keys []m
 	var wg sync.WaitGroup
 	for range concurrency {
 		wg.Add(1)
-		go s.validationWorker(&wg, group, jobs, results)
+		go s.validationWorker(ctx, &wg, group, jobs, results)
 	}
 
 	for _, key := range keys {
@@ -110,37 +146,32 @@ func (s *KeyManualValidationService) runValidation(group *models.Group, keys []m
 		}
 
 		// Throttle progress updates to once per second
-		if time.Since(lastUpdateTime) > time.Second {
-			if err := s.TaskService.UpdateProgress(processedCount); err != nil {
-				logrus.Warnf("Failed to update task progress: %v", err)
-			}
+		if progress != nil && time.Since(lastUpdateTime) > time.Second {
+			progress(processedCount)
 			lastUpdateTime = time.Now()
 		}
 	}
 
 	// Ensure the final progress is always updated
-	if err := s.TaskService.UpdateProgress(processedCount); err != nil {
-		logrus.Warnf("Failed to update final task progress: %v", err)
+	if progress != nil {
+		progress(processedCount)
 	}
 
-	result := ManualValidationResult{
-		TotalKeys:   len(keys),
+	return ManualValidationResult{
+		TotalKeys:   processedCount,
 		ValidKeys:   validCount,
-		InvalidKeys: len(keys) - validCount,
+		InvalidKeys: processedCount - validCount,
 	}
-
-	// End the task and store the final result
-	if err := s.TaskService.EndTask(result, nil); err != nil {
-		logrus.Errorf("Failed to end task for group %s: %v", group.Name, err)
-	}
-	logrus.Infof("Manual validation finished for group %s: %+v", group.Name, result)
 }
 
 // validationResult 包含验证结果信息
-func (s *KeyManualValidationService) validationWorker(wg *sync.WaitGroup, group *models.Group, jobs <-chan models.APIKey, results chan<- bool) {
+func (s *KeyManualValidationService) validationWorker(ctx context.Context, wg *sync.WaitGroup, group *models.Group, jobs <-chan models.APIKey, results chan<- bool) {
 	defer wg.Done()
 	for key := range jobs {
-		isValid, _ := s.Validator.ValidateSingleKey(&key, group)
+		if ctx.Err() != nil {
+			continue
+		}
+		isValid, _ := s.Validator.ValidateSingleKey(&key, group, models.KeyEventSourceManual)
 		results <- isValid
 	}
 }
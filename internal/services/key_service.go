@@ -1,14 +1,23 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"gpt-load/internal/encryption"
 	"gpt-load/internal/keypool"
 	"gpt-load/internal/models"
+	"gpt-load/internal/utils"
 	"io"
+	"net/http"
+	"net/url"
 	"regexp"
+	"slices"
 	"strings"
+	"time"
 
+	"gorm.io/datatypes"
 	"gorm.io/gorm"
 )
 
@@ -38,25 +47,80 @@ type RestoreKeysResult struct {
 	TotalInGroup  int64 `json:"total_in_group"`
 }
 
+// ErrInvalidKeyMetadata is returned when a key metadata update fails validation.
+var ErrInvalidKeyMetadata = errors.New("invalid key metadata")
+
+// UpdateKeysMetadataResult holds the result of updating the metadata of multiple keys.
+type UpdateKeysMetadataResult struct {
+	UpdatedCount int `json:"updated_count"`
+	IgnoredCount int `json:"ignored_count"`
+}
+
+// KeyMetadataUpdate holds the metadata to set on multiple keys. Nil fields are left unchanged.
+type KeyMetadataUpdate struct {
+	Labels         *string              `json:"labels"`
+	Note           *string              `json:"note"`
+	Owner          *string              `json:"owner"`
+	ExpiresAt      *time.Time           `json:"expires_at"`
+	ClearExpiresAt bool                 `json:"clear_expires_at"`
+	Weight         *int                 `json:"weight"`
+	HeaderRules    *[]models.HeaderRule `json:"header_rules"`
+	UpstreamURL    *string              `json:"upstream_url"`
+	ProxyURL       *string              `json:"proxy_url"`
+}
+
+// ErrInvalidKeyTransfer is returned when a key transfer request fails validation.
+var ErrInvalidKeyTransfer = errors.New("invalid key transfer")
+
+// KeyTransferOptions selects the keys to transfer from one group to another and how to transfer them.
+type KeyTransferOptions struct {
+	// Mode is move or copy.
+	Mode string `json:"mode"`
+	// OnConflict is the policy for keys already in the target group: skip (default), keep_target or overwrite.
+	OnConflict string `json:"on_conflict"`
+	// KeysText lists the keys to transfer. When empty, all keys with Status are transferred.
+	KeysText string `json:"keys_text"`
+	// Status is active, invalid or all, used when KeysText is empty.
+	Status string `json:"status"`
+}
+
+// KeyTransferResult holds the result of transferring keys between groups.
+type KeyTransferResult struct {
+	keypool.KeyTransferResult
+	IgnoredCount int `json:"ignored_count"`
+}
+
+// KeyListFilter holds the optional filters for listing keys in a group.
+type KeyListFilter struct {
+	Status        string
+	KeyValue      string
+	Label         string
+	Owner         string
+	Note          string
+	ExpiresBefore *time.Time
+}
+
 // KeyService provides services related to API keys.
 type KeyService struct {
-	DB           *gorm.DB
-	KeyProvider  *keypool.KeyProvider
-	KeyValidator *keypool.KeyValidator
+	DB                *gorm.DB
+	KeyProvider       *keypool.KeyProvider
+	KeyValidator      *keypool.KeyValidator
+	EncryptionService *encryption.Service
 }
 
 // NewKeyService creates a new KeyService.
-func NewKeyService(db *gorm.DB, keyProvider *keypool.KeyProvider, keyValidator *keypool.KeyValidator) *KeyService {
+func NewKeyService(db *gorm.DB, keyProvider *keypool.KeyProvider, keyValidator *keypool.KeyValidator, encryptionService *encryption.Service) *KeyService {
 	return &KeyService{
-		DB:           db,
-		KeyProvider:  keyProvider,
-		KeyValidator: keyValidator,
+		DB:                db,
+		KeyProvider:       keyProvider,
+		KeyValidator:      keyValidator,
+		EncryptionService: encryptionService,
 	}
 }
 
 // AddMultipleKeys handles the business logic of creating new keys from a text block.
 // deprecated: use KeyImportService for large imports
-func (s *KeyService) AddMultipleKeys(groupID uint, keysText string) (*AddKeysResult, error) {
+func (s *KeyService) AddMultipleKeys(owner models.KeyOwner, keysText string) (*AddKeysResult, error) {
 	keys := s.ParseKeysFromText(keysText)
 	if len(keys) > maxRequestKeys {
 		return nil, fmt.Errorf("batch size exceeds the limit of %d keys, got %d", maxRequestKeys, len(keys))
@@ -65,13 +129,13 @@ func (s *KeyService) AddMultipleKeys(groupID uint, keysText string) (*AddKeysRes
 		return nil, fmt.Errorf("no valid keys found in the input text")
 	}
 
-	addedCount, ignoredCount, err := s.processAndCreateKeys(groupID, keys, nil)
+	addedCount, ignoredCount, err := s.processAndCreateKeys(context.Background(), owner, keys, nil)
 	if err != nil {
 		return nil, err
 	}
 
 	var totalInGroup int64
-	if err := s.DB.Model(&models.APIKey{}).Where("group_id = ?", groupID).Count(&totalInGroup).Error; err != nil {
+	if err := s.DB.Model(&models.APIKey{}).Scopes(owner.Scope).Count(&totalInGroup).Error; err != nil {
 		return nil, err
 	}
 
@@ -82,56 +146,85 @@ func (s *KeyService) AddMultipleKeys(groupID uint, keysText string) (*AddKeysRes
 	}, nil
 }
 
+// AddKeys adds a list of keys to a group without the batch size limit of AddMultipleKeys.
+// Duplicate and malformed keys are skipped. It returns the number of added keys.
+func (s *KeyService) AddKeys(owner models.KeyOwner, keys []string) (int, error) {
+	addedCount, _, err := s.processAndCreateKeys(context.Background(), owner, keys, nil)
+	return addedCount, err
+}
+
+// DeleteKeys removes a list of keys from a group without the batch size limit of DeleteMultipleKeys.
+// It returns the number of deleted keys.
+func (s *KeyService) DeleteKeys(owner models.KeyOwner, keys []string) (int64, error) {
+	var totalDeletedCount int64
+	for i := 0; i < len(keys); i += chunkSize {
+		end := min(i+chunkSize, len(keys))
+		deletedCount, err := s.KeyProvider.RemoveKeys(owner, keys[i:end])
+		if err != nil {
+			return totalDeletedCount, err
+		}
+		totalDeletedCount += deletedCount
+	}
+	return totalDeletedCount, nil
+}
+
+// AddKeysInTx adds a list of keys to a group within the transaction of the caller, recording the store
+// updates in changes. Duplicate and malformed keys are skipped. It returns the number of added keys.
+func (s *KeyService) AddKeysInTx(tx *gorm.DB, owner models.KeyOwner, keys []string, changes *keypool.StoreChanges) (int, error) {
+	newKeys, err := s.newKeys(tx, owner, keys)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.KeyProvider.AddKeysInTx(tx, owner, newKeys, changes); err != nil {
+		return 0, err
+	}
+	return len(newKeys), nil
+}
+
+// DeleteKeysInTx removes a list of keys from a group within the transaction of the caller, recording the
+// store updates in changes. It returns the number of deleted keys.
+func (s *KeyService) DeleteKeysInTx(tx *gorm.DB, owner models.KeyOwner, keys []string, changes *keypool.StoreChanges) (int64, error) {
+	var totalDeletedCount int64
+	for i := 0; i < len(keys); i += chunkSize {
+		end := min(i+chunkSize, len(keys))
+		deletedCount, err := s.KeyProvider.RemoveKeysInTx(tx, owner, keys[i:end], changes)
+		if err != nil {
+			return totalDeletedCount, err
+		}
+		totalDeletedCount += deletedCount
+	}
+	return totalDeletedCount, nil
+}
+
 // processAndCreateKeys is the lowest-level reusable function for adding keys.
+// It stops between chunks when the context is done, returning the counts so far.
 func (s *KeyService) processAndCreateKeys(
-	groupID uint,
+	ctx context.Context,
+	owner models.KeyOwner,
 	keys []string,
 	progressCallback func(processed int),
 ) (addedCount int, ignoredCount int, err error) {
-	// 1. Get existing keys in the group for deduplication
-	var existingKeys []models.APIKey
-	if err := s.DB.Where("group_id = ?", groupID).Select("key_value").Find(&existingKeys).Error; err != nil {
+	// 1. Prepare new keys for creation, skipping the keys already in the group
+	newKeysToCreate, err := s.newKeys(s.DB, owner, keys)
+	if err != nil {
 		return 0, 0, err
 	}
-	existingKeyMap := make(map[string]bool)
-	for _, k := range existingKeys {
-		existingKeyMap[k.KeyValue] = true
-	}
-
-	// 2. Prepare new keys for creation
-	var newKeysToCreate []models.APIKey
-	uniqueNewKeys := make(map[string]bool)
-
-	for _, keyVal := range keys {
-		trimmedKey := strings.TrimSpace(keyVal)
-		if trimmedKey == "" {
-			continue
-		}
-		if existingKeyMap[trimmedKey] || uniqueNewKeys[trimmedKey] {
-			continue
-		}
-		if s.isValidKeyFormat(trimmedKey) {
-			uniqueNewKeys[trimmedKey] = true
-			newKeysToCreate = append(newKeysToCreate, models.APIKey{
-				GroupID:  groupID,
-				KeyValue: trimmedKey,
-				Status:   models.KeyStatusActive,
-			})
-		}
-	}
 
 	if len(newKeysToCreate) == 0 {
 		return 0, len(keys), nil
 	}
 
-	// 3. Use KeyProvider to add keys in chunks
+	// 2. Use KeyProvider to add keys in chunks
 	for i := 0; i < len(newKeysToCreate); i += chunkSize {
+		if err := ctx.Err(); err != nil {
+			return addedCount, len(keys) - addedCount, err
+		}
 		end := i + chunkSize
 		if end > len(newKeysToCreate) {
 			end = len(newKeysToCreate)
 		}
 		chunk := newKeysToCreate[i:end]
-		if err := s.KeyProvider.AddKeys(groupID, chunk); err != nil {
+		if err := s.KeyProvider.AddKeys(owner, chunk); err != nil {
 			return addedCount, len(keys) - addedCount, err
 		}
 		addedCount += len(chunk)
@@ -144,6 +237,38 @@ func (s *KeyService) processAndCreateKeys(
 	return addedCount, len(keys) - addedCount, nil
 }
 
+// newKeys returns the well-formed keys of the list that are not in the group yet, deduplicated.
+func (s *KeyService) newKeys(db *gorm.DB, owner models.KeyOwner, keys []string) ([]models.APIKey, error) {
+	var existingHashes []string
+	if err := db.Model(&models.APIKey{}).Scopes(owner.Scope).Pluck("key_hash", &existingHashes).Error; err != nil {
+		return nil, err
+	}
+	existingKeyMap := make(map[string]bool)
+	for _, hash := range existingHashes {
+		existingKeyMap[hash] = true
+	}
+
+	var newKeys []models.APIKey
+	uniqueNewKeys := make(map[string]bool)
+	for _, keyVal := range keys {
+		trimmedKey := strings.TrimSpace(keyVal)
+		if trimmedKey == "" {
+			continue
+		}
+		if existingKeyMap[s.EncryptionService.Hash(trimmedKey)] || uniqueNewKeys[trimmedKey] {
+			continue
+		}
+		if s.isValidKeyFormat(trimmedKey) {
+			uniqueNewKeys[trimmedKey] = true
+			newKeys = append(newKeys, models.APIKey{
+				KeyValue: trimmedKey,
+				Status:   models.KeyStatusActive,
+			})
+		}
+	}
+	return newKeys, nil
+}
+
 // ParseKeysFromText parses a string of keys from various formats into a string slice.
 // This function is exported to be shared with the handler layer.
 func (s *KeyService) ParseKeysFromText(text string) []string {
@@ -196,7 +321,7 @@ func (s *KeyService) isValidKeyFormat(key string) bool {
 }
 
 // RestoreMultipleKeys handles the business logic of restoring keys from a text block.
-func (s *KeyService) RestoreMultipleKeys(groupID uint, keysText string) (*RestoreKeysResult, error) {
+func (s *KeyService) RestoreMultipleKeys(owner models.KeyOwner, keysText string) (*RestoreKeysResult, error) {
 	keysToRestore := s.ParseKeysFromText(keysText)
 	if len(keysToRestore) > maxRequestKeys {
 		return nil, fmt.Errorf("batch size exceeds the limit of %d keys, got %d", maxRequestKeys, len(keysToRestore))
@@ -212,7 +337,7 @@ func (s *KeyService) RestoreMultipleKeys(groupID uint, keysText string) (*Restor
 			end = len(keysToRestore)
 		}
 		chunk := keysToRestore[i:end]
-		restoredCount, err := s.KeyProvider.RestoreMultipleKeys(groupID, chunk)
+		restoredCount, err := s.KeyProvider.RestoreMultipleKeys(owner, chunk)
 		if err != nil {
 			return nil, err
 		}
@@ -222,7 +347,7 @@ func (s *KeyService) RestoreMultipleKeys(groupID uint, keysText string) (*Restor
 	ignoredCount := len(keysToRestore) - int(totalRestoredCount)
 
 	var totalInGroup int64
-	if err := s.DB.Model(&models.APIKey{}).Where("group_id = ?", groupID).Count(&totalInGroup).Error; err != nil {
+	if err := s.DB.Model(&models.APIKey{}).Scopes(owner.Scope).Count(&totalInGroup).Error; err != nil {
 		return nil, err
 	}
 
@@ -234,22 +359,22 @@ func (s *KeyService) RestoreMultipleKeys(groupID uint, keysText string) (*Restor
 }
 
 // RestoreAllInvalidKeys sets the status of all 'inactive' keys in a group to 'active'.
-func (s *KeyService) RestoreAllInvalidKeys(groupID uint) (int64, error) {
-	return s.KeyProvider.RestoreKeys(groupID)
+func (s *KeyService) RestoreAllInvalidKeys(owner models.KeyOwner) (int64, error) {
+	return s.KeyProvider.RestoreKeys(owner)
 }
 
 // ClearAllInvalidKeys deletes all 'inactive' keys from a group.
-func (s *KeyService) ClearAllInvalidKeys(groupID uint) (int64, error) {
-	return s.KeyProvider.RemoveInvalidKeys(groupID)
+func (s *KeyService) ClearAllInvalidKeys(owner models.KeyOwner) (int64, error) {
+	return s.KeyProvider.RemoveInvalidKeys(owner)
 }
 
 // ClearAllKeys deletes all keys from a group.
-func (s *KeyService) ClearAllKeys(groupID uint) (int64, error) {
-	return s.KeyProvider.RemoveAllKeys(groupID)
+func (s *KeyService) ClearAllKeys(owner models.KeyOwner) (int64, error) {
+	return s.KeyProvider.RemoveAllKeys(owner)
 }
 
 // DeleteMultipleKeys handles the business logic of deleting keys from a text block.
-func (s *KeyService) DeleteMultipleKeys(groupID uint, keysText string) (*DeleteKeysResult, error) {
+func (s *KeyService) DeleteMultipleKeys(owner models.KeyOwner, keysText string) (*DeleteKeysResult, error) {
 	keysToDelete := s.ParseKeysFromText(keysText)
 	if len(keysToDelete) > maxRequestKeys {
 		return nil, fmt.Errorf("batch size exceeds the limit of %d keys, got %d", maxRequestKeys, len(keysToDelete))
@@ -265,7 +390,7 @@ func (s *KeyService) DeleteMultipleKeys(groupID uint, keysText string) (*DeleteK
 			end = len(keysToDelete)
 		}
 		chunk := keysToDelete[i:end]
-		deletedCount, err := s.KeyProvider.RemoveKeys(groupID, chunk)
+		deletedCount, err := s.KeyProvider.RemoveKeys(owner, chunk)
 		if err != nil {
 			return nil, err
 		}
@@ -275,7 +400,7 @@ func (s *KeyService) DeleteMultipleKeys(groupID uint, keysText string) (*DeleteK
 	ignoredCount := len(keysToDelete) - int(totalDeletedCount)
 
 	var totalInGroup int64
-	if err := s.DB.Model(&models.APIKey{}).Where("group_id = ?", groupID).Count(&totalInGroup).Error; err != nil {
+	if err := s.DB.Model(&models.APIKey{}).Scopes(owner.Scope).Count(&totalInGroup).Error; err != nil {
 		return nil, err
 	}
 
@@ -286,16 +411,40 @@ func (s *KeyService) DeleteMultipleKeys(groupID uint, keysText string) (*DeleteK
 	}, nil
 }
 
-// ListKeysInGroupQuery builds a query to list all keys within a specific group, filtered by status.
-func (s *KeyService) ListKeysInGroupQuery(groupID uint, statusFilter string, searchKeyword string) *gorm.DB {
-	query := s.DB.Model(&models.APIKey{}).Where("group_id = ?", groupID)
+// ListKeysInGroupQuery builds a query to list all keys within a specific group, narrowed by the given filter.
+func (s *KeyService) ListKeysInGroupQuery(owner models.KeyOwner, filter KeyListFilter) *gorm.DB {
+	query := s.DB.Model(&models.APIKey{}).Scopes(owner.Scope)
 
-	if statusFilter != "" {
-		query = query.Where("status = ?", statusFilter)
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+
+	if filter.KeyValue != "" {
+		// Encrypted keys can only be matched exactly, through their hash.
+		if s.EncryptionService.IsEnabled() {
+			query = query.Where("key_hash = ?", s.EncryptionService.Hash(strings.TrimSpace(filter.KeyValue)))
+		} else {
+			query = query.Where("key_value LIKE ? ESCAPE '!'", "%"+utils.EscapeLike(filter.KeyValue)+"%")
+		}
+	}
+
+	if filter.Label != "" {
+		// Labels are stored comma-separated, so match the label as a whole list item.
+		label := utils.EscapeLike(filter.Label)
+		query = query.Where("labels = ? OR labels LIKE ? ESCAPE '!' OR labels LIKE ? ESCAPE '!' OR labels LIKE ? ESCAPE '!'",
+			filter.Label, label+",%", "%,"+label, "%,"+label+",%")
+	}
+
+	if filter.Owner != "" {
+		query = query.Where("owner = ?", filter.Owner)
 	}
 
-	if searchKeyword != "" {
-		query = query.Where("key_value LIKE ?", "%"+searchKeyword+"%")
+	if filter.Note != "" {
+		query = query.Where("note LIKE ? ESCAPE '!'", "%"+utils.EscapeLike(filter.Note)+"%")
+	}
+
+	if filter.ExpiresBefore != nil {
+		query = query.Where("expires_at IS NOT NULL AND expires_at <= ?", *filter.ExpiresBefore)
 	}
 
 	query = query.Order("last_used_at desc, updated_at desc")
@@ -303,6 +452,265 @@ func (s *KeyService) ListKeysInGroupQuery(groupID uint, statusFilter string, sea
 	return query
 }
 
+// UpdateKeysMetadata handles the business logic of bulk-editing the metadata of keys from a text block.
+func (s *KeyService) UpdateKeysMetadata(owner models.KeyOwner, keysText string, update KeyMetadataUpdate) (*UpdateKeysMetadataResult, error) {
+	keysToUpdate := s.ParseKeysFromText(keysText)
+	if len(keysToUpdate) > maxRequestKeys {
+		return nil, fmt.Errorf("batch size exceeds the limit of %d keys, got %d", maxRequestKeys, len(keysToUpdate))
+	}
+	if len(keysToUpdate) == 0 {
+		return nil, fmt.Errorf("no valid keys found in the input text")
+	}
+
+	updates, err := buildMetadataUpdates(update)
+	if err != nil {
+		return nil, err
+	}
+	if len(updates) == 0 {
+		return nil, fmt.Errorf("%w: no metadata fields to update", ErrInvalidKeyMetadata)
+	}
+
+	var totalUpdatedCount int64
+	for i := 0; i < len(keysToUpdate); i += chunkSize {
+		end := min(i+chunkSize, len(keysToUpdate))
+		updatedCount, err := s.KeyProvider.UpdateKeyMetadata(owner, keysToUpdate[i:end], updates)
+		if err != nil {
+			return nil, err
+		}
+		totalUpdatedCount += updatedCount
+	}
+
+	return &UpdateKeysMetadataResult{
+		UpdatedCount: int(totalUpdatedCount),
+		IgnoredCount: len(keysToUpdate) - int(totalUpdatedCount),
+	}, nil
+}
+
+// TransferKeys moves or copies keys from the keys of the source group to those of the target group in batches.
+// Each batch is transferred atomically, keeping the status, counts and metadata of the keys.
+func (s *KeyService) TransferKeys(source, target models.KeyOwner, opts KeyTransferOptions) (*KeyTransferResult, error) {
+	if source == target {
+		return nil, fmt.Errorf("%w: the source and target groups must use different keys, they are the same group or share a key pool", ErrInvalidKeyTransfer)
+	}
+	switch opts.Mode {
+	case keypool.KeyTransferMove, keypool.KeyTransferCopy:
+	default:
+		return nil, fmt.Errorf("%w: mode must be move or copy", ErrInvalidKeyTransfer)
+	}
+	if opts.OnConflict == "" {
+		opts.OnConflict = keypool.KeyConflictSkip
+	}
+	switch opts.OnConflict {
+	case keypool.KeyConflictSkip, keypool.KeyConflictKeepTarget, keypool.KeyConflictOverwrite:
+	default:
+		return nil, fmt.Errorf("%w: on_conflict must be skip, keep_target or overwrite", ErrInvalidKeyTransfer)
+	}
+
+	keyIDs, requested, err := s.findTransferKeyIDs(source, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// 所有批次在同一事务中执行，失败时整体回滚，store 在提交后再更新
+	result := &KeyTransferResult{}
+	changes := &keypool.StoreChanges{}
+	err = s.DB.Transaction(func(tx *gorm.DB) error {
+		for i := 0; i < len(keyIDs); i += chunkSize {
+			end := min(i+chunkSize, len(keyIDs))
+			batchResult, err := s.KeyProvider.TransferKeysInTx(tx, source, target, keyIDs[i:end], opts.Mode, opts.OnConflict, changes)
+			if err != nil {
+				return err
+			}
+			result.Add(batchResult)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.KeyProvider.ApplyStoreChanges(changes); err != nil {
+		return nil, err
+	}
+
+	processed := result.TransferredCount + result.OverwrittenCount + result.MergedCount + result.SkippedCount
+	result.IgnoredCount = requested - processed
+	return result, nil
+}
+
+// findTransferKeyIDs returns the IDs of the source keys selected for a transfer and the number of requested keys.
+func (s *KeyService) findTransferKeyIDs(source models.KeyOwner, opts KeyTransferOptions) ([]uint, int, error) {
+	var keyIDs []uint
+	if strings.TrimSpace(opts.KeysText) == "" {
+		query := s.DB.Model(&models.APIKey{}).Scopes(source.Scope)
+		switch opts.Status {
+		case models.KeyStatusActive, models.KeyStatusInvalid:
+			query = query.Where("status = ?", opts.Status)
+		case "all":
+		default:
+			return nil, 0, fmt.Errorf("%w: keys_text or a status of active, invalid or all is required", ErrInvalidKeyTransfer)
+		}
+		if err := query.Order("id").Pluck("id", &keyIDs).Error; err != nil {
+			return nil, 0, err
+		}
+		return keyIDs, len(keyIDs), nil
+	}
+
+	keys := s.ParseKeysFromText(opts.KeysText)
+	if len(keys) > maxRequestKeys {
+		return nil, 0, fmt.Errorf("batch size exceeds the limit of %d keys, got %d", maxRequestKeys, len(keys))
+	}
+	if len(keys) == 0 {
+		return nil, 0, fmt.Errorf("no valid keys found in the input text")
+	}
+
+	hashes := make([]string, 0, len(keys))
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		hash := s.EncryptionService.Hash(key)
+		if !seen[hash] {
+			seen[hash] = true
+			hashes = append(hashes, hash)
+		}
+	}
+	for i := 0; i < len(hashes); i += chunkSize {
+		end := min(i+chunkSize, len(hashes))
+		var batchIDs []uint
+		if err := s.DB.Model(&models.APIKey{}).Scopes(source.Scope).Where("key_hash IN ?", hashes[i:end]).Pluck("id", &batchIDs).Error; err != nil {
+			return nil, 0, err
+		}
+		keyIDs = append(keyIDs, batchIDs...)
+	}
+	return keyIDs, len(hashes), nil
+}
+
+// buildMetadataUpdates validates a metadata update and converts it into column updates.
+func buildMetadataUpdates(update KeyMetadataUpdate) (map[string]any, error) {
+	updates := make(map[string]any)
+
+	if update.Labels != nil {
+		labels := NormalizeLabels(*update.Labels)
+		if len(labels) > 512 {
+			return nil, fmt.Errorf("%w: labels exceed the maximum length of 512 characters", ErrInvalidKeyMetadata)
+		}
+		updates["labels"] = labels
+	}
+	if update.Note != nil {
+		updates["note"] = strings.TrimSpace(*update.Note)
+	}
+	if update.Owner != nil {
+		owner := strings.TrimSpace(*update.Owner)
+		if len(owner) > 255 {
+			return nil, fmt.Errorf("%w: owner exceeds the maximum length of 255 characters", ErrInvalidKeyMetadata)
+		}
+		updates["owner"] = owner
+	}
+	if update.ClearExpiresAt {
+		updates["expires_at"] = nil
+	} else if update.ExpiresAt != nil {
+		updates["expires_at"] = *update.ExpiresAt
+	}
+	if update.Weight != nil {
+		if *update.Weight < models.MinKeyWeight || *update.Weight > models.MaxKeyWeight {
+			return nil, fmt.Errorf("%w: weight must be between %d and %d", ErrInvalidKeyMetadata, models.MinKeyWeight, models.MaxKeyWeight)
+		}
+		updates["weight"] = *update.Weight
+	}
+	if update.HeaderRules != nil {
+		headerRules, err := normalizeKeyHeaderRules(*update.HeaderRules)
+		if err != nil {
+			return nil, err
+		}
+		updates["header_rules"] = headerRules
+	}
+	if update.UpstreamURL != nil {
+		upstreamURL, err := normalizeKeyURL(*update.UpstreamURL, "upstream_url", "http", "https")
+		if err != nil {
+			return nil, err
+		}
+		updates["upstream_url"] = upstreamURL
+	}
+	if update.ProxyURL != nil {
+		proxyURL, err := normalizeKeyURL(*update.ProxyURL, "proxy_url", "http", "https", "socks5")
+		if err != nil {
+			return nil, err
+		}
+		updates["proxy_url"] = proxyURL
+	}
+
+	return updates, nil
+}
+
+// normalizeKeyHeaderRules validates a key's header rules and returns their JSON form.
+func normalizeKeyHeaderRules(rules []models.HeaderRule) (datatypes.JSON, error) {
+	normalized := make([]models.HeaderRule, 0, len(rules))
+	seenKeys := make(map[string]bool)
+
+	for _, rule := range rules {
+		key := strings.TrimSpace(rule.Key)
+		if key == "" {
+			continue
+		}
+		if rule.Action != "set" && rule.Action != "remove" {
+			return nil, fmt.Errorf("%w: invalid action '%s' for header %s", ErrInvalidKeyMetadata, rule.Action, key)
+		}
+
+		canonicalKey := http.CanonicalHeaderKey(key)
+		if seenKeys[canonicalKey] {
+			return nil, fmt.Errorf("%w: duplicate header key: %s", ErrInvalidKeyMetadata, canonicalKey)
+		}
+		seenKeys[canonicalKey] = true
+
+		normalized = append(normalized, models.HeaderRule{
+			Key:    canonicalKey,
+			Value:  rule.Value,
+			Action: rule.Action,
+		})
+	}
+
+	headerRules, err := json.Marshal(normalized)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal header rules: %w", err)
+	}
+	return headerRules, nil
+}
+
+// normalizeKeyURL trims a key's URL override and checks its scheme. An empty value clears the override.
+func normalizeKeyURL(rawURL, field string, schemes ...string) (string, error) {
+	rawURL = strings.TrimSpace(rawURL)
+	if rawURL == "" {
+		return "", nil
+	}
+	if len(rawURL) > 500 {
+		return "", fmt.Errorf("%w: %s exceeds the maximum length of 500 characters", ErrInvalidKeyMetadata, field)
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" || !slices.Contains(schemes, u.Scheme) {
+		return "", fmt.Errorf("%w: invalid %s: %s", ErrInvalidKeyMetadata, field, rawURL)
+	}
+	return rawURL, nil
+}
+
+// NormalizeLabels trims, deduplicates and joins a comma-separated list of labels.
+func NormalizeLabels(labels string) string {
+	seen := make(map[string]bool)
+	var result []string
+	for _, label := range strings.Split(labels, ",") {
+		label = strings.TrimSpace(label)
+		if label == "" || seen[label] {
+			continue
+		}
+		seen[label] = true
+		result = append(result, label)
+	}
+	return strings.Join(result, ",")
+}
+
+// ListKeyEventsQuery builds a query to list the status change history of a key, newest first.
+func (s *KeyService) ListKeyEventsQuery(keyID uint) *gorm.DB {
+	return s.DB.Model(&models.KeyEvent{}).Where("key_id = ?", keyID).Order("created_at desc, id desc")
+}
+
 // TestMultipleKeys handles a one-off validation test for multiple keys.
 func (s *KeyService) TestMultipleKeys(group *models.Group, keysText string) ([]keypool.KeyTestResult, error) {
 	keysToTest := s.ParseKeysFromText(keysText)
@@ -331,8 +739,8 @@ func (s *KeyService) TestMultipleKeys(group *models.Group, keysText string) ([]k
 }
 
 // StreamKeysToWriter fetches keys from the database in batches and writes them to the provided writer.
-func (s *KeyService) StreamKeysToWriter(groupID uint, statusFilter string, writer io.Writer) error {
-	query := s.DB.Model(&models.APIKey{}).Where("group_id = ?", groupID).Select("id, key_value")
+func (s *KeyService) StreamKeysToWriter(owner models.KeyOwner, statusFilter string, writer io.Writer) error {
+	query := s.DB.Model(&models.APIKey{}).Scopes(owner.Scope).Select("id, key_value")
 
 	switch statusFilter {
 	case models.KeyStatusActive, models.KeyStatusInvalid:
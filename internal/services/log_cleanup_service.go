@@ -11,7 +11,10 @@ import (
 	"gorm.io/gorm"
 )
 
-// LogCleanupService 负责清理过期的请求日志
+// taskHistoryRetentionDays 已结束的后台任务记录保留天数
+const taskHistoryRetentionDays = 30
+
+// LogCleanupService 负责清理过期的请求日志、审计日志、密钥事件、探测记录和任务记录
 type LogCleanupService struct {
 	db              *gorm.DB
 	settingsManager *config.SystemSettingsManager
@@ -61,11 +64,19 @@ func (s *LogCleanupService) run() {
 
 	// 启动时先执行一次清理
 	s.cleanupExpiredLogs()
+	s.cleanupExpiredAuditLogs()
+	s.cleanupExpiredKeyEvents()
+	s.cleanupExpiredProbeResults()
+	s.cleanupExpiredTasks()
 
 	for {
 		select {
 		case <-ticker.C:
 			s.cleanupExpiredLogs()
+			s.cleanupExpiredAuditLogs()
+			s.cleanupExpiredKeyEvents()
+			s.cleanupExpiredProbeResults()
+			s.cleanupExpiredTasks()
 		case <-s.stopCh:
 			return
 		}
@@ -87,15 +98,15 @@ func (s *LogCleanupService) cleanupExpiredLogs() {
 	cutoffTime := time.Now().AddDate(0, 0, -retentionDays).UTC()
 
 	// 执行删除操作
-	result := s.db.Where("timestamp < ?", cutoffTime).Delete(&models.RequestLog{})
-	if result.Error != nil {
-		logrus.WithError(result.Error).Error("Failed to cleanup expired request logs")
+	deletedCount, err := s.PruneRequestLogs(cutoffTime)
+	if err != nil {
+		logrus.WithError(err).Error("Failed to cleanup expired request logs")
 		return
 	}
 
-	if result.RowsAffected > 0 {
+	if deletedCount > 0 {
 		logrus.WithFields(logrus.Fields{
-			"deleted_count":  result.RowsAffected,
+			"deleted_count":  deletedCount,
 			"cutoff_time":    cutoffTime.Format(time.RFC3339),
 			"retention_days": retentionDays,
 		}).Info("Successfully cleaned up expired request logs")
@@ -103,3 +114,99 @@ func (s *LogCleanupService) cleanupExpiredLogs() {
 		logrus.Debug("No expired request logs found to cleanup")
 	}
 }
+
+// PruneRequestLogs 删除指定时间之前的请求日志，返回删除的条数
+func (s *LogCleanupService) PruneRequestLogs(before time.Time) (int64, error) {
+	result := s.db.Where("timestamp < ?", before).Delete(&models.RequestLog{})
+	return result.RowsAffected, result.Error
+}
+
+// cleanupExpiredAuditLogs 清理过期的审计日志
+func (s *LogCleanupService) cleanupExpiredAuditLogs() {
+	retentionDays := s.settingsManager.GetSettings().AuditLogRetentionDays
+	if retentionDays <= 0 {
+		logrus.Debug("Audit log retention is disabled (retention_days <= 0)")
+		return
+	}
+
+	cutoffTime := time.Now().AddDate(0, 0, -retentionDays).UTC()
+	result := s.db.Where("created_at < ?", cutoffTime).Delete(&models.AuditLog{})
+	if result.Error != nil {
+		logrus.WithError(result.Error).Error("Failed to cleanup expired audit logs")
+		return
+	}
+
+	if result.RowsAffected > 0 {
+		logrus.WithFields(logrus.Fields{
+			"deleted_count":  result.RowsAffected,
+			"cutoff_time":    cutoffTime.Format(time.RFC3339),
+			"retention_days": retentionDays,
+		}).Info("Successfully cleaned up expired audit logs")
+	}
+}
+
+// cleanupExpiredKeyEvents 清理过期的密钥状态变更记录
+func (s *LogCleanupService) cleanupExpiredKeyEvents() {
+	retentionDays := s.settingsManager.GetSettings().KeyEventRetentionDays
+	if retentionDays <= 0 {
+		logrus.Debug("Key event retention is disabled (retention_days <= 0)")
+		return
+	}
+
+	cutoffTime := time.Now().AddDate(0, 0, -retentionDays).UTC()
+	result := s.db.Where("created_at < ?", cutoffTime).Delete(&models.KeyEvent{})
+	if result.Error != nil {
+		logrus.WithError(result.Error).Error("Failed to cleanup expired key events")
+		return
+	}
+
+	if result.RowsAffected > 0 {
+		logrus.WithFields(logrus.Fields{
+			"deleted_count":  result.RowsAffected,
+			"cutoff_time":    cutoffTime.Format(time.RFC3339),
+			"retention_days": retentionDays,
+		}).Info("Successfully cleaned up expired key events")
+	}
+}
+
+// cleanupExpiredProbeResults 清理过期的探测记录，故障记录保留
+func (s *LogCleanupService) cleanupExpiredProbeResults() {
+	retentionDays := s.settingsManager.GetSettings().ProbeResultRetentionDays
+	if retentionDays <= 0 {
+		logrus.Debug("Probe result retention is disabled (retention_days <= 0)")
+		return
+	}
+
+	cutoffTime := time.Now().AddDate(0, 0, -retentionDays).UTC()
+	result := s.db.Where("checked_at < ?", cutoffTime).Delete(&models.ProbeResult{})
+	if result.Error != nil {
+		logrus.WithError(result.Error).Error("Failed to cleanup expired probe results")
+		return
+	}
+
+	if result.RowsAffected > 0 {
+		logrus.WithFields(logrus.Fields{
+			"deleted_count":  result.RowsAffected,
+			"cutoff_time":    cutoffTime.Format(time.RFC3339),
+			"retention_days": retentionDays,
+		}).Info("Successfully cleaned up expired probe results")
+	}
+}
+
+// cleanupExpiredTasks 清理过期的后台任务记录，运行中的任务保留
+func (s *LogCleanupService) cleanupExpiredTasks() {
+	cutoffTime := time.Now().AddDate(0, 0, -taskHistoryRetentionDays).UTC()
+	result := s.db.Where("status <> ? AND finished_at < ?", models.TaskStatusRunning, cutoffTime).Delete(&models.Task{})
+	if result.Error != nil {
+		logrus.WithError(result.Error).Error("Failed to cleanup expired tasks")
+		return
+	}
+
+	if result.RowsAffected > 0 {
+		logrus.WithFields(logrus.Fields{
+			"deleted_count":  result.RowsAffected,
+			"cutoff_time":    cutoffTime.Format(time.RFC3339),
+			"retention_days": taskHistoryRetentionDays,
+		}).Info("Successfully cleaned up expired tasks")
+	}
+}
@@ -3,9 +3,12 @@ package services
 import (
 	"encoding/csv"
 	"fmt"
+	"gpt-load/internal/auth"
+	"gpt-load/internal/encryption"
 	"gpt-load/internal/models"
 	"io"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -21,22 +24,45 @@ type ExportableLogKey struct {
 
 // LogService provides services related to request logs.
 type LogService struct {
-	DB *gorm.DB
+	DB                *gorm.DB
+	EncryptionService *encryption.Service
 }
 
 // NewLogService creates a new LogService.
-func NewLogService(db *gorm.DB) *LogService {
-	return &LogService{DB: db}
+func NewLogService(db *gorm.DB, encryptionService *encryption.Service) *LogService {
+	return &LogService{DB: db, EncryptionService: encryptionService}
+}
+
+// logScopeForPrincipal restricts group-scoped users to the logs of their groups.
+func logScopeForPrincipal(c *gin.Context) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if principal := auth.GetPrincipal(c); principal.IsGroupScoped() {
+			db = db.Where("group_id IN ?", principal.GroupIDs)
+		}
+		return db
+	}
 }
 
 // logFiltersScope returns a GORM scope function that applies filters from the Gin context.
-func logFiltersScope(c *gin.Context) func(db *gorm.DB) *gorm.DB {
+func logFiltersScope(c *gin.Context, encryptionService *encryption.Service) func(db *gorm.DB) *gorm.DB {
 	return func(db *gorm.DB) *gorm.DB {
+		db = db.Scopes(logScopeForPrincipal(c))
+		if requestID := c.Query("request_id"); requestID != "" {
+			db = db.Where("request_id = ?", requestID)
+		}
+		if clientRequestID := c.Query("client_request_id"); clientRequestID != "" {
+			db = db.Where("client_request_id = ?", clientRequestID)
+		}
 		if groupName := c.Query("group_name"); groupName != "" {
 			db = db.Where("group_name LIKE ?", "%"+groupName+"%")
 		}
 		if keyValue := c.Query("key_value"); keyValue != "" {
-			db = db.Where("key_value LIKE ?", "%"+keyValue+"%")
+			// Encrypted keys can only be matched exactly, through their hash.
+			if encryptionService.IsEnabled() {
+				db = db.Where("key_hash = ?", encryptionService.Hash(strings.TrimSpace(keyValue)))
+			} else {
+				db = db.Where("key_value LIKE ?", "%"+keyValue+"%")
+			}
 		}
 		if model := c.Query("model"); model != "" {
 			db = db.Where("model LIKE ?", "%"+model+"%")
@@ -76,7 +102,56 @@ func logFiltersScope(c *gin.Context) func(db *gorm.DB) *gorm.DB {
 
 // GetLogsQuery returns a GORM query for fetching logs with filters.
 func (s *LogService) GetLogsQuery(c *gin.Context) *gorm.DB {
-	return s.DB.Model(&models.RequestLog{}).Scopes(logFiltersScope(c))
+	return s.DB.Model(&models.RequestLog{}).Scopes(logFiltersScope(c, s.EncryptionService))
+}
+
+// RequestTimeline groups the attempts of one client request, linking retries to the final outcome.
+type RequestTimeline struct {
+	RequestID       string              `json:"request_id"`
+	ClientRequestID string              `json:"client_request_id,omitempty"`
+	GroupName       string              `json:"group_name"`
+	Model           string              `json:"model"`
+	IsSuccess       bool                `json:"is_success"`
+	StatusCode      int                 `json:"status_code"`
+	Attempts        int                 `json:"attempts"`
+	StartedAt       time.Time           `json:"started_at"`
+	Duration        int64               `json:"duration_ms"`
+	Logs            []models.RequestLog `json:"logs"`
+}
+
+// GetRequestTimeline returns the attempts of a request in order. The outcome is taken from
+// the final attempt, or the last recorded one while the request is still in progress.
+func (s *LogService) GetRequestTimeline(c *gin.Context, requestID string) (*RequestTimeline, error) {
+	var logs []models.RequestLog
+	if err := s.DB.Scopes(logScopeForPrincipal(c)).
+		Where("request_id = ?", requestID).
+		Order("attempt asc, timestamp asc").
+		Find(&logs).Error; err != nil {
+		return nil, err
+	}
+	if len(logs) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	last := logs[len(logs)-1]
+	for _, log := range logs {
+		if log.RequestType == models.RequestTypeFinal {
+			last = log
+		}
+	}
+
+	return &RequestTimeline{
+		RequestID:       requestID,
+		ClientRequestID: logs[0].ClientRequestID,
+		GroupName:       last.GroupName,
+		Model:           last.Model,
+		IsSuccess:       last.IsSuccess,
+		StatusCode:      last.StatusCode,
+		Attempts:        len(logs),
+		StartedAt:       logs[0].Timestamp.Add(-time.Duration(logs[0].Duration) * time.Millisecond),
+		Duration:        last.Duration,
+		Logs:            logs,
+	}, nil
 }
 
 // StreamLogKeysToCSV fetches unique keys from logs based on filters and streams them as a CSV.
@@ -93,9 +168,9 @@ func (s *LogService) StreamLogKeysToCSV(c *gin.Context, writer io.Writer) error
 
 	var results []ExportableLogKey
 
-	baseQuery := s.DB.Model(&models.RequestLog{}).Scopes(logFiltersScope(c))
+	baseQuery := s.DB.Model(&models.RequestLog{}).Scopes(logFiltersScope(c, s.EncryptionService))
 
-	// 使用窗口函数获取每个key_value的最新记录
+	// 使用窗口函数获取每个key的最新记录，加密后的 key_value 每行不同，按 key_hash 分组
 	err := s.DB.Raw(`
 		SELECT
 			key_value,
@@ -106,7 +181,7 @@ func (s *LogService) StreamLogKeysToCSV(c *gin.Context, writer io.Writer) error
 				key_value,
 				group_name,
 				status_code,
-				ROW_NUMBER() OVER (PARTITION BY key_value ORDER BY timestamp DESC) as rn
+				ROW_NUMBER() OVER (PARTITION BY COALESCE(NULLIF(key_hash, ''), key_value) ORDER BY timestamp DESC) as rn
 			FROM (?) as filtered_logs
 		) ranked
 		WHERE rn = 1
@@ -119,8 +194,12 @@ func (s *LogService) StreamLogKeysToCSV(c *gin.Context, writer io.Writer) error
 
 	// 写入CSV数据
 	for _, record := range results {
+		keyValue, err := s.EncryptionService.Decrypt(record.KeyValue)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt log key: %w", err)
+		}
 		csvRecord := []string{
-			record.KeyValue,
+			keyValue,
 			record.GroupName,
 			strconv.Itoa(record.StatusCode),
 		}
@@ -0,0 +1,77 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"gpt-load/internal/auth"
+	"gpt-load/internal/encryption"
+	"gpt-load/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// newTestLogService returns a log service with one request in each of the groups 1 to 3.
+func newTestLogService(t *testing.T) *LogService {
+	t.Helper()
+	encryptionService := encryption.NewService(testConfig{})
+	db := newTestDB(t, &models.RequestLog{})
+	for groupID := uint(1); groupID <= 3; groupID++ {
+		log := models.RequestLog{
+			ID:        fmt.Sprintf("log-%d", groupID),
+			RequestID: fmt.Sprintf("request-%d", groupID),
+			Timestamp: time.Now(),
+			GroupID:   groupID,
+			KeyValue:  "sk-test",
+		}
+		if err := db.Create(&log).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return NewLogService(db, encryptionService)
+}
+
+// newPrincipalContext returns a request context authenticated as the principal.
+func newPrincipalContext(p *auth.Principal) *gin.Context {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/", nil)
+	auth.SetPrincipal(c, p)
+	return c
+}
+
+func TestLogsScopedToMaintainerGroups(t *testing.T) {
+	s := newTestLogService(t)
+	tests := []struct {
+		principal *auth.Principal
+		want      []uint
+	}{
+		{&auth.Principal{Role: models.RoleAdmin}, []uint{1, 2, 3}},
+		{&auth.Principal{Role: models.RoleViewer}, []uint{1, 2, 3}},
+		{&auth.Principal{Role: models.RoleMaintainer, GroupIDs: []uint{1, 3}}, []uint{1, 3}},
+		{&auth.Principal{Role: models.RoleMaintainer}, nil},
+	}
+	for _, tt := range tests {
+		c := newPrincipalContext(tt.principal)
+		var got []uint
+		if err := s.GetLogsQuery(c).Order("group_id").Pluck("group_id", &got).Error; err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s with groups %v sees the logs of groups %v, want %v", tt.principal.Role, tt.principal.GroupIDs, got, tt.want)
+		}
+	}
+
+	maintainer := newPrincipalContext(&auth.Principal{Role: models.RoleMaintainer, GroupIDs: []uint{1}})
+	if _, err := s.GetRequestTimeline(maintainer, "request-1"); err != nil {
+		t.Errorf("timeline of an assigned group: %v", err)
+	}
+	if _, err := s.GetRequestTimeline(maintainer, "request-2"); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("timeline of another group: err = %v, want not found", err)
+	}
+}
@@ -0,0 +1,78 @@
+package services
+
+import (
+	"net/http"
+
+	"gpt-load/internal/httpclient"
+	"gpt-load/internal/metrics"
+	"gpt-load/internal/models"
+	"gpt-load/internal/store"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+// MetricsService registers the metrics read from the database and store on each scrape.
+type MetricsService struct {
+	DB    *gorm.DB
+	store store.Store
+}
+
+// NewMetricsService creates a new MetricsService. It must only be created once, as it registers collectors.
+func NewMetricsService(db *gorm.DB, store store.Store, clientManager *httpclient.HTTPClientManager) *MetricsService {
+	s := &MetricsService{DB: db, store: store}
+
+	metrics.RegisterKeyCounts(s.keyCounts)
+	metrics.RegisterGaugeFunc("pending_log_keys", "Request logs cached in the store and waiting to be written to the database.", s.pendingLogKeys)
+	metrics.RegisterGaugeFunc("http_clients", "Shared upstream HTTP clients, each with its own connection pool.", func() float64 {
+		return float64(clientManager.ClientCount())
+	})
+
+	return s
+}
+
+// Handler returns the HTTP handler serving the metrics.
+func (s *MetricsService) Handler() http.Handler {
+	return metrics.Handler()
+}
+
+func (s *MetricsService) keyCounts() ([]metrics.KeyCount, error) {
+	var rows []struct {
+		GroupID uint
+		PoolID  uint
+		Status  string
+		Count   int64
+	}
+	if err := s.DB.Model(&models.APIKey{}).Select("group_id, pool_id, status, COUNT(*) AS count").
+		Group("group_id, pool_id, status").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	var groups []models.Group
+	if err := s.DB.Select("id, name, key_pool_id").Find(&groups).Error; err != nil {
+		return nil, err
+	}
+	// 密钥池中的 Key 计入每个引用它的分组
+	groupNames := make(map[models.KeyOwner][]string, len(groups))
+	for _, group := range groups {
+		owner := group.KeyOwner()
+		groupNames[owner] = append(groupNames[owner], group.Name)
+	}
+
+	counts := make([]metrics.KeyCount, 0, len(rows))
+	for _, row := range rows {
+		for _, name := range groupNames[models.KeyOwner{GroupID: row.GroupID, PoolID: row.PoolID}] {
+			counts = append(counts, metrics.KeyCount{Group: name, Status: row.Status, Count: row.Count})
+		}
+	}
+	return counts, nil
+}
+
+func (s *MetricsService) pendingLogKeys() float64 {
+	count, err := s.store.SCard(PendingLogKeysSet)
+	if err != nil {
+		logrus.WithError(err).Warn("Failed to count pending request logs for metrics")
+		return 0
+	}
+	return float64(count)
+}
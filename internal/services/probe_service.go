@@ -0,0 +1,563 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"gpt-load/internal/config"
+	"gpt-load/internal/models"
+	"gpt-load/internal/utils"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	probeTickInterval   = 10 * time.Second
+	probeUserAgent      = "GPT-Load-Probe"
+	probeRequestIDStart = "probe-"
+	maxProbeErrorLength = 512
+	// publicStatusCacheTTL limits how often the unauthenticated status endpoint queries the database.
+	publicStatusCacheTTL = 30 * time.Second
+)
+
+// ErrProbeInProgress is returned when a probe of the group is already running.
+var ErrProbeInProgress = errors.New("a probe of this group is already running")
+
+// Probe statuses of a group
+const (
+	ProbeStatusUp          = "up"
+	ProbeStatusDegraded    = "degraded" // The last probe failed but no incident is open yet
+	ProbeStatusDown        = "down"
+	ProbeStatusUnknown     = "unknown"
+	ProbeStatusDisabled    = "disabled"    // The group is disabled, probes are paused
+	ProbeStatusMaintenance = "maintenance" // The group is under maintenance, probes are paused
+)
+
+// UptimeWindows are the windows over which uptime is reported.
+var UptimeWindows = []struct {
+	Name     string
+	Duration time.Duration
+}{
+	{"24h", 24 * time.Hour},
+	{"7d", 7 * 24 * time.Hour},
+	{"30d", 30 * 24 * time.Hour},
+}
+
+// UptimeWindow is the probe summary of a group within a window.
+type UptimeWindow struct {
+	Probes        int64    `json:"probes"`
+	Successes     int64    `json:"successes"`
+	UptimePercent *float64 `json:"uptime_percent"` // Nil when there were no probes
+	AvgLatencyMs  float64  `json:"avg_latency_ms"`
+}
+
+// GroupUptime is the availability of a group as seen by its probes.
+type GroupUptime struct {
+	GroupID       uint                    `json:"group_id"`
+	GroupName     string                  `json:"group_name"`
+	DisplayName   string                  `json:"display_name"`
+	Status        string                  `json:"status"`
+	LastCheckedAt *time.Time              `json:"last_checked_at"`
+	LastLatencyMs int64                   `json:"last_latency_ms"`
+	Windows       map[string]UptimeWindow `json:"windows"`
+	OpenIncident  *models.ProbeIncident   `json:"open_incident"`
+}
+
+// ProbeService sends synthetic requests through the proxy endpoint of each group with probes
+// enabled, and records the results and incidents.
+type ProbeService struct {
+	db              *gorm.DB
+	settingsManager *config.SystemSettingsManager
+	groupManager    *GroupManager
+	handler         http.Handler
+	lastRun         map[uint]time.Time
+	running         map[uint]struct{}
+	mu              sync.Mutex
+	publicStatus    *PublicStatus
+	publicMu        sync.Mutex
+	stopCh          chan struct{}
+	wg              sync.WaitGroup
+}
+
+// NewProbeService creates a new ProbeService.
+func NewProbeService(db *gorm.DB, settingsManager *config.SystemSettingsManager, groupManager *GroupManager) *ProbeService {
+	return &ProbeService{
+		db:              db,
+		settingsManager: settingsManager,
+		groupManager:    groupManager,
+		lastRun:         make(map[uint]time.Time),
+		running:         make(map[uint]struct{}),
+		stopCh:          make(chan struct{}),
+	}
+}
+
+// SetHandler sets the HTTP handler that probe requests are served by, so they run through the
+// same middleware and proxy pipeline as client requests.
+func (s *ProbeService) SetHandler(handler http.Handler) {
+	s.handler = handler
+}
+
+// Start starts the probe scheduler.
+func (s *ProbeService) Start() {
+	s.wg.Add(1)
+	go s.run()
+	logrus.Debug("Probe service started")
+}
+
+// Stop stops the probe scheduler and waits for running probes.
+func (s *ProbeService) Stop(ctx context.Context) {
+	close(s.stopCh)
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		logrus.Info("ProbeService stopped gracefully.")
+	case <-ctx.Done():
+		logrus.Warn("ProbeService stop timed out.")
+	}
+}
+
+func (s *ProbeService) run() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(probeTickInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.runDueProbes()
+		case <-s.stopCh:
+			return
+		}
+	}
+}
+
+// runDueProbes starts the probes whose interval has elapsed.
+func (s *ProbeService) runDueProbes() {
+	var groups []models.Group
+	if err := s.db.Select("id", "name", "probe_config", "enabled", "maintenance_config").Where("probe_config IS NOT NULL").Find(&groups).Error; err != nil {
+		logrus.WithError(err).Error("ProbeService: failed to load groups")
+		return
+	}
+
+	now := time.Now()
+	for _, group := range groups {
+		cfg := ParseProbeConfig(group.ProbeConfig)
+		if cfg == nil || !cfg.Enabled || groupPausedStatus(&group) != "" {
+			continue
+		}
+
+		s.mu.Lock()
+		last := s.lastRun[group.ID]
+		s.mu.Unlock()
+		// 容忍半个调度周期，避免间隔与调度周期相同时每隔一次才执行
+		if now.Sub(last) < time.Duration(cfg.IntervalSeconds)*time.Second-probeTickInterval/2 {
+			continue
+		}
+
+		s.wg.Add(1)
+		go func(name string) {
+			defer s.wg.Done()
+			if _, err := s.RunProbe(name); err != nil && !errors.Is(err, ErrProbeInProgress) {
+				logrus.WithError(err).Warnf("ProbeService: failed to probe group %s", name)
+			}
+		}(group.Name)
+	}
+}
+
+// ParseProbeConfig parses the probe config of a group, returning nil when it is not set or invalid.
+func ParseProbeConfig(raw []byte) *models.ProbeConfig {
+	if len(raw) == 0 {
+		return nil
+	}
+	var cfg *models.ProbeConfig
+	if err := json.Unmarshal(raw, &cfg); err != nil {
+		logrus.WithError(err).Warn("Failed to unmarshal probe config")
+		return nil
+	}
+	return cfg
+}
+
+// RunProbe probes the group immediately and records the result.
+func (s *ProbeService) RunProbe(groupName string) (*models.ProbeResult, error) {
+	group, err := s.groupManager.GetGroupByName(groupName)
+	if err != nil {
+		return nil, err
+	}
+	cfg := ParseProbeConfig(group.ProbeConfig)
+	if cfg == nil {
+		return nil, fmt.Errorf("group %s has no probe configured", group.Name)
+	}
+
+	s.mu.Lock()
+	if _, ok := s.running[group.ID]; ok {
+		s.mu.Unlock()
+		return nil, ErrProbeInProgress
+	}
+	s.running[group.ID] = struct{}{}
+	s.lastRun[group.ID] = time.Now()
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.running, group.ID)
+		s.mu.Unlock()
+	}()
+
+	result := s.probe(group, cfg)
+	if err := s.db.Create(result).Error; err != nil {
+		return nil, fmt.Errorf("failed to save probe result: %w", err)
+	}
+	if err := s.updateIncident(result); err != nil {
+		logrus.WithError(err).Errorf("ProbeService: failed to update incident of group %s", group.Name)
+	}
+	return result, nil
+}
+
+// probe sends the configured request through the proxy endpoint of the group.
+func (s *ProbeService) probe(group *models.Group, cfg *models.ProbeConfig) *models.ProbeResult {
+	result := &models.ProbeResult{
+		GroupID:   group.ID,
+		CheckedAt: time.Now(),
+	}
+	clientRequestID := probeRequestIDStart + utils.NewRequestID()
+
+	proxyKey := probeProxyKey(group)
+	if proxyKey == "" {
+		result.ErrorMessage = "no proxy key is configured for the group"
+		return result
+	}
+	if s.handler == nil {
+		result.ErrorMessage = "probe handler is not initialized"
+		return result
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.TimeoutSeconds)*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, cfg.Method, "/proxy/"+group.Name+cfg.Path, strings.NewReader(cfg.Body))
+	if err != nil {
+		result.ErrorMessage = fmt.Sprintf("failed to create probe request: %v", err)
+		return result
+	}
+	req.RemoteAddr = "127.0.0.1:0"
+	req.Header.Set("Authorization", "Bearer "+proxyKey)
+	req.Header.Set("User-Agent", probeUserAgent)
+	req.Header.Set(utils.RequestIDHeader, clientRequestID)
+	if cfg.Body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	writer := newProbeResponseWriter()
+	start := time.Now()
+	s.handler.ServeHTTP(writer, req)
+	result.LatencyMs = time.Since(start).Milliseconds()
+	result.StatusCode = writer.status
+	// 记录代理端生成的请求 ID，以便关联请求日志
+	result.RequestID = writer.Header().Get(utils.RequestIDHeader)
+
+	switch {
+	case ctx.Err() != nil:
+		result.ErrorMessage = fmt.Sprintf("probe timed out after %ds", cfg.TimeoutSeconds)
+	case probeStatusExpected(cfg, writer.status):
+		result.Success = true
+	default:
+		result.ErrorMessage = strings.TrimSpace(writer.body.String())
+		if result.ErrorMessage == "" {
+			result.ErrorMessage = fmt.Sprintf("unexpected status code %d", writer.status)
+		}
+	}
+	return result
+}
+
+// probeProxyKey returns a proxy key that is accepted by the proxy endpoint of the group.
+func probeProxyKey(group *models.Group) string {
+	for _, keys := range []map[string]struct{}{group.ProxyKeysMap, group.EffectiveConfig.ProxyKeysMap} {
+		candidates := make([]string, 0, len(keys))
+		for key := range keys {
+			candidates = append(candidates, key)
+		}
+		if len(candidates) > 0 {
+			slices.Sort(candidates)
+			return candidates[0]
+		}
+	}
+	return ""
+}
+
+func probeStatusExpected(cfg *models.ProbeConfig, status int) bool {
+	if len(cfg.ExpectedStatuses) == 0 {
+		return status >= 200 && status < 300
+	}
+	return slices.Contains(cfg.ExpectedStatuses, status)
+}
+
+// updateIncident opens an incident once the group has failed enough consecutive probes, and
+// resolves the open incident on the next successful probe.
+func (s *ProbeService) updateIncident(result *models.ProbeResult) error {
+	var incident models.ProbeIncident
+	err := s.db.Where("group_id = ? AND resolved_at IS NULL", result.GroupID).Order("id desc").First(&incident).Error
+	hasOpen := err == nil
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+
+	if result.Success {
+		if !hasOpen {
+			return nil
+		}
+		return s.db.Model(&incident).Update("resolved_at", result.CheckedAt).Error
+	}
+
+	if hasOpen {
+		return s.db.Model(&incident).Updates(map[string]any{
+			"failure_count": gorm.Expr("failure_count + 1"),
+			"status_code":   result.StatusCode,
+			"error_message": result.ErrorMessage,
+		}).Error
+	}
+
+	threshold := s.settingsManager.GetSettings().ProbeIncidentThreshold
+	var recent []models.ProbeResult
+	if err := s.db.Where("group_id = ?", result.GroupID).Order("checked_at desc, id desc").Limit(threshold).Find(&recent).Error; err != nil {
+		return err
+	}
+	if len(recent) < threshold {
+		return nil
+	}
+	for _, r := range recent {
+		if r.Success {
+			return nil
+		}
+	}
+
+	return s.db.Create(&models.ProbeIncident{
+		GroupID:      result.GroupID,
+		StartedAt:    recent[len(recent)-1].CheckedAt,
+		FailureCount: len(recent),
+		StatusCode:   result.StatusCode,
+		ErrorMessage: result.ErrorMessage,
+	}).Error
+}
+
+// GetUptime returns the availability of the given groups that have probes enabled.
+func (s *ProbeService) GetUptime(groups []models.Group) ([]GroupUptime, error) {
+	uptimes := make([]GroupUptime, 0, len(groups))
+	var groupIDs []uint
+	paused := make(map[uint]string)
+	for _, group := range groups {
+		cfg := ParseProbeConfig(group.ProbeConfig)
+		if cfg == nil || !cfg.Enabled {
+			continue
+		}
+		if status := groupPausedStatus(&group); status != "" {
+			paused[group.ID] = status
+		}
+		uptimes = append(uptimes, GroupUptime{
+			GroupID:     group.ID,
+			GroupName:   group.Name,
+			DisplayName: group.DisplayName,
+			Status:      ProbeStatusUnknown,
+			Windows:     make(map[string]UptimeWindow),
+		})
+		groupIDs = append(groupIDs, group.ID)
+	}
+	if len(groupIDs) == 0 {
+		return uptimes, nil
+	}
+	byID := make(map[uint]*GroupUptime, len(uptimes))
+	for i := range uptimes {
+		byID[uptimes[i].GroupID] = &uptimes[i]
+	}
+
+	now := time.Now()
+	for _, window := range UptimeWindows {
+		var rows []struct {
+			GroupID      uint
+			Probes       int64
+			Successes    int64
+			AvgLatencyMs float64
+		}
+		err := s.db.Model(&models.ProbeResult{}).
+			Select("group_id, COUNT(*) AS probes, SUM(CASE WHEN success THEN 1 ELSE 0 END) AS successes, AVG(latency_ms) AS avg_latency_ms").
+			Where("group_id IN ? AND checked_at >= ?", groupIDs, now.Add(-window.Duration)).
+			Group("group_id").
+			Scan(&rows).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			w := UptimeWindow{Probes: row.Probes, Successes: row.Successes, AvgLatencyMs: row.AvgLatencyMs}
+			if row.Probes > 0 {
+				percent := float64(row.Successes) * 100 / float64(row.Probes)
+				w.UptimePercent = &percent
+			}
+			byID[row.GroupID].Windows[window.Name] = w
+		}
+	}
+
+	for i := range uptimes {
+		fillUptimeWindows(uptimes[i].Windows)
+	}
+
+	var incidents []models.ProbeIncident
+	if err := s.db.Where("group_id IN ? AND resolved_at IS NULL", groupIDs).Find(&incidents).Error; err != nil {
+		return nil, err
+	}
+	for i := range incidents {
+		byID[incidents[i].GroupID].OpenIncident = &incidents[i]
+	}
+
+	for _, groupID := range groupIDs {
+		uptime := byID[groupID]
+		var last models.ProbeResult
+		err := s.db.Where("group_id = ?", groupID).Order("checked_at desc, id desc").First(&last).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		uptime.LastCheckedAt = &last.CheckedAt
+		uptime.LastLatencyMs = last.LatencyMs
+		switch {
+		case uptime.OpenIncident != nil:
+			uptime.Status = ProbeStatusDown
+		case last.Success:
+			uptime.Status = ProbeStatusUp
+		default:
+			uptime.Status = ProbeStatusDegraded
+		}
+	}
+	for i := range uptimes {
+		if status, ok := paused[uptimes[i].GroupID]; ok {
+			uptimes[i].Status = status
+		}
+	}
+
+	return uptimes, nil
+}
+
+// groupPausedStatus returns the status of a group that is not probed because it is disabled or under maintenance.
+func groupPausedStatus(group *models.Group) string {
+	if !group.Enabled {
+		return ProbeStatusDisabled
+	}
+	if cfg := ParseMaintenanceConfig(group.MaintenanceConfig); cfg != nil && cfg.Enabled {
+		return ProbeStatusMaintenance
+	}
+	return ""
+}
+
+// fillUptimeWindows adds empty windows so every window is present in the response.
+func fillUptimeWindows(windows map[string]UptimeWindow) {
+	for _, window := range UptimeWindows {
+		if _, ok := windows[window.Name]; !ok {
+			windows[window.Name] = UptimeWindow{}
+		}
+	}
+}
+
+// probeResponseWriter captures the status and the beginning of the body of a probe response.
+type probeResponseWriter struct {
+	header http.Header
+	status int
+	body   strings.Builder
+}
+
+func newProbeResponseWriter() *probeResponseWriter {
+	return &probeResponseWriter{header: make(http.Header), status: http.StatusOK}
+}
+
+func (w *probeResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *probeResponseWriter) WriteHeader(status int) {
+	w.status = status
+}
+
+func (w *probeResponseWriter) Write(b []byte) (int, error) {
+	if remaining := maxProbeErrorLength - w.body.Len(); remaining > 0 {
+		w.body.Write(b[:min(len(b), remaining)])
+	}
+	return len(b), nil
+}
+
+// Flush lets streaming responses be probed.
+func (w *probeResponseWriter) Flush() {}
+
+// PublicGroupStatus is the availability of a group published on the public status endpoint.
+type PublicGroupStatus struct {
+	Name          string              `json:"name"`
+	DisplayName   string              `json:"display_name,omitempty"`
+	Status        string              `json:"status"`
+	Uptime        map[string]*float64 `json:"uptime"`
+	IncidentSince *time.Time          `json:"incident_since,omitempty"`
+}
+
+// PublicStatus is the response of the public status endpoint.
+type PublicStatus struct {
+	Status    string              `json:"status"`
+	Groups    []PublicGroupStatus `json:"groups"`
+	UpdatedAt time.Time           `json:"updated_at"`
+}
+
+// GetPublicStatus returns the status of all groups with probes enabled, without error details.
+// The result is cached briefly because the endpoint is unauthenticated.
+func (s *ProbeService) GetPublicStatus() (*PublicStatus, error) {
+	s.publicMu.Lock()
+	defer s.publicMu.Unlock()
+	if s.publicStatus != nil && time.Since(s.publicStatus.UpdatedAt) < publicStatusCacheTTL {
+		return s.publicStatus, nil
+	}
+
+	var groups []models.Group
+	if err := s.db.Select("id", "name", "display_name", "probe_config", "enabled", "maintenance_config").Order("sort asc, id desc").Find(&groups).Error; err != nil {
+		return nil, err
+	}
+	uptimes, err := s.GetUptime(groups)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &PublicStatus{Status: ProbeStatusUp, Groups: make([]PublicGroupStatus, 0, len(uptimes)), UpdatedAt: time.Now()}
+	for _, uptime := range uptimes {
+		groupStatus := PublicGroupStatus{
+			Name:        uptime.GroupName,
+			DisplayName: uptime.DisplayName,
+			Status:      uptime.Status,
+			Uptime:      make(map[string]*float64, len(uptime.Windows)),
+		}
+		for name, window := range uptime.Windows {
+			groupStatus.Uptime[name] = window.UptimePercent
+		}
+		if uptime.OpenIncident != nil {
+			groupStatus.IncidentSince = &uptime.OpenIncident.StartedAt
+		}
+		status.Groups = append(status.Groups, groupStatus)
+
+		switch {
+		case uptime.Status == ProbeStatusDown:
+			status.Status = ProbeStatusDown
+		case uptime.Status == ProbeStatusDegraded && status.Status == ProbeStatusUp:
+			status.Status = ProbeStatusDegraded
+		}
+	}
+
+	s.publicStatus = status
+	return status, nil
+}
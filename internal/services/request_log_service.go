@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"gpt-load/internal/config"
+	"gpt-load/internal/encryption"
 	"gpt-load/internal/models"
 	"gpt-load/internal/store"
 	"strings"
@@ -25,21 +26,23 @@ const (
 
 // RequestLogService is responsible for managing request logs.
 type RequestLogService struct {
-	db              *gorm.DB
-	store           store.Store
-	settingsManager *config.SystemSettingsManager
-	stopChan        chan struct{}
-	wg              sync.WaitGroup
-	ticker          *time.Ticker
+	db                *gorm.DB
+	store             store.Store
+	settingsManager   *config.SystemSettingsManager
+	encryptionService *encryption.Service
+	stopChan          chan struct{}
+	wg                sync.WaitGroup
+	ticker            *time.Ticker
 }
 
 // NewRequestLogService creates a new RequestLogService instance
-func NewRequestLogService(db *gorm.DB, store store.Store, sm *config.SystemSettingsManager) *RequestLogService {
+func NewRequestLogService(db *gorm.DB, store store.Store, sm *config.SystemSettingsManager, encryptionService *encryption.Service) *RequestLogService {
 	return &RequestLogService{
-		db:              db,
-		store:           store,
-		settingsManager: sm,
-		stopChan:        make(chan struct{}),
+		db:                db,
+		store:             store,
+		settingsManager:   sm,
+		encryptionService: encryptionService,
+		stopChan:          make(chan struct{}),
 	}
 }
 
@@ -111,7 +114,15 @@ func (s *RequestLogService) Record(log *models.RequestLog) error {
 
 	cacheKey := RequestLogCachePrefix + log.ID
 
-	logBytes, err := json.Marshal(log)
+	// Keep the key encrypted while the log waits in the store
+	cachedLog := *log
+	keyValue, err := s.encryptionService.Encrypt(log.KeyValue)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt request log key: %w", err)
+	}
+	cachedLog.KeyValue = keyValue
+
+	logBytes, err := json.Marshal(&cachedLog)
 	if err != nil {
 		return fmt.Errorf("failed to marshal request log: %w", err)
 	}
@@ -163,6 +174,10 @@ func (s *RequestLogService) flush() {
 				logrus.Warnf("Failed to unmarshal log for key %s: %v", key, err)
 				continue
 			}
+			if log.KeyValue, err = s.encryptionService.Decrypt(log.KeyValue); err != nil {
+				logrus.Warnf("Failed to decrypt log for key %s: %v", key, err)
+				continue
+			}
 			logs = append(logs, &log)
 			processedKeys = append(processedKeys, key)
 		}
@@ -202,6 +217,12 @@ func (s *RequestLogService) writeLogsToDB(logs []*models.RequestLog) error {
 		return nil
 	}
 
+	for _, log := range logs {
+		if log.KeyValue != "" {
+			log.KeyHash = s.encryptionService.Hash(log.KeyValue)
+		}
+	}
+
 	return s.db.Transaction(func(tx *gorm.DB) error {
 		if err := tx.CreateInBatches(logs, len(logs)).Error; err != nil {
 			return fmt.Errorf("failed to batch insert request logs: %w", err)
@@ -209,22 +230,22 @@ func (s *RequestLogService) writeLogsToDB(logs []*models.RequestLog) error {
 
 		keyStats := make(map[string]int64)
 		for _, log := range logs {
-			if log.IsSuccess && log.KeyValue != "" {
-				keyStats[log.KeyValue]++
+			if log.IsSuccess && log.KeyHash != "" {
+				keyStats[log.KeyHash]++
 			}
 		}
 
 		if len(keyStats) > 0 {
 			var caseStmt strings.Builder
-			var keyValues []string
-			caseStmt.WriteString("CASE key_value ")
-			for keyValue, count := range keyStats {
-				caseStmt.WriteString(fmt.Sprintf("WHEN '%s' THEN request_count + %d ", keyValue, count))
-				keyValues = append(keyValues, keyValue)
+			var keyHashes []string
+			caseStmt.WriteString("CASE key_hash ")
+			for keyHash, count := range keyStats {
+				caseStmt.WriteString(fmt.Sprintf("WHEN '%s' THEN request_count + %d ", keyHash, count))
+				keyHashes = append(keyHashes, keyHash)
 			}
 			caseStmt.WriteString("END")
 
-			if err := tx.Model(&models.APIKey{}).Where("key_value IN ?", keyValues).
+			if err := tx.Model(&models.APIKey{}).Where("key_hash IN ?", keyHashes).
 				Updates(map[string]any{
 					"request_count": gorm.Expr(caseStmt.String()),
 					"last_used_at":  time.Now(),
@@ -0,0 +1,267 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gpt-load/internal/auth"
+	"gpt-load/internal/store"
+	"gpt-load/internal/types"
+)
+
+const (
+	sessionTokenPrefix      = "gls_"
+	refreshTokenPrefix      = "glr_"
+	sessionKeyPrefix        = "session:"
+	userSessionsEpochPrefix = "session_epoch:"
+)
+
+// ErrSessionExpired is returned for a genuine session token that has expired or was revoked.
+// Unlike ErrInvalidCredentials it does not indicate a guessing attempt.
+var ErrSessionExpired = errors.New("session expired")
+
+// Session is a pair of a short-lived signed access token and a refresh token.
+type Session struct {
+	Token        string    `json:"token"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// sessionRecord is the server side state of a session, used for refresh and revocation.
+type sessionRecord struct {
+	UserID      uint   `json:"user_id"`
+	IsRoot      bool   `json:"is_root"`
+	RefreshHash string `json:"refresh_hash"`
+	CreatedAt   int64  `json:"created_at"` // Unix nanoseconds
+}
+
+// sessionClaims is the signed payload of an access token.
+type sessionClaims struct {
+	SessionID string `json:"sid"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// SessionService issues, refreshes and revokes admin sessions.
+// Sessions live in the store so that every cluster node can verify and revoke them.
+type SessionService struct {
+	store       store.Store
+	authConfig  types.AuthConfig
+	userService *AdminUserService
+	signingKey  []byte
+}
+
+// NewSessionService creates a new SessionService.
+// The signing key is derived from AUTH_KEY, so changing it invalidates all sessions.
+func NewSessionService(store store.Store, configManager types.ConfigManager, userService *AdminUserService) *SessionService {
+	authConfig := configManager.GetAuthConfig()
+	mac := hmac.New(sha256.New, []byte(authConfig.Key))
+	mac.Write([]byte("gpt-load-session"))
+
+	return &SessionService{
+		store:       store,
+		authConfig:  authConfig,
+		userService: userService,
+		signingKey:  mac.Sum(nil),
+	}
+}
+
+// IsSessionToken reports whether a credential looks like a session access token.
+func IsSessionToken(credential string) bool {
+	return strings.HasPrefix(credential, sessionTokenPrefix)
+}
+
+// Create starts a new session for the principal.
+func (s *SessionService) Create(principal *auth.Principal) (*Session, error) {
+	sessionID, err := randomToken(16)
+	if err != nil {
+		return nil, err
+	}
+
+	record := &sessionRecord{
+		UserID:    principal.UserID,
+		IsRoot:    principal.IsRoot,
+		CreatedAt: time.Now().UnixNano(),
+	}
+	return s.issue(sessionID, record)
+}
+
+// Authenticate verifies an access token and returns the principal of its session.
+func (s *SessionService) Authenticate(token string) (*auth.Principal, error) {
+	claims, err := s.parseToken(token)
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, ErrSessionExpired
+	}
+
+	record, err := s.getRecord(claims.SessionID)
+	if err != nil {
+		if errors.Is(err, ErrInvalidCredentials) {
+			return nil, ErrSessionExpired
+		}
+		return nil, err
+	}
+	principal, err := s.principalFor(claims.SessionID, record)
+	if errors.Is(err, ErrInvalidCredentials) {
+		return nil, ErrSessionExpired
+	}
+	return principal, err
+}
+
+// Refresh exchanges a refresh token for a new session token pair. The old refresh token stops working.
+func (s *SessionService) Refresh(refreshToken string) (*Session, error) {
+	sessionID, secret, ok := strings.Cut(strings.TrimPrefix(refreshToken, refreshTokenPrefix), ".")
+	if !strings.HasPrefix(refreshToken, refreshTokenPrefix) || !ok || sessionID == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	record, err := s.getRecord(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hashAdminToken(secret)), []byte(record.RefreshHash)) != 1 {
+		return nil, ErrInvalidCredentials
+	}
+	if _, err := s.principalFor(sessionID, record); err != nil {
+		return nil, err
+	}
+
+	return s.issue(sessionID, record)
+}
+
+// Revoke ends a session.
+func (s *SessionService) Revoke(sessionID string) error {
+	return s.store.Delete(sessionKeyPrefix + sessionID)
+}
+
+// RevokeUserSessions ends all sessions of a user that were started before now.
+func (s *SessionService) RevokeUserSessions(userID uint) error {
+	epoch := strconv.FormatInt(time.Now().UnixNano(), 10)
+	return s.store.Set(fmt.Sprintf("%s%d", userSessionsEpochPrefix, userID), []byte(epoch), s.refreshTTL())
+}
+
+// issue rotates the refresh secret of a session and signs a new access token for it.
+func (s *SessionService) issue(sessionID string, record *sessionRecord) (*Session, error) {
+	secret, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	record.RefreshHash = hashAdminToken(secret)
+
+	// The refresh lifetime is absolute, refreshing does not extend the session.
+	ttl := time.Until(time.Unix(0, record.CreatedAt).Add(s.refreshTTL()))
+	if ttl <= 0 {
+		return nil, ErrInvalidCredentials
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.store.Set(sessionKeyPrefix+sessionID, data, ttl); err != nil {
+		return nil, fmt.Errorf("failed to save session: %w", err)
+	}
+
+	expiresAt := time.Now().Add(time.Duration(s.authConfig.SessionTTLMinutes) * time.Minute)
+	payload, err := json.Marshal(sessionClaims{SessionID: sessionID, ExpiresAt: expiresAt.Unix()})
+	if err != nil {
+		return nil, err
+	}
+	encodedPayload := base64.RawURLEncoding.EncodeToString(payload)
+
+	return &Session{
+		Token:        sessionTokenPrefix + encodedPayload + "." + s.sign(encodedPayload),
+		RefreshToken: refreshTokenPrefix + sessionID + "." + secret,
+		ExpiresAt:    expiresAt,
+	}, nil
+}
+
+// parseToken verifies the signature of an access token and decodes its claims.
+func (s *SessionService) parseToken(token string) (*sessionClaims, error) {
+	encodedPayload, signature, ok := strings.Cut(strings.TrimPrefix(token, sessionTokenPrefix), ".")
+	if !IsSessionToken(token) || !ok {
+		return nil, ErrInvalidCredentials
+	}
+	if !hmac.Equal([]byte(signature), []byte(s.sign(encodedPayload))) {
+		return nil, ErrInvalidCredentials
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	var claims sessionClaims
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.SessionID == "" {
+		return nil, ErrInvalidCredentials
+	}
+	return &claims, nil
+}
+
+// principalFor resolves the principal of a session, rejecting sessions of disabled or revoked users.
+func (s *SessionService) principalFor(sessionID string, record *sessionRecord) (*auth.Principal, error) {
+	var principal *auth.Principal
+	if record.IsRoot {
+		principal = auth.RootPrincipal()
+	} else {
+		epoch, err := s.store.Get(fmt.Sprintf("%s%d", userSessionsEpochPrefix, record.UserID))
+		if err == nil {
+			if revokedAt, _ := strconv.ParseInt(string(epoch), 10, 64); record.CreatedAt < revokedAt {
+				return nil, ErrInvalidCredentials
+			}
+		} else if !errors.Is(err, store.ErrNotFound) {
+			return nil, err
+		}
+
+		principal, err = s.userService.PrincipalForUser(record.UserID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	principal.SessionID = sessionID
+	return principal, nil
+}
+
+func (s *SessionService) getRecord(sessionID string) (*sessionRecord, error) {
+	data, err := s.store.Get(sessionKeyPrefix + sessionID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+
+	var record sessionRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+	return &record, nil
+}
+
+func (s *SessionService) sign(payload string) string {
+	mac := hmac.New(sha256.New, s.signingKey)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (s *SessionService) refreshTTL() time.Duration {
+	return time.Duration(s.authConfig.RefreshTTLHours) * time.Hour
+}
+
+// randomToken returns n random bytes as a hex string.
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,367 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"gpt-load/internal/auth"
+	"gpt-load/internal/models"
+	"gpt-load/internal/oidc"
+	"gpt-load/internal/store"
+	"gpt-load/internal/types"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const (
+	ssoStatePrefix = "oidc_state:"
+	SSOStateTTL    = 10 * time.Minute // how long a started login stays valid
+)
+
+var (
+	// ErrSSODisabled is returned when single sign-on is not configured.
+	ErrSSODisabled = errors.New("single sign-on is not configured")
+	// ErrSSODenied is returned when the identity provider user maps to no role.
+	ErrSSODenied = errors.New("your account is not authorized to access gpt-load")
+)
+
+// roleRanks orders roles by privilege, so that the highest mapped role wins.
+var roleRanks = map[string]int{
+	models.RoleViewer:     1,
+	models.RoleMaintainer: 2,
+	models.RoleOperator:   3,
+	models.RoleAdmin:      4,
+}
+
+// ssoState is kept in the store between the redirect to the provider and the callback.
+type ssoState struct {
+	CodeVerifier string `json:"code_verifier"`
+	Nonce        string `json:"nonce"`
+	RedirectURI  string `json:"redirect_uri"`
+}
+
+// roleMapping maps a claim value to a role, and for maintainers to group names.
+type roleMapping struct {
+	Value  string
+	Role   string
+	Groups []string
+}
+
+// SSOService implements OpenID Connect single sign-on for the admin console.
+type SSOService struct {
+	DB             *gorm.DB
+	store          store.Store
+	config         types.OIDCConfig
+	provider       *oidc.Provider
+	mappings       []roleMapping
+	userService    *AdminUserService
+	sessionService *SessionService
+}
+
+// NewSSOService creates a new SSOService.
+func NewSSOService(
+	db *gorm.DB,
+	store store.Store,
+	configManager types.ConfigManager,
+	userService *AdminUserService,
+	sessionService *SessionService,
+) (*SSOService, error) {
+	config := configManager.GetOIDCConfig()
+	service := &SSOService{
+		DB:             db,
+		store:          store,
+		config:         config,
+		userService:    userService,
+		sessionService: sessionService,
+	}
+	if !config.Enabled() {
+		return service, nil
+	}
+
+	mappings, err := parseRoleMapping(config.RoleMapping)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OIDC_ROLE_MAPPING: %w", err)
+	}
+	if config.DefaultRole != "" && !auth.IsValidRole(config.DefaultRole) {
+		return nil, fmt.Errorf("invalid OIDC_DEFAULT_ROLE '%s'", config.DefaultRole)
+	}
+	if config.DefaultRole == models.RoleMaintainer {
+		return nil, errors.New("OIDC_DEFAULT_ROLE cannot be maintainer, map maintainers to groups in OIDC_ROLE_MAPPING")
+	}
+
+	service.mappings = mappings
+	service.provider = oidc.NewProvider(oidc.Config{
+		Issuer:       config.Issuer,
+		ClientID:     config.ClientID,
+		ClientSecret: config.ClientSecret,
+		Scopes:       config.Scopes,
+	})
+	return service, nil
+}
+
+// IsEnabled reports whether single sign-on is configured.
+func (s *SSOService) IsEnabled() bool {
+	return s.provider != nil
+}
+
+// DisplayName returns the name of the identity provider shown on the login page.
+func (s *SSOService) DisplayName() string {
+	return s.config.DisplayName
+}
+
+// RedirectURL returns the configured callback URL registered at the provider.
+func (s *SSOService) RedirectURL() string {
+	return s.config.RedirectURL
+}
+
+// BeginLogin starts an authorization code flow with PKCE and returns the URL of the provider login page
+// and the state, which the caller must bind to the browser starting the login.
+func (s *SSOService) BeginLogin(ctx context.Context, redirectURI string) (authURL, state string, err error) {
+	if !s.IsEnabled() {
+		return "", "", ErrSSODisabled
+	}
+
+	state, err = oidc.RandomString(24)
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := oidc.RandomString(24)
+	if err != nil {
+		return "", "", err
+	}
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil {
+		return "", "", err
+	}
+
+	authURL, err = s.provider.AuthCodeURL(ctx, redirectURI, state, nonce, challenge)
+	if err != nil {
+		return "", "", err
+	}
+
+	data, err := json.Marshal(ssoState{CodeVerifier: verifier, Nonce: nonce, RedirectURI: redirectURI})
+	if err != nil {
+		return "", "", err
+	}
+	if err := s.store.Set(ssoStatePrefix+state, data, SSOStateTTL); err != nil {
+		return "", "", fmt.Errorf("failed to save login state: %w", err)
+	}
+	return authURL, state, nil
+}
+
+// SSOStateBinding returns the value of the browser cookie binding a login state to the browser that started it.
+func SSOStateBinding(state string) string {
+	sum := sha256.Sum256([]byte(state))
+	return hex.EncodeToString(sum[:])
+}
+
+// CheckStateBinding reports whether the cookie of the browser matches the state of the callback.
+func CheckStateBinding(state, binding string) bool {
+	if state == "" || binding == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(SSOStateBinding(state)), []byte(binding)) == 1
+}
+
+// CompleteLogin handles the provider callback and starts a session for the mapped user.
+func (s *SSOService) CompleteLogin(ctx context.Context, code, state string) (*Session, error) {
+	if !s.IsEnabled() {
+		return nil, ErrSSODisabled
+	}
+
+	loginState, err := s.takeState(state)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := s.provider.Exchange(ctx, code, loginState.CodeVerifier, loginState.RedirectURI)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := s.provider.VerifyIDToken(ctx, token.IDToken, loginState.Nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	// Providers often omit group claims from the ID token, fill them in from userinfo.
+	if lookupClaim(claims, s.config.RoleClaim) == nil || lookupClaim(claims, s.config.UsernameClaim) == nil {
+		userInfo, err := s.provider.UserInfo(ctx, token.AccessToken)
+		if err != nil {
+			return nil, err
+		}
+		if sub, _ := userInfo["sub"].(string); userInfo != nil && sub == claims["sub"] {
+			for name, value := range userInfo {
+				if _, exists := claims[name]; !exists {
+					claims[name] = value
+				}
+			}
+		}
+	}
+
+	external, err := s.mapUser(claims)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.userService.LoginExternalUser(*external)
+	if err != nil {
+		return nil, err
+	}
+
+	logrus.Infof("Admin user %s logged in through single sign-on as %s", user.Username, user.Role)
+	return s.sessionService.Create(&auth.Principal{UserID: user.ID, Username: user.Username, Role: user.Role})
+}
+
+// takeState loads and deletes the state of a login, so that each state can only be used once.
+func (s *SSOService) takeState(state string) (*ssoState, error) {
+	if state == "" {
+		return nil, errors.New("missing login state")
+	}
+	data, err := s.store.Get(ssoStatePrefix + state)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, errors.New("login state is invalid or has expired, please try again")
+		}
+		return nil, err
+	}
+	if err := s.store.Delete(ssoStatePrefix + state); err != nil {
+		return nil, err
+	}
+
+	var loginState ssoState
+	if err := json.Unmarshal(data, &loginState); err != nil {
+		return nil, err
+	}
+	return &loginState, nil
+}
+
+// mapUser derives the account name, role and groups of a provider user from its claims.
+func (s *SSOService) mapUser(claims oidc.Claims) (*ExternalUser, error) {
+	subject, _ := claims["sub"].(string)
+
+	username := firstClaimString(claims, s.config.UsernameClaim, "preferred_username", "email", "sub")
+	if len(username) > maxAdminUsernameLength {
+		username = username[:maxAdminUsernameLength]
+	}
+
+	values := claimStrings(lookupClaim(claims, s.config.RoleClaim))
+	role := ""
+	var groupNames []string
+	for _, mapping := range s.mappings {
+		if !slices.Contains(values, mapping.Value) {
+			continue
+		}
+		if roleRanks[mapping.Role] > roleRanks[role] {
+			role = mapping.Role
+		}
+		groupNames = append(groupNames, mapping.Groups...)
+	}
+	if role == "" {
+		role = s.config.DefaultRole
+	}
+	if role == "" {
+		return nil, ErrSSODenied
+	}
+
+	external := &ExternalUser{Subject: subject, Username: username, Role: role, GroupIDs: []uint{}}
+	if role == models.RoleMaintainer {
+		var groups []models.Group
+		if err := s.DB.Select("id, name").Where("name IN ?", groupNames).Find(&groups).Error; err != nil {
+			return nil, err
+		}
+		if len(groups) < len(slices.Compact(slices.Sorted(slices.Values(groupNames)))) {
+			logrus.Warnf("Some groups mapped to SSO user %s do not exist: %v", username, groupNames)
+		}
+		for _, group := range groups {
+			external.GroupIDs = append(external.GroupIDs, group.ID)
+		}
+	}
+	return external, nil
+}
+
+// parseRoleMapping parses entries like "gpt-admins=admin;team-a=maintainer:group-a,group-b".
+func parseRoleMapping(value string) ([]roleMapping, error) {
+	var mappings []roleMapping
+	for _, entry := range strings.Split(value, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		claimValue, target, ok := strings.Cut(entry, "=")
+		claimValue = strings.TrimSpace(claimValue)
+		if !ok || claimValue == "" {
+			return nil, fmt.Errorf("entry '%s' must have the form value=role", entry)
+		}
+
+		role, groupList, hasGroups := strings.Cut(strings.TrimSpace(target), ":")
+		if !auth.IsValidRole(role) {
+			return nil, fmt.Errorf("entry '%s' has unknown role '%s'", entry, role)
+		}
+		if hasGroups != (role == models.RoleMaintainer) {
+			return nil, fmt.Errorf("entry '%s': groups must be given for maintainers and only for maintainers", entry)
+		}
+
+		mapping := roleMapping{Value: claimValue, Role: role}
+		for _, group := range strings.Split(groupList, ",") {
+			if group = strings.TrimSpace(group); group != "" {
+				mapping.Groups = append(mapping.Groups, group)
+			}
+		}
+		mappings = append(mappings, mapping)
+	}
+	return mappings, nil
+}
+
+// lookupClaim resolves a claim by name, or by a dotted path for nested claims like "realm_access.roles".
+func lookupClaim(claims oidc.Claims, name string) any {
+	if value, ok := claims[name]; ok {
+		return value
+	}
+	var current any = map[string]any(claims)
+	for _, part := range strings.Split(name, ".") {
+		object, ok := current.(map[string]any)
+		if !ok {
+			return nil
+		}
+		if current, ok = object[part]; !ok {
+			return nil
+		}
+	}
+	return current
+}
+
+// claimStrings converts a string or array claim into a list of strings.
+func claimStrings(value any) []string {
+	switch v := value.(type) {
+	case string:
+		return strings.Fields(strings.ReplaceAll(v, ",", " "))
+	case []any:
+		result := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				result = append(result, s)
+			}
+		}
+		return result
+	}
+	return nil
+}
+
+// firstClaimString returns the first non-empty string claim of the given names.
+func firstClaimString(claims oidc.Claims, names ...string) string {
+	for _, name := range names {
+		if value, ok := lookupClaim(claims, name).(string); ok && value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -1,16 +1,29 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"gpt-load/internal/store"
+	"strconv"
+	"sync"
 	"time"
+
+	"gpt-load/internal/models"
+	"gpt-load/internal/store"
+
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
 )
 
 const (
-	globalTaskKey = "global_task"
-	ResultTTL     = 60 * time.Minute
+	// taskGroupLockPrefix 每个分组同时只能运行一个任务，锁的值为任务 ID
+	taskGroupLockPrefix = "task:group:"
+	// taskPoolLockPrefix 引用同一密钥池的分组共享 Key，每个密钥池同时也只能运行一个任务
+	taskPoolLockPrefix = "task:pool:"
+	// taskCancelPrefix 取消请求可能落在其他实例上，通过存储通知运行任务的实例
+	taskCancelPrefix       = "task:cancel:"
+	taskCancelPollInterval = 2 * time.Second
 )
 
 const (
@@ -19,10 +32,20 @@ const (
 	TaskTypeKeyDelete     = "KEY_DELETE"
 )
 
+var (
+	// ErrTaskNotRunning is returned when cancelling a task that has already finished.
+	ErrTaskNotRunning = errors.New("the task is not running")
+	// errTaskInterrupted is recorded for running tasks whose instance stopped before they finished.
+	errTaskInterrupted = errors.New("the task was interrupted before it finished")
+)
+
 // TaskStatus represents the full lifecycle of a long-running task.
 type TaskStatus struct {
+	ID              uint       `json:"id"`
 	TaskType        string     `json:"task_type"`
+	Status          string     `json:"status"`
 	IsRunning       bool       `json:"is_running"`
+	GroupID         uint       `json:"group_id,omitempty"`
 	GroupName       string     `json:"group_name,omitempty"`
 	Processed       int        `json:"processed"`
 	Total           int        `json:"total"`
@@ -33,114 +56,349 @@ type TaskStatus struct {
 	DurationSeconds float64    `json:"duration_seconds,omitempty"`
 }
 
-// TaskService manages the state of a single, global, long-running task using the store interface.
+// TaskFilter filters the task history.
+type TaskFilter struct {
+	GroupIDs []uint // Restricts the tasks to these groups when not nil
+	GroupID  uint
+	TaskType string
+	Status   string
+}
+
+// TaskService records long-running tasks in the database.
+// Tasks of different groups run concurrently, while each group, and each key pool, runs one task at a time.
 type TaskService struct {
+	db    *gorm.DB
 	store store.Store
+
+	mu      sync.Mutex
+	running map[uint]*TaskRun
 }
 
 // NewTaskService creates a new TaskService.
-func NewTaskService(store store.Store) *TaskService {
+func NewTaskService(db *gorm.DB, store store.Store) *TaskService {
 	return &TaskService{
-		store: store,
+		db:      db,
+		store:   store,
+		running: make(map[uint]*TaskRun),
 	}
 }
 
-// StartTask attempts to start a new task. It returns an error if a task is already running.
-func (s *TaskService) StartTask(taskType, groupName string, total int, timeout time.Duration) (*TaskStatus, error) {
-	currentStatus, err := s.GetTaskStatus()
+// TaskRun is a task running on this instance. Its context is cancelled when the task is
+// cancelled or times out, and the task must be ended with End.
+type TaskRun struct {
+	ID       uint
+	ctx      context.Context
+	cancel   context.CancelFunc
+	service  *TaskService
+	task     models.Task
+	poolLock string // Lock of the key pool the group references, empty for groups with their own keys
+	once     sync.Once
+}
+
+// StartTask records a new running task for the group. It returns an error if the group, or the key pool
+// it references, already has a running task. The task fails when it is not ended within the timeout.
+func (s *TaskService) StartTask(taskType string, group *models.Group, total int, timeout time.Duration) (*TaskRun, *TaskStatus, error) {
+	lockKey := taskGroupLockPrefix + strconv.FormatUint(uint64(group.ID), 10)
+	// 先以占位值加锁，创建任务记录后再写入任务 ID
+	acquired, err := s.store.SetNX(lockKey, []byte("0"), timeout)
 	if err != nil {
-		return nil, fmt.Errorf("failed to check current task status before starting a new one: %w", err)
+		return nil, nil, fmt.Errorf("failed to check the running task of the group: %w", err)
+	}
+	if !acquired {
+		return nil, nil, fmt.Errorf("a task is already running for group %s, please wait", group.Name)
 	}
 
-	if currentStatus.IsRunning {
-		return nil, errors.New("a task is already running, please wait")
+	var poolLock string
+	if owner := group.KeyOwner(); owner.IsPool() {
+		poolLock = taskPoolLockPrefix + strconv.FormatUint(uint64(owner.PoolID), 10)
+		acquired, err := s.store.SetNX(poolLock, []byte("0"), timeout)
+		if err != nil || !acquired {
+			_ = s.store.Delete(lockKey)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to check the running task of the key pool: %w", err)
+		}
+		if !acquired {
+			return nil, nil, fmt.Errorf("a task is already running for the key pool of group %s, please wait", group.Name)
+		}
 	}
 
-	status := &TaskStatus{
+	// 持有锁时仍处于运行状态的任务，其实例已在结束前退出
+	s.interruptRunningTasks(group.ID)
+
+	task := models.Task{
 		TaskType:  taskType,
-		IsRunning: true,
-		GroupName: groupName,
+		Status:    models.TaskStatusRunning,
+		GroupID:   group.ID,
+		GroupName: group.Name,
 		Total:     total,
-		Processed: 0,
 		StartedAt: time.Now(),
 	}
-	statusBytes, err := json.Marshal(status)
-	if err != nil {
-		return nil, fmt.Errorf("failed to serialize new task status: %w", err)
+	if err := s.db.Create(&task).Error; err != nil {
+		_ = s.store.Delete(lockKey)
+		if poolLock != "" {
+			_ = s.store.Delete(poolLock)
+		}
+		return nil, nil, fmt.Errorf("failed to record the task: %w", err)
 	}
-
-	if err := s.store.Set(globalTaskKey, statusBytes, timeout); err != nil {
-		return nil, fmt.Errorf("failed to set initial task status: %w", err)
+	for _, key := range []string{lockKey, poolLock} {
+		if key == "" {
+			continue
+		}
+		if err := s.store.Set(key, []byte(strconv.FormatUint(uint64(task.ID), 10)), timeout); err != nil {
+			logrus.WithError(err).Warnf("Failed to record task %d in the lock %s", task.ID, key)
+		}
 	}
 
-	return status, nil
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	run := &TaskRun{ID: task.ID, ctx: ctx, cancel: cancel, service: s, task: task, poolLock: poolLock}
+
+	s.mu.Lock()
+	s.running[task.ID] = run
+	s.mu.Unlock()
+	go run.watchCancellation()
+
+	return run, newTaskStatus(&task), nil
 }
 
-// GetTaskStatus returns the current status of the task.
-func (s *TaskService) GetTaskStatus() (*TaskStatus, error) {
-	statusBytes, err := s.store.Get(globalTaskKey)
-	if err != nil {
-		if errors.Is(err, store.ErrNotFound) {
-			return &TaskStatus{IsRunning: false}, nil
-		}
-		return nil, fmt.Errorf("failed to get task status: %w", err)
+// GetTask returns a task by ID.
+func (s *TaskService) GetTask(id uint) (*TaskStatus, error) {
+	var task models.Task
+	if err := s.db.First(&task, id).Error; err != nil {
+		return nil, err
 	}
+	s.reconcile(&task)
+	return newTaskStatus(&task), nil
+}
 
-	var status TaskStatus
-	if err := json.Unmarshal(statusBytes, &status); err != nil {
-		return nil, fmt.Errorf("failed to deserialize task status: %w", err)
+// ListTasks returns a query of the tasks matching the filter, newest first.
+func (s *TaskService) ListTasks(filter TaskFilter) *gorm.DB {
+	query := s.db.Model(&models.Task{}).Order("started_at desc, id desc")
+	if filter.GroupIDs != nil {
+		query = query.Where("group_id IN ?", filter.GroupIDs)
+	}
+	if filter.GroupID != 0 {
+		query = query.Where("group_id = ?", filter.GroupID)
 	}
+	if filter.TaskType != "" {
+		query = query.Where("task_type = ?", filter.TaskType)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	return query
+}
 
-	if !status.IsRunning && status.FinishedAt != nil {
-		status.DurationSeconds = status.FinishedAt.Sub(status.StartedAt).Seconds()
+// NewTaskStatuses converts the listed tasks, marking the interrupted ones.
+func (s *TaskService) NewTaskStatuses(tasks []models.Task) []*TaskStatus {
+	statuses := make([]*TaskStatus, 0, len(tasks))
+	for i := range tasks {
+		s.reconcile(&tasks[i])
+		statuses = append(statuses, newTaskStatus(&tasks[i]))
 	}
+	return statuses
+}
 
-	return &status, nil
+// GetTaskStatus returns the latest running task, or the latest finished one when none is running.
+// It is kept for clients that follow a single task.
+func (s *TaskService) GetTaskStatus(groupIDs []uint) (*TaskStatus, error) {
+	for _, status := range []string{models.TaskStatusRunning, ""} {
+		var task models.Task
+		err := s.ListTasks(TaskFilter{GroupIDs: groupIDs, Status: status}).First(&task).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get task status: %w", err)
+		}
+		if s.reconcile(&task) && status == models.TaskStatusRunning {
+			continue
+		}
+		return newTaskStatus(&task), nil
+	}
+	return &TaskStatus{IsRunning: false}, nil
 }
 
-// UpdateProgress updates the progress of the current task.
-func (s *TaskService) UpdateProgress(processed int) error {
-	status, err := s.GetTaskStatus()
-	if err != nil {
-		return err
+// CancelTask requests the cancellation of a running task. The task stops at its next checkpoint.
+func (s *TaskService) CancelTask(id uint) (*TaskStatus, error) {
+	var task models.Task
+	if err := s.db.First(&task, id).Error; err != nil {
+		return nil, err
 	}
-	if !status.IsRunning {
-		return nil
+	if s.reconcile(&task) || task.Status != models.TaskStatusRunning {
+		return nil, ErrTaskNotRunning
 	}
 
-	status.Processed = processed
-	statusBytes, err := json.Marshal(status)
-	if err != nil {
-		return fmt.Errorf("failed to serialize updated status: %w", err)
+	s.mu.Lock()
+	run := s.running[id]
+	s.mu.Unlock()
+	if run != nil {
+		run.cancel()
+	} else if err := s.store.Set(taskCancelKey(id), []byte("1"), time.Hour); err != nil {
+		return nil, fmt.Errorf("failed to request the cancellation: %w", err)
 	}
+	return newTaskStatus(&task), nil
+}
 
-	return s.store.Set(globalTaskKey, statusBytes, ResultTTL)
+// Context returns the context of the task, done when the task is cancelled or times out.
+func (r *TaskRun) Context() context.Context {
+	return r.ctx
 }
 
-// EndTask marks the current task as finished and stores its final result.
-func (s *TaskService) EndTask(resultData any, taskErr error) error {
-	status, err := s.GetTaskStatus()
-	if err != nil {
-		return fmt.Errorf("failed to get task object to end task: %w", err)
+// UpdateProgress records the number of processed items.
+func (r *TaskRun) UpdateProgress(processed int) error {
+	return r.service.db.Model(&models.Task{}).
+		Where("id = ? AND status = ?", r.ID, models.TaskStatusRunning).
+		Update("processed", processed).Error
+}
+
+// End records the result of the task and releases its group and key pool. A result is kept for failed
+// and cancelled tasks too, since it holds the work done before they stopped.
+func (r *TaskRun) End(result any, taskErr error) error {
+	var endErr error
+	r.once.Do(func() {
+		// 先记录上下文的状态，再释放上下文
+		ctxErr := r.ctx.Err()
+		r.cancel()
+
+		s := r.service
+		s.mu.Lock()
+		delete(s.running, r.ID)
+		s.mu.Unlock()
+
+		status := models.TaskStatusSucceeded
+		switch {
+		case errors.Is(ctxErr, context.Canceled):
+			status, taskErr = models.TaskStatusCancelled, errors.New("the task was cancelled")
+		case errors.Is(ctxErr, context.DeadlineExceeded):
+			status, taskErr = models.TaskStatusFailed, errors.New("the task timed out")
+		case taskErr != nil:
+			status = models.TaskStatusFailed
+		}
+
+		updates := map[string]any{"status": status, "finished_at": time.Now()}
+		if taskErr != nil {
+			updates["error"] = taskErr.Error()
+		}
+		if result != nil {
+			resultBytes, err := json.Marshal(result)
+			if err != nil {
+				endErr = fmt.Errorf("failed to serialize the task result: %w", err)
+			} else {
+				updates["result"] = resultBytes
+			}
+		}
+		if err := s.db.Model(&models.Task{}).Where("id = ?", r.ID).Updates(updates).Error; err != nil {
+			endErr = fmt.Errorf("failed to record the task result: %w", err)
+		}
+
+		s.releaseLock(taskGroupLockPrefix+strconv.FormatUint(uint64(r.task.GroupID), 10), r.ID)
+		if r.poolLock != "" {
+			s.releaseLock(r.poolLock, r.ID)
+		}
+		_ = s.store.Delete(taskCancelKey(r.ID))
+	})
+	return endErr
+}
+
+// watchCancellation cancels the task when another instance requests it.
+func (r *TaskRun) watchCancellation() {
+	ticker := time.NewTicker(taskCancelPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-ticker.C:
+			if exists, err := r.service.store.Exists(taskCancelKey(r.ID)); err == nil && exists {
+				r.cancel()
+				return
+			}
+		}
+	}
+}
+
+// reconcile marks a running task as failed when no instance is running it anymore,
+// and reports whether it did.
+func (s *TaskService) reconcile(task *models.Task) bool {
+	if task.Status != models.TaskStatusRunning {
+		return false
+	}
+	s.mu.Lock()
+	_, local := s.running[task.ID]
+	s.mu.Unlock()
+	if local {
+		return false
+	}
+
+	// 占位值表示另一个实例正在创建任务
+	holder, err := s.store.Get(taskGroupLockPrefix + strconv.FormatUint(uint64(task.GroupID), 10))
+	if err == nil && (string(holder) == strconv.FormatUint(uint64(task.ID), 10) || string(holder) == "0") {
+		return false
 	}
-	if !status.IsRunning {
-		return nil
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return false
 	}
 
 	now := time.Now()
-	status.IsRunning = false
-	status.FinishedAt = &now
-	status.DurationSeconds = now.Sub(status.StartedAt).Seconds()
-	if taskErr != nil {
-		status.Error = taskErr.Error()
-	} else {
-		status.Result = resultData
+	result := s.db.Model(&models.Task{}).Where("id = ? AND status = ?", task.ID, models.TaskStatusRunning).
+		Updates(map[string]any{"status": models.TaskStatusFailed, "error": errTaskInterrupted.Error(), "finished_at": now})
+	if result.Error != nil || result.RowsAffected == 0 {
+		// 任务可能刚好正常结束，重新读取
+		if err := s.db.First(task, task.ID).Error; err != nil {
+			logrus.WithError(err).Warnf("Failed to reload task %d", task.ID)
+		}
+		return false
 	}
+	task.Status = models.TaskStatusFailed
+	task.Error = errTaskInterrupted.Error()
+	task.FinishedAt = &now
+	return true
+}
 
-	updatedTaskBytes, err := json.Marshal(status)
+// interruptRunningTasks marks the running tasks of a group as interrupted. It is called while holding the group lock.
+func (s *TaskService) interruptRunningTasks(groupID uint) {
+	err := s.db.Model(&models.Task{}).Where("group_id = ? AND status = ?", groupID, models.TaskStatusRunning).
+		Updates(map[string]any{"status": models.TaskStatusFailed, "error": errTaskInterrupted.Error(), "finished_at": time.Now()}).Error
 	if err != nil {
-		return fmt.Errorf("failed to serialize final task status: %w", err)
+		logrus.WithError(err).Warnf("Failed to mark the interrupted tasks of group %d", groupID)
+	}
+}
+
+// releaseLock releases a group or key pool lock if it is still held by the task.
+func (s *TaskService) releaseLock(lockKey string, taskID uint) {
+	holder, err := s.store.Get(lockKey)
+	if err != nil || string(holder) != strconv.FormatUint(uint64(taskID), 10) {
+		return
+	}
+	if err := s.store.Delete(lockKey); err != nil {
+		logrus.WithError(err).Warnf("Failed to release the task lock %s", lockKey)
 	}
+}
+
+func taskCancelKey(id uint) string {
+	return taskCancelPrefix + strconv.FormatUint(uint64(id), 10)
+}
 
-	return s.store.Set(globalTaskKey, updatedTaskBytes, ResultTTL)
+func newTaskStatus(task *models.Task) *TaskStatus {
+	status := &TaskStatus{
+		ID:         task.ID,
+		TaskType:   task.TaskType,
+		Status:     task.Status,
+		IsRunning:  task.Status == models.TaskStatusRunning,
+		GroupID:    task.GroupID,
+		GroupName:  task.GroupName,
+		Processed:  task.Processed,
+		Total:      task.Total,
+		Error:      task.Error,
+		StartedAt:  task.StartedAt,
+		FinishedAt: task.FinishedAt,
+	}
+	if len(task.Result) > 0 && string(task.Result) != "null" {
+		status.Result = json.RawMessage(task.Result)
+	}
+	if task.FinishedAt != nil {
+		status.DurationSeconds = task.FinishedAt.Sub(task.StartedAt).Seconds()
+	}
+	return status
 }
@@ -0,0 +1,196 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"gpt-load/internal/models"
+	"gpt-load/internal/store"
+)
+
+func newTestTaskService(t *testing.T) *TaskService {
+	t.Helper()
+	return NewTaskService(newTestDB(t, &models.Task{}), store.NewMemoryStore())
+}
+
+func TestStartTaskLocksKeyPool(t *testing.T) {
+	s := newTestTaskService(t)
+	poolID := uint(1)
+	first := &models.Group{ID: 1, Name: "first", KeyPoolID: &poolID}
+	second := &models.Group{ID: 2, Name: "second", KeyPoolID: &poolID}
+	own := &models.Group{ID: 3, Name: "own-keys"}
+
+	run, _, err := s.StartTask(TaskTypeKeyValidation, first, 1, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.StartTask(TaskTypeKeyValidation, second, 1, time.Minute); err == nil {
+		t.Fatal("a group of a key pool with a running task should not start a task")
+	}
+	ownRun, _, err := s.StartTask(TaskTypeKeyValidation, own, 1, time.Minute)
+	if err != nil {
+		t.Fatalf("a group with its own keys should start a task: %v", err)
+	}
+	defer ownRun.End(nil, nil)
+
+	if err := run.End(nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	// 获取密钥池锁失败时，分组锁也已释放
+	secondRun, _, err := s.StartTask(TaskTypeKeyValidation, second, 1, time.Minute)
+	if err != nil {
+		t.Fatalf("the key pool should be released when the task ends: %v", err)
+	}
+	defer secondRun.End(nil, nil)
+	if _, _, err := s.StartTask(TaskTypeKeyValidation, first, 1, time.Minute); err == nil {
+		t.Error("the key pool should be locked by the task of the other group")
+	}
+}
+
+func TestStartTaskLocksGroup(t *testing.T) {
+	s := newTestTaskService(t)
+	group := &models.Group{ID: 1, Name: "openai"}
+
+	run, status, err := s.StartTask(TaskTypeKeyImport, group, 10, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.IsRunning || status.Total != 10 {
+		t.Errorf("status = %+v, want a running task of 10 items", status)
+	}
+	if _, _, err := s.StartTask(TaskTypeKeyDelete, group, 1, time.Minute); err == nil {
+		t.Fatal("a group with a running task should not start another one")
+	}
+
+	if err := run.UpdateProgress(4); err != nil {
+		t.Fatal(err)
+	}
+	if err := run.End(map[string]int{"added": 4}, nil); err != nil {
+		t.Fatal(err)
+	}
+	task, err := s.GetTask(run.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.Status != models.TaskStatusSucceeded || task.Processed != 4 || task.Result == nil || task.FinishedAt == nil {
+		t.Errorf("task = %+v, want the recorded result", task)
+	}
+
+	next, _, err := s.StartTask(TaskTypeKeyDelete, group, 1, time.Minute)
+	if err != nil {
+		t.Fatalf("the group should be released when the task ends: %v", err)
+	}
+	next.End(nil, nil)
+}
+
+func TestCancelTask(t *testing.T) {
+	s := newTestTaskService(t)
+	run, _, err := s.StartTask(TaskTypeKeyValidation, &models.Group{ID: 1, Name: "openai"}, 1, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.CancelTask(run.ID); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-run.Context().Done():
+	default:
+		t.Fatal("cancelling a local task should cancel its context")
+	}
+	if err := run.End(nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	task, err := s.GetTask(run.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.Status != models.TaskStatusCancelled {
+		t.Errorf("status = %s, want cancelled", task.Status)
+	}
+
+	if _, err := s.CancelTask(run.ID); !errors.Is(err, ErrTaskNotRunning) {
+		t.Errorf("cancelling a finished task: err = %v, want ErrTaskNotRunning", err)
+	}
+}
+
+func TestTaskTimeout(t *testing.T) {
+	s := newTestTaskService(t)
+	run, _, err := s.StartTask(TaskTypeKeyValidation, &models.Group{ID: 1, Name: "openai"}, 1, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-run.Context().Done()
+	if err := run.End(nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	task, err := s.GetTask(run.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.Status != models.TaskStatusFailed || task.Error != "the task timed out" {
+		t.Errorf("task = %+v, want it failed after the timeout", task)
+	}
+}
+
+func TestCancelTaskFromAnotherInstance(t *testing.T) {
+	running := newTestTaskService(t)
+	// 两个实例共享数据库和存储
+	other := NewTaskService(running.db, running.store)
+
+	run, _, err := running.StartTask(TaskTypeKeyValidation, &models.Group{ID: 1, Name: "openai"}, 1, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer run.End(nil, nil)
+
+	// 锁仍由任务持有，其他实例不会将其视为中断
+	status, err := other.GetTask(run.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.IsRunning {
+		t.Fatalf("status = %+v, want the task running on the other instance", status)
+	}
+
+	if _, err := other.CancelTask(run.ID); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-run.Context().Done():
+	case <-time.After(3 * taskCancelPollInterval):
+		t.Fatal("the task should be cancelled by the request of the other instance")
+	}
+}
+
+func TestReconcileInterruptedTask(t *testing.T) {
+	s := newTestTaskService(t)
+	group := &models.Group{ID: 1, Name: "openai"}
+	run, _, err := s.StartTask(TaskTypeKeyValidation, group, 1, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	run.cancel()
+
+	// 实例退出后锁随之失效，由新的实例读取任务
+	restarted := NewTaskService(s.db, store.NewMemoryStore())
+	status, err := restarted.GetTask(run.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Status != models.TaskStatusFailed || status.Error != errTaskInterrupted.Error() {
+		t.Errorf("status = %+v, want the task marked as interrupted", status)
+	}
+	if _, err := restarted.CancelTask(run.ID); !errors.Is(err, ErrTaskNotRunning) {
+		t.Errorf("cancelling an interrupted task: err = %v, want ErrTaskNotRunning", err)
+	}
+
+	latest, err := restarted.GetTaskStatus(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest.IsRunning || latest.ID != run.ID {
+		t.Errorf("latest status = %+v, want the interrupted task as finished", latest)
+	}
+}
@@ -1,6 +1,8 @@
 package store
 
 import (
+	"bytes"
+	"container/heap"
 	"fmt"
 	"strconv"
 	"sync"
@@ -146,6 +148,46 @@ func (s *MemoryStore) SetNX(key string, value []byte, ttl time.Duration) (bool,
 	return true, nil
 }
 
+// CompareAndSet sets a key-value pair only if the key currently holds the expected value.
+func (s *MemoryStore) CompareAndSet(key string, expected, value []byte, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.holdsLocked(key, expected) {
+		return false, nil
+	}
+	var expiresAt int64
+	if ttl > 0 {
+		expiresAt = time.Now().UnixNano() + ttl.Nanoseconds()
+	}
+	s.data[key] = memoryStoreItem{
+		value:     value,
+		expiresAt: expiresAt,
+	}
+	return true, nil
+}
+
+// CompareAndDelete removes a key only if it currently holds the expected value.
+func (s *MemoryStore) CompareAndDelete(key string, expected []byte) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.holdsLocked(key, expected) {
+		return false, nil
+	}
+	delete(s.data, key)
+	return true, nil
+}
+
+// holdsLocked reports whether the unexpired value of a key equals expected. The caller must hold s.mu.
+func (s *MemoryStore) holdsLocked(key string, expected []byte) bool {
+	item, ok := s.data[key].(memoryStoreItem)
+	if !ok || (item.expiresAt > 0 && time.Now().UnixNano() > item.expiresAt) {
+		return false
+	}
+	return bytes.Equal(item.value, expected)
+}
+
 // --- HASH operations ---
 
 func (s *MemoryStore) HSet(key string, values map[string]any) error {
@@ -302,6 +344,141 @@ func (s *MemoryStore) Rotate(key string) (string, error) {
 	return item, nil
 }
 
+// --- WEIGHTED ROTATION operations ---
+
+// weightedRotation is a min-heap of the members ordered by their next turn, like a Redis sorted set,
+// so that selecting a member does not scan the whole rotation.
+type weightedRotation struct {
+	heap    rotationHeap
+	members map[string]*rotationMember
+}
+
+// rotationMember is a member of a weighted rotation with its next turn and its weight.
+type rotationMember struct {
+	name   string
+	turn   float64
+	weight int
+	index  int // Position in the heap
+}
+
+// rotationHeap implements heap.Interface, ties are broken by member name like a Redis sorted set.
+type rotationHeap []*rotationMember
+
+func (h rotationHeap) Len() int { return len(h) }
+
+func (h rotationHeap) Less(i, j int) bool {
+	if h[i].turn != h[j].turn {
+		return h[i].turn < h[j].turn
+	}
+	return h[i].name < h[j].name
+}
+
+func (h rotationHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *rotationHeap) Push(x any) {
+	member := x.(*rotationMember)
+	member.index = len(*h)
+	*h = append(*h, member)
+}
+
+func (h *rotationHeap) Pop() any {
+	old := *h
+	n := len(old)
+	member := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return member
+}
+
+// rotationLocked returns the weighted rotation at key. The caller must hold s.mu.
+func (s *MemoryStore) rotationLocked(key string, create bool) (*weightedRotation, error) {
+	raw, exists := s.data[key]
+	if !exists {
+		if !create {
+			return nil, nil
+		}
+		rotation := &weightedRotation{members: make(map[string]*rotationMember)}
+		s.data[key] = rotation
+		return rotation, nil
+	}
+	rotation, ok := raw.(*weightedRotation)
+	if !ok {
+		return nil, fmt.Errorf("type mismatch: key '%s' holds a different data type", key)
+	}
+	return rotation, nil
+}
+
+// WeightedAdd adds members with their weights to a weighted rotation.
+func (s *MemoryStore) WeightedAdd(key string, weights map[string]int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rotation, err := s.rotationLocked(key, true)
+	if err != nil {
+		return err
+	}
+	// 新成员从当前最早的轮次开始，不会连续占用多次轮换
+	var start float64
+	if len(rotation.heap) > 0 {
+		start = rotation.heap[0].turn
+	}
+	for name, weight := range weights {
+		if member, exists := rotation.members[name]; exists {
+			member.weight = weight
+			continue
+		}
+		member := &rotationMember{name: name, turn: start, weight: weight}
+		rotation.members[name] = member
+		heap.Push(&rotation.heap, member)
+	}
+	return nil
+}
+
+// WeightedRemove removes members from a weighted rotation.
+func (s *MemoryStore) WeightedRemove(key string, members ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rotation, err := s.rotationLocked(key, false)
+	if err != nil || rotation == nil {
+		return err
+	}
+	for _, name := range members {
+		if member, exists := rotation.members[name]; exists {
+			heap.Remove(&rotation.heap, member.index)
+			delete(rotation.members, name)
+		}
+	}
+	return nil
+}
+
+// WeightedRotate returns the member whose turn is next and schedules its following turn.
+func (s *MemoryStore) WeightedRotate(key string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rotation, err := s.rotationLocked(key, false)
+	if err != nil {
+		return "", err
+	}
+	if rotation == nil || len(rotation.heap) == 0 {
+		return "", ErrNotFound
+	}
+	member := rotation.heap[0]
+	member.turn += 1 / float64(max(member.weight, 1))
+	heap.Fix(&rotation.heap, 0)
+	return member.name, nil
+}
+
+// WeightedClear deletes a weighted rotation.
+func (s *MemoryStore) WeightedClear(key string) error {
+	return s.Delete(key)
+}
+
 // --- SET operations ---
 
 // SAdd adds members to a set.
@@ -359,6 +536,23 @@ func (s *MemoryStore) SPopN(key string, count int64) ([]string, error) {
 	return popped, nil
 }
 
+// SCard returns the number of members of a set.
+func (s *MemoryStore) SCard(key string) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rawSet, exists := s.data[key]
+	if !exists {
+		return 0, nil
+	}
+
+	set, ok := rawSet.(map[string]struct{})
+	if !ok {
+		return 0, fmt.Errorf("type mismatch: key '%s' holds a different data type", key)
+	}
+	return int64(len(set)), nil
+}
+
 // --- Pub/Sub operations ---
 
 // memorySubscription implements the Subscription interface for the in-memory store.
@@ -0,0 +1,124 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreCompareAndSet(t *testing.T) {
+	s := NewMemoryStore()
+	if ok, _ := s.CompareAndSet("lock", []byte("a"), []byte("a"), time.Minute); ok {
+		t.Fatal("a missing key should not be set")
+	}
+
+	if _, err := s.SetNX("lock", []byte("a"), time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := s.CompareAndSet("lock", []byte("b"), []byte("b"), time.Minute); ok {
+		t.Error("a key held by another owner should not be set")
+	}
+	if ok, _ := s.CompareAndSet("lock", []byte("a"), []byte("a"), time.Minute); !ok {
+		t.Error("the owner should be able to extend the key")
+	}
+
+	if ok, _ := s.CompareAndDelete("lock", []byte("b")); ok {
+		t.Error("a key held by another owner should not be deleted")
+	}
+	if ok, _ := s.CompareAndDelete("lock", []byte("a")); !ok {
+		t.Error("the owner should be able to delete the key")
+	}
+	if exists, _ := s.Exists("lock"); exists {
+		t.Error("the key should be deleted")
+	}
+}
+
+func TestMemoryStoreCompareAndSetExpired(t *testing.T) {
+	s := NewMemoryStore()
+	if err := s.Set("lock", []byte("a"), time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if ok, _ := s.CompareAndSet("lock", []byte("a"), []byte("a"), time.Minute); ok {
+		t.Error("an expired key should not be extended")
+	}
+}
+
+func TestMemoryStoreWeightedRotate(t *testing.T) {
+	s := NewMemoryStore()
+	if _, err := s.WeightedRotate("keys"); err != ErrNotFound {
+		t.Fatalf("an empty rotation should return ErrNotFound, got %v", err)
+	}
+
+	if err := s.WeightedAdd("keys", map[string]int{"1": 1, "2": 3}); err != nil {
+		t.Fatal(err)
+	}
+	counts := make(map[string]int)
+	for range 400 {
+		member, err := s.WeightedRotate("keys")
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts[member]++
+	}
+	if counts["1"] != 100 || counts["2"] != 300 {
+		t.Errorf("selections = %v, want them in proportion to the weights", counts)
+	}
+
+	// 新加入的成员不会连续占用多次轮换
+	if err := s.WeightedAdd("keys", map[string]int{"3": 1}); err != nil {
+		t.Fatal(err)
+	}
+	counts = make(map[string]int)
+	for range 5 {
+		member, _ := s.WeightedRotate("keys")
+		counts[member]++
+	}
+	if counts["3"] > 2 {
+		t.Errorf("a new member took %d of 5 turns", counts["3"])
+	}
+
+	if err := s.WeightedRemove("keys", "1", "2", "3"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.WeightedRotate("keys"); err != ErrNotFound {
+		t.Errorf("a rotation without members should return ErrNotFound, got %v", err)
+	}
+}
+
+func TestMemoryStoreWeightedRotateOrder(t *testing.T) {
+	s := NewMemoryStore()
+	if err := s.WeightedAdd("keys", map[string]int{"c": 1, "a": 1, "b": 1, "d": 1}); err != nil {
+		t.Fatal(err)
+	}
+	rotate := func(n int) string {
+		var members string
+		for range n {
+			member, err := s.WeightedRotate("keys")
+			if err != nil {
+				t.Fatal(err)
+			}
+			members += member
+		}
+		return members
+	}
+
+	// 轮次相同时按成员排序，与 Redis 有序集合一致
+	if got := rotate(8); got != "abcdabcd" {
+		t.Errorf("rotation = %q, want abcdabcd", got)
+	}
+
+	if err := s.WeightedRemove("keys", "b", "missing"); err != nil {
+		t.Fatal(err)
+	}
+	if got := rotate(6); got != "acdacd" {
+		t.Errorf("rotation after removing b = %q, want acdacd", got)
+	}
+
+	// 更新权重不重置已有成员的轮次
+	if err := s.WeightedAdd("keys", map[string]int{"d": 2}); err != nil {
+		t.Fatal(err)
+	}
+	if got := rotate(4); got != "acdd" {
+		t.Errorf("rotation after doubling the weight of d = %q, want acdd", got)
+	}
+}
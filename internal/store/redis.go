@@ -64,6 +64,37 @@ func (s *RedisStore) SetNX(key string, value []byte, ttl time.Duration) (bool, e
 	return s.client.SetNX(context.Background(), key, value, ttl).Result()
 }
 
+// compareAndSetScript sets the key only if it holds the expected value, atomically on the Redis server.
+var compareAndSetScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	if tonumber(ARGV[3]) > 0 then
+		return redis.call("SET", KEYS[1], ARGV[2], "PX", ARGV[3]) and 1 or 0
+	end
+	return redis.call("SET", KEYS[1], ARGV[2]) and 1 or 0
+end
+return 0
+`)
+
+// compareAndDeleteScript deletes the key only if it holds the expected value.
+var compareAndDeleteScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// CompareAndSet sets a key-value pair only if the key currently holds the expected value.
+func (s *RedisStore) CompareAndSet(key string, expected, value []byte, ttl time.Duration) (bool, error) {
+	n, err := compareAndSetScript.Run(context.Background(), s.client, []string{key}, expected, value, ttl.Milliseconds()).Int()
+	return n == 1, err
+}
+
+// CompareAndDelete removes a key only if it currently holds the expected value.
+func (s *RedisStore) CompareAndDelete(key string, expected []byte) (bool, error) {
+	n, err := compareAndDeleteScript.Run(context.Background(), s.client, []string{key}, expected).Int()
+	return n == 1, err
+}
+
 // Close closes the Redis client connection.
 func (s *RedisStore) Close() error {
 	return s.client.Close()
@@ -104,6 +135,84 @@ func (s *RedisStore) Rotate(key string) (string, error) {
 	return val, nil
 }
 
+// --- WEIGHTED ROTATION operations ---
+// A weighted rotation is a sorted set of members scored by their next turn, with their weights in a companion hash.
+
+func rotationWeightsKey(key string) string {
+	return key + ":weights"
+}
+
+// weightedAddScript adds new members at the turn of the next member, so they do not take a run of turns.
+var weightedAddScript = redis.NewScript(`
+local next = redis.call("ZRANGE", KEYS[1], 0, 0, "WITHSCORES")
+local start = 0
+if #next > 0 then
+	start = next[2]
+end
+for i = 1, #ARGV, 2 do
+	redis.call("ZADD", KEYS[1], "NX", start, ARGV[i])
+	redis.call("HSET", KEYS[2], ARGV[i], ARGV[i + 1])
+end
+return 1
+`)
+
+// weightedRotateScript returns the member whose turn is next and moves its turn by 1/weight.
+var weightedRotateScript = redis.NewScript(`
+local next = redis.call("ZRANGE", KEYS[1], 0, 0)
+if #next == 0 then
+	return false
+end
+local weight = tonumber(redis.call("HGET", KEYS[2], next[1])) or 1
+if weight < 1 then
+	weight = 1
+end
+redis.call("ZINCRBY", KEYS[1], 1 / weight, next[1])
+return next[1]
+`)
+
+func (s *RedisStore) WeightedAdd(key string, weights map[string]int) error {
+	if len(weights) == 0 {
+		return nil
+	}
+	args := make([]any, 0, len(weights)*2)
+	for member, weight := range weights {
+		args = append(args, member, weight)
+	}
+	return weightedAddScript.Run(context.Background(), s.client, []string{key, rotationWeightsKey(key)}, args...).Err()
+}
+
+func (s *RedisStore) WeightedRemove(key string, members ...string) error {
+	if len(members) == 0 {
+		return nil
+	}
+	ctx := context.Background()
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		zMembers := make([]any, len(members))
+		for i, member := range members {
+			zMembers[i] = member
+		}
+		pipe.ZRem(ctx, key, zMembers...)
+		pipe.HDel(ctx, rotationWeightsKey(key), members...)
+		return nil
+	})
+	return err
+}
+
+func (s *RedisStore) WeightedRotate(key string) (string, error) {
+	val, err := weightedRotateScript.Run(context.Background(), s.client, []string{key, rotationWeightsKey(key)}).Text()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return "", ErrNotFound
+		}
+		return "", err
+	}
+	return val, nil
+}
+
+func (s *RedisStore) WeightedClear(key string) error {
+	return s.client.Del(context.Background(), key, rotationWeightsKey(key)).Err()
+}
+
 // --- SET operations ---
 
 func (s *RedisStore) SAdd(key string, members ...any) error {
@@ -114,6 +223,10 @@ func (s *RedisStore) SPopN(key string, count int64) ([]string, error) {
 	return s.client.SPopN(context.Background(), key, count).Result()
 }
 
+func (s *RedisStore) SCard(key string) (int64, error) {
+	return s.client.SCard(context.Background(), key).Result()
+}
+
 // --- Pipeliner implementation ---
 
 type redisPipeliner struct {
@@ -40,6 +40,12 @@ type Store interface {
 	// SetNX sets a key-value pair if the key does not already exist.
 	SetNX(key string, value []byte, ttl time.Duration) (bool, error)
 
+	// CompareAndSet sets a key-value pair with a TTL only if the key currently holds the expected value.
+	CompareAndSet(key string, expected, value []byte, ttl time.Duration) (bool, error)
+
+	// CompareAndDelete removes a key only if it currently holds the expected value.
+	CompareAndDelete(key string, expected []byte) (bool, error)
+
 	// HASH operations
 	HSet(key string, values map[string]any) error
 	HGetAll(key string) (map[string]string, error)
@@ -50,9 +56,22 @@ type Store interface {
 	LRem(key string, count int64, value any) error
 	Rotate(key string) (string, error)
 
+	// WEIGHTED ROTATION operations
+	// WeightedAdd adds members with their weights to a weighted rotation. New members take the next turn,
+	// members already in the rotation keep their turn and take the new weight.
+	WeightedAdd(key string, weights map[string]int) error
+	// WeightedRemove removes members from a weighted rotation.
+	WeightedRemove(key string, members ...string) error
+	// WeightedRotate returns the member whose turn is next and schedules its following turn
+	// after 1/weight, so members are returned in proportion to their weights.
+	WeightedRotate(key string) (string, error)
+	// WeightedClear deletes a weighted rotation.
+	WeightedClear(key string) error
+
 	// SET operations
 	SAdd(key string, members ...any) error
 	SPopN(key string, count int64) ([]string, error)
+	SCard(key string) (int64, error)
 
 	// Close closes the store and releases any underlying resources.
 	Close() error
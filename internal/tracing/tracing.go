@@ -0,0 +1,107 @@
+// Package tracing sets up OpenTelemetry tracing of the proxy pipeline.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"gpt-load/internal/types"
+	"gpt-load/internal/version"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "gpt-load"
+
+// Provider owns the tracer provider and flushes pending spans on shutdown.
+type Provider struct {
+	tracerProvider *sdktrace.TracerProvider
+}
+
+// NewProvider installs the global tracer provider and W3C trace context propagator.
+// Without an OTLP endpoint no spans are recorded, but incoming traceparent headers are
+// still propagated to upstreams.
+func NewProvider(configManager types.ConfigManager) (*Provider, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		logrus.WithError(err).Warn("OpenTelemetry error")
+	}))
+
+	config := configManager.GetTracingConfig()
+	if config.Endpoint == "" {
+		return &Provider{}, nil
+	}
+
+	tracerProvider, err := newTracerProvider(config)
+	if err != nil {
+		return nil, err
+	}
+	otel.SetTracerProvider(tracerProvider)
+
+	return &Provider{tracerProvider: tracerProvider}, nil
+}
+
+// newTracerProvider creates a tracer provider that batches spans to the OTLP endpoint.
+func newTracerProvider(config types.TracingConfig) (*sdktrace.TracerProvider, error) {
+	exporter, err := otlptracehttp.New(context.Background(),
+		otlptracehttp.WithEndpointURL(traceEndpointURL(config.Endpoint)),
+		otlptracehttp.WithHeaders(config.Headers),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP trace exporter: %w", err)
+	}
+
+	res, err := resource.New(context.Background(),
+		resource.WithTelemetrySDK(),
+		resource.WithHost(),
+		resource.WithSchemaURL(semconv.SchemaURL),
+		resource.WithAttributes(
+			semconv.ServiceName(config.ServiceName),
+			semconv.ServiceVersion(version.Version),
+		),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace resource: %w", err)
+	}
+
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.SampleRatio))),
+	), nil
+}
+
+// traceEndpointURL returns the URL spans are sent to. Like OTEL_EXPORTER_OTLP_ENDPOINT, an endpoint
+// without a path gets the default /v1/traces path, while an endpoint with a path is used as is.
+func traceEndpointURL(endpoint string) string {
+	parsed, err := url.Parse(endpoint)
+	if err != nil || strings.Trim(parsed.Path, "/") != "" {
+		return endpoint
+	}
+	parsed.Path = "/v1/traces"
+	return parsed.String()
+}
+
+// Stop flushes pending spans and shuts down the exporter.
+func (p *Provider) Stop(ctx context.Context) {
+	if p.tracerProvider == nil {
+		return
+	}
+	if err := p.tracerProvider.Shutdown(ctx); err != nil {
+		logrus.WithError(err).Warn("Failed to flush traces on shutdown")
+	}
+}
+
+// Tracer returns the tracer for gpt-load spans.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
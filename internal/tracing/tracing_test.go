@@ -0,0 +1,82 @@
+package tracing
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gpt-load/internal/types"
+)
+
+func TestTraceEndpointURL(t *testing.T) {
+	tests := []struct {
+		endpoint string
+		want     string
+	}{
+		{"http://otel-collector:4318", "http://otel-collector:4318/v1/traces"},
+		{"http://otel-collector:4318/", "http://otel-collector:4318/v1/traces"},
+		{"https://otlp.example.com/v1/traces", "https://otlp.example.com/v1/traces"},
+		{"https://otlp.example.com/otlp/v1/traces", "https://otlp.example.com/otlp/v1/traces"},
+	}
+	for _, tt := range tests {
+		if got := traceEndpointURL(tt.endpoint); got != tt.want {
+			t.Errorf("traceEndpointURL(%q) = %q, want %q", tt.endpoint, got, tt.want)
+		}
+	}
+}
+
+func TestTracerProviderExportsToReceiver(t *testing.T) {
+	type export struct {
+		path   string
+		header string
+		size   int
+	}
+	exports := make(chan export, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		exports <- export{path: r.URL.Path, header: r.Header.Get("X-Tenant"), size: len(body)}
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer receiver.Close()
+
+	for _, tt := range []struct {
+		endpoint string
+		wantPath string
+	}{
+		{receiver.URL, "/v1/traces"},
+		{receiver.URL + "/custom/traces", "/custom/traces"},
+	} {
+		tracerProvider, err := newTracerProvider(types.TracingConfig{
+			Endpoint:    tt.endpoint,
+			Headers:     map[string]string{"X-Tenant": "gpt-load"},
+			ServiceName: "gpt-load-test",
+			SampleRatio: 1,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, span := tracerProvider.Tracer(instrumentationName).Start(context.Background(), "test")
+		span.End()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		if err := tracerProvider.Shutdown(ctx); err != nil {
+			cancel()
+			t.Fatalf("%s: shutdown: %v", tt.endpoint, err)
+		}
+		cancel()
+
+		select {
+		case got := <-exports:
+			if got.path != tt.wantPath || got.header != "gpt-load" || got.size == 0 {
+				t.Errorf("%s: export = %+v, want path %s with the configured header", tt.endpoint, got, tt.wantPath)
+			}
+		default:
+			t.Fatalf("%s: the receiver got no spans", tt.endpoint)
+		}
+	}
+}
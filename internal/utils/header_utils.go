@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"encoding/json"
 	"gpt-load/internal/models"
 	"net/http"
 	"strconv"
@@ -8,13 +9,15 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
 )
 
 // HeaderVariableContext holds context data for variable resolution
 type HeaderVariableContext struct {
-	ClientIP string
-	Group    *models.Group
-	APIKey   *models.APIKey
+	ClientIP  string
+	RequestID string
+	Group     *models.Group
+	APIKey    *models.APIKey
 }
 
 // ResolveHeaderVariables resolves dynamic variables in header values
@@ -29,6 +32,7 @@ func ResolveHeaderVariables(value string, ctx *HeaderVariableContext) string {
 	// Replace all supported variables
 	variables := map[string]string{
 		"${CLIENT_IP}":    ctx.ClientIP,
+		"${REQUEST_ID}":   ctx.RequestID,
 		"${TIMESTAMP_MS}": strconv.FormatInt(now.UnixMilli(), 10),
 		"${TIMESTAMP_S}":  strconv.FormatInt(now.Unix(), 10),
 	}
@@ -68,6 +72,20 @@ func ApplyHeaderRules(req *http.Request, rules []models.HeaderRule, ctx *HeaderV
 	}
 }
 
+// ApplyKeyHeaderRules applies the key's own header rules to the HTTP request
+func ApplyKeyHeaderRules(req *http.Request, apiKey *models.APIKey, ctx *HeaderVariableContext) {
+	if apiKey == nil || len(apiKey.HeaderRules) == 0 {
+		return
+	}
+
+	var rules []models.HeaderRule
+	if err := json.Unmarshal(apiKey.HeaderRules, &rules); err != nil {
+		logrus.WithError(err).Warnf("Failed to parse header rules for key %d", apiKey.ID)
+		return
+	}
+	ApplyHeaderRules(req, rules, ctx)
+}
+
 // NewHeaderVariableContextFromGin creates HeaderVariableContext from Gin context
 func NewHeaderVariableContextFromGin(c *gin.Context, group *models.Group, apiKey *models.APIKey) *HeaderVariableContext {
 	if c == nil {
@@ -75,9 +93,10 @@ func NewHeaderVariableContextFromGin(c *gin.Context, group *models.Group, apiKey
 	}
 
 	return &HeaderVariableContext{
-		ClientIP: c.ClientIP(),
-		Group:    group,
-		APIKey:   apiKey,
+		ClientIP:  c.ClientIP(),
+		RequestID: GetRequestID(c),
+		Group:     group,
+		APIKey:    apiKey,
 	}
 }
 
@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// RequestIDHeader carries the correlation ID of a client request.
+const RequestIDHeader = "X-Request-ID"
+
+const (
+	requestIDContextKey       = "requestID"
+	clientRequestIDContextKey = "clientRequestID"
+)
+
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:\-]{1,64}$`)
+
+// NewRequestID returns a new server-side request ID. Client-provided IDs are not unique,
+// so they are never used as the request ID.
+func NewRequestID() string {
+	return uuid.NewString()
+}
+
+// ClientRequestID returns the client-provided ID if it is safe to store, otherwise an empty string.
+func ClientRequestID(provided string) string {
+	if requestIDPattern.MatchString(provided) {
+		return provided
+	}
+	return ""
+}
+
+// SetRequestID stores the server-side and client-provided IDs of the request in the Gin context.
+func SetRequestID(c *gin.Context, requestID, clientRequestID string) {
+	c.Set(requestIDContextKey, requestID)
+	c.Set(clientRequestIDContextKey, clientRequestID)
+}
+
+// GetRequestID returns the correlation ID of the request, or an empty string if none was assigned.
+func GetRequestID(c *gin.Context) string {
+	return c.GetString(requestIDContextKey)
+}
+
+// GetClientRequestID returns the ID the client sent in the X-Request-ID header, or an empty string.
+func GetClientRequestID(c *gin.Context) string {
+	return c.GetString(clientRequestIDContextKey)
+}
@@ -54,3 +54,12 @@ func StringToSet(s string, sep string) map[string]struct{} {
 	}
 	return set
 }
+
+// likeEscaper escapes the wildcards of a LIKE pattern.
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// EscapeLike escapes s so it is matched literally inside a LIKE pattern, used with `LIKE ? ESCAPE '!'`.
+// A backslash is not portable as the escape character, MySQL also treats it as an escape in string literals.
+func EscapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
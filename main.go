@@ -10,6 +10,7 @@ import (
 	"time"
 
 	"gpt-load/internal/app"
+	"gpt-load/internal/commands"
 	"gpt-load/internal/container"
 	"gpt-load/internal/types"
 	"gpt-load/internal/utils"
@@ -45,6 +46,14 @@ func main() {
 		logrus.Fatalf("Failed to setup logger: %v", err)
 	}
 
+	// Run a subcommand instead of the server if one is given
+	if len(os.Args) > 1 {
+		if err := commands.Run(container, os.Args[1], os.Args[2:]); err != nil {
+			logrus.Fatalf("Command %s failed: %v", os.Args[1], err)
+		}
+		return
+	}
+
 	// Create and run the application
 	if err := container.Invoke(func(application *app.App, configManager types.ConfigManager) {
 		if err := application.Start(); err != nil {
@@ -1,3 +1,4 @@
+import { ensureFreshSession } from "@/services/auth";
 import type {
   APIKey,
   Group,
@@ -188,7 +189,8 @@ export const keysApi = {
   },
 
   // 导出密钥
-  exportKeys(groupId: number, status: "all" | "active" | "invalid" = "all") {
+  async exportKeys(groupId: number, status: "all" | "active" | "invalid" = "all") {
+    await ensureFreshSession();
     const authKey = localStorage.getItem("authKey");
     if (!authKey) {
       window.$message.error("未找到认证信息，无法导出");
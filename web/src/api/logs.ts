@@ -1,4 +1,11 @@
-import type { ApiResponse, Group, LogFilter, LogsResponse } from "@/types/models";
+import { ensureFreshSession } from "@/services/auth";
+import type {
+  ApiResponse,
+  Group,
+  LogFilter,
+  LogsResponse,
+  RequestTimeline,
+} from "@/types/models";
 import http from "@/utils/http";
 
 export const logApi = {
@@ -7,13 +14,19 @@ export const logApi = {
     return http.get("/logs", { params });
   },
 
+  // 获取同一请求的全部尝试
+  getRequestTimeline: (requestId: string): Promise<ApiResponse<RequestTimeline>> => {
+    return http.get(`/logs/requests/${encodeURIComponent(requestId)}`);
+  },
+
   // 获取分组列表（用于筛选）
   getGroups: (): Promise<ApiResponse<Group[]>> => {
     return http.get("/groups");
   },
 
   // 导出日志
-  exportLogs: (params: Omit<LogFilter, "page" | "page_size">) => {
+  exportLogs: async (params: Omit<LogFilter, "page" | "page_size">) => {
+    await ensureFreshSession();
     const authKey = localStorage.getItem("authKey");
     if (!authKey) {
       window.$message.error("未找到认证信息，无法导出");
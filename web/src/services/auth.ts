@@ -1,20 +1,96 @@
 import http from "@/utils/http";
 import { useState } from "@/utils/state";
+import axios from "axios";
 
 const AUTH_KEY = "authKey";
+const REFRESH_TOKEN = "refreshToken";
+const EXPIRES_AT = "sessionExpiresAt";
+
+// 会话令牌在过期前多久主动刷新
+const REFRESH_MARGIN_MS = 60 * 1000;
+
+interface Session {
+  token: string;
+  refresh_token: string;
+  expires_at: string;
+}
 
 export const useAuthKey = () => {
   return useState<string | null>(AUTH_KEY, () => null);
 };
 
+const saveSession = (session: Session) => {
+  localStorage.setItem(AUTH_KEY, session.token);
+  localStorage.setItem(REFRESH_TOKEN, session.refresh_token);
+  localStorage.setItem(EXPIRES_AT, session.expires_at);
+  useAuthKey().value = session.token;
+};
+
+// 仅清除本地会话，不通知服务端
+export const clearSession = (): void => {
+  localStorage.removeItem(AUTH_KEY);
+  localStorage.removeItem(REFRESH_TOKEN);
+  localStorage.removeItem(EXPIRES_AT);
+  useAuthKey().value = null;
+};
+
+let refreshing: Promise<boolean> | null = null;
+
+// 使用刷新令牌换取新的会话令牌，并发调用共享同一次刷新
+export const refreshSession = (): Promise<boolean> => {
+  const refreshToken = localStorage.getItem(REFRESH_TOKEN);
+  if (!refreshToken) {
+    return Promise.resolve(false);
+  }
+  if (!refreshing) {
+    refreshing = axios
+      .post("/api/auth/refresh", { refresh_token: refreshToken })
+      .then(res => {
+        saveSession(res.data.data);
+        return true;
+      })
+      .catch(() => false)
+      .finally(() => {
+        refreshing = null;
+      });
+  }
+  return refreshing;
+};
+
+// 会话令牌即将过期时先刷新，用于通过链接直接下载等不经过拦截器的请求
+export const ensureFreshSession = async (): Promise<void> => {
+  const expiresAt = localStorage.getItem(EXPIRES_AT);
+  if (expiresAt && new Date(expiresAt).getTime() - Date.now() < REFRESH_MARGIN_MS) {
+    await refreshSession();
+  }
+};
+
+// 单点登录回调将会话放在 URL 片段中，返回错误信息或 null
+export const completeSSOLogin = (hash: string): string | null => {
+  const params = new URLSearchParams(hash.replace(/^#/, ""));
+  const error = params.get("error");
+  if (error) {
+    return error;
+  }
+  const token = params.get("token");
+  const refreshToken = params.get("refresh_token");
+  const expiresAt = params.get("expires_at");
+  if (!token || !refreshToken || !expiresAt) {
+    return "单点登录失败";
+  }
+  saveSession({ token, refresh_token: refreshToken, expires_at: expiresAt });
+  return null;
+};
+
 export function useAuthService() {
   const authKey = useAuthKey();
 
-  const login = async (key: string): Promise<boolean> => {
+  // 未填写用户名时使用授权密钥登录，否则使用管理员账号登录
+  const login = async (secret: string, username = ""): Promise<boolean> => {
     try {
-      await http.post("/auth/login", { auth_key: key });
-      localStorage.setItem(AUTH_KEY, key);
-      authKey.value = key;
+      const body = username ? { username, password: secret } : { auth_key: secret };
+      const res = (await http.post("/auth/login", body)) as unknown as { session: Session };
+      saveSession(res.session);
       return true;
     } catch (_error) {
       // 错误已记录
@@ -22,9 +98,15 @@ export function useAuthService() {
     }
   };
 
-  const logout = (): void => {
-    localStorage.removeItem(AUTH_KEY);
-    authKey.value = null;
+  const logout = async (): Promise<void> => {
+    if (authKey.value) {
+      try {
+        await http.post("/auth/logout", {}, { hideMessage: true });
+      } catch (_error) {
+        // 会话可能已失效，忽略
+      }
+    }
+    clearSession();
   };
 
   const checkLogin = (): boolean => {
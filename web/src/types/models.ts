@@ -17,10 +17,34 @@ export interface APIKey {
   request_count: number;
   failure_count: number;
   last_used_at?: string;
+  last_validated_at?: string;
+  last_error?: string;
+  last_error_at?: string;
+  labels: string;
+  note: string;
+  owner: string;
+  expires_at?: string;
+  weight: number;
+  header_rules?: HeaderRule[];
+  upstream_url: string;
+  proxy_url: string;
   created_at: string;
   updated_at: string;
 }
 
+export interface KeyEvent {
+  id: number;
+  key_id: number;
+  group_id: number;
+  event_type: "blacklisted" | "recovered" | "restored" | "expired" | "cooled_down";
+  from_status: KeyStatus;
+  to_status: KeyStatus;
+  source: "traffic" | "cron" | "manual" | "system";
+  status_code: number;
+  error_message: string;
+  created_at: string;
+}
+
 // 类型别名，用于兼容
 export type Key = APIKey;
 
@@ -35,6 +59,29 @@ export interface HeaderRule {
   action: "set" | "remove";
 }
 
+export interface ValidationResponseRule {
+  statuses?: number[];
+  body_contains?: string;
+  result: "valid" | "invalid" | "rate_limited";
+}
+
+export interface ValidationConfig {
+  method: "completion" | "list_models" | "count_tokens" | "custom";
+  http_method?: string;
+  body?: string;
+  response_rules?: ValidationResponseRule[];
+}
+
+export interface ProbeConfig {
+  enabled: boolean;
+  interval_seconds: number;
+  timeout_seconds: number;
+  method: "GET" | "POST";
+  path: string;
+  body?: string;
+  expected_statuses?: number[];
+}
+
 export interface Group {
   id?: number;
   name: string;
@@ -45,6 +92,8 @@ export interface Group {
   channel_type: "openai" | "gemini" | "anthropic";
   upstreams: UpstreamInfo[];
   validation_endpoint: string;
+  validation_config?: ValidationConfig;
+  probe_config?: ProbeConfig;
   config: Record<string, unknown>;
   api_keys?: APIKey[];
   endpoint?: string;
@@ -117,6 +166,9 @@ export interface TaskInfo {
 // Based on backend response
 export interface RequestLog {
   id: string;
+  request_id: string;
+  client_request_id: string;
+  attempt: number;
   timestamp: string;
   group_id: number;
   key_id: number;
@@ -136,6 +188,19 @@ export interface RequestLog {
   request_body?: string;
 }
 
+export interface RequestTimeline {
+  request_id: string;
+  client_request_id?: string;
+  group_name: string;
+  model: string;
+  is_success: boolean;
+  status_code: number;
+  attempts: number;
+  started_at: string;
+  duration_ms: number;
+  logs: RequestLog[];
+}
+
 export interface Pagination {
   page: number;
   page_size: number;
@@ -151,6 +216,7 @@ export interface LogsResponse {
 export interface LogFilter {
   page?: number;
   page_size?: number;
+  request_id?: string;
   group_name?: string;
   key_value?: string;
   model?: string;
@@ -204,3 +270,31 @@ export interface ChartData {
   labels: string[];
   datasets: ChartDataset[];
 }
+
+// 管理员角色
+export type AdminRole = "admin" | "operator" | "maintainer" | "viewer";
+
+// 管理员账号
+export interface AdminUser {
+  id: number;
+  username: string;
+  role: AdminRole;
+  enabled: boolean;
+  group_ids: number[];
+  oidc_subject?: string;
+  last_login_at?: string;
+  created_at: string;
+  updated_at: string;
+}
+
+// 管理员 API 令牌，token 仅在创建时返回
+export interface AdminToken {
+  id: number;
+  user_id: number;
+  name: string;
+  token_prefix: string;
+  expires_at?: string;
+  last_used_at?: string;
+  created_at: string;
+  token?: string;
+}
@@ -1,4 +1,4 @@
-import { useAuthService } from "@/services/auth";
+import { clearSession, refreshSession } from "@/services/auth";
 import axios from "axios";
 import { appState } from "./app-state";
 
@@ -8,6 +8,7 @@ const noLoadingUrls = ["/tasks/status"];
 declare module "axios" {
   interface AxiosRequestConfig {
     hideMessage?: boolean;
+    retried?: boolean;
   }
 }
 
@@ -39,13 +40,18 @@ http.interceptors.response.use(
     }
     return response.data;
   },
-  error => {
+  async error => {
     appState.loading = false;
     if (error.response) {
       if (error.response.status === 401) {
+        // 会话令牌过期时尝试刷新一次并重试原请求
+        const config = error.config;
+        if (config && !config.retried && config.url !== "/auth/login" && (await refreshSession())) {
+          config.retried = true;
+          return http(config);
+        }
         if (window.location.pathname !== "/login") {
-          const { logout } = useAuthService();
-          logout();
+          clearSession();
           window.location.href = "/login";
         }
       }